@@ -19,18 +19,30 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/clearlinux/clr-installer/conf"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/trust"
 	flag "github.com/spf13/pflag"
 )
 
 const (
 	kernelCmdlineConf = "clri.descriptor"
+	kernelCmdlineKey  = "clri.descriptor.key"
+	kernelCmdlineCert = "clri.swupd-cert"
 	kernelCmdlineDemo = "clri.demo"
 	kernelCmdlineLog  = "clri.loglevel"
+	kernelCmdlineDisc = "clri.discover"
 	logFileEnvironVar = "CLR_INSTALLER_LOG_FILE"
+
+	// OutputText is the default, human readable, mass installer output format
+	OutputText = "text"
+
+	// OutputJSON is the machine readable mass installer output format, one json
+	// object per line
+	OutputJSON = "json"
 )
 
 var (
@@ -44,6 +56,8 @@ type Args struct {
 	RebootSet               bool
 	LogFile                 string
 	ConfigFile              string
+	ConfigOverlays          []string
+	PrintConfig             bool
 	CfDownloaded            bool
 	CryptPassFile           string
 	SwupdMirror             string
@@ -62,24 +76,35 @@ type Args struct {
 	PamSalt                 string
 	LogLevel                int
 	ForceTUI                bool
+	DiscoverConfig          bool
 	Archive                 bool
 	ArchiveSet              bool
 	DemoMode                bool
 	BlockDevices            []string
 	StubImage               bool
 	ConvertConfigFile       string
+	ValidateConfigFile      string
+	MigrateConfigFile       string
+	DiskSize                string
 	MakeISO                 bool
 	MakeISOSet              bool
 	KeepImage               bool
 	KeepImageSet            bool
 	SystemCheck             bool
 	CopyNetwork             bool
+	PrintMetrics            bool
+	OutputFormat            string
+	OutputFD                int
+	OutputLogLevel          int
+	ControlSocket           string
+	WebAddr                 string
 }
 
 func (args *Args) setKernelArgs() (err error) {
 	var (
 		kernelCmd string
-		url       string
+		desc      string
+		keys      []string
 	)
 
 	if kernelCmd, err = args.readKernelCmd(); err != nil {
@@ -90,7 +115,13 @@ func (args *Args) setKernelArgs() (err error) {
 	for _, curr := range strings.Split(kernelCmd, " ") {
 		curr = strings.TrimSpace(curr)
 		if strings.HasPrefix(curr, kernelCmdlineConf+"=") {
-			url = strings.Split(curr, "=")[1]
+			desc = strings.SplitN(curr, "=", 2)[1]
+		} else if strings.HasPrefix(curr, kernelCmdlineKey+"=") {
+			keys = append(keys, strings.SplitN(curr, "=", 2)[1])
+		} else if strings.HasPrefix(curr, kernelCmdlineCert+"=") {
+			args.SwupdCertPath = strings.SplitN(curr, "=", 2)[1]
+		} else if curr == kernelCmdlineDisc {
+			args.DiscoverConfig = true
 		} else if strings.HasPrefix(curr, kernelCmdlineDemo) {
 			args.DemoMode = true
 		} else if strings.HasPrefix(curr, kernelCmdlineLog) {
@@ -103,10 +134,21 @@ func (args *Args) setKernelArgs() (err error) {
 		}
 	}
 
-	if url != "" {
-		var ffile string
+	if desc != "" {
+		var (
+			ffile      string
+			descriptor *trust.Descriptor
+		)
+
+		if args.SwupdCertPath != "" {
+			network.SetCACertsPath(args.SwupdCertPath)
+		}
+
+		if descriptor, err = trust.ParseDescriptor(desc); err != nil {
+			return err
+		}
 
-		if ffile, err = network.FetchRemoteConfigFile(url); err != nil {
+		if ffile, err = trust.FetchConfigFile(descriptor, keys); err != nil {
 			return err
 		}
 
@@ -140,13 +182,25 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.ForceTUI, "tui", false, "Use TUI frontend",
 	)
 
+	flag.BoolVar(
+		&args.DiscoverConfig, "discover-config", args.DiscoverConfig,
+		"Look for an unattended configuration on CLR-INSTALL labelled media and DHCP leases, as the clri.discover kernel parameter",
+	)
+
 	flag.StringSliceVarP(
 		&args.BlockDevices, "block-device", "b", args.BlockDevices,
 		"Adds a new block-device's entry to configuration file. Format: <alias:filename>",
 	)
 
-	flag.StringVarP(
-		&args.ConfigFile, "config", "c", args.ConfigFile, "Installation configuration file",
+	configFiles := []string{}
+	flag.StringArrayVarP(
+		&configFiles, "config", "c", configFiles,
+		"Installation configuration file, when repeated the next files are overlays merged on top of the first one",
+	)
+
+	flag.BoolVar(
+		&args.PrintConfig, "print-config", false,
+		"Prints the effective configuration merged from the --config files and exits",
 	)
 
 	flag.StringVar(
@@ -162,7 +216,7 @@ func (args *Args) setCommandLineArgs() (err error) {
 	)
 
 	flag.StringVar(
-		&args.SwupdCertPath, "swupd-cert", args.SwupdCertPath, "Swupd --certpath",
+		&args.SwupdCertPath, "swupd-cert", args.SwupdCertPath, "Swupd --certpath, also trusted by the installer downloads",
 	)
 
 	flag.BoolVar(
@@ -201,6 +255,27 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.ConvertConfigFile, "json-yaml", "j", args.ConvertConfigFile, "Converts ister JSON config to clr-installer YAML config",
 	)
 
+	flag.StringVar(
+		&args.ConvertConfigFile, "convert-config", args.ConvertConfigFile,
+		"Converts an ister JSON, kickstart or cloud-init config to clr-installer YAML config, "+
+			"reporting the unsupported directives",
+	)
+
+	flag.StringVar(
+		&args.MigrateConfigFile, "migrate-config", args.MigrateConfigFile,
+		"Rewrites a YAML config of an older schema version to the current version and exits",
+	)
+
+	flag.StringVar(
+		&args.ValidateConfigFile, "validate-config", args.ValidateConfigFile,
+		"Validates a YAML or ister JSON config, reports all its problems and exits",
+	)
+
+	flag.StringVar(
+		&args.DiskSize, "disk-size", args.DiskSize,
+		"Disk size the --validate-config partitions must fit in, i.e: 20G",
+	)
+
 	flag.StringVar(
 		&args.TelemetryURL, "telemetry-url", args.TelemetryURL, "Telemetry server URL",
 	)
@@ -271,10 +346,44 @@ func (args *Args) setCommandLineArgs() (err error) {
 		&args.CopyNetwork, "copy-network", true, "Copy the network interface configuration files to target",
 	)
 
+	flag.BoolVar(
+		&args.PrintMetrics, "print-metrics", false, "Print the install phases and commands timing summary",
+	)
+
+	flag.StringVar(
+		&args.OutputFormat, "output", OutputText,
+		fmt.Sprintf("Mass installer output format: %s or %s", OutputText, OutputJSON),
+	)
+
+	flag.IntVar(
+		&args.OutputFD, "output-fd", 1, "File descriptor the mass installer output is written to",
+	)
+
+	flag.IntVar(
+		&args.OutputLogLevel, "output-log-level", log.LogLevelWarning,
+		"Least severe log level included in the json output, same values as --log-level",
+	)
+
+	flag.StringVar(
+		&args.ControlSocket, "control-socket", args.ControlSocket,
+		"Serve the install control API on the given unix socket path",
+	)
+
+	flag.StringVar(
+		&args.WebAddr, "web", args.WebAddr,
+		"Serve the web installer on the given address, i.e: :8080",
+	)
+
 	flag.ErrHelp = errors.New("Clear Linux Installer program")
 
 	saveConfigFile := args.ConfigFile
 	flag.Parse()
+
+	if len(configFiles) > 0 {
+		args.ConfigFile = configFiles[0]
+		args.ConfigOverlays = configFiles[1:]
+	}
+
 	// If we have a downloaded file, but it is overridden by command line, remove the tempfile
 	if args.CfDownloaded && args.ConfigFile != saveConfigFile {
 		_ = os.Remove(saveConfigFile)
@@ -319,6 +428,28 @@ func (args *Args) setCommandLineArgs() (err error) {
 		return errors.New("Telemetry requires both --telemetry-url and --telemetry-tid")
 	}
 
+	if args.OutputFormat != OutputText && args.OutputFormat != OutputJSON {
+		return fmt.Errorf("Invalid --output format: %s", args.OutputFormat)
+	}
+
+	if args.OutputFormat == OutputJSON {
+		if err := checkOutputFD(args.OutputFD); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkOutputFD checks the --output-fd file descriptor is open, an invalid one would only
+// fail on the first event written and the events would be lost
+func checkOutputFD(fd int) error {
+	var st syscall.Stat_t
+
+	if err := syscall.Fstat(fd, &st); err != nil {
+		return fmt.Errorf("Invalid --output-fd %d: %v", fd, err)
+	}
+
 	return nil
 }
 
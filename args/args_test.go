@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/clearlinux/clr-installer/log"
@@ -90,6 +91,27 @@ func TestParseArgsKernelCmdInvalidFile(t *testing.T) {
 	}
 }
 
+func TestCheckOutputFD(t *testing.T) {
+	if err := checkOutputFD(int(os.Stdout.Fd())); err != nil {
+		t.Fatalf("The standard output should be a valid output fd: %v", err)
+	}
+
+	f, err := ioutil.TempFile("", "output-fd-")
+	if err != nil {
+		t.Fatalf("Failed to create the output file: %v", err)
+	}
+	defer func() { _ = os.Remove(f.Name()) }()
+
+	fd := int(f.Fd())
+	_ = f.Close()
+
+	for _, curr := range []int{fd, -1} {
+		if err = checkOutputFD(curr); err == nil || !strings.Contains(err.Error(), "--output-fd") {
+			t.Fatalf("The fd %d should be refused, got: %v", curr, err)
+		}
+	}
+}
+
 func TestTelemetry(t *testing.T) {
 	var testArgs Args
 	var err error
@@ -172,6 +194,36 @@ func TestKernelCmdDemoFalse(t *testing.T) {
 	}
 }
 
+func TestKernelCmdDiscover(t *testing.T) {
+	var err error
+
+	for _, curr := range []struct {
+		kernelCmd string
+		discover  bool
+	}{
+		{"quiet rw", false},
+		{"quiet rw clri.discovery", false},
+		{"quiet rw " + kernelCmdlineDisc, true},
+	} {
+		var testArgs Args
+
+		kernelCmdlineFile, err = makeTestKernelCmd(curr.kernelCmd)
+		if err != nil {
+			t.Fatalf("Failed to makeTestKernelCmd with error %q", err)
+		}
+
+		err = testArgs.setKernelArgs()
+		_ = os.Remove(kernelCmdlineFile)
+		if err != nil {
+			t.Fatalf("Failed to setKernelArgs with error %q", err)
+		}
+
+		if testArgs.DiscoverConfig != curr.discover {
+			t.Fatalf("Expected the discovery %v with kernel command %q", curr.discover, curr.kernelCmd)
+		}
+	}
+}
+
 func TestKernelCmdConfPresent(t *testing.T) {
 
 	var testArgs Args
@@ -0,0 +1,252 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package bootloader
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+var (
+	// partUUID returns the partition uuid of a device file, it's replaced in tests
+	partUUID = func(devFile string) (string, error) {
+		w := bytes.NewBuffer(nil)
+
+		if err := cmd.Run(w, "blkid", "-s", "PARTUUID", "-o", "value", devFile); err != nil {
+			return "", errors.Wrap(err)
+		}
+
+		return strings.TrimSpace(w.String()), nil
+	}
+)
+
+// clrBootManager installs the boot loader with the target's clr-boot-manager
+type clrBootManager struct{}
+
+func (bm *clrBootManager) run(rootDir string, args ...string) error {
+	args = append([]string{filepath.Join(rootDir, "usr", "bin", "clr-boot-manager")}, args...)
+	args = append(args, fmt.Sprintf("--path=%s", rootDir))
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// Install writes the configured arguments to a cmdline.d snippet, shared by every
+// kernel, and lets clr-boot-manager write the boot entries
+func (bm *clrBootManager) Install(cfg *Config, opts *Options) error {
+	extra := []string{}
+	for _, curr := range opts.Kernels {
+		for _, arg := range cfg.extraArgs(curr) {
+			if !utils.StringSliceContains(extra, arg) {
+				extra = append(extra, arg)
+			}
+		}
+	}
+
+	if len(extra) > 0 {
+		dir := filepath.Join(opts.RootDir, "etc", "kernel", "cmdline.d")
+		if err := utils.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		content := []byte(strings.Join(extra, " ") + "\n")
+		if err := ioutil.WriteFile(filepath.Join(dir, "clr-installer.conf"), content, 0644); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	if cfg != nil && cfg.Timeout != nil {
+		if err := bm.run(opts.RootDir, "set-timeout", fmt.Sprintf("%d", *cfg.Timeout)); err != nil {
+			return err
+		}
+	}
+
+	if err := bm.run(opts.RootDir, "update"); err != nil {
+		return err
+	}
+
+	if cfg == nil || cfg.Default == "" {
+		return nil
+	}
+
+	name, _, err := installedKernel(opts.RootDir, cfg.Default)
+	if err != nil {
+		return err
+	}
+
+	return bm.run(opts.RootDir, "set-kernel", name)
+}
+
+// systemdBoot installs systemd-boot and writes its entries directly, the kernel and
+// initrd are copied to the ESP the same way clr-boot-manager lays them out
+type systemdBoot struct{}
+
+func copyFile(src string, dest string) error {
+	if err := utils.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	return utils.CopyFile(src, dest)
+}
+
+func (sb *systemdBoot) installLoader(rootDir string) error {
+	src := filepath.Join(rootDir, "usr", "lib", "systemd", "boot", "efi", "systemd-bootx64.efi")
+
+	if _, err := os.Stat(src); err != nil {
+		return errors.Errorf("systemd-boot is not installed in the target: %v", err)
+	}
+
+	for _, dest := range []string{
+		filepath.Join(rootDir, "boot", "EFI", "systemd", "systemd-bootx64.efi"),
+		filepath.Join(rootDir, "boot", "EFI", "Boot", "BOOTX64.EFI"),
+	} {
+		if err := copyFile(src, dest); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// entryOptions returns the kernel command line of the bundle's boot entry
+func (sb *systemdBoot) entryOptions(cfg *Config, opts *Options, bundle string, version string) ([]string, error) {
+	uuid, err := partUUID(opts.RootDevice)
+	if err != nil {
+		return nil, err
+	}
+
+	base := []string{}
+	cmdline := filepath.Join(opts.RootDir, "usr", "lib", "kernel",
+		fmt.Sprintf("cmdline-%s.%s", version, kernelFlavor(bundle)))
+
+	content, err := ioutil.ReadFile(cmdline)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err)
+	}
+
+	base = append(base, strings.Fields(string(content))...)
+
+	add := []string{}
+	remove := []string{}
+
+	if opts.Args != nil {
+		add = append(add, opts.Args.Add...)
+		remove = opts.Args.Remove
+	}
+
+	add = append(add, cfg.extraArgs(bundle)...)
+
+	return append([]string{"root=PARTUUID=" + uuid}, ComposeCmdline(base, add, remove)...), nil
+}
+
+// writeEntry copies the bundle's kernel to the ESP and writes its boot entry, the
+// entry name is returned
+func (sb *systemdBoot) writeEntry(cfg *Config, opts *Options, bundle string) (string, error) {
+	name, version, err := installedKernel(opts.RootDir, bundle)
+	if err != nil {
+		return "", err
+	}
+
+	kernelDir := filepath.Join(opts.RootDir, "usr", "lib", "kernel")
+	espDir := filepath.Join("EFI", "org.clearlinux")
+	flavor := kernelFlavor(bundle)
+
+	kernelFile := filepath.Join(espDir, "kernel-"+name)
+	if err = copyFile(filepath.Join(kernelDir, name),
+		filepath.Join(opts.RootDir, "boot", kernelFile)); err != nil {
+		return "", err
+	}
+
+	lines := []string{
+		"title Clear Linux OS",
+		"linux /" + kernelFile,
+	}
+
+	initrd := fmt.Sprintf("initrd-%s%s.%s", kernelPrefix, flavor, version)
+	if ok, _ := utils.FileExists(filepath.Join(kernelDir, initrd)); ok {
+		initrdFile := filepath.Join(espDir, initrd)
+		if err = copyFile(filepath.Join(kernelDir, initrd),
+			filepath.Join(opts.RootDir, "boot", initrdFile)); err != nil {
+			return "", err
+		}
+
+		lines = append(lines, "initrd /"+initrdFile)
+	}
+
+	options, err := sb.entryOptions(cfg, opts, bundle, version)
+	if err != nil {
+		return "", err
+	}
+
+	lines = append(lines, "options "+strings.Join(options, " "))
+
+	entry := fmt.Sprintf("Clear-linux-%s-%s.conf", flavor, version)
+	entryDir := filepath.Join(opts.RootDir, "boot", "loader", "entries")
+
+	if err = utils.MkdirAll(entryDir, 0755); err != nil {
+		return "", err
+	}
+
+	log.Debug("Writing boot entry %s: %s", entry, strings.Join(options, " "))
+
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	if err = ioutil.WriteFile(filepath.Join(entryDir, entry), content, 0644); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return entry, nil
+}
+
+// Install copies systemd-boot to the ESP and writes a boot entry per installed kernel
+func (sb *systemdBoot) Install(cfg *Config, opts *Options) error {
+	if len(opts.Kernels) == 0 {
+		return errors.Errorf("No kernel to write a boot entry for")
+	}
+
+	if err := sb.installLoader(opts.RootDir); err != nil {
+		return err
+	}
+
+	entries := map[string]string{}
+
+	for _, curr := range opts.Kernels {
+		entry, err := sb.writeEntry(cfg, opts, curr)
+		if err != nil {
+			return err
+		}
+
+		entries[curr] = entry
+	}
+
+	def := opts.Kernels[0]
+	if cfg != nil && cfg.Default != "" {
+		def = cfg.Default
+	}
+
+	lines := []string{"default " + entries[def]}
+	if cfg != nil && cfg.Timeout != nil {
+		lines = append(lines, fmt.Sprintf("timeout %d", *cfg.Timeout))
+	}
+
+	content := []byte(strings.Join(lines, "\n") + "\n")
+	if err := ioutil.WriteFile(filepath.Join(opts.RootDir, "boot", "loader", "loader.conf"),
+		content, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,277 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package bootloader
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// BackendClrBootManager manages the boot entries with clr-boot-manager, the default
+	BackendClrBootManager = "clr-boot-manager"
+
+	// BackendSystemdBoot writes the systemd-boot entries directly, for minimal images
+	// lacking the clr-boot-manager bundle
+	BackendSystemdBoot = "systemd-boot"
+
+	// kernelPrefix is the prefix of the kernel files installed by the kernel bundles
+	kernelPrefix = "org.clearlinux."
+)
+
+// Config describes the boot loader configuration of the target system
+type Config struct {
+	Backend    string              `yaml:"backend,omitempty,flow"`
+	Timeout    *uint               `yaml:"timeout,omitempty,flow"`
+	Default    string              `yaml:"default,omitempty,flow"`
+	Console    []string            `yaml:"console,omitempty,flow"`
+	KernelArgs map[string][]string `yaml:"kernelArgs,omitempty,flow"`
+}
+
+// Options are the install time settings shared by the backends
+type Options struct {
+	RootDir    string            // RootDir is where the target is mounted
+	Kernels    []string          // Kernels are the installed kernel bundles, the first is the default
+	LegacyBios bool              // LegacyBios is set for legacy BIOS installs
+	RootDevice string            // RootDevice is the root file system device file
+	Args       *kernel.Arguments // Args are the arguments added to, or removed from, every kernel
+}
+
+// Backend is implemented by the boot loader backends
+type Backend interface {
+	// Install installs the boot loader and its entries to the target
+	Install(cfg *Config, opts *Options) error
+}
+
+// GetBackend returns the backend name, the default backend if cfg is nil or has no backend set
+func (cfg *Config) GetBackend() string {
+	if cfg == nil || cfg.Backend == "" {
+		return BackendClrBootManager
+	}
+
+	return cfg.Backend
+}
+
+// New returns the backend configured by cfg, cfg may be nil
+func New(cfg *Config) (Backend, error) {
+	switch cfg.GetBackend() {
+	case BackendClrBootManager:
+		return &clrBootManager{}, nil
+	case BackendSystemdBoot:
+		return &systemdBoot{}, nil
+	}
+
+	return nil, errors.Errorf("Invalid boot loader backend: %s", cfg.Backend)
+}
+
+// Validate checks the configuration applies to the installed kernels and backend
+func (cfg *Config) Validate(kernels []string, legacyBios bool) error {
+	switch cfg.GetBackend() {
+	case BackendClrBootManager:
+		// clr-boot-manager shares a single command line between every kernel
+		if len(cfg.KernelArgs) > 0 && len(kernels) > 1 {
+			return errors.FieldValidationErrorf("kernelArgs",
+				"%s can not set per kernel arguments with more than one kernel installed",
+				BackendClrBootManager)
+		}
+	case BackendSystemdBoot:
+		if legacyBios {
+			return errors.FieldValidationErrorf("backend", "%s does not support legacy BIOS installs",
+				BackendSystemdBoot)
+		}
+	default:
+		return errors.FieldValidationErrorf("backend", "Invalid boot loader backend: %s", cfg.Backend)
+	}
+
+	if cfg.Default != "" && !utils.StringSliceContains(kernels, cfg.Default) {
+		return errors.FieldValidationErrorf("default", "Default kernel is not installed: %s", cfg.Default)
+	}
+
+	for idx, curr := range cfg.Console {
+		if curr == "" || strings.ContainsAny(curr, " \t") {
+			return errors.FieldValidationErrorf(fmt.Sprintf("console[%d]", idx), "Invalid console: %q", curr)
+		}
+	}
+
+	for bundle, args := range cfg.KernelArgs {
+		if !utils.StringSliceContains(kernels, bundle) {
+			return errors.FieldValidationErrorf("kernelArgs", "Kernel is not installed: %s", bundle)
+		}
+
+		if err := validateArgs(args); err != nil {
+			return errors.FieldValidationErrorf("kernelArgs", "%s: %v", bundle, err)
+		}
+
+		for _, curr := range args {
+			if err := kernel.ValidateArgument(curr); err != nil {
+				return errors.FieldValidationErrorf("kernelArgs", "%s: %v", bundle, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateArgs(args []string) error {
+	for _, curr := range args {
+		if curr == "" || strings.ContainsAny(curr, " \t\n\"'") {
+			return errors.Errorf("Invalid kernel argument: %q", curr)
+		}
+
+		// the root file system is always set by the boot loader backend
+		if strings.HasPrefix(curr, "root=") {
+			return errors.Errorf("The root kernel argument can not be set: %s", curr)
+		}
+	}
+
+	return nil
+}
+
+// ValidateArguments checks the arguments added to, or removed from, the kernel command line,
+// the values of the added known parameters are checked against the kernel parameters catalog
+func ValidateArguments(args *kernel.Arguments) error {
+	if err := validateArgs(args.Add); err != nil {
+		return errors.FieldValidationErrorf("add", "%v", err)
+	}
+
+	if err := validateArgs(args.Remove); err != nil {
+		return errors.FieldValidationErrorf("remove", "%v", err)
+	}
+
+	for idx, curr := range args.Add {
+		if err := kernel.ValidateArgument(curr); err != nil {
+			return errors.FieldValidationErrorf(fmt.Sprintf("add[%d]", idx), "%v", err)
+		}
+	}
+
+	return nil
+}
+
+// extraArgs returns the arguments the configuration adds to the bundle's kernel
+func (cfg *Config) extraArgs(bundle string) []string {
+	result := []string{}
+
+	if cfg == nil {
+		return result
+	}
+
+	for _, curr := range cfg.Console {
+		result = append(result, "console="+curr)
+	}
+
+	return append(result, cfg.KernelArgs[bundle]...)
+}
+
+// ComposeCmdline returns base with the add arguments appended, and then the remove
+// arguments dropped, the same way clr-boot-manager composes the kernel command line
+func ComposeCmdline(base []string, add []string, remove []string) []string {
+	result := []string{}
+
+	for _, curr := range append(append([]string{}, base...), add...) {
+		if !utils.StringSliceContains(remove, curr) {
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
+
+// Preview returns the kernel command line of the bundle's boot entry, the values
+// only known once installed are replaced by place holders
+func Preview(cfg *Config, args *kernel.Arguments, bundle string) string {
+	add := []string{}
+	remove := []string{}
+
+	if args != nil {
+		add = append(add, args.Add...)
+		remove = args.Remove
+	}
+
+	add = append(add, cfg.extraArgs(bundle)...)
+	cmdline := ComposeCmdline([]string{"<kernel default arguments>"}, add, remove)
+
+	removed := []string{}
+	for _, curr := range remove {
+		removed = append(removed, "-"+curr)
+	}
+
+	result := "root=<root partition> " + strings.Join(cmdline, " ")
+	if len(removed) > 0 {
+		result = result + " (" + strings.Join(removed, " ") + ")"
+	}
+
+	return result
+}
+
+// kernelFlavor returns the kernel flavor, i.e native for kernel-native, used to name
+// the kernel files installed by the bundle
+func kernelFlavor(bundle string) string {
+	return strings.TrimPrefix(bundle, "kernel-")
+}
+
+// installedKernel returns the kernel file name, i.e org.clearlinux.native.5.3.8-855, and
+// version, i.e 5.3.8-855, of the latest kernel installed by the bundle
+func installedKernel(rootDir string, bundle string) (string, string, error) {
+	prefix := kernelPrefix + kernelFlavor(bundle) + "."
+
+	files, err := filepath.Glob(filepath.Join(rootDir, "usr", "lib", "kernel", prefix+"*"))
+	if err != nil {
+		return "", "", errors.Wrap(err)
+	}
+
+	if len(files) == 0 {
+		return "", "", errors.Errorf("No kernel installed by %s", bundle)
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return compareVersions(strings.TrimPrefix(filepath.Base(files[i]), prefix),
+			strings.TrimPrefix(filepath.Base(files[j]), prefix)) < 0
+	})
+	name := filepath.Base(files[len(files)-1])
+
+	return name, strings.TrimPrefix(name, prefix), nil
+}
+
+// compareVersions compares two kernel versions, i.e 5.9.16-1004 and 5.10.1-1007, their
+// numeric parts are compared as numbers. It returns -1 if a is older than b, 1 if newer
+// and 0 if they are the same.
+func compareVersions(a string, b string) int {
+	split := func(r rune) bool { return r == '.' || r == '-' }
+	aParts, bParts := strings.FieldsFunc(a, split), strings.FieldsFunc(b, split)
+
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.ParseUint(aParts[i], 10, 64)
+		bNum, bErr := strconv.ParseUint(bParts[i], 10, 64)
+
+		switch {
+		case aErr == nil && bErr == nil && aNum != bNum:
+			if aNum < bNum {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && aParts[i] != bParts[i]:
+			if aParts[i] < bParts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,255 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package bootloader
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+)
+
+func uintPtr(v uint) *uint {
+	return &v
+}
+
+func TestValidate(t *testing.T) {
+	kernels := []string{"kernel-native"}
+
+	tests := []struct {
+		cfg    *Config
+		legacy bool
+		field  string
+	}{
+		{&Config{}, true, ""},
+		{&Config{Backend: BackendSystemdBoot, Timeout: uintPtr(5), Default: "kernel-native"}, false, ""},
+		{&Config{Console: []string{"tty0", "ttyS0,115200n8"}}, false, ""},
+		{&Config{KernelArgs: map[string][]string{"kernel-native": {"quiet"}}}, false, ""},
+		{&Config{Backend: "grub"}, false, "backend"},
+		{&Config{Backend: BackendSystemdBoot}, true, "backend"},
+		{&Config{Default: "kernel-lts"}, false, "default"},
+		{&Config{Console: []string{"tty0", ""}}, false, "console[1]"},
+		{&Config{KernelArgs: map[string][]string{"kernel-lts": {"quiet"}}}, false, "kernelArgs"},
+		{&Config{KernelArgs: map[string][]string{"kernel-native": {"root=/dev/sda2"}}}, false, "kernelArgs"},
+	}
+
+	for _, curr := range tests {
+		err := curr.cfg.Validate(kernels, curr.legacy)
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Config %+v should be valid: %v", curr.cfg, err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for %q, got: %v", curr.field, err)
+		}
+	}
+
+	cfg := &Config{KernelArgs: map[string][]string{"kernel-native": {"quiet"}}}
+	if err := cfg.Validate([]string{"kernel-native", "kernel-lts"}, false); err == nil {
+		t.Fatal("clr-boot-manager should not support per kernel arguments for several kernels")
+	}
+}
+
+func TestValidateArguments(t *testing.T) {
+	tests := []struct {
+		args  *kernel.Arguments
+		field string
+	}{
+		{&kernel.Arguments{Add: []string{"quiet", "console=tty0"}, Remove: []string{"rw"}}, ""},
+		{&kernel.Arguments{Add: []string{""}}, "add"},
+		{&kernel.Arguments{Add: []string{"root=/dev/sda2"}}, "add"},
+		{&kernel.Arguments{Remove: []string{"a b"}}, "remove"},
+		{&kernel.Arguments{Add: []string{"quiet"}, Remove: []string{"quiet"}}, ""},
+		{&kernel.Arguments{Add: []string{"quiet", "intel_iommu=maybe"}}, "add[1]"},
+		{&kernel.Arguments{Add: []string{"loglevel=9"}}, "add[0]"},
+	}
+
+	for _, curr := range tests {
+		err := ValidateArguments(curr.args)
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Arguments %+v should be valid: %v", curr.args, err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for %q, got: %v", curr.field, err)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	cfg := &Config{
+		Console:    []string{"ttyS0"},
+		KernelArgs: map[string][]string{"kernel-native": {"quiet"}},
+	}
+
+	args := &kernel.Arguments{Add: []string{"splash"}, Remove: []string{"rw"}}
+
+	expected := "root=<root partition> <kernel default arguments> splash console=ttyS0 quiet (-rw)"
+	if preview := Preview(cfg, args, "kernel-native"); preview != expected {
+		t.Fatalf("Unexpected preview: %q", preview)
+	}
+
+	expected = "root=<root partition> <kernel default arguments>"
+	if preview := Preview(nil, nil, "kernel-lts"); preview != expected {
+		t.Fatalf("Unexpected preview: %q", preview)
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(nil); err != nil {
+		t.Fatalf("The default backend should be returned: %v", err)
+	}
+
+	if b, err := New(&Config{Backend: BackendSystemdBoot}); err != nil || b == nil {
+		t.Fatalf("The systemd-boot backend should be returned: %v", err)
+	}
+
+	if _, err := New(&Config{Backend: "grub"}); err == nil {
+		t.Fatal("An invalid backend should fail")
+	}
+}
+
+func writeFiles(t *testing.T, rootDir string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(rootDir, path)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	return string(content)
+}
+
+func TestInstalledKernel(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "bootloader-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	writeFiles(t, rootDir, map[string]string{
+		"usr/lib/kernel/org.clearlinux.native.5.9.16-1004": "kernel",
+		"usr/lib/kernel/org.clearlinux.native.5.10.1-1007": "kernel",
+		"usr/lib/kernel/org.clearlinux.native.5.10.1-998":  "kernel",
+		"usr/lib/kernel/org.clearlinux.lts.5.4.80-1000":    "kernel",
+	})
+
+	name, version, err := installedKernel(rootDir, "kernel-native")
+	if err != nil {
+		t.Fatalf("Failed to find the installed kernel: %v", err)
+	}
+
+	if name != "org.clearlinux.native.5.10.1-1007" || version != "5.10.1-1007" {
+		t.Fatalf("The newest kernel version should be found, got: %s %s", name, version)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a        string
+		b        string
+		expected int
+	}{
+		{"5.9.16-1004", "5.10.1-1007", -1},
+		{"5.10.1-1007", "5.10.1-998", 1},
+		{"5.3.8-855", "5.3.8-855", 0},
+		{"5.3.8", "5.3.8-855", -1},
+		{"5.3.8-rc1", "5.3.8-rc2", -1},
+	}
+
+	for _, curr := range tests {
+		if result := compareVersions(curr.a, curr.b); result != curr.expected {
+			t.Fatalf("compareVersions(%q, %q) should return %d, got: %d", curr.a, curr.b,
+				curr.expected, result)
+		}
+	}
+}
+
+func TestSystemdBootInstall(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "bootloader-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	saved := partUUID
+	partUUID = func(devFile string) (string, error) { return "1234-abcd", nil }
+	defer func() { partUUID = saved }()
+
+	cfg := &Config{Backend: BackendSystemdBoot, Timeout: uintPtr(3), Console: []string{"ttyS0"}}
+	opts := &Options{
+		RootDir:    rootDir,
+		Kernels:    []string{"kernel-native"},
+		RootDevice: "/dev/sda3",
+		Args:       &kernel.Arguments{Add: []string{"splash"}, Remove: []string{"quiet"}},
+	}
+
+	backend, err := New(cfg)
+	if err != nil {
+		t.Fatalf("Failed to create backend: %v", err)
+	}
+
+	if err = backend.Install(cfg, opts); err == nil {
+		t.Fatal("Install should fail without systemd-boot in the target")
+	}
+
+	writeFiles(t, rootDir, map[string]string{
+		"usr/lib/systemd/boot/efi/systemd-bootx64.efi":          "efi",
+		"usr/lib/kernel/org.clearlinux.native.5.3.8-855":        "kernel",
+		"usr/lib/kernel/initrd-org.clearlinux.native.5.3.8-855": "initrd",
+		"usr/lib/kernel/cmdline-5.3.8-855.native":               "quiet rw\n",
+	})
+
+	if err = backend.Install(cfg, opts); err != nil {
+		t.Fatalf("Install should succeed: %v", err)
+	}
+
+	for _, curr := range []string{
+		"boot/EFI/systemd/systemd-bootx64.efi",
+		"boot/EFI/Boot/BOOTX64.EFI",
+		"boot/EFI/org.clearlinux/kernel-org.clearlinux.native.5.3.8-855",
+		"boot/EFI/org.clearlinux/initrd-org.clearlinux.native.5.3.8-855",
+	} {
+		if _, err = os.Stat(filepath.Join(rootDir, curr)); err != nil {
+			t.Fatalf("File should be installed to the ESP: %s", curr)
+		}
+	}
+
+	entry := readFile(t, filepath.Join(rootDir, "boot/loader/entries/Clear-linux-native-5.3.8-855.conf"))
+	if !strings.Contains(entry, "options root=PARTUUID=1234-abcd rw splash console=ttyS0\n") {
+		t.Fatalf("Unexpected boot entry: %q", entry)
+	}
+
+	loader := readFile(t, filepath.Join(rootDir, "boot/loader/loader.conf"))
+	if loader != "default Clear-linux-native-5.3.8-855.conf\ntimeout 3\n" {
+		t.Fatalf("Unexpected loader configuration: %q", loader)
+	}
+}
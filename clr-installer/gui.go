@@ -7,15 +7,19 @@
 package main
 
 import (
+	"github.com/clearlinux/clr-installer/controlsocket"
 	"github.com/clearlinux/clr-installer/frontend"
 	"github.com/clearlinux/clr-installer/gui"
 	"github.com/clearlinux/clr-installer/massinstall"
 	"github.com/clearlinux/clr-installer/tui"
+	"github.com/clearlinux/clr-installer/web"
 )
 
 // The list of possible frontends to run for GUI
 func initFrontendList() {
 	frontEndImpls = []frontend.Frontend{
+		controlsocket.New(),
+		web.New(),
 		massinstall.New(),
 		gui.New(),
 		tui.New(),
@@ -21,13 +21,17 @@ import (
 	"github.com/clearlinux/clr-installer/args"
 	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/discover"
 	"github.com/clearlinux/clr-installer/encrypt"
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/frontend"
 	"github.com/clearlinux/clr-installer/keyboard"
 	"github.com/clearlinux/clr-installer/language"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/massinstall"
 	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/swupd"
 	"github.com/clearlinux/clr-installer/syscheck"
 	"github.com/clearlinux/clr-installer/telemetry"
@@ -40,10 +44,17 @@ var (
 	classExp      = regexp.MustCompile(`(?im)(\w+)`)
 	lockFile      = "/root/clr-installer.lock"
 	lock          lockfile.Lockfile
+
+	// discovered is the unattended configuration found on the host, if any, fatal
+	// releases its media before bailing out
+	discovered *discover.Config
 )
 
 func fatal(err error) {
 	log.ErrorError(err)
+	if discovered != nil {
+		discovered.Close()
+	}
 	panic(err)
 }
 
@@ -97,6 +108,106 @@ func validateTelemetry(options args.Args, md *model.SystemInstall) error {
 	return nil
 }
 
+// printConfig prints the effective configuration, the --config files merged with the
+// files they extend and include
+func printConfig(options args.Args) error {
+	var err error
+
+	cf := options.ConfigFile
+	if cf == "" {
+		if cf, err = conf.LookupDefaultConfig(); err != nil {
+			return err
+		}
+	}
+
+	content, err := model.ComposeFiles(append([]string{cf}, options.ConfigOverlays...))
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(content))
+	return nil
+}
+
+// validateConfig loads the --validate-config file as an install would, prints all its
+// problems and returns false if there is any, neither root, disks nor network are used
+func validateConfig(options args.Args) bool {
+	var diskSize uint64
+	var err error
+
+	cf := options.ValidateConfigFile
+
+	report := func(err error) bool {
+		fmt.Printf("Error: %v\n", err)
+		fmt.Printf("Invalid configuration file: %s\n", cf)
+		return false
+	}
+
+	if options.DiskSize != "" {
+		if diskSize, err = storage.ParseVolumeSize(options.DiskSize); err != nil || diskSize == 0 {
+			return report(fmt.Errorf("Invalid --disk-size: %s", options.DiskSize))
+		}
+	}
+
+	if _, err = os.Stat(cf); err != nil {
+		return report(err)
+	}
+
+	path := cf
+
+	// the ister file is converted in a temporary directory, the user's files are left as is
+	if filepath.Ext(cf) == ".json" {
+		converted, err := model.ConvertIster(cf)
+		if err != nil {
+			return report(err)
+		}
+
+		dir, err := ioutil.TempDir("", "clr-installer-validate-")
+		if err != nil {
+			return report(err)
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		path = filepath.Join(dir, conf.ConfigFile)
+		if err = converted.WriteFile(path); err != nil {
+			return report(err)
+		}
+	}
+
+	// the configuration file is the one validated, not the default one
+	options.ConfigFile = path
+
+	log.Debug("Validating config file: %s", cf)
+	md, err := model.LoadFile(path, options)
+	if err != nil {
+		return report(err)
+	}
+
+	// the telemetry is disabled, as on install, if the file does not acknowledge it
+	md.EnableTelemetry(md.IsTelemetryEnabled())
+
+	// the problems are reported in the configured language
+	utils.SetLocale(md.Language.Code)
+
+	problems, warnings := md.Lint(diskSize)
+
+	for _, curr := range warnings {
+		fmt.Printf("Warning: %s\n", curr)
+	}
+
+	for _, curr := range problems {
+		fmt.Printf("Error: %v\n", curr)
+	}
+
+	if len(problems) > 0 {
+		fmt.Printf("Invalid configuration file: %s, %d problem(s) found\n", cf, len(problems))
+		return false
+	}
+
+	fmt.Printf("Valid configuration file: %s\n", cf)
+	return true
+}
+
 func main() {
 	var options args.Args
 
@@ -123,6 +234,10 @@ func main() {
 	log.Info(path.Base(os.Args[0]) + ": " + model.Version +
 		", built on " + model.BuildDate)
 
+	if options.SwupdCertPath != "" {
+		network.SetCACertsPath(options.SwupdCertPath)
+	}
+
 	if options.SwupdContentURL != "" && swupd.IsValidMirror(options.SwupdContentURL) == false {
 		fatal(errors.Errorf("swupd-contenturl %s must use HTTPS or FILE protocol", options.SwupdContentURL))
 	}
@@ -143,13 +258,50 @@ func main() {
 	}
 
 	if options.ConvertConfigFile != "" {
-		if filepath.Ext(options.ConvertConfigFile) == ".json" {
-			_, err = model.JSONtoYAMLConfig(options.ConvertConfigFile)
-			if err != nil {
-				fatal(err)
-			}
+		cf, warnings, err := model.ConvertConfigFile(options.ConvertConfigFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, curr := range warnings {
+			fmt.Printf("WARNING: %s\n", curr)
+		}
+
+		fmt.Printf("Converted config file: %s\n", cf)
+		return
+	}
+
+	if options.MigrateConfigFile != "" {
+		migrated, warnings, err := model.MigrateConfigFile(options.MigrateConfigFile)
+		if err != nil {
+			fatal(err)
+		}
+
+		for _, curr := range warnings {
+			fmt.Printf("%s: %s\n", options.MigrateConfigFile, curr)
+		}
+
+		if migrated {
+			fmt.Printf("Migrated config file %s to schema version %d\n", options.MigrateConfigFile,
+				model.CurrentSchemaVersion)
 		} else {
-			fatal(errors.Errorf("Config file '%s' must end in '.json'", options.ConvertConfigFile))
+			fmt.Printf("Config file %s is already at schema version %d\n", options.MigrateConfigFile,
+				model.CurrentSchemaVersion)
+		}
+		return
+	}
+
+	if options.PrintConfig {
+		if err = printConfig(options); err != nil {
+			fatal(err)
+		}
+		return
+	}
+
+	if options.ValidateConfigFile != "" {
+		if !validateConfig(options) {
+			_ = f.Close()
+			os.Exit(1)
 		}
 		return
 	}
@@ -193,6 +345,23 @@ func main() {
 	}
 	defer func() { _ = os.RemoveAll(rootDir) }()
 
+	if options.ConfigFile == "" && options.DiscoverConfig && !options.ForceTUI {
+		log.Info("No clri.descriptor kernel parameter nor --config given")
+		var discoverErr error
+
+		discovered, discoverErr = discover.Find()
+		if discoverErr != nil {
+			log.Warning("Could not discover an unattended configuration, using the interactive installer: %v",
+				discoverErr)
+		} else if discovered != nil {
+			defer discovered.Close()
+
+			log.Info("Using the unattended configuration of %s", discovered.Source)
+			options.ConfigFile = discovered.Path
+			options.CfDownloaded = discovered.Downloaded
+		}
+	}
+
 	var md *model.SystemInstall
 	cf := options.ConfigFile
 
@@ -205,21 +374,36 @@ func main() {
 		defer func() { _ = os.Remove(cf) }()
 	}
 
+	// the machine readable output consumer is told why no install is going to run, the
+	// configuration could not be loaded or the loaded one is not usable
+	loadFailure := func(err error) {
+		if options.OutputFormat == args.OutputJSON && !options.ForceTUI {
+			massinstall.EmitLoadError(options, err)
+		} else if errors.IsValidationError(err) {
+			fmt.Printf("Error: Invalid configuration file: %s\n", cf)
+		}
+		fatal(err)
+	}
+
 	if filepath.Ext(cf) == ".json" {
 		cf, err = model.JSONtoYAMLConfig(cf)
 		if err != nil {
-			fatal(err)
+			loadFailure(err)
 		}
 	}
 
 	log.Debug("Loading config file: %s", cf)
-	if md, err = model.LoadFile(cf, options); err != nil {
-		fatal(err)
+	for _, curr := range options.ConfigOverlays {
+		log.Debug("Merging config file overlay: %s", curr)
+	}
+
+	if md, err = model.LoadFiles(append([]string{cf}, options.ConfigOverlays...), options); err != nil {
+		loadFailure(err)
 	}
 
 	log.Info("Querying Clear Linux version")
 	if err := utils.ParseOSClearVersion(); err != nil {
-		fatal(err)
+		loadFailure(err)
 	}
 
 	if options.CryptPassFile != "" {
@@ -268,27 +452,27 @@ func main() {
 			var url string
 			url, err = swupd.SetHostMirror(md.SwupdMirror)
 			if err != nil {
-				fatal(err)
+				loadFailure(err)
 			} else {
 				log.Info("Using Swupd Mirror value: %q", url)
 			}
 		}
 
 		if err = validateTelemetry(options, md); err != nil {
-			fatal(err)
+			loadFailure(err)
 		}
 	}
 
 	if md.Keyboard != nil && !keyboard.IsValidKeyboard(md.Keyboard) {
-		fatal(fmt.Errorf("Invalid Keyboard '%s'", md.Keyboard.Code))
+		loadFailure(errors.FieldValidationErrorf("keyboard", "Invalid Keyboard '%s'", md.Keyboard.Code))
 	}
 
 	if md.Timezone != nil && !timezone.IsValidTimezone(md.Timezone) {
-		fatal(fmt.Errorf("Invalid Time Zone '%s'", md.Timezone.Code))
+		loadFailure(errors.FieldValidationErrorf("timezone", "Invalid Time Zone '%s'", md.Timezone.Code))
 	}
 
 	if md.Language != nil && !language.IsValidLanguage(md.Language) {
-		fatal(fmt.Errorf("Invalid Language '%s'", md.Language.Code))
+		loadFailure(errors.FieldValidationErrorf("language", "Invalid Language '%s'", md.Language.Code))
 	}
 
 	// Set locale
@@ -322,7 +506,12 @@ func main() {
 					log.Error("Failed to log Telemetry fail record: %s", feName)
 				}
 
-				if errors.IsValidationError(err) {
+				// the mass installer's json output already carries the error details,
+				// don't mess with the machine readable output
+				if _, isMass := fe.(*massinstall.MassInstall); isMass &&
+					options.OutputFormat == args.OutputJSON {
+					errChan <- err
+				} else if errors.IsValidationError(err) {
 					fmt.Println("Error: Invalid configuration:")
 					errChan <- err
 				} else {
@@ -7,14 +7,18 @@
 package main
 
 import (
+	"github.com/clearlinux/clr-installer/controlsocket"
 	"github.com/clearlinux/clr-installer/frontend"
 	"github.com/clearlinux/clr-installer/massinstall"
 	"github.com/clearlinux/clr-installer/tui"
+	"github.com/clearlinux/clr-installer/web"
 )
 
 // The list of possible frontends to run for TUI
 func initFrontendList() {
 	frontEndImpls = []frontend.Frontend{
+		controlsocket.New(),
+		web.New(),
 		massinstall.New(),
 		tui.New(),
 	}
@@ -11,8 +11,12 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
 	"github.com/clearlinux/clr-installer/proxy"
 )
 
@@ -68,22 +72,38 @@ func PipeRunAndLog(in string, args ...string) error {
 	}, runLogger{}, nil, args...)
 }
 
-func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string, args ...string) error {
-	var exe string
-	var cmdArgs []string
+func newCommand(env map[string]string, args ...string) *exec.Cmd {
+	cmd := newEnvCommand(env, args...)
 
-	log.Debug("%s", strings.Join(args, " "))
+	for k, v := range env {
+		cmd.Args = append(cmd.Args, fmt.Sprintf("%s=%s", k, v))
+	}
 
-	exe = args[0]
-	cmdArgs = args[1:]
+	return cmd
+}
 
-	cmd := exec.Command(exe, cmdArgs...)
+// newEnvCommand creates a command with the env variables added to its environment only,
+// never to its arguments
+func newEnvCommand(env map[string]string, args ...string) *exec.Cmd {
+	log.Debug("%s", strings.Join(args, " "))
+
+	cmd := exec.Command(args[0], args[1:]...)
 
 	// Add any proxy environment variables
 	for _, pvar := range proxy.GetProxyValues() {
 		cmd.Env = append(cmd.Env, pvar)
 	}
-	log.Debug("cmd.Env: %+v", cmd.Env)
+	log.Debug("cmd.Env: %+v", proxy.RedactValues(cmd.Env))
+
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", k, v))
+	}
+
+	return cmd
+}
+
+func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string, args ...string) error {
+	cmd := newCommand(env, args...)
 
 	if sw != nil {
 		if err := sw(cmd); err != nil {
@@ -98,13 +118,9 @@ func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string,
 		cmd.Stdin = os.Stdin
 	}
 
-	for k, v := range env {
-		curr := fmt.Sprintf("%s=%s", k, v)
-		cmd.Args = append(cmd.Args, curr)
-		cmd.Env = append(cmd.Env, curr)
-	}
-
+	timing := metrics.StartCommand(args)
 	err := cmd.Run()
+	timing.Finish(err)
 	if err != nil {
 		return err
 	}
@@ -112,6 +128,47 @@ func run(sw func(cmd *exec.Cmd) error, writer io.Writer, env map[string]string,
 	return nil
 }
 
+// RunWithTimeout executes a command writing stdout and stderr to separate writers and
+// adding the provided env variables to its environment, unlike RunAndLogWithEnv they are
+// not added to its arguments. The command and all of its children are killed if it doesn't
+// finish within timeout, a zero timeout means no limit
+func RunWithTimeout(stdout io.Writer, stderr io.Writer, timeout time.Duration,
+	env map[string]string, args ...string) error {
+	cmd := newEnvCommand(env, args...)
+
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Stdin = os.Stdin
+
+	// run in its own process group so the whole group can be killed on timeout
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	timing := metrics.StartCommand(args)
+
+	if err := cmd.Start(); err != nil {
+		timing.Finish(err)
+		return err
+	}
+
+	var timedOut int32
+
+	if timeout > 0 {
+		timer := time.AfterFunc(timeout, func() {
+			atomic.StoreInt32(&timedOut, 1)
+			_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		defer timer.Stop()
+	}
+
+	err := cmd.Wait()
+	if atomic.LoadInt32(&timedOut) == 1 {
+		err = fmt.Errorf("command timed out after %s", timeout)
+	}
+
+	timing.Finish(err)
+	return err
+}
+
 // Run executes a command and uses writer to write both stdout and stderr
 // args are the actual command and its arguments
 func Run(writer io.Writer, args ...string) error {
@@ -137,7 +194,7 @@ func RunAndProcessOutput(output Output, args ...string) error {
 	for _, pvar := range proxy.GetProxyValues() {
 		cmd.Env = append(cmd.Env, pvar)
 	}
-	log.Debug("cmd.Env: %+v", cmd.Env)
+	log.Debug("cmd.Env: %+v", proxy.RedactValues(cmd.Env))
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -145,9 +202,12 @@ func RunAndProcessOutput(output Output, args ...string) error {
 		return err
 	}
 
+	timing := metrics.StartCommand(args)
+
 	// run the command but don't wait for it to finish
 	if err := cmd.Start(); err != nil {
 		log.Error("Failed to start command execution")
+		timing.Finish(err)
 		return err
 	}
 
@@ -162,11 +222,14 @@ func RunAndProcessOutput(output Output, args ...string) error {
 
 	if err := scannerOut.Err(); err != nil {
 		log.Error("An error occurred while reading stdout")
+		timing.Finish(err)
 		return err
 	}
 
 	// wait for the command to finish running
-	if err := cmd.Wait(); err != nil {
+	err = cmd.Wait()
+	timing.Finish(err)
+	if err != nil {
 		log.Error("An error occurred executing command: \"%s\". Error: %s", strings.Join(args, " "), err)
 		return err
 	}
@@ -22,6 +22,12 @@ const (
 	// ConfigFile is the install descriptor
 	ConfigFile = "clr-installer.yaml"
 
+	// MetricsFile is the installation timing and metrics report file name
+	MetricsFile = "clr-installer-metrics.json"
+
+	// HookLogDir is the directory, next to the log file, holding the install hooks output
+	HookLogDir = "clr-installer-hooks"
+
 	// ChpasswdPAMFile is the chpasswd pam configuration file
 	ChpasswdPAMFile = "chpasswd"
 
@@ -35,6 +41,13 @@ const (
 	// KernelListFile is the file describing the available kernel bundles
 	KernelListFile = "kernels.json"
 
+	// ConfigPolicyFile is the remote configuration files verification policy
+	ConfigPolicyFile = "config-policy.yaml"
+
+	// TrustedKeysDir is the directory holding the keys the remote configuration files
+	// signatures are checked against
+	TrustedKeysDir = "trusted-keys"
+
 	// SourcePath is the source path (within the .gopath)
 	SourcePath = "src/github.com/clearlinux/clr-installer"
 )
@@ -101,3 +114,13 @@ func LookupDefaultConfig() (string, error) {
 func LookupChpasswdConfig() (string, error) {
 	return lookupDefaultFile(ChpasswdPAMFile)
 }
+
+// LookupConfigPolicy looks up the remote configuration files verification policy
+func LookupConfigPolicy() (string, error) {
+	return lookupDefaultFile(ConfigPolicyFile)
+}
+
+// LookupTrustedKeysDir looks up the remote configuration files trusted keys directory
+func LookupTrustedKeysDir() (string, error) {
+	return lookupDefaultFile(TrustedKeysDir)
+}
@@ -11,21 +11,26 @@ import (
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"gopkg.in/yaml.v2"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/bootloader"
 	"github.com/clearlinux/clr-installer/cmd"
 	"github.com/clearlinux/clr-installer/conf"
 	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/files"
 	"github.com/clearlinux/clr-installer/hostname"
 	"github.com/clearlinux/clr-installer/isoutils"
 	"github.com/clearlinux/clr-installer/keyboard"
 	"github.com/clearlinux/clr-installer/language"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/oci"
 	"github.com/clearlinux/clr-installer/progress"
 	"github.com/clearlinux/clr-installer/proxy"
 	"github.com/clearlinux/clr-installer/storage"
@@ -34,12 +39,20 @@ import (
 	"github.com/clearlinux/clr-installer/timezone"
 	cuser "github.com/clearlinux/clr-installer/user"
 	"github.com/clearlinux/clr-installer/utils"
+	"github.com/clearlinux/clr-installer/verify"
 )
 
 var (
 	// NetworkPassing is used to track if the latest network configuration
 	// is passing; changes in proxy, etc.
 	NetworkPassing bool
+
+	// cancelRequested is set (atomically) when a frontend asks the running
+	// install to stop
+	cancelRequested int32
+
+	// verificationReport holds the *verify.Report of the latest install, if verified
+	verificationReport atomic.Value
 )
 
 const (
@@ -55,62 +68,120 @@ func sortMountPoint(bds []*storage.BlockDevice) []*storage.BlockDevice {
 	return bds
 }
 
+// Cancel requests the running install to stop, the request is honored at the next
+// install phase boundary, the command currently running is not interrupted
+func Cancel() {
+	atomic.StoreInt32(&cancelRequested, 1)
+}
+
+// IsCancelRequested returns true if Cancel was called for the running install
+func IsCancelRequested() bool {
+	return atomic.LoadInt32(&cancelRequested) == 1
+}
+
+// VerificationReport returns the verification report of the latest install, nil is
+// returned if the install was not verified
+func VerificationReport() *verify.Report {
+	report, _ := verificationReport.Load().(*verify.Report)
+	return report
+}
+
+// checkCancel returns an error if the install was requested to be cancelled
+func checkCancel() error {
+	if IsCancelRequested() {
+		log.Warning("Install cancellation requested, stopping")
+		return errors.Errorf("Installation cancelled")
+	}
+
+	return nil
+}
+
 // Install is the main install controller, this is the entry point for a full
 // installation
-func Install(rootDir string, model *model.SystemInstall, options args.Args) error {
+func Install(rootDir string, md *model.SystemInstall, options args.Args) error {
 	var err error
 	var version string
 	var prg progress.Progress
 	var encryptedUsed bool
 
+	// every install produces its own timing report
+	metrics.Reset()
+	defer metrics.Finish()
+
+	atomic.StoreInt32(&cancelRequested, 0)
+	verificationReport.Store((*verify.Report)(nil))
+
+	// a directory target is installed in place, the target directory is the root
+	if md.IsDirectoryTarget() {
+		if err = md.Validate(); err != nil {
+			return err
+		}
+
+		rootDir = md.TargetDir
+	}
+
 	vars := map[string]string{
 		"chrootDir": rootDir,
 		"yamlDir":   filepath.Dir(options.ConfigFile),
 	}
 
-	for k, v := range model.Environment {
+	for k, v := range md.Environment {
 		vars[k] = v
 	}
 
+	// hook output files of a previous install must not be archived with this one
+	if err = os.RemoveAll(hookLogDir()); err != nil {
+		log.Warning("Failed to remove hook log dir: %v", err)
+	}
+
 	preConfFile := log.GetPreConfFile()
 
-	if err = model.WriteFile(preConfFile); err != nil {
+	if err = md.WriteFile(preConfFile); err != nil {
 		log.Error("Failed to write pre-install YAML file (%v) %q", err, preConfFile)
 	}
 
-	if model.EncryptionRequiresPassphrase() && model.CryptPass == "" {
-		model.CryptPass = storage.GetPassPhrase()
-		if model.CryptPass == "" {
+	if md.EncryptionRequiresPassphrase() && md.CryptPass == "" {
+		md.CryptPass = storage.GetPassPhrase()
+		if md.CryptPass == "" {
 			return errors.Errorf("Can not create encrypted file system, no passphrase")
 		}
 	}
 
 	if !options.StubImage {
-		if err = applyHooks("pre-install", vars, model.PreInstall); err != nil {
+		if err = applyHooks(model.HookPreInstall, vars, md.PreInstall); err != nil {
 			return err
 		}
 	}
 
-	if model.Version == 0 {
+	if md.Version == 0 {
 		version = utils.ClearVersion
 	} else {
-		version = fmt.Sprintf("%d", model.Version)
+		version = fmt.Sprintf("%d", md.Version)
 	}
 
 	log.Debug("Clear Linux version: %s", version)
 
 	// do we have the minimum required to install a system?
-	if err = model.Validate(); err != nil {
+	if err = md.Validate(); err != nil {
+		return err
+	}
+
+	if err = checkCancel(); err != nil {
 		return err
 	}
 
 	// Using MassInstaller (non-UI) the network will not have been checked yet
 	if !NetworkPassing && !options.StubImage {
-		if err = ConfigureNetwork(model); err != nil {
+		if err = ConfigureNetwork(md); err != nil {
 			return err
 		}
 	}
 
+	// the ssh keys files and urls are read before the target is changed
+	if err = cuser.ResolveSSHKeys(md.Users, vars["yamlDir"]); err != nil {
+		return err
+	}
+
 	expandMe := []*storage.BlockDevice{}
 	detachMe := []string{}
 	removeMe := []string{}
@@ -118,7 +189,7 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 
 	// prepare image file, case the user has declared image alias then create
 	// the image, setup the loop device, prepare the variable expansion
-	for _, alias := range model.StorageAlias {
+	for _, alias := range md.StorageAlias {
 		var file string
 
 		if alias.DeviceFile {
@@ -126,7 +197,7 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		}
 
 		// create the image and add the alias name to the variable expansion list
-		for _, tm := range model.TargetMedias {
+		for _, tm := range md.TargetMedias {
 			if tm.Name == fmt.Sprintf("${%s}", alias.Name) {
 				if err = storage.MakeImage(tm, alias.File); err != nil {
 					return err
@@ -143,7 +214,7 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 
 		aliasMap[alias.Name] = filepath.Base(file)
 		detachMe = append(detachMe, file)
-		if !model.KeepImage {
+		if !md.KeepImage {
 			removeMe = append(removeMe, alias.File)
 		}
 
@@ -188,12 +259,20 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		tm.ExpandName(aliasMap)
 	}
 
+	if err = checkCancel(); err != nil {
+		return err
+	}
+
 	mountPoints := []*storage.BlockDevice{}
 
 	// prepare all the target block devices
-	for _, curr := range model.TargetMedias {
+	for _, curr := range md.TargetMedias {
+		if err = checkCancel(); err != nil {
+			return err
+		}
+
 		// based on the description given, write the partition table
-		if err = curr.WritePartitionTable(model.LegacyBios, model.InstallSelected.WholeDisk); err != nil {
+		if err = curr.WritePartitionTable(md.LegacyBios, md.InstallSelected.WholeDisk); err != nil {
 			return err
 		}
 
@@ -206,7 +285,7 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 					msg := utils.Locale.Get("Mapping %s partition to an encrypted partition", ch.Name)
 					prg = progress.NewLoop(msg)
 					log.Info(msg)
-					if err = ch.MapEncrypted(model.CryptPass); err != nil {
+					if err = ch.MapEncrypted(md.CryptPass); err != nil {
 						return err
 					}
 					prg.Success()
@@ -239,14 +318,24 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 	}
 
 	// Update the target devices current labels and UUIDs
-	if scanErr := storage.UpdateBlockDevices(model.TargetMedias); scanErr != nil {
-		return scanErr
+	if !md.IsDirectoryTarget() {
+		if scanErr := storage.UpdateBlockDevices(md.TargetMedias); scanErr != nil {
+			return scanErr
+		}
 	}
 
 	if options.StubImage {
 		return nil
 	}
 
+	if err = applyHooks(model.HookPostPartition, vars, md.PostPartition); err != nil {
+		return err
+	}
+
+	if err = checkCancel(); err != nil {
+		return err
+	}
+
 	// mount all the prepared partitions
 	for _, curr := range sortMountPoint(mountPoints) {
 		log.Info("Mounting: %s", curr.MountPoint)
@@ -263,65 +352,87 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 			return
 		}
 
+		// the target directory is the install result, it must be kept
+		if md.IsDirectoryTarget() {
+			return
+		}
+
 		log.Info("Removing rootDir: %s", rootDir)
 		if err = os.RemoveAll(rootDir); err != nil {
 			log.Warning("Failed to remove rootDir: %s", rootDir)
 		}
 	}()
 
+	if md.IsDirectoryTarget() {
+		if err = utils.MkdirAll(rootDir, 0755); err != nil {
+			return err
+		}
+	}
+
 	err = storage.MountMetaFs(rootDir)
 	if err != nil {
 		return err
 	}
 
+	if err = applyHooks(model.HookPostMount, vars, md.PostMount); err != nil {
+		return err
+	}
+
 	// If we are using NetworkManager add the basic bundle
 	if network.IsNetworkManagerActive() {
-		model.AddBundle(network.RequiredBundle)
+		md.AddBundle(network.RequiredBundle)
 	}
 
 	// Add in the User Defined bundles
-	for _, curr := range model.UserBundles {
-		model.AddBundle(curr)
+	for _, curr := range md.UserBundles {
+		md.AddBundle(curr)
 	}
 
-	if model.Telemetry.Enabled {
-		model.AddBundle(telemetry.RequiredBundle)
+	if md.Telemetry.Enabled {
+		md.AddBundle(telemetry.RequiredBundle)
 	}
 
-	if len(model.Users) > 0 {
-		model.AddBundle(cuser.RequiredBundle)
+	if len(md.Users) > 0 {
+		md.AddBundle(cuser.RequiredBundle)
 	}
 
-	if model.Timezone.Code != timezone.DefaultTimezone {
-		model.AddBundle(timezone.RequiredBundle)
+	if md.Timezone.Code != timezone.DefaultTimezone {
+		md.AddBundle(timezone.RequiredBundle)
 	}
 
-	if model.Keyboard.Code != keyboard.DefaultKeyboard {
-		model.AddBundle(keyboard.RequiredBundle)
+	if md.Keyboard.Code != keyboard.DefaultKeyboard {
+		md.AddBundle(keyboard.RequiredBundle)
 	}
 
-	if model.Language.Code != language.DefaultLanguage {
-		model.AddBundle(language.RequiredBundle)
+	if md.Language.Code != language.DefaultLanguage {
+		md.AddBundle(language.RequiredBundle)
 	}
 
 	if encryptedUsed {
-		model.AddBundle(storage.RequiredBundle)
+		md.AddBundle(storage.RequiredBundle)
 		kernelArgs := []string{storage.KernelArgument}
-		model.AddExtraKernelArguments(kernelArgs)
+		md.AddExtraKernelArguments(kernelArgs)
 	}
 
-	msg := utils.Locale.Get("Writing mount files")
-	prg = progress.NewLoop(msg)
-	log.Info(msg)
-	if err = storage.GenerateTabFiles(rootDir, model.TargetMedias); err != nil {
-		return err
+	// there are no file systems to mount in a directory target
+	if !md.IsDirectoryTarget() {
+		msg := utils.Locale.Get("Writing mount files")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err = storage.GenerateTabFiles(rootDir, md.TargetMedias); err != nil {
+			return err
+		}
+		prg.Success()
+	}
+
+	for _, curr := range md.KernelArgumentWarnings() {
+		log.Warning("Kernel arguments: %s", curr)
 	}
-	prg.Success()
 
-	if model.KernelArguments != nil && len(model.KernelArguments.Add) > 0 {
+	if md.KernelArguments != nil && len(md.KernelArguments.Add) > 0 {
 		cmdlineDir := filepath.Join(rootDir, "etc", "kernel")
 		cmdlineFile := filepath.Join(cmdlineDir, "cmdline")
-		cmdline := strings.Join(model.KernelArguments.Add, " ")
+		cmdline := strings.Join(md.KernelArguments.Add, " ")
 
 		if err = utils.MkdirAll(cmdlineDir, 0755); err != nil {
 			return err
@@ -332,10 +443,10 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		}
 	}
 
-	if model.KernelArguments != nil && len(model.KernelArguments.Remove) > 0 {
+	if md.KernelArguments != nil && len(md.KernelArguments.Remove) > 0 {
 		cmdlineDir := filepath.Join(rootDir, "etc", "kernel", "cmdline-removal.d")
 		cmdlineFile := filepath.Join(cmdlineDir, "clr-installer.conf")
-		cmdline := strings.Join(model.KernelArguments.Remove, " ")
+		cmdline := strings.Join(md.KernelArguments.Remove, " ")
 
 		if err = utils.MkdirAll(cmdlineDir, 0755); err != nil {
 			return err
@@ -346,67 +457,130 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 		}
 	}
 
-	if prg, err = contentInstall(rootDir, version, model, options); err != nil {
-		prg.Failure()
+	if err = checkCancel(); err != nil {
 		return err
 	}
 
-	if err = configureTimezone(rootDir, model); err != nil {
+	if prg, err = contentInstall(rootDir, version, md, options, vars); err != nil {
+		// a failed hook has already reported its own progress failure
+		if prg != nil {
+			prg.Failure()
+		}
+		return err
+	}
+
+	if err = checkCancel(); err != nil {
+		return err
+	}
+
+	if err = configureTimezone(rootDir, md); err != nil {
 		// Just log the error, not setting the timezone is not reason to fail the install
 		log.Error("Error setting timezone: %v", err)
 	}
 
-	if err = configureKeyboard(rootDir, model); err != nil {
+	if err = configureKeyboard(rootDir, md); err != nil {
 		// Just log the error, not setting the keyboard is not reason to fail the install
 		log.Error("Error setting keyboard: %v", err)
 	}
 
-	if err = configureLanguage(rootDir, model); err != nil {
+	if err = configureLanguage(rootDir, md); err != nil {
 		// Just log the error, not setting the language is not reason to fail the install
 		log.Error("Error setting language locale: %v", err)
 	}
 
-	if err = cuser.Apply(rootDir, model.Users); err != nil {
+	if err = cuser.Apply(rootDir, md.Users); err != nil {
 		return err
 	}
 
-	if model.Hostname != "" {
-		if err = hostname.SetTargetHostname(rootDir, model.Hostname); err != nil {
+	if md.Hostname != "" {
+		if err = hostname.SetTargetHostname(rootDir, md.Hostname); err != nil {
 			return err
 		}
 	}
 
-	if model.CopyNetwork {
+	// written after the users are created so they can own the files
+	if len(md.Files) > 0 {
+		msg := utils.Locale.Get("Writing configured files")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err = files.Apply(rootDir, md.Files, vars); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	if md.Services != nil {
+		msg := utils.Locale.Get("Configuring services")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err = md.Services.Apply(rootDir); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	if md.CopyNetwork {
 		if err = network.CopyNetworkInterfaces(rootDir); err != nil {
 			return err
 		}
 	}
 
-	if model.Telemetry.URL != "" {
-		if err = model.Telemetry.CreateTelemetryConf(rootDir); err != nil {
+	if md.Telemetry.URL != "" {
+		if err = md.Telemetry.CreateTelemetryConf(rootDir); err != nil {
 			return err
 		}
 	}
 
-	if err = applyHooks("post-install", vars, model.PostInstall); err != nil {
+	if err = checkCancel(); err != nil {
 		return err
 	}
 
-	msg = utils.Locale.Get("Saving the installation results")
+	if err = applyHooks(model.HookPostInstall, vars, md.PostInstall); err != nil {
+		return err
+	}
+
+	if md.Verify {
+		msg := utils.Locale.Get("Verifying the installation")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		report := verify.Run(rootDir, md, options)
+		verificationReport.Store(report)
+		report.Log()
+		if err = report.Error(); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
+	msg := utils.Locale.Get("Saving the installation results")
 	prg = progress.NewLoop(msg)
 	log.Info(msg)
-	if err = saveInstallResults(rootDir, model); err != nil {
+	if err = saveInstallResults(rootDir, md); err != nil {
 		log.ErrorError(err)
 	}
 	prg.Success()
 
-	if model.MakeISO {
+	if md.MakeISO {
 		log.Info("Generating ISO image")
-		if err = generateISO(rootDir, model, options); err != nil {
+		if err = generateISO(rootDir, md, options); err != nil {
 			log.ErrorError(err)
 		}
 	}
 
+	if md.Container != nil {
+		msg = utils.Locale.Get("Exporting container image")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err = oci.Export(rootDir, md.Container, containerLabels(rootDir, version, md)); err != nil {
+			prg.Failure()
+			return err
+		}
+		prg.Success()
+	}
+
 	msg = utils.Locale.Get("Installation completed")
 	prg = progress.NewLoop(msg)
 	log.Info(msg)
@@ -415,16 +589,29 @@ func Install(rootDir string, model *model.SystemInstall, options args.Args) erro
 	return nil
 }
 
+// hookLogDir returns the directory holding the install hooks output files
+func hookLogDir() string {
+	return filepath.Join(filepath.Dir(log.GetLogFileName()), conf.HookLogDir)
+}
+
 func applyHooks(name string, vars map[string]string, hooks []*model.InstallHook) error {
+	if len(hooks) == 0 {
+		return nil
+	}
+
 	locName := utils.Locale.Get(name)
 	msg := utils.Locale.Get("Running %s hooks", locName)
 	prg := progress.MultiStep(len(hooks), msg)
 	log.Info(msg)
 
 	for idx, curr := range hooks {
-		if err := runInstallHook(vars, curr); err != nil {
-			prg.Failure()
-			return err
+		if err := runInstallHook(vars, name, idx, curr); err != nil {
+			if !curr.ContinueOnError {
+				prg.Failure()
+				return err
+			}
+
+			log.Warning("Ignoring %s hook %d failure: %v", name, idx, err)
 		}
 		prg.Partial(idx)
 	}
@@ -433,22 +620,147 @@ func applyHooks(name string, vars map[string]string, hooks []*model.InstallHook)
 	return nil
 }
 
-func runInstallHook(vars map[string]string, hook *model.InstallHook) error {
+// copyHookScript copies a script file into the target so it can be run by a chrooted
+// hook, the returned path is relative to the chroot dir
+func copyHookScript(rootDir string, script string) (string, error) {
+	content, err := ioutil.ReadFile(script)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Join(rootDir, "tmp"), "clr-installer-hook-")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = tmp.Close()
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	if err = tmp.Chmod(0755); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return filepath.Join("/tmp", filepath.Base(tmp.Name())), nil
+}
+
+func runInstallHook(vars map[string]string, stage string, idx int, hook *model.InstallHook) error {
 	args := []string{}
-	vars["chrooted"] = "0"
+	env := map[string]string{}
+
+	for k, v := range vars {
+		env[k] = v
+	}
+
+	env["chrooted"] = "0"
 
 	if hook.Chroot {
 		args = append(args, []string{"chroot", vars["chrootDir"]}...)
-		vars["chrooted"] = "1"
+		env["chrooted"] = "1"
+
+		if hook.User != "" {
+			args = append(args, []string{"runuser", "-u", hook.User, "--"}...)
+		}
+	}
+
+	for k, v := range hook.Env {
+		env[k] = utils.ExpandVariables(vars, v)
+	}
+
+	if hook.Script != "" {
+		script := hook.Script
+		if !filepath.IsAbs(script) {
+			script = filepath.Join(vars["yamlDir"], script)
+		}
+
+		if hook.Chroot {
+			var err error
+
+			if script, err = copyHookScript(vars["chrootDir"], script); err != nil {
+				return err
+			}
+
+			defer func() {
+				_ = os.Remove(filepath.Join(vars["chrootDir"], script))
+			}()
+		}
+
+		args = append(args, []string{"bash", "-l", script}...)
+	} else {
+		exec := utils.ExpandVariables(env, hook.Cmd)
+		args = append(args, []string{"bash", "-l", "-c", exec}...)
+	}
+
+	logDir := hookLogDir()
+	if err := utils.MkdirAll(logDir, 0755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s-%d", stage, idx)
+	stdoutFile := filepath.Join(logDir, name+".stdout.log")
+	stderrFile := filepath.Join(logDir, name+".stderr.log")
+
+	stdout, err := os.OpenFile(stdoutFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = stdout.Close()
+	}()
+
+	stderr, err := os.OpenFile(stderrFile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = stderr.Close()
+	}()
+
+	log.Debug("Writing %s hook %d output to: %s, %s", stage, idx, stdoutFile, stderrFile)
+
+	timeout := time.Duration(hook.Timeout) * time.Second
+	attempts := hook.Retries + 1
+
+	for attempt := uint(1); ; attempt++ {
+		if err = cmd.RunWithTimeout(stdout, stderr, timeout, env, args...); err == nil {
+			return nil
+		}
+
+		if attempt >= attempts {
+			break
+		}
+
+		log.Warning("%s hook %d failed (attempt %d of %d): %v", stage, idx, attempt, attempts, err)
 	}
 
-	exec := utils.ExpandVariables(vars, hook.Cmd)
-	args = append(args, []string{"bash", "-l", "-c", exec}...)
+	return errors.Errorf("%s hook %d failed, see %s: %v", stage, idx, stderrFile, err)
+}
 
-	if err := cmd.RunAndLogWithEnv(vars, args...); err != nil {
+// archiveHookLogs copies the install hooks output files to saveDir
+func archiveHookLogs(saveDir string) error {
+	entries, err := ioutil.ReadDir(hookLogDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		return errors.Wrap(err)
 	}
 
+	for _, curr := range entries {
+		src := filepath.Join(hookLogDir(), curr.Name())
+		dest := filepath.Join(saveDir, conf.HookLogDir, curr.Name())
+
+		if err = utils.CopyFile(src, dest); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -456,33 +768,32 @@ func runInstallHook(vars map[string]string, hook *model.InstallHook) error {
 // latest one and start adding new bundles
 // for the bootstrap we use the hosts's swupd and the following operations are
 // executed using the target swupd
-func contentInstall(rootDir string, version string, model *model.SystemInstall, options args.Args) (progress.Progress, error) {
+func contentInstall(rootDir string, version string, md *model.SystemInstall,
+	options args.Args, vars map[string]string) (progress.Progress, error) {
 
 	var prg progress.Progress
 
 	sw := swupd.New(rootDir, options)
 
-	bundles := model.Bundles
+	bundles := md.Bundles
 
-	if model.Kernel.Bundle != "none" {
-		bundles = append(bundles, model.Kernel.Bundle)
-	}
+	bundles = append(bundles, md.InstalledKernels()...)
 
-	if model.AutoUpdate {
+	if md.AutoUpdate {
 		version = "latest"
 	}
 
 	msg := utils.Locale.Get("Installing base OS and configured bundles")
 	log.Info(msg)
 	log.Debug("Installing bundles: %s", strings.Join(bundles, ", "))
-	if err := sw.VerifyWithBundles(version, model.SwupdMirror, bundles); err != nil {
+	if err := sw.VerifyWithBundles(version, md.SwupdMirror, bundles); err != nil {
 		// If the swupd command failed to run there wont be a progress
 		// bar, so we need to create a new one that we can fail
 		prg = progress.NewLoop(msg)
 		return prg, err
 	}
 
-	if !model.AutoUpdate {
+	if !md.AutoUpdate {
 		msg := utils.Locale.Get("Disabling automatic updates")
 		prg = progress.NewLoop(msg)
 		log.Info(msg)
@@ -494,27 +805,31 @@ func contentInstall(rootDir string, version string, model *model.SystemInstall,
 		prg.Success()
 	}
 
-	msg = utils.Locale.Get("Installing boot loader")
-	prg = progress.NewLoop(msg)
-	log.Info(msg)
-	args := []string{
-		fmt.Sprintf("%s/usr/bin/clr-boot-manager", rootDir),
-		"update",
-		fmt.Sprintf("--path=%s", rootDir),
+	if err := applyHooks(model.HookPostBundles, vars, md.PostBundles); err != nil {
+		return nil, err
 	}
 
-	err := cmd.RunAndLog(args...)
-	if err != nil {
-		return prg, errors.Wrap(err)
+	// a directory target is never booted directly, there is no boot loader to install
+	if !md.IsDirectoryTarget() {
+		if err := applyHooks(model.HookPreBootloader, vars, md.PreBootloader); err != nil {
+			return nil, err
+		}
+
+		msg = utils.Locale.Get("Installing boot loader")
+		prg = progress.NewLoop(msg)
+		log.Info(msg)
+		if err := installBootloader(rootDir, md); err != nil {
+			return prg, err
+		}
+		prg.Success()
 	}
-	prg.Success()
 
 	// Clean-up State Directory content
 	if options.SwupdStateClean {
 		msg = utils.Locale.Get("Cleaning Swupd state directory")
 		prg = progress.NewLoop(msg)
 		log.Info(msg)
-		if err = sw.CleanUpState(); err != nil {
+		if err := sw.CleanUpState(); err != nil {
 			log.ErrorError(err)
 		}
 		prg.Success()
@@ -523,6 +838,46 @@ func contentInstall(rootDir string, version string, model *model.SystemInstall,
 	return nil, nil
 }
 
+// installBootloader installs the boot loader with the configured backend
+func installBootloader(rootDir string, model *model.SystemInstall) error {
+	backend, err := bootloader.New(model.Bootloader)
+	if err != nil {
+		return err
+	}
+
+	opts := &bootloader.Options{
+		RootDir:    rootDir,
+		Kernels:    model.InstalledKernels(),
+		LegacyBios: model.LegacyBios,
+		Args:       model.KernelArguments,
+	}
+
+	// the other installed kernels are boot entry fallbacks of the default one
+	cfg := &bootloader.Config{}
+	if model.Bootloader != nil {
+		*cfg = *model.Bootloader
+	}
+
+	if cfg.Default == "" && len(opts.Kernels) > 1 {
+		cfg.Default = opts.Kernels[0]
+	}
+
+	for _, curr := range model.TargetMedias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" {
+				opts.RootDevice = ch.GetDeviceFile()
+			}
+		}
+	}
+
+	for _, curr := range opts.Kernels {
+		log.Debug("Boot loader %s %s command line: %s", cfg.GetBackend(), curr,
+			bootloader.Preview(cfg, model.KernelArguments, curr))
+	}
+
+	return backend.Install(cfg, opts)
+}
+
 // ConfigureNetwork applies the model/configured network interfaces
 func ConfigureNetwork(model *model.SystemInstall) error {
 	prg, err := configureNetwork(model)
@@ -538,7 +893,7 @@ func ConfigureNetwork(model *model.SystemInstall) error {
 }
 
 func configureNetwork(model *model.SystemInstall) (progress.Progress, error) {
-	proxy.SetHTTPSProxy(model.HTTPSProxy)
+	proxy.SetHTTPSProxy(model.HTTPSProxyURL())
 
 	if len(model.NetworkInterfaces) > 0 {
 		msg := "Applying network settings"
@@ -680,14 +1035,26 @@ func saveInstallResults(rootDir string, md *model.SystemInstall) error {
 	cleanModel.Users = nil             // Remove User Info
 	cleanModel.Hostname = ""           // Remove user defined hostname
 	cleanModel.HTTPSProxy = ""         // Remove user defined Proxy
+	cleanModel.ProxyCredentials = nil  // Remove the Proxy credentials reference
+	cleanModel.CryptPassphrase = nil   // Remove the passphrase reference
 	cleanModel.SwupdMirror = ""        // Remove user defined Swupd Mirror
 	cleanModel.NetworkInterfaces = nil // Remove Network information
+	cleanModel.Files = nil             // Remove user defined file contents
 
 	// Remove the Serial number from the target media
 	for _, bd := range cleanModel.TargetMedias {
 		bd.Serial = ""
 	}
 
+	// Remove the hooks environment, it may hold credentials
+	for _, stage := range model.HookStages {
+		for _, hook := range cleanModel.Hooks(stage) {
+			if hook != nil {
+				hook.Env = nil
+			}
+		}
+	}
+
 	var payload string
 	hypervisor := md.Telemetry.RunningEnvironment()
 	extendedModel := model.SystemUsage{
@@ -729,6 +1096,21 @@ func saveInstallResults(rootDir string, md *model.SystemInstall) error {
 			errMsgs = append(errMsgs, "Failed to archive log file")
 		}
 
+		if err := archiveHookLogs(saveDir); err != nil {
+			log.Error("Failed to archive hook log files (%v)", err)
+			errMsgs = append(errMsgs, "Failed to archive hook log files")
+		}
+
+		metricsFile := filepath.Join(saveDir, conf.MetricsFile)
+
+		// the ISO image and the container are built from the target afterwards, the
+		// saved report can't account for them
+		metrics.FinishUntil("saving the installation results")
+		if err := metrics.WriteFile(metricsFile); err != nil {
+			log.Error("Failed to write metrics file (%v) %q", err, metricsFile)
+			errMsgs = append(errMsgs, "Failed to write metrics file")
+		}
+
 	} else {
 		log.Info("Skipping archiving of Installation results")
 	}
@@ -750,6 +1132,24 @@ func saveInstallResults(rootDir string, md *model.SystemInstall) error {
 	return nil
 }
 
+// containerLabels returns the default labels of a container image built from the
+// installed system, the version is the one actually installed when it can be read
+func containerLabels(rootDir string, version string, md *model.SystemInstall) map[string]string {
+	osRelease := filepath.Join(rootDir, "usr", "lib", "os-release")
+
+	if installed, err := utils.ReadOSReleaseVersion(osRelease); err == nil {
+		version = installed
+	} else {
+		log.Warning("Could not read the installed version: %v", err)
+	}
+
+	return map[string]string{
+		"org.clearlinux.version":           version,
+		"org.clearlinux.bundles":           strings.Join(md.Bundles, ","),
+		"org.opencontainers.image.version": version,
+	}
+}
+
 // generateISO creates an ISO image from the just created raw image
 func generateISO(rootDir string, md *model.SystemInstall, options args.Args) error {
 	var err error
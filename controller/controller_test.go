@@ -0,0 +1,58 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controller
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+func init() {
+	utils.SetLocale("en_US.UTF-8")
+}
+
+func TestScriptHookArguments(t *testing.T) {
+	dir, err := ioutil.TempDir("", "controller-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	fh, err := log.SetOutputFilename(filepath.Join(dir, conf.LogFile))
+	if err != nil {
+		t.Fatalf("Failed to set the log file: %v", err)
+	}
+	defer func() { _ = fh.Close() }()
+
+	script := filepath.Join(dir, "hook.sh")
+	if err = ioutil.WriteFile(script, []byte("echo \"$# $HOOK_VAR\"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write the hook script: %v", err)
+	}
+
+	vars := map[string]string{"chrootDir": dir, "yamlDir": dir}
+	hook := &model.InstallHook{Script: "hook.sh", Env: map[string]string{"HOOK_VAR": "value"}}
+
+	if err = runInstallHook(vars, model.HookPostInstall, 0, hook); err != nil {
+		t.Fatalf("The script hook should succeed: %v", err)
+	}
+
+	output, err := ioutil.ReadFile(filepath.Join(hookLogDir(), model.HookPostInstall+"-0.stdout.log"))
+	if err != nil {
+		t.Fatalf("Failed to read the hook output: %v", err)
+	}
+
+	// the hook env is only passed through the environment, never as the script arguments
+	if result := strings.TrimSpace(string(output)); result != "0 value" {
+		t.Fatalf("The script hook should get no arguments and its env, got: %q", result)
+	}
+}
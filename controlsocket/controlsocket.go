@@ -0,0 +1,596 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controlsocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/events"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+const (
+	// StateIdle is the state before any install is started
+	StateIdle = "idle"
+
+	// StateRunning is the state while an install is in progress
+	StateRunning = "running"
+
+	// StateSuccess is the state after an install has successfully finished
+	StateSuccess = "success"
+
+	// StateFailure is the state after an install has failed
+	StateFailure = "failure"
+
+	// StateCancelled is the state after an install has been cancelled
+	StateCancelled = "cancelled"
+
+	// maxBodySize is the max accepted request body size
+	maxBodySize = 1 << 20
+
+	// shutdownTimeout is how long we wait the pending requests before quitting
+	shutdownTimeout = 5 * time.Second
+)
+
+// ControlSocket is the frontend implementation serving a HTTP/JSON API on an unix
+// socket, it allows an external program to drive and observe an install
+type ControlSocket struct {
+	mutex       sync.Mutex
+	md          *model.SystemInstall
+	snapshot    interface{}
+	rootDir     string
+	options     args.Args
+	broadcaster *events.Broadcaster
+	state       string
+	instError   error
+	reboot      bool
+	done        chan struct{}
+	quitOnce    sync.Once
+}
+
+// Status is the response of the status endpoint
+type Status struct {
+	State  string `json:"state"`
+	Error  string `json:"error,omitempty"`
+	Reboot bool   `json:"reboot"`
+}
+
+// ValidationResult is the response of the validate endpoint
+type ValidationResult struct {
+	Valid  bool            `json:"valid"`
+	Errors []*events.Event `json:"errors"`
+}
+
+type installRequest struct {
+	Passphrase string `json:"passphrase"`
+}
+
+type quitRequest struct {
+	Reboot bool `json:"reboot"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// New creates a new instance of ControlSocket frontend implementation
+func New() *ControlSocket {
+	return &ControlSocket{
+		broadcaster: events.NewBroadcaster(),
+		state:       StateIdle,
+		done:        make(chan struct{}),
+	}
+}
+
+// MustRun is part of the Frontend implementation and tells the core implementation that this
+// frontend wants or should be executed
+func (cs *ControlSocket) MustRun(args *args.Args) bool {
+	return args.ControlSocket != ""
+}
+
+// Run is part of the Frontend implementation and is the actual entry point for the
+// control socket frontend, it serves the API until a client asks it to quit
+func (cs *ControlSocket) Run(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
+	cs.md = md
+	cs.rootDir = rootDir
+	cs.options = options
+
+	// an API client drives a whole disk install, same as the mass installer
+	cs.md.InstallSelected = storage.InstallTarget{WholeDisk: true}
+
+	// remove a stale socket left behind by a previous execution
+	if err := os.Remove(options.ControlSocket); err != nil && !os.IsNotExist(err) {
+		return false, errors.Wrap(err)
+	}
+
+	listener, err := net.Listen("unix", options.ControlSocket)
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = os.Remove(options.ControlSocket)
+	}()
+
+	// the API allows to wipe disks, only the owner (root) may use it
+	if err = os.Chmod(options.ControlSocket, 0600); err != nil {
+		_ = listener.Close()
+		return false, errors.Wrap(err)
+	}
+
+	progress.Set(events.NewProgress(cs.broadcaster))
+	log.SetHookFunc(events.LogHook(cs.broadcaster, options.OutputLogLevel))
+	defer log.SetHookFunc(nil)
+
+	srv := &http.Server{Handler: cs.handler()}
+	srvErr := make(chan error, 1)
+
+	go func() {
+		srvErr <- srv.Serve(listener)
+	}()
+
+	log.Info("Control socket listening on: %s", options.ControlSocket)
+
+	select {
+	case <-cs.done:
+	case err = <-srvErr:
+		return false, errors.Wrap(err)
+	}
+
+	// let the in flight responses, i.e the quit one, to be delivered
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err = srv.Shutdown(ctx); err != nil {
+		_ = srv.Close()
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	return cs.reboot, cs.instError
+}
+
+func (cs *ControlSocket) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/model", cs.handleModel)
+	mux.HandleFunc("/v1/devices", cs.handleDevices)
+	mux.HandleFunc("/v1/validate", cs.handleValidate)
+	mux.HandleFunc("/v1/install", cs.handleInstall)
+	mux.HandleFunc("/v1/cancel", cs.handleCancel)
+	mux.HandleFunc("/v1/status", cs.handleStatus)
+	mux.HandleFunc("/v1/events", cs.handleEvents)
+	mux.HandleFunc("/v1/quit", cs.handleQuit)
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		status = http.StatusInternalServerError
+		data = []byte(fmt.Sprintf("{\"error\":%q}", err.Error()))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(append(data, '\n'))
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	msg := err.Error()
+
+	if te, ok := err.(errors.TraceableError); ok {
+		msg = te.What
+	}
+
+	writeJSON(w, status, &errorResponse{Error: msg})
+}
+
+func allowMethods(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, curr := range methods {
+		if r.Method == curr {
+			return true
+		}
+	}
+
+	writeError(w, http.StatusMethodNotAllowed, errors.Errorf("Method not allowed: %s", r.Method))
+	return false
+}
+
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	return ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+}
+
+// toJSONValue converts the generic maps produced by the yaml decoder, which are
+// keyed by interface{}, into maps the json encoder is able to handle
+func toJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		result := map[string]interface{}{}
+		for key, val := range v {
+			result[fmt.Sprintf("%v", key)] = toJSONValue(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = toJSONValue(val)
+		}
+		return result
+	}
+
+	return value
+}
+
+// yamlToJSON produces a json compatible representation of v based on its yaml
+// marshalling, this way the API uses the same names as the configuration file
+func yamlToJSON(v interface{}) (interface{}, error) {
+	data, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	var generic interface{}
+	if err = yaml.Unmarshal(data, &generic); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return toJSONValue(generic), nil
+}
+
+// isRunning must be called with cs.mutex held
+func (cs *ControlSocket) isRunning() bool {
+	return cs.state == StateRunning
+}
+
+func (cs *ControlSocket) handleModel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet, http.MethodPut, http.MethodPatch) {
+		return
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if r.Method != http.MethodGet {
+		if cs.isRunning() {
+			writeError(w, http.StatusConflict, errors.Errorf("Can not change the model while installing"))
+			return
+		}
+
+		body, err := readBody(w, r)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+
+		if r.Method == http.MethodPut {
+			err = cs.loadModel(body)
+		} else {
+			err = cs.patchModel(body)
+		}
+
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	// the install changes the model as it goes, the model it started with is served instead
+	if cs.isRunning() {
+		writeJSON(w, http.StatusOK, cs.snapshot)
+		return
+	}
+
+	result, err := yamlToJSON(cs.md)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// loadModel replaces the current model with the one described by data, a json
+// or yaml document with the same syntax of the configuration file. Its relative paths
+// are resolved from the configuration file directory, as the ones of patchModel.
+func (cs *ControlSocket) loadModel(data []byte) error {
+	loaded, err := model.LoadData(data, filepath.Dir(cs.options.ConfigFile), cs.options)
+	if err != nil {
+		return err
+	}
+
+	loaded.InstallSelected = cs.md.InstallSelected
+	if loaded.CryptPass == "" {
+		loaded.CryptPass = cs.md.CryptPass
+	}
+	*cs.md = *loaded
+
+	return nil
+}
+
+// patchModel replaces the top level model entries present in data, a json or
+// yaml document with the same syntax of the configuration file. The model is only
+// changed if the whole patch is valid.
+func (cs *ControlSocket) patchModel(data []byte) error {
+	patched, err := cs.md.Patch(data, filepath.Dir(cs.options.ConfigFile))
+	if err != nil {
+		return err
+	}
+
+	*cs.md = *patched
+	return nil
+}
+
+func (cs *ControlSocket) handleDevices(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	var bds []*storage.BlockDevice
+	var err error
+
+	if r.URL.Query().Get("rescan") != "" {
+		bds, err = storage.RescanBlockDevices(nil)
+	} else {
+		bds, err = storage.ListAvailableBlockDevices(nil)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	result, err := yamlToJSON(bds)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (cs *ControlSocket) handleValidate(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	cs.mutex.Lock()
+	if cs.isRunning() {
+		cs.mutex.Unlock()
+		writeError(w, http.StatusConflict, errors.Errorf("Can not validate the model while installing"))
+		return
+	}
+	err := cs.md.Validate()
+	cs.mutex.Unlock()
+
+	result := &ValidationResult{Valid: err == nil, Errors: []*events.Event{}}
+
+	if err != nil {
+		ev := events.NewValidation(err)
+		if ev == nil {
+			ev = &events.Event{Type: events.TypeValidation, Message: err.Error()}
+		}
+
+		result.Errors = append(result.Errors, ev)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (cs *ControlSocket) handleInstall(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	req := &installRequest{}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.isRunning() {
+		writeError(w, http.StatusConflict, errors.Errorf("An install is already running"))
+		return
+	}
+
+	if req.Passphrase != "" {
+		cs.md.CryptPass = req.Passphrase
+	}
+
+	// there is no terminal to prompt for the passphrase
+	if cs.md.EncryptionRequiresPassphrase() && cs.md.CryptPass == "" {
+		writeError(w, http.StatusBadRequest, errors.Errorf("Encryption requires a passphrase"))
+		return
+	}
+
+	snapshot, err := yamlToJSON(cs.md)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	cs.state = StateRunning
+	cs.snapshot = snapshot
+	cs.instError = nil
+	cs.reboot = false
+
+	go cs.install()
+
+	writeJSON(w, http.StatusAccepted, cs.status())
+}
+
+func (cs *ControlSocket) install() {
+	log.Debug("Starting install")
+
+	instError := controller.Install(cs.rootDir, cs.md, cs.options)
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	cs.instError = instError
+	cs.snapshot = nil
+
+	switch {
+	case instError == nil:
+		cs.state = StateSuccess
+		cs.reboot = cs.md.PostReboot
+	case controller.IsCancelRequested():
+		cs.state = StateCancelled
+	default:
+		cs.state = StateFailure
+	}
+
+	if ev := events.NewValidation(instError); ev != nil {
+		cs.broadcaster.Emit(ev)
+	}
+
+	cs.broadcaster.Emit(events.NewResult(instError, cs.reboot, controller.VerificationReport()))
+}
+
+func (cs *ControlSocket) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if !cs.isRunning() {
+		writeError(w, http.StatusConflict, errors.Errorf("No install is running"))
+		return
+	}
+
+	controller.Cancel()
+	writeJSON(w, http.StatusAccepted, cs.status())
+}
+
+// status must be called with cs.mutex held
+func (cs *ControlSocket) status() *Status {
+	result := &Status{State: cs.state, Reboot: cs.reboot}
+
+	if cs.instError != nil {
+		result.Error = cs.instError.Error()
+
+		if te, ok := cs.instError.(errors.TraceableError); ok {
+			result.Error = te.What
+		}
+	}
+
+	return result
+}
+
+func (cs *ControlSocket) handleStatus(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	writeJSON(w, http.StatusOK, cs.status())
+}
+
+// handleEvents streams the progress, log and result events as one json object per line
+func (cs *ControlSocket) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodGet) {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, errors.Errorf("Streaming not supported"))
+		return
+	}
+
+	ch := cs.broadcaster.Subscribe()
+	defer cs.broadcaster.Unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	writer := events.NewWriter(w)
+
+	for {
+		select {
+		case ev := <-ch:
+			writer.Emit(ev)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		case <-cs.done:
+			return
+		}
+	}
+}
+
+func (cs *ControlSocket) handleQuit(w http.ResponseWriter, r *http.Request) {
+	if !allowMethods(w, r, http.MethodPost) {
+		return
+	}
+
+	req := &quitRequest{}
+
+	body, err := readBody(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, req); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	if cs.isRunning() {
+		writeError(w, http.StatusConflict, errors.Errorf("Can not quit while installing"))
+		return
+	}
+
+	// the client has the last word on rebooting, but only a successful install may reboot
+	cs.reboot = req.Reboot && cs.state == StateSuccess
+
+	writeJSON(w, http.StatusOK, cs.status())
+
+	cs.quitOnce.Do(func() {
+		close(cs.done)
+	})
+}
@@ -0,0 +1,223 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package controlsocket
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/timezone"
+)
+
+func newTestControlSocket() *ControlSocket {
+	cs := New()
+	cs.md = &model.SystemInstall{
+		Timezone: &timezone.TimeZone{Code: timezone.DefaultTimezone},
+	}
+
+	return cs
+}
+
+func doRequest(t *testing.T, cs *ControlSocket, method string, path string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+
+	cs.handler().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestMustRun(t *testing.T) {
+	cs := New()
+
+	if cs.MustRun(&args.Args{}) {
+		t.Fatal("MustRun() should be false without a control socket")
+	}
+
+	if !cs.MustRun(&args.Args{ControlSocket: "/run/clr-installer.sock"}) {
+		t.Fatal("MustRun() should be true with a control socket")
+	}
+}
+
+func TestModelGetAndPatch(t *testing.T) {
+	cs := newTestControlSocket()
+
+	rec := doRequest(t, cs, http.MethodPatch, "/v1/model", `{"hostname": "clr-test", "bundles": ["vim"]}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected PATCH status: %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if cs.md.Hostname != "clr-test" || len(cs.md.Bundles) != 1 {
+		t.Fatalf("Model was not patched: %+v", cs.md)
+	}
+
+	if cs.md.Timezone == nil || cs.md.Timezone.Code != timezone.DefaultTimezone {
+		t.Fatal("Patching should preserve the entries not present in the patch")
+	}
+
+	rec = doRequest(t, cs, http.MethodGet, "/v1/model", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected GET status: %d", rec.Code)
+	}
+
+	result := map[string]interface{}{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+		t.Fatalf("Failed to decode model: %v", err)
+	}
+
+	if result["hostname"] != "clr-test" {
+		t.Fatalf("Model should use the configuration file names: %v", result)
+	}
+
+	rec = doRequest(t, cs, http.MethodPatch, "/v1/model", `{"bundles": "not a list"`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Invalid patch should be rejected, got: %d", rec.Code)
+	}
+
+	if len(cs.md.Bundles) != 1 || cs.md.Bundles[0] != "vim" {
+		t.Fatal("A rejected patch must not change the model")
+	}
+
+	for _, curr := range []string{
+		`{"bundles": ["emacs"], "hostnam": "clr"}`,
+		`{"bundles": ["emacs"], "files": [{"path": "etc/motd"}]}`,
+		`{"bundles": ["emacs"], "timezone": null}`,
+	} {
+		rec = doRequest(t, cs, http.MethodPatch, "/v1/model", curr)
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("%s: the patch should be rejected, got: %d", curr, rec.Code)
+		}
+
+		if len(cs.md.Bundles) != 1 || cs.md.Bundles[0] != "vim" || cs.md.Timezone == nil {
+			t.Fatalf("%s: a rejected patch must not change the model", curr)
+		}
+	}
+}
+
+func TestModelPutRelativePaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "controlsocket-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	for name, content := range map[string]string{
+		"luks":      "luks passphrase\n",
+		"base.yaml": "hostname: clr-base\n",
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	cs := newTestControlSocket()
+	cs.options.ConfigFile = filepath.Join(dir, "config.yaml")
+
+	rec := doRequest(t, cs, http.MethodPut, "/v1/model",
+		`{"extends": ["base.yaml"], "cryptPassphrase": {"fromFile": "luks"}}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected PUT status: %d: %s", rec.Code, rec.Body.String())
+	}
+
+	if cs.md.CryptPass != "luks passphrase" {
+		t.Fatalf("The relative secret file should be read from the configuration directory, got: %q",
+			cs.md.CryptPass)
+	}
+
+	if cs.md.Hostname != "clr-base" {
+		t.Fatalf("The extended file should be read from the configuration directory, got: %q",
+			cs.md.Hostname)
+	}
+}
+
+func TestModelLockedWhileRunning(t *testing.T) {
+	cs := newTestControlSocket()
+	cs.state = StateRunning
+
+	rec := doRequest(t, cs, http.MethodPatch, "/v1/model", `{"hostname": "clr-test"}`)
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Model changes should be rejected while installing, got: %d", rec.Code)
+	}
+
+	rec = doRequest(t, cs, http.MethodPost, "/v1/install", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("A second install should be rejected, got: %d", rec.Code)
+	}
+
+	rec = doRequest(t, cs, http.MethodPost, "/v1/quit", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Quitting should be rejected while installing, got: %d", rec.Code)
+	}
+
+	rec = doRequest(t, cs, http.MethodPost, "/v1/validate", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Validating should be rejected while installing, got: %d", rec.Code)
+	}
+
+	cs.snapshot = map[string]interface{}{"hostname": "clr-snapshot"}
+	cs.md.Hostname = "clr-installing"
+
+	rec = doRequest(t, cs, http.MethodGet, "/v1/model", "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "clr-snapshot") {
+		t.Fatalf("The model the install started with should be served, got: %d %s", rec.Code,
+			rec.Body.String())
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cs := newTestControlSocket()
+
+	rec := doRequest(t, cs, http.MethodPost, "/v1/validate", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected validate status: %d", rec.Code)
+	}
+
+	result := &ValidationResult{}
+	if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+		t.Fatalf("Failed to decode validation result: %v", err)
+	}
+
+	if result.Valid || len(result.Errors) != 1 || result.Errors[0].Field != "targetMedia" {
+		t.Fatalf("An empty model should fail the targetMedia validation: %+v", result)
+	}
+
+	rec = doRequest(t, cs, http.MethodGet, "/v1/validate", "")
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("Unexpected validate status for GET: %d", rec.Code)
+	}
+}
+
+func TestCancelAndQuit(t *testing.T) {
+	cs := newTestControlSocket()
+
+	rec := doRequest(t, cs, http.MethodPost, "/v1/cancel", "")
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("Cancel without a running install should be rejected, got: %d", rec.Code)
+	}
+
+	cs.state = StateFailure
+
+	rec = doRequest(t, cs, http.MethodPost, "/v1/quit", `{"reboot": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Unexpected quit status: %d", rec.Code)
+	}
+
+	if cs.reboot {
+		t.Fatal("A failed install must not reboot")
+	}
+
+	select {
+	case <-cs.done:
+	default:
+		t.Fatal("Quit should release the frontend")
+	}
+}
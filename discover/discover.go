@@ -0,0 +1,238 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package discover
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/trust"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// MediaLabel is the file system label of the unattended configuration media
+	MediaLabel = "CLR-INSTALL"
+
+	// DHCPOption is the site specific DHCP option carrying the unattended configuration url
+	DHCPOption = 224
+)
+
+// the host lookups, replaced by the tests
+var (
+	listBlockDevices = storage.ListBlockDevices
+	fetchConfigFile  = trust.FetchSignedConfigFile
+	leaseDirs        = []string{"/run/systemd/netif/leases", "/var/lib/NetworkManager"}
+	mountMedia       = func(device string, dir string) error {
+		return cmd.RunAndLog("mount", "-o", "ro", device, dir)
+	}
+	umountMedia = func(dir string) error {
+		return cmd.RunAndLog("umount", dir)
+	}
+)
+
+// Config is an unattended configuration found on the host
+type Config struct {
+	// Path is the local configuration file
+	Path string
+
+	// Downloaded is true if Path is a temporary file to remove once loaded
+	Downloaded bool
+
+	// Source describes where the configuration was found
+	Source string
+
+	// mountDir is the configuration media mount point, if any
+	mountDir string
+}
+
+// Close releases the configuration media, if any
+func (cfg *Config) Close() {
+	if cfg.mountDir == "" {
+		return
+	}
+
+	if err := umountMedia(cfg.mountDir); err != nil {
+		log.Warning("Could not umount the configuration media %s: %v", cfg.mountDir, err)
+		return
+	}
+
+	_ = os.Remove(cfg.mountDir)
+	cfg.mountDir = ""
+}
+
+// Find looks an unattended configuration up, in order: the clr-installer.yaml file of a
+// removable media labelled CLR-INSTALL and the url of the DHCP option 224 of the network
+// leases. Anyone on the network can answer DHCP, so the url's configuration must be signed
+// with a trusted key whatever the policy says. It returns nil if none is found.
+func Find() (*Config, error) {
+	log.Info("Looking for an unattended configuration: %s labelled media, then DHCP option %d",
+		MediaLabel, DHCPOption)
+
+	cfg, err := findMedia()
+	if err != nil || cfg != nil {
+		return cfg, err
+	}
+
+	if cfg, err = findDHCP(); err != nil || cfg != nil {
+		return cfg, err
+	}
+
+	log.Info("No unattended configuration found")
+	return nil, nil
+}
+
+// findMedia mounts the removable media labelled CLR-INSTALL, the media stays mounted until
+// the configuration is closed so the files it extends and includes are available
+func findMedia() (*Config, error) {
+	bds, err := listBlockDevices(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, curr := range labelledDevices(bds, false) {
+		device := filepath.Join("/dev", curr.Name)
+		log.Info("Found the %s labelled media: %s", MediaLabel, device)
+
+		dir, err := ioutil.TempDir("", "clr-installer-media-")
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		if err = mountMedia(device, dir); err != nil {
+			log.Warning("Could not mount %s: %v", device, err)
+			_ = os.Remove(dir)
+			continue
+		}
+
+		cfg := &Config{Path: filepath.Join(dir, conf.ConfigFile), Source: device, mountDir: dir}
+		if ok, _ := utils.FileExists(cfg.Path); !ok {
+			log.Warning("No %s file on %s", conf.ConfigFile, device)
+			cfg.Close()
+			continue
+		}
+
+		log.Info("Using the configuration of the %s media", device)
+		return cfg, nil
+	}
+
+	return nil, nil
+}
+
+// labelledDevices returns the removable devices, or partitions of removable devices,
+// labelled CLR-INSTALL
+func labelledDevices(bds []*storage.BlockDevice, removable bool) []*storage.BlockDevice {
+	result := []*storage.BlockDevice{}
+
+	for _, curr := range bds {
+		rm := removable || curr.RemovableDevice
+
+		if rm && curr.Label == MediaLabel {
+			result = append(result, curr)
+		}
+
+		result = append(result, labelledDevices(curr.Children, rm)...)
+	}
+
+	return result
+}
+
+// findDHCP fetches the url of the first DHCP lease with the configuration option
+func findDHCP() (*Config, error) {
+	url, lease := leaseURL()
+	if url == "" {
+		return nil, nil
+	}
+
+	log.Info("Found the configuration url %s in the DHCP lease %s", url, lease)
+
+	desc, err := trust.ParseDescriptor(url)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := fetchConfigFile(desc, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Config{Path: path, Downloaded: true, Source: url}, nil
+}
+
+// leaseURL returns the DHCP option of the systemd-networkd or NetworkManager internal
+// client lease files, the option values are hex encoded as OPTION_<n>=<hex>
+func leaseURL() (string, string) {
+	key := fmt.Sprintf("OPTION_%d=", DHCPOption)
+
+	for _, dir := range leaseDirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.Warning("Could not read the DHCP leases of %s: %v", dir, err)
+			}
+			continue
+		}
+
+		names := []string{}
+		for _, curr := range files {
+			if !curr.IsDir() {
+				names = append(names, curr.Name())
+			}
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			path := filepath.Join(dir, name)
+
+			value, err := leaseValue(path, key)
+			if err != nil {
+				log.Warning("Could not read the DHCP lease %s: %v", path, err)
+				continue
+			}
+
+			if value == "" {
+				continue
+			}
+
+			url, err := hex.DecodeString(value)
+			if err != nil {
+				log.Warning("Invalid DHCP option %d in %s: %v", DHCPOption, path, err)
+				continue
+			}
+
+			return strings.TrimRight(string(url), "\x00"), path
+		}
+	}
+
+	return "", ""
+}
+
+func leaseValue(path string, key string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); strings.HasPrefix(line, key) {
+			return strings.TrimPrefix(line, key), nil
+		}
+	}
+
+	return "", scanner.Err()
+}
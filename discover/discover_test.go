@@ -0,0 +1,155 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package discover
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/trust"
+)
+
+// setupDiscover replaces the host lookups, the media are served from the directories
+// named after the devices and the fetched urls are recorded
+func setupDiscover(t *testing.T, bds []*storage.BlockDevice) (string, *[]string, func()) {
+	dir, err := ioutil.TempDir("", "discover-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+
+	fetched := []string{}
+	savedList, savedFetch, savedDirs := listBlockDevices, fetchConfigFile, leaseDirs
+	savedMount, savedUmount := mountMedia, umountMedia
+
+	listBlockDevices = func([]*storage.BlockDevice) ([]*storage.BlockDevice, error) { return bds, nil }
+	fetchConfigFile = func(desc *trust.Descriptor, keys []string) (string, error) {
+		fetched = append(fetched, desc.URL)
+		return filepath.Join(dir, "fetched.yaml"), nil
+	}
+	leaseDirs = []string{filepath.Join(dir, "networkd"), filepath.Join(dir, "nm")}
+	mountMedia = func(device string, mountDir string) error {
+		src := filepath.Join(dir, filepath.Base(device))
+
+		files, err := ioutil.ReadDir(src)
+		for _, curr := range files {
+			if err = os.Symlink(filepath.Join(src, curr.Name()), filepath.Join(mountDir, curr.Name())); err != nil {
+				break
+			}
+		}
+		return err
+	}
+	umountMedia = func(mountDir string) error {
+		files, err := ioutil.ReadDir(mountDir)
+		for _, curr := range files {
+			if err = os.Remove(filepath.Join(mountDir, curr.Name())); err != nil {
+				break
+			}
+		}
+		return err
+	}
+
+	return dir, &fetched, func() {
+		listBlockDevices, fetchConfigFile, leaseDirs = savedList, savedFetch, savedDirs
+		mountMedia, umountMedia = savedMount, savedUmount
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create the %s directory: %v", path, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+}
+
+func TestLabelledDevices(t *testing.T) {
+	bds := []*storage.BlockDevice{
+		{Name: "sda", Children: []*storage.BlockDevice{{Name: "sda1", Label: MediaLabel}}},
+		{Name: "sdb", RemovableDevice: true, Children: []*storage.BlockDevice{
+			{Name: "sdb1", Label: "DATA"},
+			{Name: "sdb2", Label: MediaLabel},
+		}},
+		{Name: "sdc", RemovableDevice: true, Label: MediaLabel},
+	}
+
+	result := labelledDevices(bds, false)
+	if len(result) != 2 || result[0].Name != "sdb2" || result[1].Name != "sdc" {
+		t.Fatalf("Expected the removable sdb2 and sdc devices, got: %v", result)
+	}
+}
+
+func TestFindMedia(t *testing.T) {
+	bds := []*storage.BlockDevice{
+		{Name: "sdb", RemovableDevice: true, Label: MediaLabel},
+		{Name: "sdc", RemovableDevice: true, Label: MediaLabel},
+	}
+
+	dir, fetched, cleanup := setupDiscover(t, bds)
+	defer cleanup()
+
+	// the first media has no configuration file
+	writeFile(t, filepath.Join(dir, "sdb", "README"), "")
+	writeFile(t, filepath.Join(dir, "sdc", conf.ConfigFile), "keyboard: us\n")
+	writeFile(t, filepath.Join(dir, "networkd", "2"), "OPTION_224="+hex.EncodeToString([]byte("http://h/c.yaml"))+"\n")
+
+	cfg, err := Find()
+	if err != nil || cfg == nil {
+		t.Fatalf("Expected the media configuration, got: %v %v", cfg, err)
+	}
+
+	if cfg.Source != "/dev/sdc" || cfg.Downloaded || filepath.Base(cfg.Path) != conf.ConfigFile {
+		t.Fatalf("Unexpected configuration: %+v", cfg)
+	}
+
+	if len(*fetched) != 0 {
+		t.Fatalf("The media should be looked up before the DHCP leases, fetched: %v", *fetched)
+	}
+
+	content, err := ioutil.ReadFile(cfg.Path)
+	if err != nil || string(content) != "keyboard: us\n" {
+		t.Fatalf("Expected the media configuration content, got: %q %v", content, err)
+	}
+
+	cfg.Close()
+	if _, err = os.Stat(filepath.Dir(cfg.Path)); !os.IsNotExist(err) {
+		t.Fatal("The media should be released once the configuration is closed")
+	}
+}
+
+func TestFindDHCP(t *testing.T) {
+	dir, fetched, cleanup := setupDiscover(t, nil)
+	defer cleanup()
+
+	if cfg, err := Find(); err != nil || cfg != nil {
+		t.Fatalf("No configuration should be found, got: %v %v", cfg, err)
+	}
+
+	url := "https://h/c.yaml"
+	writeFile(t, filepath.Join(dir, "networkd", "2"), "ADDRESS=10.0.0.2\nOPTION_225=00\n")
+	writeFile(t, filepath.Join(dir, "nm", "internal-eth0.lease"),
+		"ADDRESS=10.0.0.3\nOPTION_224="+hex.EncodeToString([]byte(url+"\x00"))+"\n")
+
+	cfg, err := Find()
+	if err != nil || cfg == nil {
+		t.Fatalf("Expected the DHCP configuration, got: %v %v", cfg, err)
+	}
+
+	if cfg.Source != url || !cfg.Downloaded || len(*fetched) != 1 || (*fetched)[0] != url {
+		t.Fatalf("Unexpected configuration: %+v, fetched: %v", cfg, *fetched)
+	}
+
+	writeFile(t, filepath.Join(dir, "networkd", "2"), "OPTION_224=zz\n")
+	if cfg, err = Find(); err != nil || cfg == nil || cfg.Source != url {
+		t.Fatalf("An invalid option should be skipped, got: %v %v", cfg, err)
+	}
+}
@@ -26,9 +26,17 @@ type TraceableError struct {
 // a nicely formatted and user friendly error message (the What attribute) and keep
 // returning a non zero exit code.
 // Consider this error as a user error, not an internal malfunctioning.
+// Field is the path of the offending configuration field, i.e: targetMedia[0].children[1],
+// if the error is not related to a specific field it's left empty.
+// Line is the configuration file line of the offending field, 0 if unknown.
+// File is the configuration file of the offending field, when it is one of several
+// composed configuration files, empty otherwise.
 type ValidationError struct {
-	When time.Time
-	What string
+	When  time.Time
+	What  string
+	Field string
+	Line  int
+	File  string
 }
 
 func getTraceIdx(idx int) (string, string, int) {
@@ -92,7 +100,21 @@ func Wrap(err error) error {
 }
 
 func (ve ValidationError) Error() string {
-	return ve.What
+	result := ve.What
+
+	if ve.Field != "" {
+		result = fmt.Sprintf("%s: %s", ve.Field, ve.What)
+	}
+
+	if ve.Line > 0 {
+		result = fmt.Sprintf("line %d: %s", ve.Line, result)
+	}
+
+	if ve.File != "" {
+		result = fmt.Sprintf("%s: %s", ve.File, result)
+	}
+
+	return result
 }
 
 // ValidationErrorf formats a new ValidationError
@@ -102,6 +124,15 @@ func ValidationErrorf(format string, a ...interface{}) error {
 	}
 }
 
+// FieldValidationErrorf formats a new ValidationError for the configuration field
+// pointed by the field path
+func FieldValidationErrorf(field string, format string, a ...interface{}) error {
+	return ValidationError{
+		What:  fmt.Sprintf(format, a...),
+		Field: field,
+	}
+}
+
 // IsValidationError returns true if err is a ValidationError
 // returns false otherwise
 func IsValidationError(err error) bool {
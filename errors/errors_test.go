@@ -65,3 +65,39 @@ func TestValidationError(t *testing.T) {
 		t.Fatal("IsValidationError() should return false for a TraceableError")
 	}
 }
+
+func TestFieldValidationError(t *testing.T) {
+	fe := FieldValidationErrorf("targetMedia[0]", "Could not find a %s partition", "root")
+
+	if !IsValidationError(fe) {
+		t.Fatal("IsValidationError() should report true")
+	}
+
+	ve := fe.(ValidationError)
+	if ve.Field != "targetMedia[0]" || ve.What != "Could not find a root partition" {
+		t.Fatalf("Wrong field validation error content: %+v", ve)
+	}
+
+	if fe.Error() != "targetMedia[0]: Could not find a root partition" {
+		t.Fatalf("Wrong field validation error message: %s", fe.Error())
+	}
+}
+
+func TestLineValidationError(t *testing.T) {
+	ve := FieldValidationErrorf("targetMedia[0].children", "Could not find a root partition").(ValidationError)
+	ve.Line = 12
+
+	if ve.Error() != "line 12: targetMedia[0].children: Could not find a root partition" {
+		t.Fatalf("Wrong located validation error message: %s", ve.Error())
+	}
+}
+
+func TestFileValidationError(t *testing.T) {
+	ve := FieldValidationErrorf("bundles", "Unknown field: bundels").(ValidationError)
+	ve.Line = 3
+	ve.File = "site.yaml"
+
+	if ve.Error() != "site.yaml: line 3: bundles: Unknown field: bundels" {
+		t.Fatalf("Wrong file validation error message: %s", ve.Error())
+	}
+}
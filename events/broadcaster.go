@@ -0,0 +1,69 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// subscriberQueueSize is the number of events buffered per subscriber, events
+// sent to a subscriber with a full queue are dropped
+const subscriberQueueSize = 256
+
+// Broadcaster is an Emitter implementation which fans out every event to all
+// of its subscribers
+type Broadcaster struct {
+	mutex       sync.Mutex
+	subscribers map[chan *Event]bool
+}
+
+// NewBroadcaster creates a new Broadcaster with no subscribers
+func NewBroadcaster() *Broadcaster {
+	return &Broadcaster{subscribers: map[chan *Event]bool{}}
+}
+
+// Subscribe registers a new subscriber, the returned channel receives every
+// event emitted after the subscription
+func (bc *Broadcaster) Subscribe() chan *Event {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	ch := make(chan *Event, subscriberQueueSize)
+	bc.subscribers[ch] = true
+
+	return ch
+}
+
+// Unsubscribe removes a subscriber previously registered with Subscribe and
+// closes its channel
+func (bc *Broadcaster) Unsubscribe(ch chan *Event) {
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	if !bc.subscribers[ch] {
+		return
+	}
+
+	delete(bc.subscribers, ch)
+	close(ch)
+}
+
+// Emit sends ev to all the subscribers, a slow subscriber never blocks the emitter
+func (bc *Broadcaster) Emit(ev *Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	bc.mutex.Lock()
+	defer bc.mutex.Unlock()
+
+	for ch := range bc.subscribers {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
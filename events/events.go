@@ -0,0 +1,189 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package events
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/verify"
+)
+
+const (
+	// TypeDesc is the event type emitted when a new progress unit is started
+	TypeDesc = "desc"
+
+	// TypePartial is the event type emitted for each partial step of a progress unit
+	TypePartial = "partial"
+
+	// TypeSuccess is the event type emitted when a progress unit completes successfully
+	TypeSuccess = "success"
+
+	// TypeFailure is the event type emitted when a progress unit fails to complete
+	TypeFailure = "failure"
+
+	// TypeLog is the event type emitted for a log message
+	TypeLog = "log"
+
+	// TypeMessage is the event type emitted for an informational message to the user
+	TypeMessage = "message"
+
+	// TypeValidation is the event type emitted for a configuration validation error
+	TypeValidation = "validation"
+
+	// TypeResult is the event type emitted when the install is finished
+	TypeResult = "result"
+)
+
+// Event is a single machine readable installer event, only the fields
+// relevant to a given event type are set
+type Event struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Desc    string    `json:"desc,omitempty"`
+	Total   int       `json:"total,omitempty"`
+	Step    int       `json:"step,omitempty"`
+	Level   string    `json:"level,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Field   string    `json:"field,omitempty"`
+	Status  *int      `json:"status,omitempty"`
+	Reboot  *bool     `json:"reboot,omitempty"`
+
+	Verification *verify.Report `json:"verification,omitempty"`
+}
+
+// Emitter is the interface implemented by the event consumers
+type Emitter interface {
+	Emit(ev *Event)
+}
+
+// Writer is an Emitter implementation which writes one json object per line
+type Writer struct {
+	mutex sync.Mutex
+	w     io.Writer
+}
+
+// Progress implements the progress.Client interface and translates every
+// progress notification into an event
+type Progress struct {
+	emitter Emitter
+	desc    string
+}
+
+var levelNames = map[int]string{
+	log.LogLevelError:   "error",
+	log.LogLevelWarning: "warning",
+	log.LogLevelInfo:    "info",
+	log.LogLevelDebug:   "debug",
+	log.LogLevelVerbose: "verbose",
+}
+
+// NewWriter creates a new Writer emitting the events to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Emit writes ev as a single line json object
+func (wr *Writer) Emit(ev *Event) {
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+
+	wr.mutex.Lock()
+	defer wr.mutex.Unlock()
+
+	_, _ = wr.w.Write(append(data, '\n'))
+}
+
+// NewProgress creates a new progress.Client implementation forwarding the
+// progress notifications to emitter
+func NewProgress(emitter Emitter) *Progress {
+	return &Progress{emitter: emitter}
+}
+
+// Desc is part of the progress.Client implementation
+func (pr *Progress) Desc(desc string) {
+	pr.desc = desc
+	pr.emitter.Emit(&Event{Type: TypeDesc, Desc: desc})
+}
+
+// Partial is part of the progress.Client implementation
+func (pr *Progress) Partial(total int, step int) {
+	pr.emitter.Emit(&Event{Type: TypePartial, Desc: pr.desc, Total: total, Step: step})
+}
+
+// Step is part of the progress.Client implementation, loop steps carry no
+// information so no event is emitted
+func (pr *Progress) Step() {}
+
+// Success is part of the progress.Client implementation
+func (pr *Progress) Success() {
+	pr.emitter.Emit(&Event{Type: TypeSuccess, Desc: pr.desc})
+}
+
+// Failure is part of the progress.Client implementation
+func (pr *Progress) Failure() {
+	pr.emitter.Emit(&Event{Type: TypeFailure, Desc: pr.desc})
+}
+
+// LoopWaitDuration is part of the progress.Client implementation
+func (pr *Progress) LoopWaitDuration() time.Duration {
+	return 500 * time.Millisecond
+}
+
+// LogHook returns a log.HookFunc emitting a log event for every message with
+// level equal or more severe than maxLevel
+func LogHook(emitter Emitter, maxLevel int) log.HookFunc {
+	return func(level int, msg string) {
+		if level > maxLevel {
+			return
+		}
+
+		emitter.Emit(&Event{Type: TypeLog, Level: levelNames[level], Message: msg})
+	}
+}
+
+// NewMessage creates a new informational message event
+func NewMessage(msg string) *Event {
+	return &Event{Type: TypeMessage, Message: msg}
+}
+
+// NewValidation creates a new validation event based on a validation error,
+// returns nil if err is not a validation error
+func NewValidation(err error) *Event {
+	ve, ok := err.(errors.ValidationError)
+	if !ok {
+		return nil
+	}
+
+	return &Event{Type: TypeValidation, Message: ve.What, Field: ve.Field}
+}
+
+// NewResult creates a new final result event, err is the install error, if any, and
+// report the post install verification report, if the verification was run
+func NewResult(err error, reboot bool, report *verify.Report) *Event {
+	status := 0
+	ev := &Event{Type: TypeResult, Status: &status, Reboot: &reboot, Verification: report}
+
+	if err != nil {
+		status = 1
+		ev.Message = err.Error()
+
+		if te, ok := err.(errors.TraceableError); ok {
+			ev.Message = te.What
+		}
+	}
+
+	return ev
+}
@@ -0,0 +1,143 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/verify"
+)
+
+func decodeEvents(t *testing.T, buf *bytes.Buffer) []*Event {
+	result := []*Event{}
+
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		ev := &Event{}
+
+		if err := json.Unmarshal([]byte(line), ev); err != nil {
+			t.Fatalf("Failed to decode event %q: %s", line, err)
+		}
+
+		result = append(result, ev)
+	}
+
+	return result
+}
+
+func TestProgressEvents(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	prg := NewProgress(NewWriter(buf))
+
+	prg.Desc("Writing mount files")
+	prg.Step()
+	prg.Partial(10, 5)
+	prg.Success()
+	prg.Failure()
+
+	evs := decodeEvents(t, buf)
+	expected := []string{TypeDesc, TypePartial, TypeSuccess, TypeFailure}
+
+	if len(evs) != len(expected) {
+		t.Fatalf("Expected %d events, got: %d", len(expected), len(evs))
+	}
+
+	for i, ev := range evs {
+		if ev.Type != expected[i] {
+			t.Fatalf("Expected event type %q, got: %q", expected[i], ev.Type)
+		}
+
+		if ev.Desc != "Writing mount files" {
+			t.Fatalf("Event %q should carry the progress description", ev.Type)
+		}
+	}
+
+	if evs[1].Total != 10 || evs[1].Step != 5 {
+		t.Fatalf("Invalid partial event: %+v", evs[1])
+	}
+}
+
+func TestLogHook(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	hook := LogHook(NewWriter(buf), log.LogLevelWarning)
+
+	hook(log.LogLevelError, "error message")
+	hook(log.LogLevelWarning, "warning message")
+	hook(log.LogLevelInfo, "info message")
+
+	evs := decodeEvents(t, buf)
+	if len(evs) != 2 {
+		t.Fatalf("Expected 2 log events, got: %d", len(evs))
+	}
+
+	if evs[0].Level != "error" || evs[0].Message != "error message" {
+		t.Fatalf("Invalid log event: %+v", evs[0])
+	}
+}
+
+func TestValidationAndResult(t *testing.T) {
+	if NewValidation(errors.Errorf("not a validation error")) != nil {
+		t.Fatal("NewValidation() should return nil for non validation errors")
+	}
+
+	ev := NewValidation(errors.FieldValidationErrorf("targetMedia[0].children", "Could not find a root partition"))
+	if ev == nil || ev.Field != "targetMedia[0].children" {
+		t.Fatalf("Invalid validation event: %+v", ev)
+	}
+
+	ev = NewResult(nil, true, nil)
+	if *ev.Status != 0 || !*ev.Reboot || ev.Verification != nil {
+		t.Fatalf("Invalid success result event: %+v", ev)
+	}
+
+	ev = NewResult(errors.Errorf("install failed"), false, nil)
+	if *ev.Status != 1 || *ev.Reboot || ev.Message != "install failed" {
+		t.Fatalf("Invalid failure result event: %+v", ev)
+	}
+
+	report := &verify.Report{Checks: []*verify.Check{{Name: verify.CheckUsers, Message: "User clrlinux not found"}}}
+
+	data, err := json.Marshal(NewResult(errors.Errorf("verification failed"), false, report))
+	if err != nil || !strings.Contains(string(data), `"verification":{"passed":false,"checks":[{"name":"users"`) {
+		t.Fatalf("Result event should carry the verification report: %s", string(data))
+	}
+}
+
+func TestBroadcaster(t *testing.T) {
+	bc := NewBroadcaster()
+
+	first := bc.Subscribe()
+	second := bc.Subscribe()
+
+	bc.Emit(NewMessage("hello"))
+
+	for _, ch := range []chan *Event{first, second} {
+		ev := <-ch
+		if ev.Type != TypeMessage || ev.Message != "hello" || ev.Time.IsZero() {
+			t.Fatalf("Invalid broadcasted event: %+v", ev)
+		}
+	}
+
+	bc.Unsubscribe(first)
+	if _, ok := <-first; ok {
+		t.Fatal("Unsubscribed channel should be closed")
+	}
+
+	// a full subscriber queue must not block the emitter
+	for i := 0; i < subscriberQueueSize+10; i++ {
+		bc.Emit(NewMessage("flood"))
+	}
+
+	if len(second) != subscriberQueueSize {
+		t.Fatalf("Expected %d queued events, got: %d", subscriberQueueSize, len(second))
+	}
+
+	bc.Unsubscribe(second)
+	bc.Unsubscribe(second)
+}
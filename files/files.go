@@ -0,0 +1,359 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package files
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// EncodingBase64 indicates the file content is base64 encoded
+	EncodingBase64 = "base64"
+
+	// DefaultMode is the mode of written files with no mode set
+	DefaultMode = "0644"
+
+	// maxSymlinks is the number of symlinks followed resolving a path, as the kernel's
+	maxSymlinks = 40
+)
+
+// File describes a file to be written to the target system
+type File struct {
+	Path     string `yaml:"path,omitempty,flow"`
+	Content  string `yaml:"content,omitempty,flow"`
+	Encoding string `yaml:"encoding,omitempty,flow"`
+	Source   string `yaml:"source,omitempty,flow"`
+	Owner    string `yaml:"owner,omitempty,flow"`
+	Group    string `yaml:"group,omitempty,flow"`
+	Mode     string `yaml:"mode,omitempty,flow"`
+	Append   bool   `yaml:"append,omitempty,flow"`
+	Template bool   `yaml:"template,omitempty,flow"`
+}
+
+// Validate checks the file description is complete and consistent, the source
+// file itself is only checked when writing
+func (f *File) Validate() error {
+	if f.Path == "" {
+		return errors.FieldValidationErrorf("path", "A file must provide a path")
+	}
+
+	if !filepath.IsAbs(f.Path) {
+		return errors.FieldValidationErrorf("path", "File path must be absolute: %s", f.Path)
+	}
+
+	if strings.HasSuffix(f.Path, "/") || filepath.Clean(f.Path) == "/" {
+		return errors.FieldValidationErrorf("path", "File path must not be a directory: %s", f.Path)
+	}
+
+	for _, curr := range strings.Split(f.Path, "/") {
+		if curr == ".." {
+			return errors.FieldValidationErrorf("path", "File path must not have a .. component: %s", f.Path)
+		}
+	}
+
+	if f.Content != "" && f.Source != "" {
+		return errors.FieldValidationErrorf("source", "A file can not provide both a content and a source")
+	}
+
+	switch f.Encoding {
+	case "":
+	case EncodingBase64:
+		if f.Source != "" {
+			return errors.FieldValidationErrorf("encoding", "Encoding only applies to an inline content")
+		}
+
+		if _, err := base64.StdEncoding.DecodeString(f.Content); err != nil {
+			return errors.FieldValidationErrorf("content", "Invalid base64 content: %v", err)
+		}
+	default:
+		return errors.FieldValidationErrorf("encoding", "Invalid file encoding: %s", f.Encoding)
+	}
+
+	if f.Encoding == EncodingBase64 && f.Template {
+		return errors.FieldValidationErrorf("template", "A base64 encoded content can not be a template")
+	}
+
+	if _, err := f.fileMode(); err != nil {
+		return errors.FieldValidationErrorf("mode", "Invalid file mode: %s", f.Mode)
+	}
+
+	return nil
+}
+
+func (f *File) fileMode() (os.FileMode, error) {
+	mode := f.Mode
+	if mode == "" {
+		mode = DefaultMode
+	}
+
+	value, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	if value > 07777 {
+		return 0, errors.Errorf("Mode out of range: %s", mode)
+	}
+
+	perm := os.FileMode(value & 0777)
+
+	if value&04000 != 0 {
+		perm |= os.ModeSetuid
+	}
+
+	if value&02000 != 0 {
+		perm |= os.ModeSetgid
+	}
+
+	if value&01000 != 0 {
+		perm |= os.ModeSticky
+	}
+
+	return perm, nil
+}
+
+// content returns the content to be written, a relative source is resolved
+// from vars' yamlDir and templates are expanded with vars
+func (f *File) content(vars map[string]string) ([]byte, error) {
+	var data []byte
+	var err error
+
+	if f.Source != "" {
+		src := f.Source
+		if !filepath.IsAbs(src) {
+			src = filepath.Join(vars["yamlDir"], src)
+		}
+
+		if data, err = ioutil.ReadFile(src); err != nil {
+			return nil, errors.Wrap(err)
+		}
+	} else if f.Encoding == EncodingBase64 {
+		if data, err = base64.StdEncoding.DecodeString(f.Content); err != nil {
+			return nil, errors.Wrap(err)
+		}
+	} else {
+		data = []byte(f.Content)
+	}
+
+	if f.Template {
+		data = []byte(utils.ExpandVariables(vars, string(data)))
+	}
+
+	return data, nil
+}
+
+// lookupID resolves a user or group name to its numeric id using the target's
+// database file (i.e passwd or group), the stateless defaults are used if the
+// name is not found in the target's /etc; a numeric name is used as is
+func lookupID(rootDir string, db string, name string) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	for _, dir := range []string{"etc", "usr/share/defaults/etc"} {
+		f, err := os.Open(filepath.Join(rootDir, dir, db))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return -1, errors.Wrap(err)
+		}
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Split(scanner.Text(), ":")
+			if len(fields) < 3 || fields[0] != name {
+				continue
+			}
+
+			_ = f.Close()
+
+			id, err := strconv.Atoi(fields[2])
+			if err != nil {
+				return -1, errors.Errorf("Invalid %s entry for %s", db, name)
+			}
+
+			return id, nil
+		}
+
+		_ = f.Close()
+	}
+
+	return -1, errors.Errorf("%s not found in the target %s database", name, db)
+}
+
+// resolvePath returns the rootDir path of the target path, the symlinks are resolved as if
+// rootDir was the root directory so neither an absolute symlink nor a .. can lead out of it.
+// The missing parent directories are created.
+func resolvePath(rootDir string, path string) (string, error) {
+	root := filepath.Clean(rootDir)
+	pending := strings.Split(path, "/")
+	resolved := "/"
+	links := 0
+
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+
+		if name == "" || name == "." {
+			continue
+		}
+
+		if name == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		host := filepath.Join(root, next)
+
+		fi, err := os.Lstat(host)
+		if os.IsNotExist(err) {
+			if len(pending) > 0 {
+				if err = os.Mkdir(host, 0755); err != nil {
+					return "", errors.Wrap(err)
+				}
+			}
+			resolved = next
+			continue
+		} else if err != nil {
+			return "", errors.Wrap(err)
+		}
+
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if links++; links > maxSymlinks {
+				return "", errors.Errorf("Too many levels of symbolic links: %s", path)
+			}
+
+			target, err := os.Readlink(host)
+			if err != nil {
+				return "", errors.Wrap(err)
+			}
+
+			if filepath.IsAbs(target) {
+				resolved = "/"
+			}
+
+			pending = append(strings.Split(target, "/"), pending...)
+			continue
+		}
+
+		if len(pending) > 0 && !fi.IsDir() {
+			return "", errors.Errorf("%s is not a directory", next)
+		}
+
+		resolved = next
+	}
+
+	result := filepath.Join(root, resolved)
+	if !strings.HasPrefix(result, root+"/") {
+		return "", errors.Errorf("File path %s is out of the target", path)
+	}
+
+	return result, nil
+}
+
+// Write writes the file to the target rootDir, parent directories are created as needed
+func (f *File) Write(rootDir string, vars map[string]string) error {
+	data, err := f.content(vars)
+	if err != nil {
+		return err
+	}
+
+	perm, err := f.fileMode()
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	uid, gid := -1, -1
+
+	if f.Owner != "" {
+		if uid, err = lookupID(rootDir, "passwd", f.Owner); err != nil {
+			return err
+		}
+	}
+
+	if f.Group != "" {
+		if gid, err = lookupID(rootDir, "group", f.Group); err != nil {
+			return err
+		}
+	}
+
+	if path := filepath.Join(rootDir, f.Path); !strings.HasPrefix(path, filepath.Clean(rootDir)+"/") {
+		return errors.Errorf("File path %s is out of the target", f.Path)
+	}
+
+	path, err := resolvePath(rootDir, f.Path)
+	if err != nil {
+		return err
+	}
+
+	// the path is resolved, a symlink created since then is not followed
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC | syscall.O_NOFOLLOW
+	if f.Append {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND | syscall.O_NOFOLLOW
+	}
+
+	out, err := os.OpenFile(path, flags, perm)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = out.Close()
+	}()
+
+	if _, err = out.Write(data); err != nil {
+		return errors.Wrap(err)
+	}
+
+	// an existing file keeps its mode when opened, and new ones are subject to umask
+	if err = out.Chmod(perm); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if uid != -1 || gid != -1 {
+		if err = out.Chown(uid, gid); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+// Apply writes the files to the target rootDir in the given order
+func Apply(rootDir string, files []*File, vars map[string]string) error {
+	for _, curr := range files {
+		log.Debug("Writing file: %s", curr.Path)
+
+		if err := curr.Write(rootDir, vars); err != nil {
+			return errors.Errorf("Failed to write file %s: %v", curr.Path, err)
+		}
+	}
+
+	return nil
+}
+
+// Paths returns the target paths of files, used to summarize the files to be written
+func Paths(files []*File) []string {
+	result := []string{}
+
+	for _, curr := range files {
+		result = append(result, curr.Path)
+	}
+
+	return result
+}
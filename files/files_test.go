@@ -0,0 +1,195 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		file  *File
+		field string
+	}{
+		{&File{Path: "/etc/motd", Content: "hello"}, ""},
+		{&File{Path: "/etc/motd", Content: "aGVsbG8=", Encoding: EncodingBase64, Mode: "0600"}, ""},
+		{&File{Path: "/etc/motd", Source: "motd", Template: true, Mode: "4755"}, ""},
+		{&File{Content: "hello"}, "path"},
+		{&File{Path: "etc/motd"}, "path"},
+		{&File{Path: "/etc/"}, "path"},
+		{&File{Path: "/../../etc/shadow"}, "path"},
+		{&File{Path: "/etc/../../shadow"}, "path"},
+		{&File{Path: "/etc/motd", Content: "hello", Source: "motd"}, "source"},
+		{&File{Path: "/etc/motd", Content: "hello", Encoding: "gzip"}, "encoding"},
+		{&File{Path: "/etc/motd", Source: "motd", Encoding: EncodingBase64}, "encoding"},
+		{&File{Path: "/etc/motd", Content: "not base64!", Encoding: EncodingBase64}, "content"},
+		{&File{Path: "/etc/motd", Content: "aGVsbG8=", Encoding: EncodingBase64, Template: true}, "template"},
+		{&File{Path: "/etc/motd", Mode: "0999"}, "mode"},
+		{&File{Path: "/etc/motd", Mode: "17777"}, "mode"},
+	}
+
+	for _, curr := range tests {
+		err := curr.file.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("File %+v should be valid: %v", curr.file, err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for %q, got: %v", curr.field, err)
+		}
+	}
+}
+
+func checkFile(t *testing.T, path string, content string, mode os.FileMode) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", path, err)
+	}
+
+	if string(data) != content {
+		t.Fatalf("Unexpected %s content: %q, expected: %q", path, string(data), content)
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Failed to stat %s: %v", path, err)
+	}
+
+	if fi.Mode() != mode {
+		t.Fatalf("Unexpected %s mode: %v, expected: %v", path, fi.Mode(), mode)
+	}
+}
+
+func TestApply(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "files-root-")
+	if err != nil {
+		t.Fatalf("Failed to create root dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	yamlDir, err := ioutil.TempDir("", "files-yaml-")
+	if err != nil {
+		t.Fatalf("Failed to create yaml dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(yamlDir) }()
+
+	if err = ioutil.WriteFile(filepath.Join(yamlDir, "motd"), []byte("Welcome to ${hostname}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+
+	// the owner is resolved from the target's stateless defaults
+	passwd := fmt.Sprintf("clrlinux:x:%d:%d::/home/clrlinux:/bin/bash\n", os.Getuid(), os.Getgid())
+	defaultsDir := filepath.Join(rootDir, "usr", "share", "defaults", "etc")
+
+	if err = os.MkdirAll(defaultsDir, 0755); err != nil {
+		t.Fatalf("Failed to create defaults dir: %v", err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(defaultsDir, "passwd"), []byte(passwd), 0644); err != nil {
+		t.Fatalf("Failed to write passwd: %v", err)
+	}
+
+	vars := map[string]string{"yamlDir": yamlDir, "hostname": "clr"}
+
+	list := []*File{
+		{Path: "/etc/motd", Source: "motd", Template: true, Owner: "clrlinux"},
+		{Path: "/etc/issue", Content: "${hostname}\n", Mode: "0600"},
+		{Path: "/etc/issue", Content: "more\n", Append: true, Mode: "0640"},
+		{Path: "/usr/local/bin/hello", Content: "IyEvYmluL3NoCg==", Encoding: EncodingBase64, Mode: "0755"},
+	}
+
+	if err = Apply(rootDir, list, vars); err != nil {
+		t.Fatalf("Failed to apply files: %v", err)
+	}
+
+	checkFile(t, filepath.Join(rootDir, "etc", "motd"), "Welcome to clr\n", 0644)
+	checkFile(t, filepath.Join(rootDir, "etc", "issue"), "${hostname}\nmore\n", 0640)
+	checkFile(t, filepath.Join(rootDir, "usr", "local", "bin", "hello"), "#!/bin/sh\n", 0755)
+
+	if err = Apply(rootDir, []*File{{Path: "/etc/motd", Content: "x", Owner: "nobody-here"}}, vars); err == nil {
+		t.Fatal("Apply should fail for an unknown owner")
+	}
+
+	if err = Apply(rootDir, []*File{{Path: "/etc/motd", Source: "missing"}}, vars); err == nil {
+		t.Fatal("Apply should fail for a missing source file")
+	}
+
+	if paths := Paths(list); len(paths) != 4 || paths[0] != "/etc/motd" {
+		t.Fatalf("Unexpected paths: %v", paths)
+	}
+}
+
+func TestWriteSymlinks(t *testing.T) {
+	rootDir, err := ioutil.TempDir("", "files-root-")
+	if err != nil {
+		t.Fatalf("Failed to create root dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	outside, err := ioutil.TempDir("", "files-outside-")
+	if err != nil {
+		t.Fatalf("Failed to create outside dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(outside) }()
+
+	links := map[string]string{
+		"etc":       outside,
+		"usr/lib":   "../../../../../" + outside,
+		"var/run":   "../run",
+		"run/motd":  "/srv/motd",
+		"usr/local": "local",
+	}
+
+	for link, target := range links {
+		path := filepath.Join(rootDir, link)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err = os.Symlink(target, path); err != nil {
+			t.Fatalf("Failed to create the %s symlink: %v", path, err)
+		}
+	}
+
+	tests := []struct {
+		path   string
+		target string
+	}{
+		{"/etc/shadow", outside + "/shadow"},
+		{"/usr/lib/os-release", outside + "/os-release"},
+		{"/var/run/motd", "/srv/motd"},
+		{"/var/run/issue", "/run/issue"},
+	}
+
+	for _, curr := range tests {
+		if err = (&File{Path: curr.path, Content: "x"}).Write(rootDir, nil); err != nil {
+			t.Fatalf("Failed to write %s: %v", curr.path, err)
+		}
+
+		checkFile(t, filepath.Join(rootDir, curr.target), "x", 0644)
+	}
+
+	if files, _ := ioutil.ReadDir(outside); len(files) != 0 {
+		t.Fatalf("The symlinks should be resolved in the target, found: %d files out of it", len(files))
+	}
+
+	if err = (&File{Path: "/usr/local/bin/hello", Content: "x"}).Write(rootDir, nil); err == nil {
+		t.Fatal("A symlink loop should fail")
+	}
+
+	if err = (&File{Path: "/../../shadow", Content: "x"}).Write(rootDir, nil); err == nil {
+		t.Fatal("A path out of the target should fail")
+	}
+}
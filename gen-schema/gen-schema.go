@@ -0,0 +1,41 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/clearlinux/clr-installer/schema"
+
+	flag "github.com/spf13/pflag"
+)
+
+func main() {
+	var srcDir string
+
+	flag.StringVar(&srcDir, "srcdir", ".", "The clr-installer source tree top directory")
+	flag.ErrHelp = fmt.Errorf("Generate the configuration JSON Schema and syntax document")
+
+	flag.Parse()
+
+	files, err := schema.Files(srcDir)
+	if err != nil {
+		panic(err)
+	}
+
+	for path, content := range files {
+		path = filepath.Join(srcDir, path)
+
+		if err = ioutil.WriteFile(path, content, 0644); err != nil {
+			fmt.Printf("ERROR: Could not write %s: %v\n", path, err)
+			os.Exit(1)
+		}
+
+		fmt.Printf("Generated %s\n", path)
+	}
+}
@@ -5,6 +5,7 @@
 package pages
 
 import (
+	"github.com/clearlinux/clr-installer/bootloader"
 	"github.com/clearlinux/clr-installer/gui/common"
 
 	"github.com/clearlinux/clr-installer/kernel"
@@ -25,9 +26,11 @@ type ConfigKernelPage struct {
 	kernelLabel *gtk.Label
 	addLabel    *gtk.Label
 	remLabel    *gtk.Label
+	hintLabel   *gtk.Label
 	scroll      *gtk.ScrolledWindow
 	list        *gtk.ListBox
 	data        []*kernel.Kernel
+	fallbacks   []*gtk.CheckButton
 	selected    *kernel.Kernel
 }
 
@@ -39,6 +42,8 @@ func NewConfigKernelPage(controller Controller, model *model.SystemInstall) (Pag
 		utils.Locale.Get("Then, the \"Remove Arguments\" items are removed.")
 	kernelArgsHelp = kernelArgsHelp + "\n" +
 		utils.Locale.Get("The final argument list contains the kernel bundle's configured arguments and the ones configured by the user.")
+	kernelArgsHelp = kernelArgsHelp + "\n" +
+		utils.Locale.Get("Press Enter to complete the known parameters.")
 
 	data, err := kernel.LoadKernelList()
 	if err != nil {
@@ -116,6 +121,14 @@ func NewConfigKernelPage(controller Controller, model *model.SystemInstall) (Pag
 		}
 		box.PackStart(labelDesc, true, true, 0)
 
+		// fallback kernels are installed along the selected, default, one
+		fallback, err := gtk.CheckButtonNewWithLabel(utils.Locale.Get("Install as fallback kernel"))
+		if err != nil {
+			return nil, err
+		}
+		box.PackStart(fallback, false, false, 0)
+		page.fallbacks = append(page.fallbacks, fallback)
+
 		page.list.Add(box)
 	}
 
@@ -160,6 +173,25 @@ func NewConfigKernelPage(controller Controller, model *model.SystemInstall) (Pag
 	page.remEntry.SetTooltipText(utils.Locale.Get(kernelArgsHelp))
 	page.box.PackStart(page.remEntry, false, false, 0)
 
+	// hintLabel: Describes the known parameters matching the argument being edited
+	page.hintLabel, err = setLabel("", "label-warning", 0.0)
+	if err != nil {
+		return nil, err
+	}
+	page.hintLabel.SetMarginStart(common.StartEndMargin)
+	page.hintLabel.SetHAlign(gtk.ALIGN_START)
+	page.box.PackStart(page.hintLabel, false, false, 10)
+
+	for _, entry := range []*gtk.Entry{page.addEntry, page.remEntry} {
+		if _, err := entry.Connect("changed", page.onArgsChange); err != nil {
+			return nil, err
+		}
+
+		if _, err := entry.Connect("activate", page.onArgsComplete); err != nil {
+			return nil, err
+		}
+	}
+
 	return page, nil
 }
 
@@ -178,6 +210,39 @@ func (page *ConfigKernelPage) getKern() *kernel.Kernel {
 	return nil
 }
 
+// onArgsChange describes the known parameters matching the last edited argument
+// and the arguments warnings
+func (page *ConfigKernelPage) onArgsChange(entry *gtk.Entry) {
+	_, matches := kernel.Complete(getTextFromEntry(entry))
+
+	hints := []string{}
+	for _, curr := range matches {
+		hints = append(hints, curr.Usage()+": "+utils.Locale.Get(curr.Desc))
+	}
+
+	args := &kernel.Arguments{
+		Add:    strings.Fields(getTextFromEntry(page.addEntry)),
+		Remove: strings.Fields(getTextFromEntry(page.remEntry)),
+	}
+
+	// invalid arguments can not be confirmed, the warnings are only informative
+	err := bootloader.ValidateArguments(args)
+	if err != nil {
+		hints = append(hints, err.Error())
+	}
+
+	hints = append(hints, args.Warnings()...)
+	page.hintLabel.SetText(strings.Join(hints, "\n"))
+	page.controller.SetButtonState(ButtonConfirm, err == nil && page.selected != nil)
+}
+
+// onArgsComplete completes the last argument with the known parameters
+func (page *ConfigKernelPage) onArgsComplete(entry *gtk.Entry) {
+	completed, _ := kernel.Complete(getTextFromEntry(entry))
+	entry.SetText(completed)
+	entry.SetPosition(-1)
+}
+
 func (page *ConfigKernelPage) onRowActivated(box *gtk.ListBox, row *gtk.ListBoxRow) {
 	page.selected = page.data[row.GetIndex()]
 	page.controller.SetButtonState(ButtonConfirm, true)
@@ -240,17 +305,24 @@ func (page *ConfigKernelPage) StoreChanges() {
 	}
 
 	if adds != "" {
-		page.model.AddExtraKernelArguments(strings.Split(adds, " "))
+		page.model.AddExtraKernelArguments(strings.Fields(adds))
 	} else {
 		page.model.ClearExtraKernelArguments()
 	}
 	if removes != "" {
-		page.model.RemoveKernelArguments(strings.Split(removes, " "))
+		page.model.RemoveKernelArguments(strings.Fields(removes))
 	} else {
 		page.model.ClearRemoveKernelArguments()
 	}
 
-	page.model.Kernel = page.selected
+	fallbacks := []*kernel.Kernel{}
+	for i, v := range page.data {
+		if page.fallbacks[i].GetActive() {
+			fallbacks = append(fallbacks, v)
+		}
+	}
+
+	page.model.SetKernels(page.selected, fallbacks)
 }
 
 // ResetChanges will reset this page to match the model
@@ -267,6 +339,12 @@ func (page *ConfigKernelPage) ResetChanges() {
 		}
 	}
 
+	// Reset the fallback kernels to match the model
+	installed := page.model.InstalledKernels()
+	for i, v := range page.data {
+		page.fallbacks[i].SetActive(!v.Equals(page.model.Kernel) && utils.StringSliceContains(installed, v.Bundle))
+	}
+
 	// Reset both entries to match the model
 	if page.model.KernelArguments != nil {
 		page.addEntry.SetText(strings.Join(page.model.KernelArguments.Add, " "))
@@ -293,6 +371,10 @@ func (page *ConfigKernelPage) GetConfiguredValue() string {
 		}
 	}
 
+	if kernels := page.model.InstalledKernels(); len(kernels) > 1 {
+		ret = ret + " " + utils.Locale.Get("and %d fallback kernels", len(kernels)-1)
+	}
+
 	// The assumption made here is that these arguments were added by the user
 	if page.model.KernelArguments != nil {
 		if len(page.model.KernelArguments.Add) > 0 || len(page.model.KernelArguments.Remove) > 0 {
@@ -5,10 +5,12 @@
 package pages
 
 import (
+	"fmt"
 	"strings"
 
 	"github.com/gotk3/gotk3/gtk"
 
+	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/gui/common"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/model"
@@ -46,6 +48,18 @@ type UserAddPage struct {
 	adminCheck   *gtk.CheckButton
 	adminChanged bool
 
+	groups         *gtk.Entry
+	uid            *gtk.Entry
+	gid            *gtk.Entry
+	shell          *gtk.Entry
+	home           *gtk.Entry
+	maxDays        *gtk.Entry
+	systemCheck    *gtk.CheckButton
+	forceChgCheck  *gtk.CheckButton
+	lockedCheck    *gtk.CheckButton
+	accountWarning *gtk.Label
+	accountChanged bool
+
 	justLoaded bool
 
 	addMode bool
@@ -112,6 +126,11 @@ func NewUserAddPage(controller Controller, model *model.SystemInstall) (Page, er
 	page.adminCheck.SetSensitive(false) // MUST have an admin user
 	page.box.PackStart(page.adminCheck, false, false, 0)
 
+	// Account settings
+	if err = page.setAccountWidgets(); err != nil {
+		return nil, err
+	}
+
 	// Generate signal on Name change
 	if _, err := page.name.Connect("changed", page.onNameChange); err != nil {
 		return nil, err
@@ -137,9 +156,89 @@ func NewUserAddPage(controller Controller, model *model.SystemInstall) (Page, er
 		return nil, err
 	}
 
+	// Generate signal on account settings change
+	for _, entry := range []*gtk.Entry{page.groups, page.uid, page.gid, page.shell, page.home, page.maxDays} {
+		if _, err := entry.Connect("changed", page.onAccountChange); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, check := range []*gtk.CheckButton{page.systemCheck, page.forceChgCheck, page.lockedCheck} {
+		if _, err := check.Connect("clicked", page.onAccountChange); err != nil {
+			return nil, err
+		}
+	}
+
 	return page, nil
 }
 
+// accountSettings returns the user with the account settings of the form, and the first
+// problem of the settings, the clashes with the system default users included
+func (page *UserAddPage) accountSettings() (*user.User, string) {
+	usr := &user.User{
+		Login:               getTextFromEntry(page.login),
+		Shell:               strings.TrimSpace(getTextFromEntry(page.shell)),
+		Home:                strings.TrimSpace(getTextFromEntry(page.home)),
+		System:              page.systemCheck.GetActive(),
+		ForcePasswordChange: page.forceChgCheck.GetActive(),
+		Locked:              page.lockedCheck.GetActive(),
+	}
+
+	var ok bool
+	var msg string
+
+	if usr.Groups, ok, msg = user.ParseGroups(getTextFromEntry(page.groups)); !ok {
+		return usr, msg
+	}
+
+	if usr.UID, ok, msg = user.ParseID(getTextFromEntry(page.uid)); !ok {
+		return usr, utils.Locale.Get("UID") + ": " + msg
+	}
+
+	if usr.GID, ok, msg = user.ParseID(getTextFromEntry(page.gid)); !ok {
+		return usr, utils.Locale.Get("GID") + ": " + msg
+	}
+
+	if usr.PasswordMaxDays, ok, msg = user.ParsePasswordMaxDays(getTextFromEntry(page.maxDays)); !ok {
+		return usr, msg
+	}
+
+	// the form always sets a password, it is encrypted once stored
+	if ve, ok := usr.Validate().(errors.ValidationError); ok && ve.Field != "forcePasswordChange" {
+		return usr, ve.What
+	}
+
+	return usr, ""
+}
+
+func (page *UserAddPage) onAccountChange() {
+	usr, msg := page.accountSettings()
+	page.accountWarning.SetText(msg)
+
+	page.accountChanged = strings.Join(usr.Groups, ",") != strings.Join(page.user.Groups, ",") ||
+		usr.UID != page.user.UID || usr.GID != page.user.GID || usr.Shell != page.user.Shell ||
+		usr.Home != page.user.Home || usr.PasswordMaxDays != page.user.PasswordMaxDays ||
+		usr.System != page.user.System || usr.ForcePasswordChange != page.user.ForcePasswordChange ||
+		usr.Locked != page.user.Locked
+
+	page.setConfirmButton()
+}
+
+// setAccount copies the account settings of the form to usr
+func (page *UserAddPage) setAccount(usr *user.User) {
+	settings, _ := page.accountSettings()
+
+	usr.Groups = settings.Groups
+	usr.UID = settings.UID
+	usr.GID = settings.GID
+	usr.Shell = settings.Shell
+	usr.Home = settings.Home
+	usr.PasswordMaxDays = settings.PasswordMaxDays
+	usr.System = settings.System
+	usr.ForcePasswordChange = settings.ForcePasswordChange
+	usr.Locked = settings.Locked
+}
+
 func (page *UserAddPage) onNameChange(entry *gtk.Entry) {
 	name := getTextFromEntry(page.name)
 	if name != page.user.UserName {
@@ -276,6 +375,7 @@ func (page *UserAddPage) StoreChanges() {
 			Admin:    page.adminCheck.GetActive(),
 		}
 
+		page.setAccount(newUser)
 		page.model.AddUser(newUser)
 	} else {
 		if len(page.model.Users) < 1 {
@@ -286,6 +386,7 @@ func (page *UserAddPage) StoreChanges() {
 		page.model.Users[0].UserName = getTextFromEntry(page.name)
 		page.model.Users[0].Login = getTextFromEntry(page.login)
 		page.model.Users[0].Admin = page.adminCheck.GetActive()
+		page.setAccount(page.model.Users[0])
 	}
 
 	log.Debug("page.model.Users[0]: %+v", page.model.Users[0]) // RemoveMe
@@ -341,6 +442,17 @@ func (page *UserAddPage) ResetChanges() {
 		page.adminCheck.SetActive(page.user.Admin)
 	}
 
+	setTextInEntry(page.groups, strings.Join(page.user.Groups, ","))
+	setTextInEntry(page.uid, formatAccountNumber(page.user.UID))
+	setTextInEntry(page.gid, formatAccountNumber(page.user.GID))
+	setTextInEntry(page.shell, page.user.Shell)
+	setTextInEntry(page.home, page.user.Home)
+	setTextInEntry(page.maxDays, formatAccountNumber(page.user.PasswordMaxDays))
+	page.systemCheck.SetActive(page.user.System)
+	page.forceChgCheck.SetActive(page.user.ForcePasswordChange)
+	page.lockedCheck.SetActive(page.user.Locked)
+	page.accountChanged = false
+
 	page.justLoaded = true
 }
 
@@ -367,14 +479,16 @@ func (page *UserAddPage) GetConfiguredValue() string {
 func (page *UserAddPage) setConfirmButton() {
 	page.controller.SetButtonState(ButtonConfirm, false)
 
-	if page.nameChanged || page.loginChanged || page.passwordChanged || page.adminChanged {
+	if page.nameChanged || page.loginChanged || page.passwordChanged || page.adminChanged || page.accountChanged {
 		userWarning, _ := page.nameWarning.GetText()
 		loginWarning, _ := page.loginWarning.GetText()
 		passwordWarning, _ := page.passwordWarning.GetText()
+		accountWarning, _ := page.accountWarning.GetText()
 		login := getTextFromEntry(page.login)
 		password := getTextFromEntry(page.password)
 
-		if userWarning == "" && loginWarning == "" && passwordWarning == "" && login != "" && password != "" {
+		if userWarning == "" && loginWarning == "" && passwordWarning == "" && accountWarning == "" &&
+			login != "" && password != "" {
 			page.controller.SetButtonState(ButtonConfirm, true)
 		} else {
 			page.controller.SetButtonState(ButtonConfirm, false)
@@ -388,12 +502,22 @@ func (page *UserAddPage) clearForm() {
 	setTextInEntry(page.password, "")
 	setTextInEntry(page.passwordConfirm, "")
 	page.adminCheck.SetActive(true)
+	setTextInEntry(page.groups, "")
+	setTextInEntry(page.uid, "")
+	setTextInEntry(page.gid, "")
+	setTextInEntry(page.shell, "")
+	setTextInEntry(page.home, "")
+	setTextInEntry(page.maxDays, "")
+	page.systemCheck.SetActive(false)
+	page.forceChgCheck.SetActive(false)
+	page.lockedCheck.SetActive(false)
 
 	page.nameChanged = false
 	page.loginChanged = false
 	page.passwordChanged = false
 	page.fakePassword = false
 	page.adminChanged = false
+	page.accountChanged = false
 	page.addMode = false
 }
 
@@ -496,3 +620,90 @@ func (page *UserAddPage) setPasswordWidgets(rulesText string, maxSize int) (*gtk
 
 	return password, passwordConfirm, warningLabel, err
 }
+
+// formatAccountNumber returns the entry text of an account number, empty if unset
+func formatAccountNumber(value uint) string {
+	if value == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d", value)
+}
+
+// newAccountCheck returns a check button of the account settings
+func (page *UserAddPage) newAccountCheck(label string) (*gtk.CheckButton, error) {
+	check, err := gtk.CheckButtonNew()
+	if err != nil {
+		return nil, err
+	}
+	check.SetLabel("   " + label)
+	sc, err := check.GetStyleContext()
+	if err != nil {
+		log.Warning("Error getting style context: ", err) // Just log trivial error
+	} else {
+		sc.AddClass("label-entry")
+	}
+	check.SetMarginStart(CommonSetting + common.StartEndMargin)
+	check.SetMarginEnd(common.StartEndMargin)
+	page.box.PackStart(check, false, false, 0)
+
+	return check, nil
+}
+
+func (page *UserAddPage) setAccountWidgets() error {
+	entries := []struct {
+		entry   **gtk.Entry
+		text    string
+		maxSize int
+	}{
+		{&page.groups, utils.Locale.Get("Groups"), 255},
+		{&page.uid, utils.Locale.Get("UID"), 5},
+		{&page.gid, utils.Locale.Get("GID"), 5},
+		{&page.shell, utils.Locale.Get("Shell"), 255},
+		{&page.home, utils.Locale.Get("Home"), 255},
+		{&page.maxDays, utils.Locale.Get("Password Days"), 5},
+	}
+
+	for _, curr := range entries {
+		boxEntry, entry, err := setLabelAndEntry(curr.text, curr.maxSize)
+		if err != nil {
+			return err
+		}
+		boxEntry.SetMarginStart(common.StartEndMargin)
+		boxEntry.SetMarginEnd(common.StartEndMargin)
+		page.box.PackStart(boxEntry, false, false, 0)
+		*curr.entry = entry
+	}
+
+	// Rules
+	rulesLabel, err := setLabel(utils.Locale.Get("Optional. Comma separated groups, absolute shell and home paths. "+
+		"An empty field keeps the default."), "label-rules", 0.0)
+	if err != nil {
+		return err
+	}
+	rulesLabel.SetMarginStart(CommonSetting + common.StartEndMargin)
+	rulesLabel.SetMaxWidthChars(1) // The value does not matter but its required for LineWrap to work
+	rulesLabel.SetLineWrap(true)
+	page.box.PackStart(rulesLabel, false, false, 0)
+
+	// Warning
+	page.accountWarning, err = setLabel("", "label-warning", 0.0)
+	if err != nil {
+		return err
+	}
+	page.accountWarning.SetMarginStart(CommonSetting + common.StartEndMargin)
+	page.accountWarning.SetMaxWidthChars(1) // The value does not matter but its required for LineWrap to work
+	page.accountWarning.SetLineWrap(true)
+	page.box.PackStart(page.accountWarning, false, false, 0)
+
+	if page.systemCheck, err = page.newAccountCheck(utils.Locale.Get("System Account")); err != nil {
+		return err
+	}
+
+	if page.forceChgCheck, err = page.newAccountCheck(utils.Locale.Get("Change Password at First Login")); err != nil {
+		return err
+	}
+
+	page.lockedCheck, err = page.newAccountCheck(utils.Locale.Get("Lock Password"))
+	return err
+}
@@ -5,11 +5,13 @@
 package gui
 
 import (
+	"html"
 	"strings"
 
 	"github.com/gotk3/gotk3/gtk"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/files"
 	"github.com/clearlinux/clr-installer/gui/common"
 	"github.com/clearlinux/clr-installer/gui/pages"
 	"github.com/clearlinux/clr-installer/log"
@@ -715,6 +717,16 @@ func (window *Window) confirmInstall() {
 	}
 	secondaryText = utils.Locale.Get("Target Media") + ": " + strings.Join(targets, ", ")
 
+	if len(window.model.Files) > 0 {
+		// the label uses markup, paths are user provided
+		paths := html.EscapeString(strings.Join(files.Paths(window.model.Files), ", "))
+		secondaryText += "\n" + utils.Locale.Get("Files") + ": " + paths
+	}
+
+	if cmdline := window.model.KernelCmdline(); cmdline != "" {
+		secondaryText += "\n" + utils.Locale.Get("Kernel command line") + ": " + html.EscapeString(cmdline)
+	}
+
 	title := utils.Locale.Get(storage.ConfirmInstallation)
 	text = primaryText + "\n" + "<small>" + secondaryText + "</small>"
 
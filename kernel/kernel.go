@@ -17,6 +17,7 @@ type Kernel struct {
 	Bundle      string // Bundle is the bundle name containing this kernel
 	Name        string // Name the bundle name for a given kernel
 	Desc        string // Desc is the kernel description
+	Default     bool   // Default is set for the kernel booted by default when several are installed
 	userDefined bool
 }
 
@@ -56,17 +57,36 @@ func (k *Kernel) IsUserDefined() bool {
 	return k.userDefined
 }
 
-// MarshalYAML marshals Kernel into YAML format
+// kernelEntry is the YAML mapping form of a Kernel, used by the kernels list
+type kernelEntry struct {
+	Bundle  string `yaml:"bundle,omitempty,flow"`
+	Default bool   `yaml:"default,omitempty,flow"`
+}
+
+// MarshalYAML marshals Kernel into YAML format, the bundle name unless it's the default
+// of a kernels list
 func (k *Kernel) MarshalYAML() (interface{}, error) {
+	if k.Default {
+		return &kernelEntry{Bundle: k.Bundle, Default: true}, nil
+	}
+
 	return k.Bundle, nil
 }
 
-// UnmarshalYAML unmarshals Kernel from YAML format
+// UnmarshalYAML unmarshals Kernel from YAML format, either the bundle name or
+// a bundle and default mapping
 func (k *Kernel) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	var bundle string
 
 	if err := unmarshal(&bundle); err != nil {
-		return err
+		var entry kernelEntry
+
+		if merr := unmarshal(&entry); merr != nil {
+			return err
+		}
+
+		bundle = entry.Bundle
+		k.Default = entry.Default
 	}
 
 	k.Bundle = bundle
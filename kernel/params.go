@@ -0,0 +1,304 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// ValueType is the type of a kernel parameter's value
+type ValueType int
+
+const (
+	// ValueNone is a flag parameter, i.e quiet, it takes no value
+	ValueNone ValueType = iota
+
+	// ValueString is a parameter taking any non empty value
+	ValueString
+
+	// ValueInt is a parameter taking an integer value, between Min and Max
+	ValueInt
+
+	// ValueEnum is a parameter taking one of a set of values, or comma separated
+	// values if the parameter is a List
+	ValueEnum
+
+	// ValueBool is a parameter taking a boolean value, i.e 0, 1, on, off, y, n
+	ValueBool
+)
+
+// Parameter describes a known kernel command line parameter
+type Parameter struct {
+	Name       string    // Name is the parameter name, a trailing * matches any suffix
+	Desc       string    // Desc is the parameter description
+	Type       ValueType // Type is the parameter's value type
+	Values     []string  // Values are the ValueEnum accepted values
+	List       bool      // List is set if a ValueEnum takes comma separated values
+	Repeatable bool      // Repeatable is set if the parameter may be given more than once
+	Min        int       // Min is the minimum ValueInt value, i.e -1 if it means auto
+	Max        int       // Max is the maximum ValueInt value, 0 for no maximum
+}
+
+var (
+	boolValues = []string{"0", "1", "on", "off", "y", "n", "yes", "no", "true", "false"}
+
+	// Catalog is the known kernel parameters, the unknown ones are accepted unchecked
+	Catalog = []*Parameter{
+		{Name: "console", Desc: "Output console device and options, i.e ttyS0,115200n8",
+			Type: ValueString, Repeatable: true},
+		{Name: "quiet", Desc: "Disable most kernel log messages", Type: ValueNone},
+		{Name: "splash", Desc: "Show a boot splash screen", Type: ValueNone},
+		{Name: "loglevel", Desc: "Console log level, 0 (emergency) to 7 (debug)", Type: ValueInt, Max: 7},
+		{Name: "init", Desc: "Program run as init instead of /sbin/init", Type: ValueString},
+		{Name: "rw", Desc: "Mount the root file system read-write", Type: ValueNone},
+		{Name: "ro", Desc: "Mount the root file system read-only", Type: ValueNone},
+		{Name: "nomodeset", Desc: "Disable kernel mode setting of the video drivers", Type: ValueNone},
+		{Name: "intel_iommu", Desc: "Intel IOMMU driver options", Type: ValueEnum, List: true,
+			Values: []string{"on", "off", "igfx_off", "forcedac", "strict", "sp_off", "sm_on", "tboot_noforce"}},
+		{Name: "iommu", Desc: "IOMMU mode", Type: ValueEnum,
+			Values: []string{"off", "force", "noforce", "pt", "nopt", "soft", "merge", "nomerge"}},
+		{Name: "mitigations", Desc: "CPU vulnerabilities mitigations", Type: ValueEnum,
+			Values: []string{"off", "auto", "auto,nosmt"}},
+		{Name: "nosmt", Desc: "Disable symmetric multithreading", Type: ValueNone},
+		{Name: "i915.modeset", Desc: "Intel graphics kernel mode setting, -1 for auto", Type: ValueInt,
+			Min: -1, Max: 1},
+		{Name: "rd.luks", Desc: "Enable or disable the initrd encrypted devices setup", Type: ValueBool},
+		{Name: "rd.luks.uuid", Desc: "UUID of an encrypted device to unlock in the initrd",
+			Type: ValueString, Repeatable: true},
+		{Name: "rd.luks.name", Desc: "UUID=name of an encrypted device to unlock in the initrd",
+			Type: ValueString, Repeatable: true},
+		{Name: "rd.luks.*", Desc: "Encrypted devices setup options of the initrd", Type: ValueString,
+			Repeatable: true},
+		{Name: "systemd.unit", Desc: "Unit systemd activates at boot", Type: ValueString},
+		{Name: "systemd.*", Desc: "systemd options", Type: ValueString, Repeatable: true},
+		{Name: "module_blacklist", Desc: "Comma separated modules never loaded", Type: ValueString},
+		{Name: "modprobe.blacklist", Desc: "Comma separated modules not loaded by modprobe",
+			Type: ValueString},
+		{Name: "panic", Desc: "Seconds before rebooting on a kernel panic, -1 to reboot immediately",
+			Type: ValueInt, Min: -1},
+	}
+)
+
+// SplitArgument returns the name and value of a kernel argument, hasValue is set if
+// the argument has a value part, even an empty one
+func SplitArgument(arg string) (name string, value string, hasValue bool) {
+	idx := strings.Index(arg, "=")
+	if idx < 0 {
+		return arg, "", false
+	}
+
+	return arg[:idx], arg[idx+1:], true
+}
+
+func (p *Parameter) matches(name string) bool {
+	if strings.HasSuffix(p.Name, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(p.Name, "*"))
+	}
+
+	return p.Name == name
+}
+
+// LookupParameter returns the catalog parameter named name, exact names take
+// precedence over the wildcard ones, nil if the parameter is unknown
+func LookupParameter(name string) *Parameter {
+	var wildcard *Parameter
+
+	for _, curr := range Catalog {
+		if curr.Name == name {
+			return curr
+		}
+
+		if wildcard == nil && curr.matches(name) {
+			wildcard = curr
+		}
+	}
+
+	return wildcard
+}
+
+// Usage returns the parameter usage, i.e intel_iommu=<on|off|...>
+func (p *Parameter) Usage() string {
+	switch p.Type {
+	case ValueString:
+		return p.Name + "=<value>"
+	case ValueInt:
+		return p.Name + "=<number>"
+	case ValueBool:
+		return p.Name + "=<0|1>"
+	case ValueEnum:
+		return p.Name + "=<" + strings.Join(p.Values, "|") + ">"
+	}
+
+	return p.Name
+}
+
+// ValidateValue checks a parameter's value matches its type
+func (p *Parameter) ValidateValue(value string, hasValue bool) error {
+	if p.Type == ValueNone {
+		if hasValue {
+			return errors.Errorf("%s takes no value", p.Name)
+		}
+		return nil
+	}
+
+	if value == "" {
+		return errors.Errorf("%s requires a value: %s", p.Name, p.Usage())
+	}
+
+	switch p.Type {
+	case ValueInt:
+		v, err := strconv.Atoi(value)
+		if err != nil || v < p.Min || (p.Max > 0 && v > p.Max) {
+			return errors.Errorf("Invalid %s value %q, expected: %s", p.Name, value, p.Usage())
+		}
+	case ValueBool:
+		if !utils.StringSliceContains(boolValues, strings.ToLower(value)) {
+			return errors.Errorf("Invalid %s value %q, expected: %s", p.Name, value, p.Usage())
+		}
+	case ValueEnum:
+		values := []string{value}
+		if p.List {
+			values = strings.Split(value, ",")
+		}
+
+		for _, curr := range values {
+			if !utils.StringSliceContains(p.Values, curr) {
+				return errors.Errorf("Invalid %s value %q, expected: %s", p.Name, curr, p.Usage())
+			}
+		}
+	}
+
+	return nil
+}
+
+// ValidateArgument checks a kernel argument's value if it's a known parameter
+func ValidateArgument(arg string) error {
+	name, value, hasValue := SplitArgument(arg)
+
+	if name == "" {
+		return errors.Errorf("Invalid kernel argument: %q", arg)
+	}
+
+	if p := LookupParameter(name); p != nil {
+		return p.ValidateValue(value, hasValue)
+	}
+
+	return nil
+}
+
+// Warnings returns the non fatal issues of the arguments: duplicated arguments, non
+// repeatable parameters added more than once and conflicting added and removed arguments
+func (a *Arguments) Warnings() []string {
+	result := []string{}
+	seen := map[string]string{}
+
+	for _, curr := range a.Add {
+		name, _, _ := SplitArgument(curr)
+
+		prev, ok := seen[name]
+		seen[name] = curr
+
+		if !ok {
+			continue
+		}
+
+		if prev == curr {
+			result = append(result, fmt.Sprintf("Duplicated argument: %s", curr))
+			continue
+		}
+
+		if p := LookupParameter(name); p == nil || !p.Repeatable {
+			result = append(result, fmt.Sprintf("Conflicting arguments, the last one takes effect: %s %s",
+				prev, curr))
+		}
+	}
+
+	for _, curr := range a.Remove {
+		name, _, hasValue := SplitArgument(curr)
+
+		if utils.StringSliceContains(a.Add, curr) {
+			result = append(result, fmt.Sprintf("Argument both added and removed, it is removed: %s", curr))
+			continue
+		}
+
+		// removing a parameter with a value doesn't remove the other values added
+		if added, ok := seen[name]; ok && hasValue && added != curr {
+			result = append(result, fmt.Sprintf("Removed argument %s does not match added %s", curr, added))
+		}
+	}
+
+	return result
+}
+
+// Complete completes the last word of a command line with the catalog parameter names,
+// the completed command line and the parameters matching the last word are returned
+func Complete(cmdline string) (string, []*Parameter) {
+	idx := strings.LastIndexAny(cmdline, " \t")
+	word := cmdline[idx+1:]
+
+	// the values of an enum parameter are completed after the =
+	if name, value, hasValue := SplitArgument(word); hasValue {
+		p := LookupParameter(name)
+		if p == nil || p.Type != ValueEnum {
+			return cmdline, nil
+		}
+
+		values := []string{}
+		for _, curr := range p.Values {
+			if strings.HasPrefix(curr, value) {
+				values = append(values, curr)
+			}
+		}
+
+		if len(values) == 0 {
+			return cmdline, nil
+		}
+
+		return cmdline[:idx+1] + name + "=" + commonPrefix(values), []*Parameter{p}
+	}
+
+	matches := []*Parameter{}
+	names := []string{}
+
+	for _, curr := range Catalog {
+		name := strings.TrimSuffix(curr.Name, "*")
+		if strings.HasPrefix(name, word) {
+			matches = append(matches, curr)
+
+			if curr.Type != ValueNone && !strings.HasSuffix(curr.Name, "*") {
+				name = name + "="
+			}
+			names = append(names, name)
+		}
+	}
+
+	if len(matches) == 0 {
+		return cmdline, matches
+	}
+
+	return cmdline[:idx+1] + commonPrefix(names), matches
+}
+
+// commonPrefix returns the longest prefix shared by every string
+func commonPrefix(values []string) string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+
+	first := sorted[0]
+	last := sorted[len(sorted)-1]
+
+	idx := 0
+	for idx < len(first) && idx < len(last) && first[idx] == last[idx] {
+		idx++
+	}
+
+	return first[:idx]
+}
@@ -0,0 +1,116 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package kernel
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateArgument(t *testing.T) {
+	tests := []struct {
+		arg   string
+		valid bool
+	}{
+		{"quiet", true},
+		{"quiet=1", false},
+		{"console=ttyS0,115200n8", true},
+		{"console=", false},
+		{"loglevel=7", true},
+		{"loglevel=8", false},
+		{"loglevel=debug", false},
+		{"loglevel=-1", false},
+		{"panic=-1", true},
+		{"panic=-2", false},
+		{"i915.modeset=-1", true},
+		{"i915.modeset=2", false},
+		{"intel_iommu=on,igfx_off", true},
+		{"intel_iommu=on,maybe", false},
+		{"mitigations=auto,nosmt", true},
+		{"mitigations=nosmt", false},
+		{"rd.luks=0", true},
+		{"rd.luks=maybe", false},
+		{"rd.luks.options=discard", true},
+		{"rd.luks.options", false},
+		{"unknown.param=anything", true},
+		{"=value", false},
+	}
+
+	for _, curr := range tests {
+		err := ValidateArgument(curr.arg)
+
+		if curr.valid && err != nil {
+			t.Fatalf("Argument %s should be valid: %v", curr.arg, err)
+		}
+
+		if !curr.valid && err == nil {
+			t.Fatalf("Argument %s should be invalid", curr.arg)
+		}
+	}
+}
+
+func TestLookupParameter(t *testing.T) {
+	if p := LookupParameter("rd.luks.uuid"); p == nil || p.Name != "rd.luks.uuid" {
+		t.Fatalf("Exact parameters should take precedence over wildcards, got: %+v", p)
+	}
+
+	if p := LookupParameter("rd.luks.key"); p == nil || p.Name != "rd.luks.*" {
+		t.Fatalf("Wildcard parameters should match, got: %+v", p)
+	}
+
+	if p := LookupParameter("rd.lvm"); p != nil {
+		t.Fatalf("Unknown parameters should not match, got: %+v", p)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	args := &Arguments{
+		Add:    []string{"quiet", "quiet", "console=tty0", "console=ttyS0", "loglevel=3", "loglevel=7", "iommu=pt"},
+		Remove: []string{"quiet", "iommu=off"},
+	}
+
+	warnings := args.Warnings()
+	expected := []string{
+		"Duplicated argument: quiet",
+		"Conflicting arguments, the last one takes effect: loglevel=3 loglevel=7",
+		"Argument both added and removed, it is removed: quiet",
+		"Removed argument iommu=off does not match added iommu=pt",
+	}
+
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Unexpected warnings: %q", warnings)
+	}
+
+	args = &Arguments{Add: []string{"console=tty0", "console=ttyS0"}}
+	if warnings = args.Warnings(); len(warnings) != 0 {
+		t.Fatalf("Repeatable parameters should not warn: %q", warnings)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	tests := []struct {
+		cmdline   string
+		completed string
+		matches   int
+	}{
+		{"quiet intel_", "quiet intel_iommu=", 1},
+		{"mitig", "mitigations=", 1},
+		{"mitigations=a", "mitigations=auto", 1},
+		{"intel_iommu=ig", "intel_iommu=igfx_off", 1},
+		{"rd.luks.", "rd.luks.", 3},
+		{"qui", "quiet", 1},
+		{"xyz", "xyz", 0},
+		{"console=tty", "console=tty", 0},
+	}
+
+	for _, curr := range tests {
+		completed, matches := Complete(curr.cmdline)
+
+		if completed != curr.completed || len(matches) != curr.matches {
+			t.Fatalf("Completion of %q expected %q (%d matches), got %q (%d matches)",
+				curr.cmdline, curr.completed, curr.matches, completed, len(matches))
+		}
+	}
+}
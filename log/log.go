@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/clearlinux/clr-installer/conf"
 	"github.com/clearlinux/clr-installer/errors"
@@ -47,8 +48,20 @@ var (
 
 	lineLast  string
 	lineCount int
+
+	hookFunc HookFunc
+	tagLevel = map[string]int{
+		"ERR": LogLevelError,
+		"WRN": LogLevelWarning,
+		"INF": LogLevelInfo,
+		"DBG": LogLevelDebug,
+	}
 )
 
+// HookFunc is the type of the function called for every emitted log message, it
+// receives the message's log level and the formatted message
+type HookFunc func(level int, msg string)
+
 func init() {
 	levelMap[LogLevelError] = "LogLevelError"
 	levelMap[LogLevelWarning] = "LogLevelWarning"
@@ -57,6 +70,13 @@ func init() {
 	levelMap[LogLevelVerbose] = "LogLevelVerbose"
 }
 
+// SetHookFunc sets the function to be called for every emitted log message, this is
+// used by frontends which need to forward the log messages i.e the json output
+// of the mass installer. The hook function must not call the log functions.
+func SetHookFunc(f HookFunc) {
+	hookFunc = f
+}
+
 // SetLogLevel sets the default log level to l
 func SetLogLevel(l int) {
 	if l < LogLevelError {
@@ -170,6 +190,11 @@ func logTag(tag string, format string, a ...interface{}) {
 	f := fmt.Sprintf("[%s] %s\n", tag, format)
 	output := fmt.Sprintf(f, a...)
 
+	if hookFunc != nil {
+		prefix := fmt.Sprintf("[%s] ", tag)
+		hookFunc(tagLevel[tag], strings.TrimSuffix(strings.TrimPrefix(output, prefix), "\n"))
+	}
+
 	if level >= LogLevelVerbose {
 		log.Printf(output)
 		return
@@ -309,3 +309,34 @@ func TestGetPreConfFile(t *testing.T) {
 func TestRequestCrashInfo(t *testing.T) {
 	RequestCrashInfo()
 }
+
+func TestHookFunc(t *testing.T) {
+	fh := setLog(t)
+	defer func() { _ = fh.Close() }()
+	defer SetHookFunc(nil)
+
+	SetLogLevel(LogLevelDebug)
+
+	levels := []int{}
+	msgs := []string{}
+
+	SetHookFunc(func(level int, msg string) {
+		levels = append(levels, level)
+		msgs = append(msgs, msg)
+	})
+
+	Warning("hooked warning %d", 1)
+	Error("hooked error")
+
+	if len(msgs) != 2 {
+		t.Fatalf("Expected 2 hooked messages, got: %d", len(msgs))
+	}
+
+	if levels[0] != LogLevelWarning || msgs[0] != "hooked warning 1" {
+		t.Fatalf("Unexpected hooked message: %d %q", levels[0], msgs[0])
+	}
+
+	if levels[1] != LogLevelError || msgs[1] != "hooked error" {
+		t.Fatalf("Unexpected hooked message: %d %q", levels[1], msgs[1])
+	}
+}
@@ -6,13 +6,16 @@ package massinstall
 
 import (
 	"fmt"
+	"os"
 	"strings"
 	"time"
 
 	"github.com/clearlinux/clr-installer/args"
 	"github.com/clearlinux/clr-installer/controller"
 	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/events"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/progress"
 	"github.com/clearlinux/clr-installer/storage"
@@ -25,6 +28,7 @@ type MassInstall struct {
 	prgDesc  string
 	prgIndex int
 	step     int
+	events   events.Emitter
 }
 
 // New creates a new instance of MassInstall frontend implementation
@@ -146,6 +150,60 @@ func shouldReboot() (bool, bool, error) {
 	return valid, reboot, nil
 }
 
+// outputFile returns the file of the machine readable output file descriptor, checked
+// when the arguments are parsed
+func outputFile(options args.Args) *os.File {
+	if options.OutputFD == int(os.Stdout.Fd()) {
+		return os.Stdout
+	}
+
+	return os.NewFile(uintptr(options.OutputFD), fmt.Sprintf("fd%d", options.OutputFD))
+}
+
+// EmitLoadError reports a configuration that could not be loaded with the validation and
+// result events of a failed install, so the machine readable output doesn't just end
+func EmitLoadError(options args.Args, err error) {
+	out := events.NewWriter(outputFile(options))
+
+	if ev := events.NewValidation(err); ev != nil {
+		out.Emit(ev)
+	}
+
+	out.Emit(events.NewResult(err, false, nil))
+}
+
+// setupJSONOutput configures the machine readable output, every progress notification,
+// log message and validation error is emitted as a json object to the requested
+// file descriptor
+func (mi *MassInstall) setupJSONOutput(options args.Args) {
+	mi.events = events.NewWriter(outputFile(options))
+
+	progress.Set(events.NewProgress(mi.events))
+	log.SetHookFunc(events.LogHook(mi.events, options.OutputLogLevel))
+}
+
+// runJSON runs the install reporting the progress and its results as json events
+func (mi *MassInstall) runJSON(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
+	mi.setupJSONOutput(options)
+	defer log.SetHookFunc(nil)
+
+	if md.Version > 0 {
+		mi.events.Emit(events.NewMessage("Config file specifies a target \"version\", forcing auto-update off."))
+	}
+
+	instError := controller.Install(rootDir, md, options)
+
+	if ev := events.NewValidation(instError); ev != nil {
+		mi.events.Emit(ev)
+	}
+
+	// there is no one to ask, the reboot intent is the configured one
+	reboot := instError == nil && md.PostReboot
+	mi.events.Emit(events.NewResult(instError, reboot, controller.VerificationReport()))
+
+	return reboot, instError
+}
+
 // Run is part of the Frontend implementation and is the actual entry point for the
 // "mass installer" frontend
 func (mi *MassInstall) Run(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
@@ -155,15 +213,24 @@ func (mi *MassInstall) Run(md *model.SystemInstall, rootDir string, options args
 	// the command line and will be using the whole disk
 	md.InstallSelected = storage.InstallTarget{WholeDisk: true}
 
-	progress.Set(mi)
-
 	log.Debug("Starting install")
 
+	if options.OutputFormat == args.OutputJSON {
+		return mi.runJSON(md, rootDir, options)
+	}
+
+	progress.Set(mi)
+
 	if md.Version > 0 {
 		fmt.Println("Config file specifies a target \"version\", forcing auto-update off.")
 	}
 
 	instError = controller.Install(rootDir, md, options)
+
+	if options.PrintMetrics {
+		fmt.Printf("\n%s\n", metrics.Summary())
+	}
+
 	if instError != nil {
 		if !errors.IsValidationError(instError) {
 			fmt.Printf("ERROR: Installation has failed!\n")
@@ -0,0 +1,253 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// StatusRunning is the status of a phase or command not yet finished
+	StatusRunning = "running"
+
+	// StatusSuccess is the status of a phase or command successfully finished
+	StatusSuccess = "success"
+
+	// StatusFailure is the status of a phase or command which has failed
+	StatusFailure = "failure"
+
+	// maxCommandLength is the max length of a command line displayed in the summary
+	maxCommandLength = 60
+)
+
+// Phase holds the timing information of a single progress unit
+type Phase struct {
+	Desc     string    `json:"desc"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Status   string    `json:"status"`
+}
+
+// Command holds the timing information of a single external command execution
+type Command struct {
+	Cmd      string    `json:"cmd"`
+	Start    time.Time `json:"start"`
+	Duration float64   `json:"duration"`
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Report is the install metrics report, all the durations are expressed in seconds.
+// Until is the install step End and Total stop at, empty if they cover the whole install.
+type Report struct {
+	Start                time.Time  `json:"start"`
+	End                  time.Time  `json:"end"`
+	Total                float64    `json:"total"`
+	Until                string     `json:"until,omitempty"`
+	SwupdDownloadedBytes uint64     `json:"swupdDownloadedBytes"`
+	Phases               []*Phase   `json:"phases"`
+	Commands             []*Command `json:"commands"`
+}
+
+var (
+	mutex   sync.Mutex
+	current = newReport()
+)
+
+func newReport() *Report {
+	return &Report{
+		Start:    time.Now(),
+		Phases:   []*Phase{},
+		Commands: []*Command{},
+	}
+}
+
+func since(start time.Time) float64 {
+	return time.Since(start).Seconds()
+}
+
+func statusString(success bool) string {
+	if success {
+		return StatusSuccess
+	}
+
+	return StatusFailure
+}
+
+// Reset discards the collected metrics and starts a new report
+func Reset() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current = newReport()
+}
+
+// StartPhase registers the beginning of a new progress unit described by desc
+func StartPhase(desc string) *Phase {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	phase := &Phase{Desc: desc, Start: time.Now(), Status: StatusRunning}
+	current.Phases = append(current.Phases, phase)
+
+	return phase
+}
+
+// Finish registers the end of a progress unit, success tells if the
+// unit has completed successfully or not
+func (ph *Phase) Finish(success bool) {
+	if ph == nil {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	// a phase may be notified more than once, we only care about the first one
+	if ph.Status != StatusRunning {
+		return
+	}
+
+	ph.Duration = since(ph.Start)
+	ph.Status = statusString(success)
+}
+
+// StartCommand registers the beginning of a new external command execution
+func StartCommand(args []string) *Command {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	command := &Command{Cmd: strings.Join(args, " "), Start: time.Now(), Status: StatusRunning}
+	current.Commands = append(current.Commands, command)
+
+	return command
+}
+
+// Finish registers the end of an external command execution, err is the error
+// returned by the execution, if any
+func (cm *Command) Finish(err error) {
+	if cm == nil {
+		return
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	cm.Duration = since(cm.Start)
+	cm.Status = statusString(err == nil)
+
+	if err != nil {
+		cm.Error = err.Error()
+	}
+}
+
+// AddDownloadedBytes accounts size bytes to the total of bytes downloaded by swupd
+func AddDownloadedBytes(size uint64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current.SwupdDownloadedBytes += size
+}
+
+// Finish marks the end of the report and computes the total install time
+func Finish() {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current.End = time.Now()
+	current.Total = current.End.Sub(current.Start).Seconds()
+	current.Until = ""
+}
+
+// FinishUntil marks the end of the report at the install step described by until, the
+// report is written before the install has finished. Finish marks the real end.
+func FinishUntil(until string) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	current.End = time.Now()
+	current.Total = current.End.Sub(current.Start).Seconds()
+	current.Until = until
+}
+
+// GetReport returns a copy of the current report
+func GetReport() *Report {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	result := *current
+	result.Phases = []*Phase{}
+	result.Commands = []*Command{}
+
+	for _, curr := range current.Phases {
+		phase := *curr
+		result.Phases = append(result.Phases, &phase)
+	}
+
+	for _, curr := range current.Commands {
+		command := *curr
+		result.Commands = append(result.Commands, &command)
+	}
+
+	return &result
+}
+
+// WriteFile writes a json formatted representation of the current report into
+// the provided file path
+func WriteFile(path string) error {
+	data, err := json.MarshalIndent(GetReport(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Summary returns a human readable table with the phases durations and the slowest
+// executed commands
+func Summary() string {
+	report := GetReport()
+	buf := bytes.NewBuffer(nil)
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "PHASE\tSTATUS\tDURATION\n")
+	for _, curr := range report.Phases {
+		fmt.Fprintf(w, "%s\t%s\t%.2fs\n", curr.Desc, curr.Status, curr.Duration)
+	}
+
+	commands := report.Commands
+	sort.SliceStable(commands, func(i, j int) bool {
+		return commands[i].Duration > commands[j].Duration
+	})
+
+	if len(commands) > 5 {
+		commands = commands[:5]
+	}
+
+	fmt.Fprintf(w, "\nSLOWEST COMMANDS\tSTATUS\tDURATION\n")
+	for _, curr := range commands {
+		command := curr.Cmd
+		if len(command) > maxCommandLength {
+			command = command[:maxCommandLength-3] + "..."
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%.2fs\n", command, curr.Status, curr.Duration)
+	}
+
+	fmt.Fprintf(w, "\nSwupd downloaded bytes:\t%d\n", report.SwupdDownloadedBytes)
+	fmt.Fprintf(w, "Total time:\t%.2fs\n", report.Total)
+
+	_ = w.Flush()
+
+	return buf.String()
+}
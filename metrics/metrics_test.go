@@ -0,0 +1,131 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPhases(t *testing.T) {
+	Reset()
+
+	ok := StartPhase("ok phase")
+	failed := StartPhase("failed phase")
+	running := StartPhase("running phase")
+
+	ok.Finish(true)
+	failed.Finish(false)
+
+	// a second notification must not override the first one
+	ok.Finish(false)
+
+	report := GetReport()
+
+	if len(report.Phases) != 3 {
+		t.Fatalf("Expected 3 phases, got: %d", len(report.Phases))
+	}
+
+	expected := []string{StatusSuccess, StatusFailure, StatusRunning}
+	for i, curr := range report.Phases {
+		if curr.Status != expected[i] {
+			t.Fatalf("Phase %q should have status %q, got: %q", curr.Desc, expected[i], curr.Status)
+		}
+	}
+
+	running.Finish(true)
+	if report.Phases[2].Status != StatusRunning {
+		t.Fatal("GetReport() should return a copy of the current report")
+	}
+
+	// Finish() must be safe on nil phases
+	var phase *Phase
+	phase.Finish(true)
+}
+
+func TestCommands(t *testing.T) {
+	Reset()
+
+	StartCommand([]string{"true"}).Finish(nil)
+	StartCommand([]string{"false", "--arg"}).Finish(fmt.Errorf("exit status 1"))
+
+	AddDownloadedBytes(100)
+	AddDownloadedBytes(23)
+
+	Finish()
+	report := GetReport()
+
+	if len(report.Commands) != 2 {
+		t.Fatalf("Expected 2 commands, got: %d", len(report.Commands))
+	}
+
+	if report.Commands[1].Cmd != "false --arg" || report.Commands[1].Error != "exit status 1" {
+		t.Fatalf("Unexpected command entry: %+v", report.Commands[1])
+	}
+
+	if report.SwupdDownloadedBytes != 123 {
+		t.Fatalf("Expected 123 downloaded bytes, got: %d", report.SwupdDownloadedBytes)
+	}
+
+	if report.End.Before(report.Start) {
+		t.Fatal("Report end time should not be before the start time")
+	}
+
+	if report.Until != "" {
+		t.Fatalf("A finished report should cover the whole install, got until: %q", report.Until)
+	}
+
+	summary := Summary()
+	for _, curr := range []string{"false --arg", "Total time:", "123"} {
+		if !strings.Contains(summary, curr) {
+			t.Fatalf("Summary should contain %q, got: %s", curr, summary)
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	Reset()
+	StartPhase("write phase").Finish(true)
+	FinishUntil("saving the results")
+
+	dir, err := ioutil.TempDir("", "clr-installer-utest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "metrics.json")
+	if err = WriteFile(path); err != nil {
+		t.Fatalf("Failed to write metrics file: %s", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := Report{}
+	if err = json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to parse metrics file: %s", err)
+	}
+
+	if len(report.Phases) != 1 || report.Phases[0].Desc != "write phase" {
+		t.Fatalf("Unexpected phases in metrics file: %+v", report.Phases)
+	}
+
+	if report.Until != "saving the results" {
+		t.Fatalf("The metrics file should tell where its total stops, got: %q", report.Until)
+	}
+
+	Finish()
+	if report = *GetReport(); report.Until != "" {
+		t.Fatalf("Finish should mark the real end of the report, got until: %q", report.Until)
+	}
+}
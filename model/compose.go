@@ -0,0 +1,337 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/proxy"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	extendsField = "extends"
+	includeField = "include"
+
+	// secretMask replaces the plain text secrets of the printed configurations
+	secretMask = "********"
+)
+
+// listKeys are the fields identifying the items of the keyed configuration lists, an
+// overlay item replaces the base item with the same key instead of being appended
+var listKeys = map[string]string{
+	"targetMedia":       "name",
+	"children":          "name",
+	"blockDevices":      "name",
+	"networkInterfaces": "name",
+	"users":             "login",
+	"kernels":           "bundle",
+	"files":             "path",
+}
+
+// ConfigFiles is a list of configuration files, the YAML value is either a single
+// file or a list of files
+type ConfigFiles []string
+
+// UnmarshalYAML decodes a single configuration file or a list of configuration files
+func (cf *ConfigFiles) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var file string
+
+	if err := unmarshal(&file); err == nil {
+		*cf = ConfigFiles{file}
+		return nil
+	}
+
+	var files []string
+	if err := unmarshal(&files); err != nil {
+		return err
+	}
+
+	*cf = files
+	return nil
+}
+
+// ComposeFiles returns the effective YAML configuration of the configuration files merged
+// in order, each one merged with the files it extends and includes. The plain text secrets
+// are masked and the files of older schema versions migrated.
+func ComposeFiles(paths []string) ([]byte, error) {
+	doc, _, _, err := composeFiles(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := yaml.Marshal(redactSecrets(doc))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return content, nil
+}
+
+// composeFiles merges the configuration files, composed is false if the document is the
+// one of a single file with neither extends nor include. It returns the deprecated fields
+// of the files too.
+func composeFiles(paths []string) (yaml.MapSlice, bool, []string, error) {
+	var result interface{}
+	composed := len(paths) > 1
+	warnings := []string{}
+
+	for _, curr := range paths {
+		doc, fileComposed, err := composeFile(curr, nil, &warnings)
+		if err != nil {
+			return nil, false, nil, err
+		}
+
+		composed = composed || fileComposed
+		result = mergeValue("", result, doc)
+	}
+
+	doc, _ := result.(yaml.MapSlice)
+	return doc, composed, warnings, nil
+}
+
+// composeFile returns the document of the configuration file merged on top of the files
+// it extends, and then the files it includes merged on top of it. The relative paths are
+// relative to the file's directory, chain holds the files being composed to detect cycles.
+// The files are migrated to the current schema version, warnings collects their deprecated
+// fields.
+func composeFile(path string, chain []string, warnings *[]string) (yaml.MapSlice, bool, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, false, errors.Wrap(err)
+	}
+
+	if utils.StringSliceContains(chain, abs) {
+		return nil, false, errors.ValidationError{File: path,
+			What: fmt.Sprintf("Configuration files cycle: %s", strings.Join(append(chain, abs), " -> "))}
+	}
+
+	content, deprecated, err := readConfigFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	*warnings = append(*warnings, deprecated...)
+
+	return composeContent(path, filepath.Dir(path), content, append(chain[:len(chain):len(chain)], abs),
+		warnings)
+}
+
+// composeContent returns the document of a migrated configuration merged as composeFile does,
+// path is its file, if any, and the relative paths are relative to dir. chain holds the files
+// being composed, including this one.
+func composeContent(path string, dir string, content []byte, chain []string,
+	warnings *[]string) (yaml.MapSlice, bool, error) {
+	// each file is checked on its own so the errors point to its lines
+	var partial SystemInstall
+	if err := yaml.UnmarshalStrict(content, &partial); err != nil {
+		return nil, false, fileError(path, locateFields(content).decodeError(err))
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, false, errors.Wrap(err)
+	}
+
+	own := yaml.MapSlice{}
+	for _, curr := range doc {
+		if curr.Key != extendsField && curr.Key != includeField {
+			own = append(own, curr)
+		}
+	}
+
+	if len(partial.Extends) == 0 && len(partial.Include) == 0 {
+		return own, false, nil
+	}
+
+	var result interface{}
+
+	compose := func(files ConfigFiles) error {
+		for _, curr := range files {
+			if !filepath.IsAbs(curr) {
+				curr = filepath.Join(dir, curr)
+			}
+
+			sub, _, err := composeFile(curr, chain, warnings)
+			if err != nil {
+				return err
+			}
+
+			result = mergeValue("", result, sub)
+		}
+
+		return nil
+	}
+
+	if err := compose(partial.Extends); err != nil {
+		return nil, false, err
+	}
+
+	result = mergeValue("", result, own)
+
+	if err := compose(partial.Include); err != nil {
+		return nil, false, err
+	}
+
+	return result.(yaml.MapSlice), true, nil
+}
+
+// redactSecrets returns the document with the plain text secrets masked, the encrypted
+// passwords and the secret references are kept
+func redactSecrets(value interface{}) interface{} {
+	switch v := value.(type) {
+	case yaml.MapSlice:
+		result := yaml.MapSlice{}
+
+		for _, curr := range v {
+			switch curr.Key {
+			case "plain":
+				curr.Value = secretMask
+			case "cryptPassphrase":
+				if isScalar(curr.Value) {
+					curr.Value = secretMask
+				}
+			case "httpsProxy":
+				curr.Value = proxy.Redact(fmt.Sprint(curr.Value))
+			}
+
+			result = append(result, yaml.MapItem{Key: curr.Key, Value: redactSecrets(curr.Value)})
+		}
+
+		return result
+	case []interface{}:
+		result := []interface{}{}
+
+		for _, curr := range v {
+			result = append(result, redactSecrets(curr))
+		}
+
+		return result
+	}
+
+	return value
+}
+
+// fileError sets the configuration file of a validation error
+func fileError(path string, err error) error {
+	ve, ok := err.(errors.ValidationError)
+	if !ok || ve.File != "" {
+		return err
+	}
+
+	ve.File = path
+	return ve
+}
+
+// mergeValue merges the overlay value of the field on top of the base one, the maps are
+// deep merged, the keyed lists items replaced by key and the other lists appended
+func mergeValue(field string, base interface{}, overlay interface{}) interface{} {
+	switch ov := overlay.(type) {
+	case yaml.MapSlice:
+		if bv, ok := base.(yaml.MapSlice); ok {
+			return mergeMaps(bv, ov)
+		}
+	case []interface{}:
+		if bv, ok := base.([]interface{}); ok {
+			return mergeLists(field, bv, ov)
+		}
+	}
+
+	return overlay
+}
+
+// mergeMaps deep merges the overlay map on top of the base one, a null overlay value
+// removes the base field
+func mergeMaps(base yaml.MapSlice, overlay yaml.MapSlice) yaml.MapSlice {
+	result := append(yaml.MapSlice{}, base...)
+
+	for _, curr := range overlay {
+		idx := mapIndex(result, curr.Key)
+
+		switch {
+		case curr.Value == nil && idx >= 0:
+			result = append(result[:idx], result[idx+1:]...)
+		case curr.Value == nil:
+		case idx >= 0:
+			result[idx].Value = mergeValue(fmt.Sprint(curr.Key), result[idx].Value, curr.Value)
+		default:
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
+
+// mergeLists appends the overlay items to the base ones, the items of a keyed list
+// replace the base item with the same key and the duplicated scalars are dropped
+func mergeLists(field string, base []interface{}, overlay []interface{}) []interface{} {
+	result := append([]interface{}{}, base...)
+	key := listKeys[field]
+
+	for _, curr := range overlay {
+		idx := listIndex(result, key, curr)
+
+		if idx >= 0 {
+			result[idx] = curr
+			continue
+		}
+
+		result = append(result, curr)
+	}
+
+	return result
+}
+
+// mapIndex returns the index of the key in the map, -1 if not found
+func mapIndex(m yaml.MapSlice, key interface{}) int {
+	for idx, curr := range m {
+		if curr.Key == key {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// listIndex returns the index of the list item matching item, the same key value for a
+// keyed list item or the same value for a scalar, -1 if not found
+func listIndex(list []interface{}, key string, item interface{}) int {
+	im, isMap := item.(yaml.MapSlice)
+
+	for idx, curr := range list {
+		if !isMap {
+			if isScalar(item) && isScalar(curr) && curr == item {
+				return idx
+			}
+			continue
+		}
+
+		cm, ok := curr.(yaml.MapSlice)
+		if !ok || key == "" {
+			continue
+		}
+
+		ii, ci := mapIndex(im, key), mapIndex(cm, key)
+		if ii >= 0 && ci >= 0 && isScalar(im[ii].Value) && im[ii].Value == cm[ci].Value {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// isScalar returns true if the decoded YAML value is neither a map nor a list
+func isScalar(value interface{}) bool {
+	switch value.(type) {
+	case yaml.MapSlice, []interface{}:
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,129 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestMergeValue(t *testing.T) {
+	tests := []struct {
+		base     string
+		overlay  string
+		expected string
+	}{
+		{"keyboard: us\n", "keyboard: fr\n", "keyboard: fr\n"},
+		{"bundles: [os-core, vim]\n", "bundles: [vim, git]\n", "bundles: [os-core, vim, git]\n"},
+		{"kernel-arguments: {add: [quiet]}\n", "kernel-arguments: {remove: [rw]}\n",
+			"kernel-arguments: {add: [quiet], remove: [rw]}\n"},
+		{"keyboard: us\nhostname: base\n", "hostname: null\n", "keyboard: us\n"},
+		{"users: [{login: a, admin: true}, {login: b}]\n", "users: [{login: a}, {login: c}]\n",
+			"users: [{login: a}, {login: b}, {login: c}]\n"},
+		{"targetMedia: [{name: sda, children: [{name: sda1, size: 1G}]}]\n",
+			"targetMedia: [{name: sda, children: [{name: sda2, size: 2G}]}]\n",
+			"targetMedia: [{name: sda, children: [{name: sda2, size: 2G}]}]\n"},
+		{"post-install: [{cmd: a}]\n", "post-install: [{cmd: a}, {cmd: b}]\n",
+			"post-install: [{cmd: a}, {cmd: a}, {cmd: b}]\n"},
+	}
+
+	for _, curr := range tests {
+		var base, overlay, expected yaml.MapSlice
+
+		for _, doc := range []struct {
+			content string
+			value   *yaml.MapSlice
+		}{{curr.base, &base}, {curr.overlay, &overlay}, {curr.expected, &expected}} {
+			if err := yaml.Unmarshal([]byte(doc.content), doc.value); err != nil {
+				t.Fatalf("Failed to parse %s: %v", doc.content, err)
+			}
+		}
+
+		if result := mergeValue("", base, overlay); !reflect.DeepEqual(result, expected) {
+			t.Fatalf("Merging %q on top of %q should result in %q, got: %v", curr.overlay, curr.base,
+				curr.expected, result)
+		}
+	}
+}
+
+func writeConfigs(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestLoadFilesComposition(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compose-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	writeConfigs(t, dir, map[string]string{
+		"base.yaml":   "bundles: [os-core]\nkeyboard: us\nkernel: kernel-native\nhostname: base\n",
+		"hooks.yaml":  "post-install:\n- cmd: echo done\n",
+		"kvm.yaml":    "extends: base.yaml\ninclude: [hooks.yaml]\nbundles: [vim]\nkernel: kernel-kvm\n",
+		"site.yaml":   "hostname: null\nkeyboard: fr\n",
+		"cycle.yaml":  "extends: cycle2.yaml\n",
+		"cycle2.yaml": "include: cycle.yaml\n",
+		"typo.yaml":   "extends: base.yaml\nbundels: [vim]\n",
+	})
+
+	si, err := LoadFiles([]string{filepath.Join(dir, "kvm.yaml"), filepath.Join(dir, "site.yaml")}, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load the composed configuration: %v", err)
+	}
+
+	if !reflect.DeepEqual(si.Bundles, []string{"os-core", "vim"}) {
+		t.Fatalf("Unexpected composed bundles: %v", si.Bundles)
+	}
+
+	if si.Kernel.Bundle != "kernel-kvm" || si.Keyboard.Code != "fr" || si.Hostname != "" {
+		t.Fatalf("Unexpected composed fields: %s %s %q", si.Kernel.Bundle, si.Keyboard.Code, si.Hostname)
+	}
+
+	if len(si.PostInstall) != 1 || si.PostInstall[0].Cmd != "echo done" {
+		t.Fatalf("The included hooks should be set, got: %v", si.PostInstall)
+	}
+
+	if si.locations != nil || len(si.Extends) > 0 || len(si.Include) > 0 {
+		t.Fatal("A composed configuration should have neither locations nor composition fields")
+	}
+
+	if _, err = LoadFile(filepath.Join(dir, "cycle.yaml"), args.Args{}); err == nil ||
+		!strings.Contains(err.Error(), "cycle") {
+		t.Fatalf("The configuration files cycle should fail, got: %v", err)
+	}
+
+	_, err = LoadFile(filepath.Join(dir, "typo.yaml"), args.Args{})
+	if ve, ok := err.(errors.ValidationError); !ok || ve.Line != 2 || !strings.HasSuffix(ve.File, "typo.yaml") {
+		t.Fatalf("Expected a validation error for the line 2 of typo.yaml, got: %v", err)
+	}
+
+	if _, err = LoadFiles([]string{filepath.Join(dir, "base.yaml"), filepath.Join(dir, "missing.yaml")},
+		args.Args{}); err == nil {
+		t.Fatal("A missing overlay should fail")
+	}
+
+	content, err := ComposeFiles([]string{filepath.Join(dir, "kvm.yaml")})
+	if err != nil {
+		t.Fatalf("Failed to compose the configuration: %v", err)
+	}
+
+	if strings.Contains(string(content), "extends") || !strings.Contains(string(content), "kernel-kvm") {
+		t.Fatalf("Unexpected effective configuration:\n%s", content)
+	}
+}
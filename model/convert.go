@@ -0,0 +1,379 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/telemetry"
+	"github.com/clearlinux/clr-installer/timezone"
+	"github.com/clearlinux/clr-installer/user"
+)
+
+const (
+	// FormatIster is the legacy ister JSON configuration format
+	FormatIster = "ister"
+
+	// FormatKickstart is the Anaconda kickstart configuration format
+	FormatKickstart = "kickstart"
+
+	// FormatCloudInit is the cloud-init, and autoinstall, configuration format
+	FormatCloudInit = "cloud-init"
+
+	// convertedDisk is the target disk when the converted configuration names none
+	convertedDisk = "sda"
+
+	// the default layout partitions, as the installer's standard partitions
+	defaultBootSize = "150M"
+	defaultSwapSize = "256M"
+)
+
+// packageBundles maps the common packages and package groups of other distributions to the
+// Clear Linux bundles providing them
+var packageBundles = map[string]string{
+	"@core":                        "os-core",
+	"@base":                        "os-core-update",
+	"@standard":                    "os-core-update",
+	"@^minimal-environment":        "os-core",
+	"@^server-product-environment": "os-core-update",
+	"@development-tools":           "c-basic",
+	"ubuntu-server":                "os-core-update",
+	"ubuntu-minimal":               "os-core",
+	"openssh":                      "openssh-server",
+	"openssh-server":               "openssh-server",
+	"openssh-clients":              "openssh-server",
+	"vim":                          "vim",
+	"vim-enhanced":                 "vim",
+	"vim-minimal":                  "vim",
+	"emacs":                        "emacs",
+	"nano":                         "nano",
+	"git":                          "git",
+	"curl":                         "curl",
+	"wget":                         "wget",
+	"rsync":                        "rsync",
+	"tmux":                         "tmux",
+	"htop":                         "htop",
+	"sudo":                         "sudo",
+	"gcc":                          "c-basic",
+	"make":                         "c-basic",
+	"build-essential":              "c-basic",
+	"python":                       "python3-basic",
+	"python3":                      "python3-basic",
+	"python3-pip":                  "python3-basic",
+	"golang":                       "go-basic",
+	"golang-go":                    "go-basic",
+	"nodejs":                       "nodejs-basic",
+	"docker":                       "containers-basic",
+	"docker-ce":                    "containers-basic",
+	"docker.io":                    "containers-basic",
+	"podman":                       "containers-basic",
+	"nginx":                        "nginx",
+	"httpd":                        "httpd",
+	"apache2":                      "httpd",
+	"postgresql":                   "postgresql",
+	"postgresql-server":            "postgresql",
+	"mariadb-server":               "mariadb",
+	"mysql-server":                 "mariadb",
+	"redis":                        "redis-native",
+	"redis-server":                 "redis-native",
+	"NetworkManager":               "NetworkManager",
+	"network-manager":              "NetworkManager",
+	"chrony":                       "network-basic",
+	"net-tools":                    "network-basic",
+	"iproute":                      "network-basic",
+	"iproute2":                     "network-basic",
+	"lvm2":                         "storage-utils",
+	"mdadm":                        "storage-utils",
+	"cryptsetup":                   "storage-utils",
+}
+
+// converter holds the configuration being converted from another format and the
+// unsupported directives found
+type converter struct {
+	si       *SystemInstall
+	warnings []string
+	disks    map[string]*storage.BlockDevice
+}
+
+func newConverter() *converter {
+	return &converter{si: &SystemInstall{}, disks: map[string]*storage.BlockDevice{}}
+}
+
+// warn records an unsupported, or partially supported, directive
+func (c *converter) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// addPackages adds the bundles of the packages, the packages with no known bundle are reported
+func (c *converter) addPackages(packages []string) {
+	for _, curr := range packages {
+		curr = strings.TrimSpace(curr)
+		if curr == "" {
+			continue
+		}
+
+		bundle, ok := packageBundles[curr]
+		if !ok {
+			c.warn("No bundle known for the package %q", curr)
+			continue
+		}
+
+		c.si.AddBundle(bundle)
+	}
+}
+
+// disk returns the target disk, added along with its block device alias on first use
+func (c *converter) disk(name string) *storage.BlockDevice {
+	name = strings.TrimPrefix(name, "/dev/")
+	if name == "" {
+		name = convertedDisk
+	}
+
+	if bd, ok := c.disks[name]; ok {
+		return bd
+	}
+
+	alias := strings.Replace(name, "/", "-", -1)
+	c.si.StorageAlias = append(c.si.StorageAlias, &StorageAlias{Name: alias, File: "/dev/" + name})
+
+	bd := &storage.BlockDevice{Name: "${" + alias + "}", Type: storage.BlockDeviceTypeDisk}
+	c.disks[name] = bd
+	c.si.AddTargetMedia(bd)
+
+	return bd
+}
+
+// addPartition adds a partition to the disk, a size of 0 takes the remaining space
+func (c *converter) addPartition(disk *storage.BlockDevice, mount string, fstype string, size uint64) {
+	disk.Children = append(disk.Children, &storage.BlockDevice{
+		Name:       fmt.Sprintf("%s%d", disk.Name, len(disk.Children)+1),
+		Type:       storage.BlockDeviceTypePart,
+		FsType:     fstype,
+		MountPoint: mount,
+		Size:       size,
+	})
+}
+
+// defaultLayout adds the standard boot, swap and root partitions to the disk
+func (c *converter) defaultLayout(disk *storage.BlockDevice) {
+	bootSize, _ := storage.ParseVolumeSize(defaultBootSize)
+	swapSize, _ := storage.ParseVolumeSize(defaultSwapSize)
+
+	disk.Children = nil
+	c.addPartition(disk, "/boot", "vfat", bootSize)
+	c.addPartition(disk, "", "swap", swapSize)
+	c.addPartition(disk, "/", "ext4", 0)
+}
+
+// user returns the user with the login, added on first use
+func (c *converter) user(login string) *user.User {
+	for _, curr := range c.si.Users {
+		if curr.Login == login {
+			return curr
+		}
+	}
+
+	usr := &user.User{Login: login}
+	c.si.AddUser(usr)
+
+	return usr
+}
+
+// setPassword sets the user's encrypted password, or encrypts the plain text one
+func (c *converter) setPassword(usr *user.User, password string, encrypted bool) {
+	if encrypted {
+		usr.Password = password
+		return
+	}
+
+	if err := usr.SetPassword(password); err != nil {
+		c.warn("Could not encrypt the password of %s: %v", usr.Login, err)
+	}
+}
+
+// finish returns the converted configuration, the EFI system partition is mounted to /boot
+// and the fields the other formats may lack are set to the installer defaults
+func (c *converter) finish() (*SystemInstall, []string) {
+	for _, disk := range c.si.TargetMedias {
+		c.fixBootPartition(disk)
+	}
+
+	if c.si.Keyboard == nil {
+		c.si.Keyboard = &keyboard.Keymap{Code: keyboard.DefaultKeyboard}
+	}
+
+	if c.si.Language == nil {
+		c.si.Language = &language.Language{Code: language.DefaultLanguage}
+	}
+
+	if c.si.Timezone == nil {
+		c.si.Timezone = &timezone.TimeZone{Code: timezone.DefaultTimezone}
+	}
+
+	if c.si.Telemetry == nil {
+		c.si.Telemetry = &telemetry.Telemetry{Enabled: false}
+	}
+
+	if c.si.Kernel == nil {
+		c.si.Kernel = &kernel.Kernel{Bundle: "kernel-native"}
+	}
+
+	for _, curr := range []string{"os-core", "os-core-update"} {
+		c.si.AddBundle(curr)
+	}
+
+	return c.si, c.warnings
+}
+
+// fixBootPartition mounts the /boot/efi partition to /boot, the installer's EFI system
+// partition, dropping the /boot partition
+func (c *converter) fixBootPartition(disk *storage.BlockDevice) {
+	var efi *storage.BlockDevice
+
+	for _, curr := range disk.Children {
+		if curr.MountPoint == "/boot/efi" {
+			efi = curr
+		}
+	}
+
+	if efi == nil {
+		return
+	}
+
+	children := []*storage.BlockDevice{}
+	for _, curr := range disk.Children {
+		if curr.MountPoint == "/boot" {
+			c.warn("The /boot partition is dropped, /boot is the EFI system partition")
+			continue
+		}
+		children = append(children, curr)
+	}
+
+	efi.MountPoint = "/boot"
+	efi.FsType = "vfat"
+
+	disk.Children = nil
+	for _, curr := range children {
+		c.addPartition(disk, curr.MountPoint, curr.FsType, curr.Size)
+	}
+}
+
+// DetectConfigFormat returns the format of a configuration file to convert: ister files
+// end with .json, cloud-init files start with #cloud-config or have an autoinstall section,
+// any other file is a kickstart
+func DetectConfigFormat(path string) (string, error) {
+	if filepath.Ext(path) == ".json" {
+		return FormatIster, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	if bytes.HasPrefix(content, []byte("#cloud-config")) {
+		return FormatCloudInit, nil
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "autoinstall:") {
+			return FormatCloudInit, nil
+		}
+	}
+
+	return FormatKickstart, nil
+}
+
+// ConvertConfigFile converts an ister, kickstart or cloud-init configuration file to a
+// clr-installer YAML configuration file written next to it, returning the YAML file path
+// and the unsupported directives
+func ConvertConfigFile(cf string) (string, []string, error) {
+	format, err := DetectConfigFormat(cf)
+	if err != nil {
+		return cf, nil, err
+	}
+
+	if format == FormatIster {
+		path, err := JSONtoYAMLConfig(cf)
+		return path, nil, err
+	}
+
+	content, err := ioutil.ReadFile(cf)
+	if err != nil {
+		return cf, nil, errors.Wrap(err)
+	}
+
+	var (
+		si       *SystemInstall
+		warnings []string
+	)
+
+	if format == FormatKickstart {
+		si, warnings, err = ConvertKickstart(content)
+	} else {
+		si, warnings, err = ConvertCloudInit(content)
+	}
+
+	if err != nil {
+		return cf, nil, err
+	}
+
+	path := strings.TrimSuffix(cf, filepath.Ext(cf)) + ".yaml"
+	if path == cf {
+		path = strings.TrimSuffix(cf, filepath.Ext(cf)) + "-clr-installer.yaml"
+	}
+
+	if err = backupConfigFile(path); err != nil {
+		return path, nil, err
+	}
+
+	if err = si.WriteFile(path); err != nil {
+		return path, nil, errors.Wrap(err)
+	}
+
+	for _, curr := range warnings {
+		log.Warning("Converting %s: %s", cf, curr)
+	}
+
+	log.Info("Converted %s config file %s to YAML: %s", format, cf, path)
+	return path, warnings, nil
+}
+
+// backupConfigFile renames an existing configuration file after its modification time
+func backupConfigFile(cf string) error {
+	info, err := os.Stat(cf)
+	if err != nil {
+		if os.IsNotExist(err) {
+			// File does not exist, skip backup
+			return nil
+		}
+		return errors.Wrap(err)
+	}
+
+	mt := info.ModTime()
+	suffix := fmt.Sprintf("-%d-%02d-%02d-%02d%02d%02d",
+		mt.Year(), mt.Month(), mt.Day(),
+		mt.Hour(), mt.Minute(), mt.Second())
+	bf := strings.TrimSuffix(cf, filepath.Ext(cf)) + suffix + ".yaml"
+
+	if err = os.Rename(cf, bf); err != nil {
+		return errors.Wrap(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "WARNING: Config file %s already exists. Making a backup: %s\n", cf, bf)
+	log.Warning("Config file %s already exists. Taking a backup: %s\n", cf, bf)
+	return nil
+}
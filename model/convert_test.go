@@ -0,0 +1,213 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/storage"
+)
+
+func TestDetectConfigFormat(t *testing.T) {
+	tests := []struct {
+		file   string
+		format string
+	}{
+		{"ister.json", FormatIster},
+		{"kickstart.ks", FormatKickstart},
+		{"cloud-init-autoinstall.yaml", FormatCloudInit},
+	}
+
+	for _, curr := range tests {
+		format, err := DetectConfigFormat(filepath.Join(testsDir, curr.file))
+		if err != nil || format != curr.format {
+			t.Fatalf("%s: expected the %s format, got: %s %v", curr.file, curr.format, format, err)
+		}
+	}
+}
+
+func TestSplitQuoted(t *testing.T) {
+	fields, err := splitQuoted(`user --gecos="Site Admin" 'a b'c --name=x`)
+	if err != nil || strings.Join(fields, "|") != "user|--gecos=Site Admin|a bc|--name=x" {
+		t.Fatalf("Unexpected fields: %q %v", fields, err)
+	}
+
+	if _, err = splitQuoted(`user --gecos="Site`); err == nil {
+		t.Fatal("An unterminated quote should fail")
+	}
+}
+
+func hasWarning(warnings []string, substr string) bool {
+	for _, curr := range warnings {
+		if strings.Contains(curr, substr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// convertTestFile converts a copy of the tests file and loads the converted configuration
+func convertTestFile(t *testing.T, name string) (*SystemInstall, []string) {
+	dir, err := ioutil.TempDir("", "convert-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	content, err := ioutil.ReadFile(filepath.Join(testsDir, name))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+
+	cf := filepath.Join(dir, name)
+	if err = ioutil.WriteFile(cf, content, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", cf, err)
+	}
+
+	saved := testAlias
+	testAlias = append(testAlias, "/dev/vda")
+	defer func() { testAlias = saved }()
+
+	path, warnings, err := ConvertConfigFile(cf)
+	if err != nil {
+		t.Fatalf("Failed to convert %s: %v", name, err)
+	}
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load the converted %s: %v", name, err)
+	}
+
+	if err = si.Validate(); err != nil {
+		t.Fatalf("The converted %s should be valid: %v", name, err)
+	}
+
+	return si, warnings
+}
+
+// checkPartitions checks the vda partitions, described as mount:fstype:size
+func checkPartitions(t *testing.T, si *SystemInstall, expected []string) {
+	if len(si.TargetMedias) != 1 || len(si.TargetMedias[0].Children) != len(expected) {
+		t.Fatalf("Expected a disk with %d partitions, got: %+v", len(expected), si.TargetMedias)
+	}
+
+	for idx, curr := range si.TargetMedias[0].Children {
+		tks := strings.Split(expected[idx], ":")
+
+		size := uint64(0)
+		if tks[2] != "0" {
+			size, _ = storage.ParseVolumeSize(tks[2])
+		}
+
+		name := fmt.Sprintf("vda%d", idx+1)
+		if curr.Name != name || curr.MountPoint != tks[0] || curr.FsType != tks[1] || curr.Size != size {
+			t.Fatalf("Expected the %s partition %s, got: %+v", name, expected[idx], curr)
+		}
+	}
+}
+
+func TestConvertKickstart(t *testing.T) {
+	si, warnings := convertTestFile(t, "kickstart.ks")
+
+	checkPartitions(t, si, []string{"/boot:vfat:512M", ":swap:2G", "/:ext4:0"})
+
+	if si.Keyboard.Code != "de" || si.Timezone.Code != "Europe/Berlin" || si.Hostname != "ks-host" {
+		t.Fatalf("Unexpected keyboard, time zone or host name: %s %s %s",
+			si.Keyboard.Code, si.Timezone.Code, si.Hostname)
+	}
+
+	if len(si.NetworkInterfaces) != 1 || si.NetworkInterfaces[0].DHCP ||
+		si.NetworkInterfaces[0].Addrs[0].NetMask != "255.255.255.0" ||
+		si.NetworkInterfaces[0].DNSServer != "192.168.1.1" {
+		t.Fatalf("Unexpected network interfaces: %+v", si.NetworkInterfaces)
+	}
+
+	if len(si.Users) != 1 || !si.Users[0].Admin || si.Users[0].UserName != "Site Admin" ||
+		si.Users[0].Password != "$6$abc$def" || len(si.Users[0].SSHKeys) != 1 ||
+		strings.Join(si.Users[0].Groups, ",") != "docker" || si.Users[0].UID != 1500 ||
+		si.Users[0].Shell != "/bin/zsh" {
+		t.Fatalf("Unexpected users: %+v", si.Users)
+	}
+
+	for _, curr := range []string{"os-core", "os-core-update", "vim"} {
+		if !si.ContainsBundle(curr) {
+			t.Fatalf("Expected the %s bundle, got: %v", curr, si.Bundles)
+		}
+	}
+
+	if strings.Join(si.Services.Enable, " ") != "sshd.service chronyd.service" ||
+		strings.Join(si.Services.Disable, " ") != "cups.service" {
+		t.Fatalf("Unexpected services: %+v", si.Services)
+	}
+
+	if !si.PostReboot || si.KernelArguments == nil || si.KernelArguments.Add[0] != "console=ttyS0" {
+		t.Fatalf("Expected the post reboot and the console kernel argument: %v %+v",
+			si.PostReboot, si.KernelArguments)
+	}
+
+	if len(si.PreInstall) != 1 || si.PreInstall[0].Chroot || len(si.PostInstall) != 2 ||
+		si.PostInstall[0].Chroot || !strings.Contains(si.PostInstall[0].Cmd, "${chrootDir}/etc") ||
+		!si.PostInstall[1].Chroot || !strings.HasPrefix(si.PostInstall[1].Cmd, "/usr/bin/python3 <<") {
+		t.Fatalf("Unexpected hooks: %+v %+v", si.PreInstall, si.PostInstall)
+	}
+
+	for _, curr := range []string{"rootpw", "/boot partition is dropped", "volgroup", "selinux",
+		"iwl*firmware", "unknown-package", "first name server"} {
+		if !hasWarning(warnings, curr) {
+			t.Fatalf("Expected a %s warning, got: %q", curr, warnings)
+		}
+	}
+}
+
+func TestConvertCloudInit(t *testing.T) {
+	si, warnings := convertTestFile(t, "cloud-init-autoinstall.yaml")
+
+	checkPartitions(t, si, []string{"/boot:vfat:512M", "/:ext4:0"})
+
+	if si.Keyboard.Code != "fr" || si.Timezone.Code != "Europe/Paris" || si.Hostname != "ci-host" {
+		t.Fatalf("Unexpected keyboard, time zone or host name: %s %s %s",
+			si.Keyboard.Code, si.Timezone.Code, si.Hostname)
+	}
+
+	if len(si.NetworkInterfaces) != 1 || si.NetworkInterfaces[0].Name != "enp0s3" ||
+		si.NetworkInterfaces[0].Addrs[0].IP != "10.0.0.5" ||
+		si.NetworkInterfaces[0].Addrs[0].NetMask != "255.255.255.0" {
+		t.Fatalf("Unexpected network interfaces: %+v", si.NetworkInterfaces)
+	}
+
+	if len(si.Users) != 1 || si.Users[0].Login != "ubuntu" || !si.Users[0].Admin ||
+		len(si.Users[0].SSHKeys) != 1 {
+		t.Fatalf("Unexpected users: %+v", si.Users)
+	}
+
+	if !si.ContainsBundle("openssh-server") || !si.ContainsBundle("git") {
+		t.Fatalf("Expected the openssh-server and git bundles, got: %v", si.Bundles)
+	}
+
+	if len(si.PreInstall) != 1 || len(si.PostInstall) != 3 ||
+		!si.PostInstall[0].Chroot || si.PostInstall[0].Cmd != "systemctl enable ssh" ||
+		si.PostInstall[1].Chroot || si.PostInstall[1].Cmd != "cp /etc/hosts ${chrootDir}/etc/hosts" ||
+		!si.PostInstall[2].Chroot || si.PostInstall[2].Cmd != `"touch" "/var/lib/converted"` {
+		t.Fatalf("Unexpected hooks: %+v %+v", si.PreInstall, si.PostInstall)
+	}
+
+	if len(si.Files) != 1 || si.Files[0].Encoding != "base64" || si.Files[0].Owner != "root" ||
+		si.Files[0].Mode != "0644" {
+		t.Fatalf("Unexpected files: %+v", si.Files)
+	}
+
+	for _, curr := range []string{"lvm_volgroup", "ubuntu-desktop", "autoinstall.apt", "bootcmd"} {
+		if !hasWarning(warnings, curr) {
+			t.Fatalf("Expected a %s warning, got: %q", curr, warnings)
+		}
+	}
+}
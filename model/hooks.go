@@ -0,0 +1,166 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/user"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// HookPreInstall hooks run before anything is written to the target
+	HookPreInstall = "preInstall"
+
+	// HookPostPartition hooks run after the target media is partitioned and formatted
+	HookPostPartition = "postPartition"
+
+	// HookPostMount hooks run after the target file systems are mounted
+	HookPostMount = "postMount"
+
+	// HookPostBundles hooks run after the bundles are installed
+	HookPostBundles = "postBundles"
+
+	// HookPreBootloader hooks run right before the boot loader is installed
+	HookPreBootloader = "preBootloader"
+
+	// HookPostInstall hooks run after the target system is fully configured
+	HookPostInstall = "postInstall"
+)
+
+// HookStages lists the hook stages in the order they are executed
+var HookStages = []string{
+	HookPreInstall,
+	HookPostPartition,
+	HookPostMount,
+	HookPostBundles,
+	HookPreBootloader,
+	HookPostInstall,
+}
+
+// preBundlesStages are the stages run before the bundles are installed, the target has no
+// shell nor runuser to run a chrooted hook with. The chrooted preInstall hooks are still
+// accepted, for the targets populated beforehand, but only lint warned.
+var preBundlesStages = []string{
+	HookPreInstall,
+	HookPostPartition,
+	HookPostMount,
+}
+
+// InstallHook is a commands to be executed in a given point of the install process
+type InstallHook struct {
+	Chroot          bool              `yaml:"chroot,omitempty,flow"`
+	Cmd             string            `yaml:"cmd,omitempty,flow"`
+	Script          string            `yaml:"script,omitempty,flow"`
+	Timeout         uint              `yaml:"timeout,omitempty,flow"`
+	Retries         uint              `yaml:"retries,omitempty,flow"`
+	ContinueOnError bool              `yaml:"continueOnError,omitempty,flow"`
+	Env             map[string]string `yaml:"env,omitempty,flow"`
+	User            string            `yaml:"user,omitempty,flow"`
+}
+
+// Validate checks the hook has exactly one command or script and a user is only
+// requested for chrooted hooks
+func (hook *InstallHook) Validate() error {
+	if hook.Cmd == "" && hook.Script == "" {
+		return errors.FieldValidationErrorf("cmd", "A hook must provide either a cmd or a script")
+	}
+
+	if hook.Cmd != "" && hook.Script != "" {
+		return errors.FieldValidationErrorf("script", "A hook can not provide both a cmd and a script")
+	}
+
+	if hook.User != "" {
+		if !hook.Chroot {
+			return errors.FieldValidationErrorf("user", "A hook user can only be set for chrooted hooks")
+		}
+
+		if ok, msg := user.IsValidLogin(hook.User); !ok {
+			return errors.FieldValidationErrorf("user", "Invalid hook user %q: %s", hook.User, msg)
+		}
+	}
+
+	for k := range hook.Env {
+		if k == "" {
+			return errors.FieldValidationErrorf("env", "Hook environment variable name can not be empty")
+		}
+	}
+
+	return nil
+}
+
+// Hooks returns the hooks configured for a given stage, nil is returned for an unknown stage
+func (si *SystemInstall) Hooks(stage string) []*InstallHook {
+	switch stage {
+	case HookPreInstall:
+		return si.PreInstall
+	case HookPostPartition:
+		return si.PostPartition
+	case HookPostMount:
+		return si.PostMount
+	case HookPostBundles:
+		return si.PostBundles
+	case HookPreBootloader:
+		return si.PreBootloader
+	case HookPostInstall:
+		return si.PostInstall
+	}
+
+	return nil
+}
+
+func (si *SystemInstall) validateHooks() error {
+	for _, stage := range HookStages {
+		hooks := si.Hooks(stage)
+
+		if len(hooks) > 0 && si.IsDirectoryTarget() &&
+			(stage == HookPostPartition || stage == HookPreBootloader) {
+			return errors.FieldValidationErrorf(stage, "%s hooks are not supported by a directory target", stage)
+		}
+
+		for idx, curr := range hooks {
+			field := fmt.Sprintf("%s[%d]", stage, idx)
+
+			if curr == nil {
+				return errors.FieldValidationErrorf(field, "Empty hook")
+			}
+
+			if curr.Chroot && utils.StringSliceContains(preBundlesStages, stage) {
+				if stage != HookPreInstall {
+					return errors.FieldValidationErrorf(field+".chroot",
+						"%s hooks can not be chrooted, the bundles are not installed yet", stage)
+				}
+
+				if curr.User != "" {
+					return errors.FieldValidationErrorf(field+".user",
+						"%s hooks can not run as a user, the bundles are not installed yet", stage)
+				}
+			}
+
+			if err := curr.Validate(); err != nil {
+				return prefixFieldError(field, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// hookWarnings returns the warnings of the chrooted preInstall hooks, they only work if the
+// target was populated beforehand
+func (si *SystemInstall) hookWarnings() []string {
+	result := []string{}
+
+	for idx, curr := range si.PreInstall {
+		if curr != nil && curr.Chroot {
+			result = append(result, fmt.Sprintf("%s[%d]: chrooted %s hooks require a target populated "+
+				"beforehand, the bundles are not installed yet", HookPreInstall, idx, HookPreInstall))
+		}
+	}
+
+	return result
+}
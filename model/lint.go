@@ -0,0 +1,189 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/timezone"
+	"github.com/clearlinux/clr-installer/user"
+)
+
+// the host lookups of the available keymaps, time zones and languages, replaced by the tests
+var (
+	loadKeymaps   = keyboard.LoadKeymaps
+	loadTimezones = timezone.Load
+	loadLanguages = language.Load
+)
+
+// Lint returns every problem of the configuration, where Validate stops at the first one,
+// and the non fatal issues. On top of Validate it checks the keyboard, time zone and language
+// are available, the users accounts and, if diskSize is not 0, the target media partitions
+// fit in a disk of diskSize bytes. It requires neither root, disks nor network.
+func (si *SystemInstall) Lint(diskSize uint64) ([]error, []string) {
+	problems := []error{}
+	warnings := append([]string{}, si.DeprecationWarnings()...)
+	warnings = append(warnings, si.KernelArgumentWarnings()...)
+	warnings = append(warnings, si.hookWarnings()...)
+
+	add := func(err error) {
+		if err != nil {
+			problems = append(problems, si.locations.locateError(err))
+		}
+	}
+
+	for _, check := range si.checks() {
+		add(check())
+	}
+
+	// the host may lack the lists, i.e a CI container, what can't be checked is only a warning
+	warn := func(what string, err error) {
+		if err == nil {
+			warnings = append(warnings, fmt.Sprintf("No %s available on this host, not checked", what))
+			return
+		}
+		warnings = append(warnings, fmt.Sprintf("Could not load the available %s: %v", what, err))
+	}
+
+	if si.Keyboard != nil {
+		if kmaps, err := loadKeymaps(); err != nil || len(kmaps) == 0 {
+			warn("keymaps", err)
+		} else if !containsKeymap(kmaps, si.Keyboard) {
+			add(errors.FieldValidationErrorf("keyboard", "Invalid Keyboard: %s", si.Keyboard.Code))
+		}
+	}
+
+	if si.Timezone != nil {
+		if tzs, err := loadTimezones(); err != nil || len(tzs) == 0 {
+			warn("time zones", err)
+		} else if !containsTimezone(tzs, si.Timezone) {
+			add(errors.FieldValidationErrorf("timezone", "Invalid Time Zone: %s", si.Timezone.Code))
+		}
+	}
+
+	if si.Language != nil {
+		if langs, err := loadLanguages(); err != nil || len(langs) == 0 {
+			warn("languages", err)
+		} else if !containsLanguage(langs, si.Language) {
+			add(errors.FieldValidationErrorf("language", "Invalid Language: %s", si.Language.Code))
+		}
+	}
+
+	for idx, curr := range si.Users {
+		for _, err := range lintUser(curr) {
+			add(prefixFieldError(fmt.Sprintf("users[%d]", idx), err))
+		}
+	}
+
+	if diskSize > 0 && !si.IsDirectoryTarget() {
+		for idx, curr := range si.TargetMedias {
+			add(prefixFieldError(fmt.Sprintf("targetMedia[%d]", idx), lintDiskSize(curr, diskSize)))
+		}
+	}
+
+	return problems, warnings
+}
+
+// lintUser returns the problems of a user account, the password is only required
+// unless the account can be reached with ssh keys
+func lintUser(usr *user.User) []error {
+	if usr == nil {
+		return []error{errors.ValidationErrorf("Empty user")}
+	}
+
+	result := []error{}
+
+	if ok, msg := user.IsValidLogin(usr.Login); !ok {
+		result = append(result, errors.FieldValidationErrorf("login", "%s", msg))
+	}
+
+	if usr.UserName != "" {
+		if ok, msg := user.IsValidUsername(usr.UserName); !ok {
+			result = append(result, errors.FieldValidationErrorf("username", "%s", msg))
+		}
+	}
+
+	// the password is already encrypted, its plain text was checked when it was resolved
+	if usr.Password == "" && len(usr.SSHKeys) == 0 {
+		_, msg := user.IsValidPassword(usr.Password)
+		result = append(result, errors.FieldValidationErrorf("password", "%s", msg))
+	}
+
+	return result
+}
+
+// lintDiskSize checks the partitions of bd fit in a disk of diskSize bytes, the partitions
+// with no size taking the remaining space
+func lintDiskSize(bd *storage.BlockDevice, diskSize uint64) error {
+	if bd == nil {
+		return nil
+	}
+
+	human := func(size uint64) string {
+		result, _ := storage.HumanReadableSize(size)
+		return result
+	}
+
+	if bd.Size > diskSize {
+		return errors.FieldValidationErrorf("size", "Media size %s is larger than the disk size %s",
+			human(bd.Size), human(diskSize))
+	}
+
+	var total uint64
+	fill := -1
+
+	for idx, curr := range bd.Children {
+		if curr.Size == 0 && fill < 0 {
+			fill = idx
+		}
+		total += curr.Size
+	}
+
+	if total > diskSize {
+		return errors.FieldValidationErrorf("children", "Partition sizes %s are larger than the disk size %s",
+			human(total), human(diskSize))
+	}
+
+	if fill >= 0 && total == diskSize {
+		return errors.FieldValidationErrorf(fmt.Sprintf("children[%d].size", fill),
+			"No space left on the %s disk for the partition", human(diskSize))
+	}
+
+	return nil
+}
+
+func containsKeymap(kmaps []*keyboard.Keymap, k *keyboard.Keymap) bool {
+	for _, curr := range kmaps {
+		if curr.Equals(k) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsTimezone(tzs []*timezone.TimeZone, tz *timezone.TimeZone) bool {
+	for _, curr := range tzs {
+		if curr.Equals(tz) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsLanguage(langs []*language.Language, lang *language.Language) bool {
+	for _, curr := range langs {
+		if curr.Equals(lang) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,137 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/timezone"
+)
+
+func setLintLookups(err error) func() {
+	saveKeymaps, saveTimezones, saveLanguages := loadKeymaps, loadTimezones, loadLanguages
+
+	loadKeymaps = func() ([]*keyboard.Keymap, error) {
+		return []*keyboard.Keymap{{Code: "us"}}, err
+	}
+
+	loadTimezones = func() ([]*timezone.TimeZone, error) {
+		return []*timezone.TimeZone{{Code: "America/Los_Angeles"}}, err
+	}
+
+	loadLanguages = func() ([]*language.Language, error) {
+		return []*language.Language{{Code: "en_US.UTF-8"}}, err
+	}
+
+	return func() {
+		loadKeymaps, loadTimezones, loadLanguages = saveKeymaps, saveTimezones, saveLanguages
+	}
+}
+
+func TestLint(t *testing.T) {
+	defer setLintLookups(nil)()
+
+	path := filepath.Join(testsDir, "invalid-lint.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	problems, warnings := si.Lint(0)
+	if len(warnings) != 0 {
+		t.Fatalf("Unexpected warnings: %v", warnings)
+	}
+
+	expected := []struct {
+		field string
+		line  int
+	}{
+		{"targetMedia[0].children", 5},
+		{"kernel", 0},
+		{"keyboard", 17},
+		{"users[0].login", 22},
+		{"users[0].username", 23},
+		{"users[0].password", 22},
+	}
+
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got: %v", len(expected), problems)
+	}
+
+	for idx, curr := range expected {
+		ve, ok := problems[idx].(errors.ValidationError)
+		if !ok || ve.Field != curr.field || ve.Line != curr.line {
+			t.Fatalf("Expected a %s problem at line %d, got: %v", curr.field, curr.line, problems[idx])
+		}
+	}
+
+	if err = si.Validate(); err == nil || err.Error() != problems[0].Error() {
+		t.Fatalf("Validate should return the first problem, got: %v", err)
+	}
+}
+
+func TestLintLookupFailure(t *testing.T) {
+	defer setLintLookups(fmt.Errorf("localectl: not found"))()
+
+	si := &SystemInstall{Keyboard: &keyboard.Keymap{Code: "xx"}}
+
+	_, warnings := si.Lint(0)
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "keymaps") {
+		t.Fatalf("The keymaps lookup failure should be a warning, got: %v", warnings)
+	}
+}
+
+func TestLintChrootedPreInstall(t *testing.T) {
+	defer setLintLookups(nil)()
+
+	si := &SystemInstall{PreInstall: []*InstallHook{{Cmd: "ls"}, {Chroot: true, Cmd: "ls"}}}
+
+	_, warnings := si.Lint(0)
+	if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "preInstall[1]: ") {
+		t.Fatalf("A chrooted preInstall hook should be a warning, got: %v", warnings)
+	}
+}
+
+func TestLintDiskSize(t *testing.T) {
+	part := func(size string) *storage.BlockDevice {
+		result, _ := storage.ParseVolumeSize(size)
+		return &storage.BlockDevice{Size: result}
+	}
+
+	tests := []struct {
+		disk  *storage.BlockDevice
+		field string
+	}{
+		{&storage.BlockDevice{Children: []*storage.BlockDevice{part("150M"), part("4G")}}, ""},
+		{&storage.BlockDevice{Children: []*storage.BlockDevice{part("150M"), part("0")}}, ""},
+		{&storage.BlockDevice{Children: []*storage.BlockDevice{part("1G"), part("9.5G")}}, "children"},
+		{&storage.BlockDevice{Children: []*storage.BlockDevice{part("2G"), part("0"), part("8G")}}, "children[1].size"},
+		{&storage.BlockDevice{Size: 20 << 30}, "size"},
+	}
+
+	for idx, curr := range tests {
+		err := lintDiskSize(curr.disk, 10<<30)
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Test %d: unexpected error: %v", idx, err)
+			}
+			continue
+		}
+
+		if ve, ok := err.(errors.ValidationError); !ok || ve.Field != curr.field {
+			t.Fatalf("Test %d: expected a %s validation error, got: %v", idx, curr.field, err)
+		}
+	}
+}
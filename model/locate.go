@@ -0,0 +1,287 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/schema"
+)
+
+var (
+	unknownFieldExp = regexp.MustCompile(`^line ([0-9]+): field (.+) not found in type .+$`)
+	duplicateExp    = regexp.MustCompile(`^line ([0-9]+): field (.+) already set in type .+$`)
+	lineErrorExp    = regexp.MustCompile(`^(?:yaml: )?line ([0-9]+): (.+)$`)
+)
+
+// fieldLines maps the field paths of a YAML configuration, i.e targetMedia[0].children[1].type,
+// to their line numbers and back. Only the block style is walked, the fields of a flow style
+// value, i.e bundles: [os-core, vim], are located at the line of the value's key.
+type fieldLines struct {
+	lines map[string]int // lines are the lines of the fields, the first one if set twice
+	paths map[int]string // paths are the deepest field path starting on each line
+}
+
+// locFrame is a mapping key or a sequence item whose children are being walked
+type locFrame struct {
+	indent int
+	path   string
+	items  int
+	item   bool
+}
+
+// locateFields walks the YAML document and returns the lines of its fields
+func locateFields(data []byte) *fieldLines {
+	result := &fieldLines{lines: map[string]int{}, paths: map[int]string{}}
+	stack := []*locFrame{{indent: -1}}
+	scalarIndent := -1
+	flowDepth := 0
+
+	for idx, line := range strings.Split(string(data), "\n") {
+		lineNo := idx + 1
+		text := strings.TrimRight(line, " \t\r")
+		trimmed := strings.TrimLeft(text, " ")
+		indent := len(text) - len(trimmed)
+
+		// the continuation lines of a multi line flow value
+		if flowDepth > 0 {
+			flowDepth += flowBalance(trimmed)
+			continue
+		}
+
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// the content lines of a literal or folded block scalar
+		if scalarIndent >= 0 {
+			if indent > scalarIndent {
+				continue
+			}
+			scalarIndent = -1
+		}
+
+		if trimmed == "---" || trimmed == "..." {
+			continue
+		}
+
+		// a sequence item, the item's content may follow the dash on the same line
+		for trimmed == "-" || strings.HasPrefix(trimmed, "- ") {
+			for top := stack[len(stack)-1]; indent < top.indent || (top.item && indent == top.indent); top = stack[len(stack)-1] {
+				stack = stack[:len(stack)-1]
+			}
+
+			parent := stack[len(stack)-1]
+			path := fmt.Sprintf("%s[%d]", parent.path, parent.items)
+			parent.items++
+
+			result.add(path, lineNo)
+			stack = append(stack, &locFrame{indent: indent, path: path, item: true})
+
+			rest := strings.TrimLeft(trimmed[1:], " ")
+			indent += len(trimmed) - len(rest)
+			trimmed = rest
+		}
+
+		key, value, ok := splitKey(trimmed)
+		if !ok {
+			flowDepth = flowBalance(trimmed)
+			continue
+		}
+
+		for top := stack[len(stack)-1]; indent <= top.indent; top = stack[len(stack)-1] {
+			stack = stack[:len(stack)-1]
+		}
+
+		path := key
+		if parent := stack[len(stack)-1]; parent.path != "" {
+			path = parent.path + "." + key
+		}
+
+		result.add(path, lineNo)
+		stack = append(stack, &locFrame{indent: indent, path: path})
+
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			scalarIndent = indent
+		} else {
+			flowDepth = flowBalance(value)
+		}
+	}
+
+	return result
+}
+
+func (fl *fieldLines) add(path string, line int) {
+	if _, ok := fl.lines[path]; !ok {
+		fl.lines[path] = line
+	}
+
+	fl.paths[line] = path
+}
+
+// splitKey splits a mapping entry line in its key and value, ok is false if text is
+// not a mapping entry
+func splitKey(text string) (key string, value string, ok bool) {
+	rest := ""
+
+	if text == "" {
+		return "", "", false
+	}
+
+	switch text[0] {
+	case '"', '\'':
+		end := strings.IndexByte(text[1:], text[0])
+		if end < 0 {
+			return "", "", false
+		}
+		key = text[1 : end+1]
+		rest = text[end+2:]
+	case '[', '{', '#', '&', '*', '!', '|', '>', '%', '@', '`':
+		return "", "", false
+	default:
+		end := strings.Index(text+" ", ": ")
+		if end < 0 {
+			return "", "", false
+		}
+		key = text[:end]
+		rest = text[end:]
+	}
+
+	if !strings.HasPrefix(rest+" ", ": ") {
+		return "", "", false
+	}
+
+	value = strings.TrimSpace(rest[1:])
+	if strings.HasPrefix(value, "#") {
+		value = ""
+	}
+
+	return key, value, true
+}
+
+// flowBalance returns the opened minus the closed flow collections of text, quoted
+// strings are skipped
+func flowBalance(text string) int {
+	result := 0
+	var quote rune
+
+	for _, curr := range text {
+		switch {
+		case quote != 0:
+			if curr == quote {
+				quote = 0
+			}
+		case curr == '"' || curr == '\'':
+			quote = curr
+		case curr == '[' || curr == '{':
+			result++
+		case curr == ']' || curr == '}':
+			result--
+		case curr == '#' && result <= 0:
+			return result
+		}
+	}
+
+	return result
+}
+
+// line returns the line of the field, or of its closest located parent, 0 if unknown
+func (fl *fieldLines) line(field string) int {
+	for field != "" {
+		if line, ok := fl.lines[field]; ok {
+			return line
+		}
+
+		idx := strings.LastIndexAny(field, ".[")
+		if idx < 0 {
+			break
+		}
+		field = field[:idx]
+	}
+
+	return 0
+}
+
+// parent returns the path of the mapping holding the key found at line, ok is false if
+// the key is not located, i.e within a flow style value, and then the path of the closest
+// field preceding the line is returned
+func (fl *fieldLines) parent(key string, line int) (string, bool) {
+	if path, ok := fl.paths[line]; ok {
+		if path == key {
+			return "", true
+		}
+
+		if strings.HasSuffix(path, "."+key) {
+			return strings.TrimSuffix(path, "."+key), true
+		}
+	}
+
+	for curr := line; curr > 0; curr-- {
+		if path, ok := fl.paths[curr]; ok {
+			return path, false
+		}
+	}
+
+	return "", false
+}
+
+// locateError sets the line of a validation error's field
+func (fl *fieldLines) locateError(err error) error {
+	ve, ok := err.(errors.ValidationError)
+	if !ok || ve.Line > 0 || fl == nil {
+		return err
+	}
+
+	ve.Line = fl.line(ve.Field)
+	return ve
+}
+
+// decodeError converts the YAML decoding errors to a validation error pointing to the
+// offending line, the unknown fields are reported with the closest known field name
+func (fl *fieldLines) decodeError(err error) error {
+	// the errors raised by the custom unmarshallers are kept as is
+	if _, ok := err.(errors.TraceableError); ok {
+		return err
+	}
+
+	msg := err.Error()
+	if te, ok := err.(*yaml.TypeError); ok && len(te.Errors) > 0 {
+		msg = te.Errors[0]
+	}
+
+	if match := unknownFieldExp.FindStringSubmatch(msg); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		key := match[2]
+		parent, located := fl.parent(key, line)
+
+		what := fmt.Sprintf("Unknown field: %s", key)
+		if suggestion := schema.Root.Lookup(parent).Closest(key); located && suggestion != "" {
+			what = fmt.Sprintf("%s, did you mean %s?", what, suggestion)
+		}
+
+		return errors.ValidationError{What: what, Field: parent, Line: line}
+	}
+
+	if match := duplicateExp.FindStringSubmatch(msg); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		parent, _ := fl.parent(match[2], line)
+
+		return errors.ValidationError{What: fmt.Sprintf("Field set more than once: %s", match[2]),
+			Field: parent, Line: line}
+	}
+
+	if match := lineErrorExp.FindStringSubmatch(msg); match != nil {
+		line, _ := strconv.Atoi(match[1])
+		return errors.ValidationError{What: match[2], Line: line}
+	}
+
+	return errors.ValidationErrorf("Invalid configuration file: %s", msg)
+}
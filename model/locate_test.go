@@ -0,0 +1,139 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/schema"
+
+	"gopkg.in/yaml.v2"
+)
+
+func TestLocateFields(t *testing.T) {
+	doc := `#clear-linux-config
+targetMedia:
+- name: sda
+  children:
+  - name: sda1
+    mountpoint: /boot
+
+  - name: sda2
+    mountpoint: /
+bundles: [os-core,
+  vim]
+files:
+- path: /etc/motd
+  content: |
+    - name: not a field
+    key: not a field
+post-install:
+  - {cmd: "true"}
+  - cmd: "false"
+`
+
+	lines := locateFields([]byte(doc))
+
+	tests := []struct {
+		field string
+		line  int
+	}{
+		{"targetMedia", 2},
+		{"targetMedia[0]", 3},
+		{"targetMedia[0].children", 4},
+		{"targetMedia[0].children[0].mountpoint", 6},
+		{"targetMedia[0].children[1]", 8},
+		{"targetMedia[0].children[1].mountpoint", 9},
+		{"targetMedia[0].children[2]", 4},
+		{"bundles[1]", 10},
+		{"files[0].content", 14},
+		{"post-install", 17},
+		{"post-install[0].cmd", 18},
+		{"post-install[1].cmd", 19},
+		{"unknown", 0},
+	}
+
+	for _, curr := range tests {
+		if line := lines.line(curr.field); line != curr.line {
+			t.Fatalf("Field %s should be located at line %d, got: %d", curr.field, curr.line, line)
+		}
+	}
+
+	if _, ok := lines.lines["files[0].key"]; ok {
+		t.Fatal("The block scalar content should not be located as fields")
+	}
+
+	if parent, ok := lines.parent("mountpoint", 9); !ok || parent != "targetMedia[0].children[1]" {
+		t.Fatalf("Unexpected parent of the field at line 9: %s", parent)
+	}
+}
+
+func TestLoadFileUnknownField(t *testing.T) {
+	path := filepath.Join(testsDir, "invalid-unknown-field.yaml")
+
+	_, err := LoadFile(path, args.Args{})
+
+	ve, ok := err.(errors.ValidationError)
+	if !ok || ve.Field != "targetMedia[0].children[1]" || ve.Line != 14 {
+		t.Fatalf("Expected a validation error for line 14, got: %v", err)
+	}
+
+	if !strings.Contains(ve.What, "mountpont") || !strings.Contains(ve.What, "did you mean mountpoint?") {
+		t.Fatalf("Unexpected unknown field error: %s", ve.What)
+	}
+}
+
+func TestDecodeError(t *testing.T) {
+	tests := []struct {
+		doc  string
+		err  string
+		line int
+	}{
+		{"bundels: [os-core]\n", "Unknown field: bundels, did you mean bundles?", 1},
+		{"kernelArguments: {add: [quiet], remvoe: [rw]}\n", "Unknown field: remvoe", 1},
+		{"keyboard: us\nkeyboard: fr\n", "Field set more than once: keyboard", 2},
+		{"bundles: [os-core\n", "did not find expected ',' or ']'", 1},
+	}
+
+	for _, curr := range tests {
+		var si SystemInstall
+
+		err := locateFields([]byte(curr.doc)).decodeError(yaml.UnmarshalStrict([]byte(curr.doc), &si))
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Line != curr.line || !strings.HasPrefix(ve.What, curr.err) {
+			t.Fatalf("Expected %q at line %d, got: %v", curr.err, curr.line, err)
+		}
+	}
+}
+
+func TestValidateLine(t *testing.T) {
+	path := filepath.Join(testsDir, "no-root-partition-descriptor.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	ve, ok := si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "targetMedia[0].children" || ve.Line != 5 {
+		t.Fatalf("Expected a validation error for line 5, got: %v", ve)
+	}
+
+	if !strings.HasPrefix(ve.Error(), "line 5: targetMedia[0].children: ") {
+		t.Fatalf("Unexpected validation error message: %s", ve.Error())
+	}
+}
+
+func TestSchema(t *testing.T) {
+	if err := schema.CheckFields(reflect.TypeOf(SystemInstall{}), ""); err != nil {
+		t.Fatal(err)
+	}
+}
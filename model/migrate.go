@@ -0,0 +1,249 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// CurrentSchemaVersion is the configuration schema version written by this installer,
+	// the configurations of the older versions are migrated when loaded
+	CurrentSchemaVersion = 2
+
+	schemaVersionField = "schemaVersion"
+)
+
+// fieldRename is a top level field renamed by a schema version
+type fieldRename struct {
+	from string
+	to   string
+}
+
+// schemaMigration lists the changes of a schema version from the previous one
+type schemaMigration struct {
+	version uint
+	renames []fieldRename
+}
+
+// schemaMigrations are the schema changes in version order, a configuration with no
+// schemaVersion is a version 1 one
+var schemaMigrations = []schemaMigration{
+	{
+		// the field names follow the targetMedia and httpsProxy camel case style
+		version: 2,
+		renames: []fieldRename{
+			{"block-devices", "blockDevices"},
+			{"kernel-arguments", "kernelArguments"},
+			{"pre-install", "preInstall"},
+			{"post-partition", "postPartition"},
+			{"post-mount", "postMount"},
+			{"post-bundles", "postBundles"},
+			{"pre-bootloader", "preBootloader"},
+			{"post-install", "postInstall"},
+		},
+	},
+}
+
+// schemaVersion returns the schema version of the configuration document
+func schemaVersion(doc yaml.MapSlice) (uint, error) {
+	idx := mapIndex(doc, schemaVersionField)
+	if idx < 0 {
+		return 1, nil
+	}
+
+	version, ok := doc[idx].Value.(int)
+	if !ok || version < 1 {
+		return 0, errors.FieldValidationErrorf(schemaVersionField, "Invalid schema version: %v", doc[idx].Value)
+	}
+
+	if version > CurrentSchemaVersion {
+		return 0, errors.FieldValidationErrorf(schemaVersionField,
+			"Schema version %d is not supported, the newest supported version is %d", version,
+			CurrentSchemaVersion)
+	}
+
+	return uint(version), nil
+}
+
+// migrateContent migrates the configuration to the current schema version, it returns the
+// configuration's schema version and the deprecated fields found. The renamed fields are
+// rewritten in place so the lines are kept, the content is re-encoded only if a renamed
+// field can't be located, i.e a flow style document.
+func migrateContent(content []byte) ([]byte, uint, []string, error) {
+	var doc yaml.MapSlice
+
+	locations := locateFields(content)
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, 0, nil, locations.decodeError(err)
+	}
+
+	version, err := schemaVersion(doc)
+	if err != nil {
+		return nil, 0, nil, locations.locateError(err)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	warnings := []string{}
+	reencode := false
+
+	for _, migration := range schemaMigrations {
+		if migration.version <= version {
+			continue
+		}
+
+		for _, curr := range migration.renames {
+			idx := mapIndex(doc, curr.from)
+			if idx < 0 {
+				continue
+			}
+
+			if mapIndex(doc, curr.to) >= 0 {
+				return nil, 0, nil, locations.locateError(errors.FieldValidationErrorf(curr.from,
+					"Both %s and %s are set, %s is the deprecated name of %s", curr.from, curr.to,
+					curr.from, curr.to))
+			}
+
+			doc[idx].Key = curr.to
+
+			line := locations.lines[curr.from]
+			if line == 0 || !renameKey(lines, line-1, curr.from, curr.to) {
+				reencode = true
+			}
+
+			warning := fmt.Sprintf("%s is deprecated since schema version %d, use %s", curr.from,
+				migration.version, curr.to)
+			if line > 0 {
+				warning = fmt.Sprintf("line %d: %s", line, warning)
+			}
+			warnings = append(warnings, warning)
+		}
+	}
+
+	if reencode {
+		if content, err = yaml.Marshal(doc); err != nil {
+			return nil, 0, nil, errors.Wrap(err)
+		}
+
+		return content, version, warnings, nil
+	}
+
+	return []byte(strings.Join(lines, "\n")), version, warnings, nil
+}
+
+// renameKey renames the top level key of the line, false if the line does not start with it
+func renameKey(lines []string, idx int, from string, to string) bool {
+	for _, quote := range []string{"", "\"", "'"} {
+		prefix := quote + from + quote + ":"
+
+		if strings.HasPrefix(lines[idx], prefix) {
+			lines[idx] = to + ":" + strings.TrimPrefix(lines[idx], prefix)
+			return true
+		}
+	}
+
+	return false
+}
+
+// readConfigFile reads a configuration file migrated to the current schema version, the
+// deprecated fields are logged
+func readConfigFile(path string) ([]byte, []string, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, errors.Wrap(err)
+	}
+
+	return migrateConfig(path, content)
+}
+
+// migrateConfig migrates the content of a configuration to the current schema version, the
+// deprecated fields are logged. path is the configuration file, empty if the content was not
+// read from a file.
+func migrateConfig(path string, content []byte) ([]byte, []string, error) {
+	content, _, warnings, err := migrateContent(content)
+	if err != nil {
+		return nil, nil, fileError(path, err)
+	}
+
+	for idx, curr := range warnings {
+		if path != "" {
+			warnings[idx] = fmt.Sprintf("%s: %s", path, curr)
+		}
+		log.Warning("Deprecated configuration field: %s", warnings[idx])
+	}
+
+	return content, warnings, nil
+}
+
+// setSchemaVersion sets the schemaVersion field of the configuration to the current version,
+// a new field is added after the header comments
+func setSchemaVersion(content []byte) []byte {
+	field := fmt.Sprintf("%s: %d", schemaVersionField, CurrentSchemaVersion)
+	lines := strings.Split(string(content), "\n")
+
+	if line := locateFields(content).lines[schemaVersionField]; line > 0 {
+		lines[line-1] = field
+		return []byte(strings.Join(lines, "\n"))
+	}
+
+	idx := 0
+	for idx < len(lines) && strings.HasPrefix(lines[idx], "#") {
+		idx++
+	}
+
+	lines = append(lines[:idx], append([]string{field}, lines[idx:]...)...)
+	return []byte(strings.Join(lines, "\n"))
+}
+
+// MigrateConfigFile rewrites the configuration file to the current schema version, the
+// comments and formatting are kept. The original file is backed up. It returns false if the
+// file is already at the current version, and the deprecated fields renamed.
+func MigrateConfigFile(cf string) (bool, []string, error) {
+	info, err := os.Stat(cf)
+	if err != nil {
+		return false, nil, errors.Wrap(err)
+	}
+
+	content, err := ioutil.ReadFile(cf)
+	if err != nil {
+		return false, nil, errors.Wrap(err)
+	}
+
+	migrated, version, warnings, err := migrateContent(content)
+	if err != nil {
+		return false, nil, fileError(cf, err)
+	}
+
+	if version == CurrentSchemaVersion {
+		return false, nil, nil
+	}
+
+	migrated = setSchemaVersion(migrated)
+
+	// the migrated file must load with no deprecated field left
+	var si SystemInstall
+	if err = yaml.UnmarshalStrict(migrated, &si); err != nil {
+		return false, nil, fileError(cf, locateFields(migrated).decodeError(err))
+	}
+
+	if err = backupConfigFile(cf); err != nil {
+		return false, nil, err
+	}
+
+	if err = ioutil.WriteFile(cf, migrated, info.Mode()); err != nil {
+		return false, nil, errors.Wrap(err)
+	}
+
+	log.Info("Migrated config file %s from schema version %d to %d", cf, version, CurrentSchemaVersion)
+	return true, warnings, nil
+}
@@ -0,0 +1,129 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestMigrateContent(t *testing.T) {
+	tests := []struct {
+		doc      string
+		result   string
+		version  uint
+		warnings []string
+		err      string
+	}{
+		{"#clear-linux-config\nblock-devices: [{name: a, file: a.img}]\n\npre-install:\n- cmd: ls # list\n",
+			"#clear-linux-config\nblockDevices: [{name: a, file: a.img}]\n\npreInstall:\n- cmd: ls # list\n", 1,
+			[]string{"line 2: block-devices is deprecated since schema version 2, use blockDevices",
+				"line 4: pre-install is deprecated since schema version 2, use preInstall"}, ""},
+		{"schemaVersion: 2\nkernelArguments: {add: [quiet]}\n",
+			"schemaVersion: 2\nkernelArguments: {add: [quiet]}\n", 2, []string{}, ""},
+		{"{\"post-install\": [{cmd: ls}]}\n", "postInstall:\n- cmd: ls\n", 1,
+			[]string{"post-install is deprecated since schema version 2, use postInstall"}, ""},
+		{"kernel-arguments: {}\nkernelArguments: {}\n", "", 0, nil, "line 1: kernel-arguments: Both"},
+		{"keyboard: us\nschemaVersion: 3\n", "", 0, nil, "line 2: schemaVersion: Schema version 3 is not supported"},
+		{"schemaVersion: two\n", "", 0, nil, "line 1: schemaVersion: Invalid schema version: two"},
+	}
+
+	for _, curr := range tests {
+		result, version, warnings, err := migrateContent([]byte(curr.doc))
+
+		if curr.err != "" {
+			if _, ok := err.(errors.ValidationError); !ok || !strings.HasPrefix(err.Error(), curr.err) {
+				t.Fatalf("%q: expected the %q error, got: %v", curr.doc, curr.err, err)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", curr.doc, err)
+		}
+
+		if string(result) != curr.result || version != curr.version ||
+			strings.Join(warnings, "|") != strings.Join(curr.warnings, "|") {
+			t.Fatalf("%q: expected %q version %d %q, got: %q version %d %q", curr.doc, curr.result,
+				curr.version, curr.warnings, result, version, warnings)
+		}
+	}
+}
+
+func TestLoadFileMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	writeConfigs(t, dir, map[string]string{
+		"base.yaml": "kernel-arguments: {add: [quiet]}\npost-install: [{cmd: a}]\n",
+		"site.yaml": "schemaVersion: 2\nextends: base.yaml\npostInstall: [{cmd: b}]\n",
+		"line.yaml": "pre-install:\n- cmd: ls\nbundels: [os-core]\n",
+	})
+
+	si, err := LoadFile(filepath.Join(dir, "site.yaml"), args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load the composed configuration: %v", err)
+	}
+
+	if si.SchemaVersion != CurrentSchemaVersion || len(si.PostInstall) != 2 ||
+		si.KernelArguments == nil || si.KernelArguments.Add[0] != "quiet" {
+		t.Fatalf("The base file should be migrated before it is merged, got: %+v", si)
+	}
+
+	warnings := si.DeprecationWarnings()
+	if len(warnings) != 2 || !strings.HasPrefix(warnings[0], filepath.Join(dir, "base.yaml")+": line 1: kernel-arguments") {
+		t.Fatalf("Expected the base file deprecated fields, got: %q", warnings)
+	}
+
+	// the migrated fields keep their lines
+	_, err = LoadFile(filepath.Join(dir, "line.yaml"), args.Args{})
+	if ve, ok := err.(errors.ValidationError); !ok || ve.Line != 3 {
+		t.Fatalf("Expected an unknown field error at line 3, got: %v", err)
+	}
+}
+
+func TestMigrateConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrate-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cf := filepath.Join(dir, "old.yaml")
+	writeConfigs(t, dir, map[string]string{
+		"old.yaml": "#clear-linux-config\n# the image alias\nblock-devices: [{name: a, file: a.img}]\n" +
+			"post-install:\n  - cmd: ls\n",
+	})
+
+	migrated, warnings, err := MigrateConfigFile(cf)
+	if err != nil || !migrated || len(warnings) != 2 {
+		t.Fatalf("Expected the file to be migrated, got: %v %q %v", migrated, warnings, err)
+	}
+
+	content, err := ioutil.ReadFile(cf)
+	expected := "#clear-linux-config\n# the image alias\nschemaVersion: 2\n" +
+		"blockDevices: [{name: a, file: a.img}]\npostInstall:\n  - cmd: ls\n"
+	if err != nil || string(content) != expected {
+		t.Fatalf("Expected the migrated content %q, got: %q %v", expected, content, err)
+	}
+
+	backups, _ := filepath.Glob(filepath.Join(dir, "old-*.yaml"))
+	if len(backups) != 1 {
+		t.Fatalf("Expected a backup of the original file, got: %v", backups)
+	}
+
+	if migrated, _, err = MigrateConfigFile(cf); err != nil || migrated {
+		t.Fatalf("A current file should be left as is, got: %v %v", migrated, err)
+	}
+}
@@ -6,7 +6,6 @@ package model
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,11 +14,17 @@ import (
 	"gopkg.in/yaml.v2"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/bootloader"
 	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/files"
 	"github.com/clearlinux/clr-installer/kernel"
 	"github.com/clearlinux/clr-installer/keyboard"
 	"github.com/clearlinux/clr-installer/language"
 	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/oci"
+	"github.com/clearlinux/clr-installer/proxy"
+	"github.com/clearlinux/clr-installer/secret"
+	"github.com/clearlinux/clr-installer/services"
 	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/telemetry"
 	"github.com/clearlinux/clr-installer/timezone"
@@ -32,6 +37,13 @@ const (
 	// when running in demo (aka documentation mode). We will
 	// now use this as a flag to not include the version in UI.
 	DemoVersion = "X.Y.Z"
+
+	// TargetDisk is the default install target, the system is installed to the target media
+	TargetDisk = "disk"
+
+	// TargetDirectory is the install target where only the root file system content
+	// is installed into a given directory
+	TargetDirectory = "directory"
 )
 
 // Version of Clear Installer.
@@ -54,6 +66,9 @@ type SystemInstall struct {
 	// device name for which it holds InstallTarget information when/if
 	// we add support for installing across multiple disks.
 	InstallSelected   storage.InstallTarget  `yaml:"-"`
+	SchemaVersion     uint                   `yaml:"schemaVersion,omitempty,flow"`
+	Target            string                 `yaml:"target,omitempty"`
+	TargetDir         string                 `yaml:"targetDir,omitempty"`
 	TargetMedias      []*storage.BlockDevice `yaml:"targetMedia"`
 	NetworkInterfaces []*network.Interface   `yaml:"networkInterfaces,omitempty,flow"`
 	Keyboard          *keyboard.Keymap       `yaml:"keyboard,omitempty,flow"`
@@ -61,11 +76,16 @@ type SystemInstall struct {
 	Bundles           []string               `yaml:"bundles,omitempty,flow"`
 	UserBundles       []string               `yaml:"userBundles,omitempty,flow"`
 	HTTPSProxy        string                 `yaml:"httpsProxy,omitempty,flow"`
+	ProxyCredentials  *secret.Value          `yaml:"httpsProxyCredentials,omitempty,flow"`
 	Telemetry         *telemetry.Telemetry   `yaml:"telemetry,omitempty,flow"`
 	Timezone          *timezone.TimeZone     `yaml:"timezone,omitempty,flow"`
 	Users             []*user.User           `yaml:"users,omitempty,flow"`
-	KernelArguments   *kernel.Arguments      `yaml:"kernel-arguments,omitempty,flow"`
+	Files             []*files.File          `yaml:"files,omitempty,flow"`
+	Services          *services.Services     `yaml:"services,omitempty,flow"`
+	KernelArguments   *kernel.Arguments      `yaml:"kernelArguments,omitempty,flow"`
 	Kernel            *kernel.Kernel         `yaml:"kernel,omitempty,flow"`
+	Kernels           []*kernel.Kernel       `yaml:"kernels,omitempty,flow"`
+	Bootloader        *bootloader.Config     `yaml:"bootloader,omitempty"`
 	PostReboot        bool                   `yaml:"postReboot,omitempty,flow"`
 	SwupdMirror       string                 `yaml:"swupdMirror,omitempty,flow"`
 	PostArchive       bool                   `yaml:"postArchive,omitempty,flow"`
@@ -74,16 +94,28 @@ type SystemInstall struct {
 	TelemetryURL      string                 `yaml:"telemetryURL,omitempty,flow"`
 	TelemetryTID      string                 `yaml:"telemetryTID,omitempty,flow"`
 	TelemetryPolicy   string                 `yaml:"telemetryPolicy,omitempty,flow"`
-	PreInstall        []*InstallHook         `yaml:"pre-install,omitempty,flow"`
-	PostInstall       []*InstallHook         `yaml:"post-install,omitempty,flow"`
+	PreInstall        []*InstallHook         `yaml:"preInstall,omitempty,flow"`
+	PostPartition     []*InstallHook         `yaml:"postPartition,omitempty,flow"`
+	PostMount         []*InstallHook         `yaml:"postMount,omitempty,flow"`
+	PostBundles       []*InstallHook         `yaml:"postBundles,omitempty,flow"`
+	PreBootloader     []*InstallHook         `yaml:"preBootloader,omitempty,flow"`
+	PostInstall       []*InstallHook         `yaml:"postInstall,omitempty,flow"`
 	Version           uint                   `yaml:"version,omitempty,flow"`
-	StorageAlias      []*StorageAlias        `yaml:"block-devices,omitempty,flow"`
+	StorageAlias      []*StorageAlias        `yaml:"blockDevices,omitempty,flow"`
 	LegacyBios        bool                   `yaml:"legacyBios,omitempty,flow"`
 	CopyNetwork       bool                   `yaml:"copyNetwork,omitempty,flow"`
 	Environment       map[string]string      `yaml:"env,omitempty,flow"`
 	CryptPass         string                 `yaml:"-"`
+	CryptPassphrase   *secret.Value          `yaml:"cryptPassphrase,omitempty,flow"`
 	MakeISO           bool                   `yaml:"iso,omitempty,flow"`
 	KeepImage         bool                   `yaml:"keepImage,omitempty,flow"`
+	Verify            bool                   `yaml:"verify,omitempty,flow"`
+	Container         *oci.Config            `yaml:"container,omitempty"`
+	Extends           ConfigFiles            `yaml:"extends,omitempty,flow"`
+	Include           ConfigFiles            `yaml:"include,omitempty,flow"`
+	locations         *fieldLines
+	proxyCredentials  string
+	deprecations      []string
 }
 
 // SystemUsage is used to include additional information into the telemetry payload
@@ -92,18 +124,16 @@ type SystemUsage struct {
 	Hypervisor   string        `yaml:"hypervisor,omitempty,flow"`
 }
 
-// InstallHook is a commands to be executed in a given point of the install process
-type InstallHook struct {
-	Chroot bool   `yaml:"chroot,omitempty,flow"`
-	Cmd    string `yaml:"cmd,omitempty,flow"`
-}
-
 // StorageAlias is used to expand variables in the targetMedia definitions
 // a partition's block device name attribute could be declared in the form of:
-//   Name: ${alias}p1
+//
+//	Name: ${alias}p1
+//
 // where ${alias} was previously declared pointing to a block device file such as:
-// block-devices : [
-//   {name: "alias", file: "/dev/nvme0n1"}
+// blockDevices : [
+//
+//	{name: "alias", file: "/dev/nvme0n1"}
+//
 // ]
 type StorageAlias struct {
 	Name       string `yaml:"name,omitempty,flow"`
@@ -260,46 +290,383 @@ func (si *SystemInstall) EncryptionRequiresPassphrase() bool {
 }
 
 // Validate checks the model for possible inconsistencies or "minimum required"
-// information
+// information, the errors of a model loaded from a configuration file carry the
+// line of the offending field
 func (si *SystemInstall) Validate() error {
 	// si will be nil if we fail to unmarshall (coverage tests has a case for that)
 	if si == nil {
 		return errors.ValidationErrorf("model is nil")
 	}
 
-	if si.TargetMedias == nil || len(si.TargetMedias) == 0 {
-		return errors.ValidationErrorf("System Installation must provide a target media")
+	return si.locations.locateError(si.validate())
+}
+
+func (si *SystemInstall) validate() error {
+	for _, check := range si.checks() {
+		if err := check(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checks returns the independent validation checks of the configuration sections, each
+// one returning the first problem of its section
+func (si *SystemInstall) checks() []func() error {
+	return []func() error{
+		si.validateTarget,
+		func() error {
+			if si.Timezone == nil {
+				return errors.FieldValidationErrorf("timezone", "Timezone not set")
+			}
+			return nil
+		},
+		func() error {
+			if si.Keyboard == nil {
+				return errors.FieldValidationErrorf("keyboard", "Keyboard not set")
+			}
+			return nil
+		},
+		func() error {
+			if si.Language == nil {
+				return errors.FieldValidationErrorf("language", "System Language not set")
+			}
+			return nil
+		},
+		func() error {
+			if si.Telemetry == nil {
+				return errors.FieldValidationErrorf("telemetry", "Telemetry not acknowledged")
+			}
+			return nil
+		},
+		si.validateUsers,
+		si.validateHooks,
+		si.validateFiles,
+		func() error {
+			if si.Services != nil {
+				return prefixFieldError("services", si.Services.Validate())
+			}
+			return nil
+		},
+		si.validateContainer,
+		func() error {
+			// a root file system only install, i.e a container base, may have no kernel
+			if si.Kernel == nil && !si.IsDirectoryTarget() {
+				return errors.FieldValidationErrorf("kernel", "A kernel must be provided")
+			}
+			return nil
+		},
+		si.validateKernels,
+		func() error {
+			if si.KernelArguments != nil {
+				return prefixFieldError("kernelArguments", bootloader.ValidateArguments(si.KernelArguments))
+			}
+			return nil
+		},
+		func() error {
+			if si.Bootloader != nil {
+				return si.validateBootloader()
+			}
+			return nil
+		},
+	}
+}
+
+func (si *SystemInstall) validateTarget() error {
+	switch si.Target {
+	case "", TargetDisk:
+		return si.validateTargetMedias()
+	case TargetDirectory:
+		return si.validateTargetDir()
+	}
+
+	return errors.FieldValidationErrorf("target", "Invalid install target: %s", si.Target)
+}
+
+func (si *SystemInstall) validateUsers() error {
+	uids := map[uint]string{}
+
+	for idx, curr := range si.Users {
+		if curr == nil {
+			continue
+		}
+
+		if err := curr.Validate(); err != nil {
+			return prefixFieldError(fmt.Sprintf("users[%d]", idx), err)
+		}
+
+		if login, ok := uids[curr.UID]; curr.UID != 0 && ok {
+			return errors.FieldValidationErrorf(fmt.Sprintf("users[%d].uid", idx),
+				"uid %d is already the %s user one", curr.UID, login)
+		}
+		uids[curr.UID] = curr.Login
+	}
+
+	return nil
+}
+
+func (si *SystemInstall) validateFiles() error {
+	for idx, curr := range si.Files {
+		if curr == nil {
+			return errors.FieldValidationErrorf(fmt.Sprintf("files[%d]", idx), "Empty file")
+		}
+
+		if err := curr.Validate(); err != nil {
+			return prefixFieldError(fmt.Sprintf("files[%d]", idx), err)
+		}
+	}
+
+	return nil
+}
+
+func (si *SystemInstall) validateContainer() error {
+	if si.Container == nil {
+		return nil
+	}
+
+	if err := si.Container.Validate(); err != nil {
+		return prefixFieldError("container", err)
+	}
+
+	if si.IsDirectoryTarget() && isPathWithin(si.Container.Output, si.TargetDir) {
+		return errors.FieldValidationErrorf("container.output",
+			"Container image output can not be inside the target directory")
 	}
 
+	return nil
+}
+
+// defaultKernel returns the kernels list entry booted by default, the flagged one or the first
+func defaultKernel(kernels []*kernel.Kernel) *kernel.Kernel {
+	for _, curr := range kernels {
+		if curr != nil && curr.Default {
+			return curr
+		}
+	}
+
+	return kernels[0]
+}
+
+func (si *SystemInstall) validateKernels() error {
+	if len(si.Kernels) == 0 {
+		return nil
+	}
+
+	bundles := []string{}
+	hasDefault := false
+
+	for idx, curr := range si.Kernels {
+		field := fmt.Sprintf("kernels[%d]", idx)
+
+		if curr == nil || curr.Bundle == "" || curr.Bundle == "none" {
+			return errors.FieldValidationErrorf(field, "A kernel bundle must be provided")
+		}
+
+		if utils.StringSliceContains(bundles, curr.Bundle) {
+			return errors.FieldValidationErrorf(field, "Duplicated kernel: %s", curr.Bundle)
+		}
+
+		if curr.Default && hasDefault {
+			return errors.FieldValidationErrorf(field+".default", "Only one kernel can be the default")
+		}
+
+		bundles = append(bundles, curr.Bundle)
+		hasDefault = hasDefault || curr.Default
+	}
+
+	if def := defaultKernel(si.Kernels); si.Kernel != nil && si.Kernel.Bundle != def.Bundle {
+		return errors.FieldValidationErrorf("kernel", "Kernel %s is not the kernels default: %s",
+			si.Kernel.Bundle, def.Bundle)
+	}
+
+	return nil
+}
+
+// SetKernels sets the kernel booted by default and the fallback kernels installed along
+func (si *SystemInstall) SetKernels(def *kernel.Kernel, fallbacks []*kernel.Kernel) {
+	si.Kernel = def
+	si.Kernels = nil
+
+	if len(fallbacks) == 0 {
+		return
+	}
+
+	si.Kernels = []*kernel.Kernel{{Bundle: def.Bundle, Name: def.Name, Desc: def.Desc, Default: true}}
+
+	for _, curr := range fallbacks {
+		if curr.Bundle == def.Bundle {
+			continue
+		}
+
+		si.Kernels = append(si.Kernels, &kernel.Kernel{Bundle: curr.Bundle, Name: curr.Name, Desc: curr.Desc})
+	}
+}
+
+// KernelCmdline returns the default kernel's boot entry command line, as previewed
+// before the installation, or an empty string if no kernel is installed
+func (si *SystemInstall) KernelCmdline() string {
+	kernels := si.InstalledKernels()
+	if len(kernels) == 0 {
+		return ""
+	}
+
+	return bootloader.Preview(si.Bootloader, si.KernelArguments, kernels[0])
+}
+
+// DeprecationWarnings returns the deprecated fields of the loaded configuration files, the
+// fields are migrated to the current schema version
+func (si *SystemInstall) DeprecationWarnings() []string {
+	return si.deprecations
+}
+
+// KernelArgumentWarnings returns the non fatal issues of the kernel arguments
+func (si *SystemInstall) KernelArgumentWarnings() []string {
+	if si.KernelArguments == nil {
+		return []string{}
+	}
+
+	return si.KernelArguments.Warnings()
+}
+
+// InstalledKernels returns the kernel bundles installed to the target, the default first
+func (si *SystemInstall) InstalledKernels() []string {
+	if si.Kernel == nil || si.Kernel.Bundle == "" || si.Kernel.Bundle == "none" {
+		return []string{}
+	}
+
+	result := []string{si.Kernel.Bundle}
+
+	for _, curr := range si.Kernels {
+		if curr != nil && curr.Bundle != "none" && !utils.StringSliceContains(result, curr.Bundle) {
+			result = append(result, curr.Bundle)
+		}
+	}
+
+	return result
+}
+
+// isRootEncrypted returns true if the root partition is an encrypted one
+func (si *SystemInstall) isRootEncrypted() bool {
 	for _, curr := range si.TargetMedias {
+		for _, ch := range curr.Children {
+			if ch.MountPoint == "/" && ch.Type == storage.BlockDeviceTypeCrypt {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (si *SystemInstall) validateBootloader() error {
+	if si.IsDirectoryTarget() {
+		return errors.FieldValidationErrorf("bootloader", "A boot loader is not installed to a directory target")
+	}
+
+	if err := si.Bootloader.Validate(si.InstalledKernels(), si.LegacyBios); err != nil {
+		return prefixFieldError("bootloader", err)
+	}
+
+	if def := si.Bootloader.Default; def != "" && len(si.Kernels) > 0 && def != si.Kernel.Bundle {
+		return errors.FieldValidationErrorf("bootloader.default",
+			"Default kernel %s is not the kernels default: %s", def, si.Kernel.Bundle)
+	}
+
+	// the encrypted root is unlocked by the arguments clr-boot-manager generates
+	if si.Bootloader.GetBackend() == bootloader.BackendSystemdBoot && si.isRootEncrypted() {
+		return errors.FieldValidationErrorf("bootloader.backend",
+			"%s does not support an encrypted root partition", bootloader.BackendSystemdBoot)
+	}
+
+	return nil
+}
+
+func (si *SystemInstall) validateTargetMedias() error {
+	if si.TargetMedias == nil || len(si.TargetMedias) == 0 {
+		return errors.FieldValidationErrorf("targetMedia", "System Installation must provide a target media")
+	}
+
+	for idx, curr := range si.TargetMedias {
 		if err := curr.Validate(si.LegacyBios, si.CryptPass); err != nil {
-			return err
+			return prefixFieldError(fmt.Sprintf("targetMedia[%d]", idx), err)
 		}
 	}
 
-	if si.Timezone == nil {
-		return errors.ValidationErrorf("Timezone not set")
+	return nil
+}
+
+func (si *SystemInstall) validateTargetDir() error {
+	if si.TargetDir == "" {
+		return errors.FieldValidationErrorf("targetDir", "A directory target must provide a target directory")
 	}
 
-	if si.Keyboard == nil {
-		return errors.ValidationErrorf("Keyboard not set")
+	if !filepath.IsAbs(si.TargetDir) {
+		return errors.FieldValidationErrorf("targetDir", "Target directory must be an absolute path: %s", si.TargetDir)
 	}
 
-	if si.Language == nil {
-		return errors.ValidationErrorf("System Language not set")
+	if filepath.Clean(si.TargetDir) == "/" {
+		return errors.FieldValidationErrorf("targetDir", "Target directory can not be the host root directory")
 	}
 
-	if si.Telemetry == nil {
-		return errors.ValidationErrorf("Telemetry not acknowledged")
+	if len(si.TargetMedias) > 0 {
+		return errors.FieldValidationErrorf("targetMedia", "Target media is not supported by a directory target")
 	}
 
-	if si.Kernel == nil {
-		return errors.ValidationErrorf("A kernel must be provided")
+	if si.MakeISO {
+		return errors.FieldValidationErrorf("iso", "ISO image generation is not supported by a directory target")
+	}
+
+	if si.PostReboot {
+		return errors.FieldValidationErrorf("postReboot", "Reboot is not supported by a directory target")
 	}
 
 	return nil
 }
 
+// isPathWithin returns true if path is dir or one of its descendants
+func isPathWithin(path string, dir string) bool {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return false
+	}
+
+	rel, err := filepath.Rel(absDir, absPath)
+	if err != nil {
+		return false
+	}
+
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, "../"))
+}
+
+// IsDirectoryTarget returns true if only the root file system content is installed
+// into TargetDir, no media is partitioned and no boot loader is installed
+func (si *SystemInstall) IsDirectoryTarget() bool {
+	return si.Target == TargetDirectory
+}
+
+// prefixFieldError prepends prefix to the field path of a validation error, errors of
+// other types are returned untouched
+func prefixFieldError(prefix string, err error) error {
+	ve, ok := err.(errors.ValidationError)
+	if !ok {
+		return err
+	}
+
+	if ve.Field == "" {
+		ve.Field = prefix
+	} else {
+		ve.Field = prefix + "." + ve.Field
+	}
+
+	return ve
+}
+
 // AddTargetMedia adds a BlockDevice instance to the list of TargetMedias
 // if bd was previously added to as a target media its pointer is updated
 func (si *SystemInstall) AddTargetMedia(bd *storage.BlockDevice) {
@@ -327,8 +694,112 @@ func (si *SystemInstall) AddNetworkInterface(iface *network.Interface) {
 	si.NetworkInterfaces = append(si.NetworkInterfaces, iface)
 }
 
+// decodeFiles decodes the composed yaml configuration files, unknown fields, i.e
+// misspelled ones, are rejected instead of silently ignored. The files of older schema
+// versions are migrated.
+func (si *SystemInstall) decodeFiles(paths []string) error {
+	doc, composed, deprecations, err := composeFiles(paths)
+	if err != nil {
+		return err
+	}
+
+	var content []byte
+	if !composed {
+		if content, _, err = readConfigFile(paths[0]); err != nil {
+			return err
+		}
+	}
+
+	return si.decodeDocument(doc, composed, content, deprecations)
+}
+
+// decodeData decodes a configuration document not read from a file, its extends and
+// include files are relative to yamlDir
+func (si *SystemInstall) decodeData(data []byte, yamlDir string) error {
+	content, deprecations, err := migrateConfig("", data)
+	if err != nil {
+		return err
+	}
+
+	doc, composed, err := composeContent("", yamlDir, content, nil, &deprecations)
+	if err != nil {
+		return err
+	}
+
+	return si.decodeDocument(doc, composed, content, deprecations)
+}
+
+// decodeDocument decodes the composed document of a configuration strictly, content is
+// the migrated configuration if it is not composed, its lines locate the errors
+func (si *SystemInstall) decodeDocument(doc yaml.MapSlice, composed bool, content []byte,
+	deprecations []string) error {
+	var err error
+
+	if composed {
+		if content, err = yaml.Marshal(doc); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	locations := locateFields(content)
+	if err = yaml.UnmarshalStrict(content, si); err != nil {
+		return locations.decodeError(err)
+	}
+
+	// the lines of a composed configuration are not the ones of its files
+	if !composed {
+		si.locations = locations
+	}
+
+	si.deprecations = deprecations
+
+	return nil
+}
+
 // LoadFile loads a model from a yaml file pointed by path
 func LoadFile(path string, options args.Args) (*SystemInstall, error) {
+	return LoadFiles([]string{path}, options)
+}
+
+// LoadFiles loads a model from yaml files merged in order, the next files are overlays
+// of the first one, see ComposeFiles
+func LoadFiles(paths []string, options args.Args) (*SystemInstall, error) {
+	result := newSystemInstall()
+
+	if _, err := os.Stat(paths[0]); err == nil || len(paths) > 1 {
+		if err = result.decodeFiles(paths); err != nil {
+			return nil, err
+		}
+
+		// the relative paths are resolved from the first file's directory, as the installer's
+		// yamlDir variable
+		if err = result.resolveSecrets(filepath.Dir(paths[0])); err != nil {
+			return nil, result.locations.locateError(err)
+		}
+	}
+
+	return result.setDefaults(options)
+}
+
+// LoadData loads a model from data, a yaml document with the configuration file syntax,
+// its relative paths are resolved from yamlDir as the ones of a file in that directory
+func LoadData(data []byte, yamlDir string, options args.Args) (*SystemInstall, error) {
+	result := newSystemInstall()
+
+	if err := result.decodeData(data, yamlDir); err != nil {
+		return nil, err
+	}
+
+	if err := result.resolveSecrets(yamlDir); err != nil {
+		return nil, result.locations.locateError(err)
+	}
+
+	return result.setDefaults(options)
+}
+
+// newSystemInstall returns a model with the defaults of the entries a configuration
+// may only disable
+func newSystemInstall() *SystemInstall {
 	var result SystemInstall
 
 	// Default to archiving by default
@@ -337,43 +808,47 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 	// Default to Auto Updating enabled by default
 	result.AutoUpdate = true
 
-	if _, err := os.Stat(path); err == nil {
-		configStr, err := ioutil.ReadFile(path)
-		if err != nil {
-			return nil, errors.Wrap(err)
-		}
+	return &result
+}
 
-		err = yaml.Unmarshal(configStr, &result)
-		if err != nil {
-			return nil, errors.Wrap(err)
-		}
-	}
+// setDefaults sets the defaults of the entries a loaded configuration left unset and
+// expands the storage aliases
+func (si *SystemInstall) setDefaults(options args.Args) (*SystemInstall, error) {
+	// the older schema versions are migrated in memory
+	si.SchemaVersion = CurrentSchemaVersion
 
 	// Set default Timezone if not defined
-	if result.Timezone == nil {
-		result.Timezone = &timezone.TimeZone{Code: timezone.DefaultTimezone}
+	if si.Timezone == nil {
+		si.Timezone = &timezone.TimeZone{Code: timezone.DefaultTimezone}
 	}
 
 	// Set default Keyboard if not defined
-	if result.Keyboard == nil {
-		result.Keyboard = &keyboard.Keymap{Code: keyboard.DefaultKeyboard}
+	if si.Keyboard == nil {
+		si.Keyboard = &keyboard.Keymap{Code: keyboard.DefaultKeyboard}
 	}
 
 	// Set default Language if not defined
-	if result.Language == nil {
-		result.Language = &language.Language{Code: language.DefaultLanguage}
+	if si.Language == nil {
+		si.Language = &language.Language{Code: language.DefaultLanguage}
 	}
 
 	// Running in VirtualBox force the default to 'kernel-lts' if
 	// we are using the system default configuration file
 	// See https://github.com/clearlinux/clr-installer/issues/203
 	if options.ConfigFile == "" && utils.IsVirtualBox() {
-		result.Kernel = &kernel.Kernel{Bundle: "kernel-lts"}
+		si.Kernel = &kernel.Kernel{Bundle: "kernel-lts"}
+	}
+
+	// the kernels list default is the kernel when not set on its own
+	if len(si.Kernels) > 0 && si.Kernel == nil {
+		if def := defaultKernel(si.Kernels); def != nil {
+			si.Kernel = &kernel.Kernel{Bundle: def.Bundle}
+		}
 	}
 
 	tmp := map[string]*StorageAlias{}
 
-	for _, bds := range result.StorageAlias {
+	for _, bds := range si.StorageAlias {
 		tmp[bds.Name] = bds
 	}
 
@@ -387,18 +862,18 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 		tmp[tks[0]] = &StorageAlias{Name: tks[0], File: tks[1]}
 	}
 
-	result.StorageAlias = []*StorageAlias{}
+	si.StorageAlias = []*StorageAlias{}
 
 	for _, bds := range tmp {
-		result.StorageAlias = append(result.StorageAlias, bds)
+		si.StorageAlias = append(si.StorageAlias, bds)
 	}
 
-	if len(result.StorageAlias) > 0 {
+	if len(si.StorageAlias) > 0 {
 		alias := map[string]string{}
 		keepMe := []*StorageAlias{}
 
-		for _, curr := range result.StorageAlias {
-			if !isAliasInUse(result.TargetMedias, curr) {
+		for _, curr := range si.StorageAlias {
+			if !isAliasInUse(si.TargetMedias, curr) {
 				continue
 			}
 
@@ -426,18 +901,18 @@ func LoadFile(path string, options args.Args) (*SystemInstall, error) {
 		}
 
 		// keep only the aliases we're using
-		result.StorageAlias = keepMe
+		si.StorageAlias = keepMe
 
-		for _, bd := range result.TargetMedias {
+		for _, bd := range si.TargetMedias {
 			bd.ExpandName(alias)
 		}
 	}
 
-	if result.Version > 0 {
-		result.AutoUpdate = false
+	if si.Version > 0 {
+		si.AutoUpdate = false
 	}
 
-	return &result, nil
+	return si, nil
 }
 
 func isAliasInUse(bds []*storage.BlockDevice, alias *StorageAlias) bool {
@@ -494,7 +969,12 @@ func (si *SystemInstall) WriteFile(path string) error {
 		_ = f.Close()
 	}()
 
-	b, err := yaml.Marshal(si)
+	// the proxy password is a secret, the secrets are only written as references
+	clean := *si
+	clean.HTTPSProxy = proxy.Redact(si.HTTPSProxy)
+	clean.SchemaVersion = CurrentSchemaVersion
+
+	b, err := yaml.Marshal(&clean)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,583 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/files"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/timezone"
+)
+
+// the cloud-config and autoinstall keys the converter knows, the others are reported
+var (
+	cloudConfigKeys = []string{
+		"autoinstall", "hostname", "fqdn", "timezone", "locale", "keyboard", "packages", "users",
+		"ssh_authorized_keys", "runcmd", "bootcmd", "write_files", "package_update",
+		"package_upgrade",
+	}
+
+	autoinstallKeys = []string{
+		"version", "locale", "keyboard", "timezone", "identity", "ssh", "network", "storage",
+		"packages", "early-commands", "late-commands", "user-data", "updates", "refresh-installer",
+	}
+)
+
+// cloudCommand is a command of a command list, either a shell string or an argument list
+type cloudCommand string
+
+// UnmarshalYAML unmarshals a string or a list of arguments, the arguments are quoted
+func (cc *cloudCommand) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var cmd string
+
+	if err := unmarshal(&cmd); err == nil {
+		*cc = cloudCommand(cmd)
+		return nil
+	}
+
+	var args []string
+	if err := unmarshal(&args); err != nil {
+		return err
+	}
+
+	for idx, curr := range args {
+		args[idx] = strconv.Quote(curr)
+	}
+
+	*cc = cloudCommand(strings.Join(args, " "))
+	return nil
+}
+
+// cloudUser is a cloud-config user, "default" stands for the distribution's default user
+type cloudUser struct {
+	Name              string      `yaml:"name"`
+	Gecos             string      `yaml:"gecos"`
+	Groups            interface{} `yaml:"groups"`
+	Sudo              interface{} `yaml:"sudo"`
+	Passwd            string      `yaml:"passwd"`
+	PlainTextPasswd   string      `yaml:"plain_text_passwd"`
+	SSHAuthorizedKeys []string    `yaml:"ssh_authorized_keys"`
+	UID               uint        `yaml:"uid"`
+	Shell             string      `yaml:"shell"`
+	HomeDir           string      `yaml:"homedir"`
+	System            bool        `yaml:"system"`
+	isDefault         bool
+}
+
+// UnmarshalYAML unmarshals a user entry or the "default" string
+func (cu *cloudUser) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+
+	if err := unmarshal(&name); err == nil {
+		cu.Name = name
+		cu.isDefault = name == "default"
+		return nil
+	}
+
+	type plain cloudUser
+	return unmarshal((*plain)(cu))
+}
+
+type cloudKeyboard struct {
+	Layout string `yaml:"layout"`
+}
+
+type cloudFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Encoding    string `yaml:"encoding"`
+	Owner       string `yaml:"owner"`
+	Permissions string `yaml:"permissions"`
+	Append      bool   `yaml:"append"`
+}
+
+type cloudEthernet struct {
+	DHCP4       bool     `yaml:"dhcp4"`
+	Addresses   []string `yaml:"addresses"`
+	Gateway4    string   `yaml:"gateway4"`
+	Nameservers struct {
+		Addresses []string `yaml:"addresses"`
+		Search    []string `yaml:"search"`
+	} `yaml:"nameservers"`
+}
+
+// cloudNetwork is a netplan version 2 configuration, autoinstall may nest it in a network key
+type cloudNetwork struct {
+	Network   *cloudNetwork             `yaml:"network"`
+	Ethernets map[string]*cloudEthernet `yaml:"ethernets"`
+}
+
+// cloudStorageEntry is a curtin storage action
+type cloudStorageEntry struct {
+	Type   string      `yaml:"type"`
+	ID     string      `yaml:"id"`
+	Path   string      `yaml:"path"`
+	Device string      `yaml:"device"`
+	Volume string      `yaml:"volume"`
+	Size   interface{} `yaml:"size"`
+	Flag   string      `yaml:"flag"`
+	FsType string      `yaml:"fstype"`
+}
+
+type cloudStorage struct {
+	Layout *struct {
+		Name string `yaml:"name"`
+	} `yaml:"layout"`
+	Config []*cloudStorageEntry `yaml:"config"`
+}
+
+type cloudAutoinstall struct {
+	Locale   string         `yaml:"locale"`
+	Keyboard *cloudKeyboard `yaml:"keyboard"`
+	Timezone string         `yaml:"timezone"`
+	Identity *struct {
+		Hostname string `yaml:"hostname"`
+		Username string `yaml:"username"`
+		Password string `yaml:"password"`
+		Realname string `yaml:"realname"`
+	} `yaml:"identity"`
+	SSH *struct {
+		InstallServer  bool     `yaml:"install-server"`
+		AuthorizedKeys []string `yaml:"authorized-keys"`
+	} `yaml:"ssh"`
+	Network       *cloudNetwork  `yaml:"network"`
+	Storage       *cloudStorage  `yaml:"storage"`
+	Packages      []string       `yaml:"packages"`
+	EarlyCommands []cloudCommand `yaml:"early-commands"`
+	LateCommands  []cloudCommand `yaml:"late-commands"`
+	UserData      *cloudConfig   `yaml:"user-data"`
+}
+
+type cloudConfig struct {
+	Autoinstall       *cloudAutoinstall `yaml:"autoinstall"`
+	Hostname          string            `yaml:"hostname"`
+	FQDN              string            `yaml:"fqdn"`
+	Timezone          string            `yaml:"timezone"`
+	Locale            string            `yaml:"locale"`
+	Keyboard          *cloudKeyboard    `yaml:"keyboard"`
+	Packages          []string          `yaml:"packages"`
+	Users             []*cloudUser      `yaml:"users"`
+	SSHAuthorizedKeys []string          `yaml:"ssh_authorized_keys"`
+	Runcmd            []cloudCommand    `yaml:"runcmd"`
+	Bootcmd           []cloudCommand    `yaml:"bootcmd"`
+	WriteFiles        []*cloudFile      `yaml:"write_files"`
+}
+
+// ConvertCloudInit converts the common subset of a cloud-config file or of an autoinstall
+// configuration: the disk layout, users and ssh keys, network, time zone, keyboard, locale,
+// packages, files and commands. It returns the unsupported keys.
+func ConvertCloudInit(content []byte) (*SystemInstall, []string, error) {
+	c := newConverter()
+
+	var cfg cloudConfig
+	if err := yaml.Unmarshal(content, &cfg); err != nil {
+		return nil, nil, errors.ValidationErrorf("Invalid cloud-init configuration: %v", err)
+	}
+
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(content, &keys); err != nil {
+		return nil, nil, errors.ValidationErrorf("Invalid cloud-init configuration: %v", err)
+	}
+
+	c.checkKeys("", keys, cloudConfigKeys)
+
+	if cfg.Autoinstall != nil {
+		if ai, ok := keys["autoinstall"].(map[interface{}]interface{}); ok {
+			c.checkKeys("autoinstall.", stringKeys(ai), autoinstallKeys)
+
+			if ud, ok := ai["user-data"].(map[interface{}]interface{}); ok {
+				c.checkKeys("autoinstall.user-data.", stringKeys(ud), cloudConfigKeys)
+			}
+		}
+
+		c.convertAutoinstall(cfg.Autoinstall)
+	}
+
+	c.convertCloudConfig(&cfg)
+
+	if len(c.si.TargetMedias) == 0 {
+		c.warn("No disk layout, using the default layout")
+		c.defaultLayout(c.disk(convertedDisk))
+	}
+
+	si, warnings := c.finish()
+	return si, warnings, nil
+}
+
+func stringKeys(values map[interface{}]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+
+	for k, v := range values {
+		result[fmt.Sprint(k)] = v
+	}
+
+	return result
+}
+
+// checkKeys reports the keys not in known, sorted so the warnings are stable
+func (c *converter) checkKeys(prefix string, values map[string]interface{}, known []string) {
+	unknown := []string{}
+
+	for key := range values {
+		found := false
+		for _, curr := range known {
+			if curr == key {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			unknown = append(unknown, key)
+		}
+	}
+
+	sort.Strings(unknown)
+	for _, curr := range unknown {
+		c.warn("Unsupported cloud-init key %s%s", prefix, curr)
+	}
+}
+
+func (c *converter) convertAutoinstall(ai *cloudAutoinstall) {
+	c.convertLocale(ai.Locale, ai.Keyboard, ai.Timezone)
+
+	if ai.Identity != nil {
+		c.si.Hostname = ai.Identity.Hostname
+
+		if ai.Identity.Username != "" {
+			usr := c.user(ai.Identity.Username)
+			usr.UserName = ai.Identity.Realname
+			usr.Admin = true
+			c.setPassword(usr, ai.Identity.Password, true)
+		}
+	}
+
+	if ai.SSH != nil {
+		if ai.SSH.InstallServer {
+			c.si.AddBundle("openssh-server")
+		}
+
+		if len(ai.SSH.AuthorizedKeys) > 0 {
+			if ai.Identity == nil || ai.Identity.Username == "" {
+				c.warn("ssh.authorized-keys requires an identity, the keys are ignored")
+			} else {
+				usr := c.user(ai.Identity.Username)
+				usr.SSHKeys = append(usr.SSHKeys, ai.SSH.AuthorizedKeys...)
+			}
+		}
+	}
+
+	if ai.Network != nil {
+		c.convertNetwork(ai.Network)
+	}
+
+	if ai.Storage != nil {
+		c.convertStorage(ai.Storage)
+	}
+
+	c.addPackages(ai.Packages)
+
+	for _, curr := range ai.EarlyCommands {
+		c.si.PreInstall = append(c.si.PreInstall, &InstallHook{Cmd: string(curr)})
+	}
+
+	for _, curr := range ai.LateCommands {
+		c.si.PostInstall = append(c.si.PostInstall, lateCommandHook(string(curr)))
+	}
+
+	if ai.UserData != nil {
+		if ai.UserData.Autoinstall != nil {
+			c.warn("Nested autoinstall section in user-data is ignored")
+		}
+		c.convertCloudConfig(ai.UserData)
+	}
+}
+
+// lateCommandHook returns the hook of an autoinstall late command, the commands run with
+// "curtin in-target --" run in the target and the /target paths are the installer's target
+func lateCommandHook(cmd string) *InstallHook {
+	for _, prefix := range []string{"curtin in-target --target=/target --", "curtin in-target --"} {
+		if strings.HasPrefix(cmd, prefix) {
+			return &InstallHook{Chroot: true, Cmd: strings.TrimSpace(strings.TrimPrefix(cmd, prefix))}
+		}
+	}
+
+	return &InstallHook{Cmd: strings.Replace(cmd, "/target", "${chrootDir}", -1)}
+}
+
+func (c *converter) convertCloudConfig(cfg *cloudConfig) {
+	c.convertLocale(cfg.Locale, cfg.Keyboard, cfg.Timezone)
+
+	if cfg.FQDN != "" {
+		c.si.Hostname = cfg.FQDN
+	} else if cfg.Hostname != "" {
+		c.si.Hostname = cfg.Hostname
+	}
+
+	c.addPackages(cfg.Packages)
+
+	for _, curr := range cfg.Users {
+		c.convertCloudUser(curr)
+	}
+
+	if len(cfg.SSHAuthorizedKeys) > 0 {
+		c.warn("ssh_authorized_keys of the default user are ignored, set the keys of a user")
+	}
+
+	for _, curr := range cfg.Runcmd {
+		c.si.PostInstall = append(c.si.PostInstall, &InstallHook{Chroot: true, Cmd: string(curr)})
+	}
+
+	if len(cfg.Bootcmd) > 0 {
+		c.warn("bootcmd is not supported, the commands are ignored")
+	}
+
+	for _, curr := range cfg.WriteFiles {
+		c.convertCloudFile(curr)
+	}
+}
+
+func (c *converter) convertLocale(locale string, kbd *cloudKeyboard, tz string) {
+	if locale != "" {
+		c.si.Language = &language.Language{Code: locale}
+	}
+
+	if kbd != nil && kbd.Layout != "" {
+		c.si.Keyboard = &keyboard.Keymap{Code: kbd.Layout}
+	}
+
+	if tz != "" {
+		c.si.Timezone = &timezone.TimeZone{Code: tz}
+	}
+}
+
+func (c *converter) convertCloudUser(cu *cloudUser) {
+	if cu.isDefault {
+		c.warn("The default user is not supported, add a named user instead")
+		return
+	}
+
+	if cu.Name == "" {
+		c.warn("users entry with no name is ignored")
+		return
+	}
+
+	usr := c.user(cu.Name)
+	usr.UserName = cu.Gecos
+	usr.SSHKeys = append(usr.SSHKeys, cu.SSHAuthorizedKeys...)
+
+	if cu.Sudo != nil && cu.Sudo != false {
+		usr.Admin = true
+	}
+
+	var groups []string
+	switch value := cu.Groups.(type) {
+	case string:
+		groups = strings.Split(value, ",")
+	case []interface{}:
+		for _, curr := range value {
+			groups = append(groups, fmt.Sprint(curr))
+		}
+	}
+
+	for _, curr := range groups {
+		switch curr = strings.TrimSpace(curr); curr {
+		case "sudo", "wheel", "admin":
+			usr.Admin = true
+		case "":
+		default:
+			usr.Groups = append(usr.Groups, curr)
+		}
+	}
+
+	usr.UID, usr.Shell, usr.Home, usr.System = cu.UID, cu.Shell, cu.HomeDir, cu.System
+
+	if cu.Passwd != "" {
+		c.setPassword(usr, cu.Passwd, true)
+	} else if cu.PlainTextPasswd != "" {
+		c.setPassword(usr, cu.PlainTextPasswd, false)
+	}
+}
+
+func (c *converter) convertCloudFile(cf *cloudFile) {
+	file := &files.File{Path: cf.Path, Content: cf.Content, Append: cf.Append}
+
+	switch cf.Encoding {
+	case "", "text/plain":
+	case "b64", "base64":
+		file.Encoding = files.EncodingBase64
+	default:
+		c.warn("write_files %s encoding %s is not supported, the file is ignored", cf.Path, cf.Encoding)
+		return
+	}
+
+	if cf.Permissions != "" {
+		file.Mode = cf.Permissions
+	}
+
+	if cf.Owner != "" {
+		tks := strings.SplitN(cf.Owner, ":", 2)
+		file.Owner = tks[0]
+
+		if len(tks) == 2 {
+			file.Group = tks[1]
+		}
+	}
+
+	c.si.Files = append(c.si.Files, file)
+}
+
+// convertNetwork converts the netplan ethernets, the first name server is kept
+func (c *converter) convertNetwork(cn *cloudNetwork) {
+	if cn.Network != nil {
+		cn = cn.Network
+	}
+
+	names := []string{}
+	for name := range cn.Ethernets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		eth := cn.Ethernets[name]
+		iface := &network.Interface{Name: name, DHCP: eth.DHCP4, Gateway: eth.Gateway4}
+
+		for _, curr := range eth.Addresses {
+			ip, ipnet, err := net.ParseCIDR(curr)
+			if err != nil || ip.To4() == nil {
+				c.warn("Network %s address %s is not supported", name, curr)
+				continue
+			}
+
+			iface.AddAddr(ip.String(), net.IP(ipnet.Mask).String(), network.IPv4)
+		}
+
+		if servers := eth.Nameservers.Addresses; len(servers) > 0 {
+			iface.DNSServer = servers[0]
+
+			if len(servers) > 1 {
+				c.warn("Network %s: only the first name server, %s, is kept", name, servers[0])
+			}
+		}
+
+		if len(eth.Nameservers.Search) > 0 {
+			iface.DNSDomain = eth.Nameservers.Search[0]
+		}
+
+		if !iface.DHCP && len(iface.Addrs) == 0 {
+			c.warn("Network %s has neither dhcp4 nor addresses, the interface is not configured", name)
+			continue
+		}
+
+		c.si.AddNetworkInterface(iface)
+	}
+}
+
+// convertStorage converts the autoinstall layout or the curtin disk, partition, format and
+// mount actions
+func (c *converter) convertStorage(cs *cloudStorage) {
+	if cs.Layout != nil {
+		if cs.Layout.Name != "direct" {
+			c.warn("Storage layout %s is not supported, using the default layout", cs.Layout.Name)
+		}
+
+		c.defaultLayout(c.disk(convertedDisk))
+		return
+	}
+
+	disks := map[string]string{}
+	formats := map[string]*cloudStorageEntry{}
+	mounts := map[string]string{}
+
+	for _, curr := range cs.Config {
+		switch curr.Type {
+		case "disk":
+			if curr.Path == "" {
+				c.warn("Storage disk %s has no path, using /dev/%s", curr.ID, convertedDisk)
+			}
+			disks[curr.ID] = curr.Path
+		case "format":
+			formats[curr.Volume] = curr
+		case "mount":
+			mounts[curr.Device] = curr.Path
+		case "partition":
+		default:
+			c.warn("Storage %s %s is not supported", curr.Type, curr.ID)
+		}
+	}
+
+	for _, curr := range cs.Config {
+		if curr.Type != "partition" {
+			continue
+		}
+
+		path, ok := disks[curr.Device]
+		if !ok {
+			c.warn("Storage partition %s disk %s is not supported", curr.ID, curr.Device)
+			continue
+		}
+
+		format, ok := formats[curr.ID]
+		if !ok {
+			c.warn("Storage partition %s is not formatted, skipped", curr.ID)
+			continue
+		}
+
+		size, err := curtinSize(curr.Size)
+		if err != nil {
+			c.warn("Storage partition %s: %v", curr.ID, err)
+			continue
+		}
+
+		fstype := format.FsType
+		mount := mounts[format.ID]
+
+		switch {
+		case fstype == "fat32" || fstype == "fat16" || fstype == "fat":
+			fstype = "vfat"
+		case fstype == "swap":
+			mount = ""
+		}
+
+		if curr.Flag == "boot" && mount == "" {
+			mount = "/boot"
+		}
+
+		c.addPartition(c.disk(path), mount, fstype, size)
+	}
+}
+
+// curtinSize returns the size in bytes of a curtin size, -1 takes the remaining space
+func curtinSize(value interface{}) (uint64, error) {
+	str := strings.TrimSpace(fmt.Sprint(value))
+
+	switch str {
+	case "-1", "<nil>":
+		return 0, nil
+	}
+
+	if size, err := strconv.ParseUint(str, 10, 64); err == nil {
+		return size, nil
+	}
+
+	size, err := storage.ParseVolumeSize(strings.TrimSuffix(strings.ToUpper(str), "B"))
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %s", str)
+	}
+
+	return size, nil
+}
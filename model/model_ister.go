@@ -85,12 +85,12 @@ type Network struct {
 	DNS     string `json:"dns"`
 }
 
-// JSONtoYAMLConfig converts the "ister"JSON config to the corresponding YAML config fields
-// and writes it out to a YAML config file.
-func JSONtoYAMLConfig(cf string) (string, error) {
+// ConvertIster converts the "ister" JSON config to the corresponding model, nothing is
+// written
+func ConvertIster(cf string) (*SystemInstall, error) {
 	fp, err := os.Open(cf)
 	if err != nil {
-		return cf, errors.Wrap(err)
+		return nil, errors.Wrap(err)
 	}
 	log.Debug("Successfully opened config file: %s", cf)
 	defer func() {
@@ -99,13 +99,13 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 
 	b, err := ioutil.ReadAll(fp)
 	if err != nil {
-		return cf, errors.Wrap(err)
+		return nil, errors.Wrap(err)
 	}
 
 	ic := IsterConfig{}
 	err = json.Unmarshal(b, &ic)
 	if err != nil {
-		return cf, errors.Wrap(err)
+		return nil, errors.Wrap(err)
 	}
 
 	si := SystemInstall{}
@@ -131,7 +131,7 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 				sa.Name = strings.TrimSuffix(curr.Disk, filepath.Ext(curr.Disk)) // remove any extensions from alias name
 				sa.File = "/dev/" + curr.Disk
 			default:
-				return cf, errors.Errorf("invalid DestinationType in config file %s", cf)
+				return nil, errors.Errorf("invalid DestinationType in config file %s", cf)
 			}
 			si.StorageAlias = append(si.StorageAlias, &sa)
 			si.AddTargetMedia(&bd)
@@ -139,17 +139,17 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 			var partitions = make(map[uint64]storage.BlockDevice)
 			partitions[curr.Partition], err = setStorageValues(curr.Disk, curr.Partition, curr.Size)
 			if err != nil {
-				return cf, errors.Wrap(err)
+				return nil, errors.Wrap(err)
 			}
 			disks[curr.Disk] = partitions
 		} else {
 			_, ok := partitions[curr.Partition]
 			if ok {
-				return cf, fmt.Errorf("partition %d already defined for disk %s in config file %s", curr.Partition, curr.Disk, cf)
+				return nil, fmt.Errorf("partition %d already defined for disk %s in config file %s", curr.Partition, curr.Disk, cf)
 			}
 			partitions[curr.Partition], err = setStorageValues(curr.Disk, curr.Partition, curr.Size)
 			if err != nil {
-				return cf, errors.Wrap(err)
+				return nil, errors.Wrap(err)
 			}
 			disks[curr.Disk] = partitions
 		}
@@ -159,12 +159,12 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 	for _, curr := range ic.FilesystemTypes {
 		partitions, ok := disks[curr.Disk]
 		if !ok {
-			return cf, errors.Errorf("disk %s not defined in config file %s", curr.Disk, cf)
+			return nil, errors.Errorf("disk %s not defined in config file %s", curr.Disk, cf)
 		}
 
 		part, ok := partitions[curr.Partition]
 		if !ok {
-			return cf, errors.Errorf("partition %d not defined for disk %s in config file %s", curr.Partition, curr.Disk, cf)
+			return nil, errors.Errorf("partition %d not defined for disk %s in config file %s", curr.Partition, curr.Disk, cf)
 		}
 		part.FsType = curr.Type
 		part.Options = curr.Options
@@ -177,12 +177,12 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 	for _, curr := range ic.PartitionMountPoints {
 		partitions, ok := disks[curr.Disk]
 		if !ok {
-			return cf, errors.Errorf("disk %s not defined in config file %s", curr.Disk, cf)
+			return nil, errors.Errorf("disk %s not defined in config file %s", curr.Disk, cf)
 		}
 
 		part, ok := partitions[curr.Partition]
 		if !ok {
-			return cf, errors.Errorf("partition %d not defined for partitions %s in config file %s", curr.Partition, curr.Disk, cf)
+			return nil, errors.Errorf("partition %d not defined for partitions %s in config file %s", curr.Partition, curr.Disk, cf)
 		}
 		part.MountPoint = curr.Mount
 
@@ -278,10 +278,10 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 	si.HTTPSProxy = ic.HTTPSProxy // Set HTTPSProxy
 	if si.HTTPSProxy == "" {
 		si.HTTPSProxy = ic.HTTPProxy
-		fmt.Println("WARNING: Mapping HTTPProxy in json to HTTPSProxy in yaml")
+		fmt.Fprintln(os.Stderr, "WARNING: Mapping HTTPProxy in json to HTTPSProxy in yaml")
 		log.Warning("Mapping HTTPProxy in json to HTTPSProxy in yaml")
 	} else {
-		fmt.Println("WARNING: Skipping HTTPProxy mapping")
+		fmt.Fprintln(os.Stderr, "WARNING: Skipping HTTPProxy mapping")
 		log.Warning("Skipping HTTPProxy mapping")
 	}
 
@@ -291,37 +291,31 @@ func JSONtoYAMLConfig(cf string) (string, error) {
 	si.Language = &language.Language{Code: language.DefaultLanguage} // Set Language
 
 	if ic.VersionURL != "" {
-		fmt.Println("WARNING: Skipping VersionURL mapping as it not supported in clr-installer config")
+		fmt.Fprintln(os.Stderr, "WARNING: Skipping VersionURL mapping as it not supported in clr-installer config")
 		log.Warning("Skipping VersionURL mapping as it not supported in clr-installer config")
 	}
 
-	cf = strings.TrimSuffix(cf, filepath.Ext(cf)) + ".yaml"
-	info, err := os.Stat(cf)
+	return &si, nil
+}
+
+// JSONtoYAMLConfig converts the "ister"JSON config to the corresponding YAML config fields
+// and writes it out to a YAML config file.
+func JSONtoYAMLConfig(cf string) (string, error) {
+	si, err := ConvertIster(cf)
 	if err != nil {
-		if os.IsNotExist(err) {
-			// File does not exist, skip backup
-		} else {
-			return cf, errors.Wrap(err)
-		}
-	} else { // Make backup
-		mt := info.ModTime()
-		suffix := fmt.Sprintf("-%d-%02d-%02d-%02d%02d%02d",
-			mt.Year(), mt.Month(), mt.Day(),
-			mt.Hour(), mt.Minute(), mt.Second())
-		bf := strings.TrimSuffix(cf, filepath.Ext(cf)) + suffix + ".yaml"
-		err = os.Rename(cf, bf)
-		if err != nil {
-			return cf, errors.Wrap(err)
-		}
-		fmt.Printf("WARNING: Config file %s already exists. Making a backup: %s\n", cf, bf)
-		log.Warning("Config file %s already exists. Taking a backup: %s\n", cf, bf)
+		return cf, err
+	}
+
+	cf = strings.TrimSuffix(cf, filepath.Ext(cf)) + ".yaml"
+	if err = backupConfigFile(cf); err != nil {
+		return cf, err
 	}
 
 	err = si.WriteFile(cf)
 	if err != nil {
 		return cf, errors.Wrap(err)
 	}
-	fmt.Println("Converted config file from JSON to YAML: " + cf)
+	fmt.Fprintln(os.Stderr, "Converted config file from JSON to YAML: "+cf)
 	log.Info("Converted config file from JSON to YAML: " + cf)
 	return cf, nil
 }
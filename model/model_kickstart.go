@@ -0,0 +1,511 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/services"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/timezone"
+)
+
+// kickstartIgnored are the kickstart directives with no meaning for the installer,
+// ignored without warning
+var kickstartIgnored = map[string]bool{
+	"text":      true,
+	"cmdline":   true,
+	"graphical": true,
+	"skipx":     true,
+	"install":   true,
+	"zerombr":   true,
+	"eula":      true,
+}
+
+// kickstartDirective is a kickstart command line: its name, --option=value options and
+// positional arguments
+type kickstartDirective struct {
+	line    int
+	name    string
+	options map[string]string
+	args    []string
+}
+
+func (kd *kickstartDirective) option(name string) (string, bool) {
+	value, ok := kd.options[name]
+	return value, ok
+}
+
+// kickstartSection is a %packages, %pre or %post section
+type kickstartSection struct {
+	directive *kickstartDirective
+	lines     []string
+}
+
+// kickstartPart is a part directive, the partitions are added once the disks are known
+type kickstartPart struct {
+	line   int
+	disk   string
+	mount  string
+	fstype string
+	size   uint64
+}
+
+// ConvertKickstart converts the common subset of an Anaconda kickstart file: the disk
+// layout, users and ssh keys, network, time zone, keyboard, language, packages, services,
+// boot loader arguments and %pre/%post scripts. It returns the unsupported directives.
+func ConvertKickstart(content []byte) (*SystemInstall, []string, error) {
+	c := newConverter()
+
+	var (
+		section   *kickstartSection
+		parts     []*kickstartPart
+		drives    []string
+		autopart  bool
+		lineCount int
+	)
+
+	for idx, raw := range strings.Split(string(content), "\n") {
+		lineCount = idx + 1
+		line := strings.TrimSpace(raw)
+
+		if section != nil {
+			if line == "%end" {
+				convertKickstartSection(c, section)
+				section = nil
+				continue
+			}
+
+			section.lines = append(section.lines, strings.TrimRight(raw, "\r"))
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		kd, err := parseKickstartDirective(idx+1, line)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if strings.HasPrefix(kd.name, "%") {
+			section = &kickstartSection{directive: kd}
+			continue
+		}
+
+		switch kd.name {
+		case "lang":
+			if len(kd.args) > 0 {
+				c.si.Language = &language.Language{Code: kd.args[0]}
+			}
+		case "keyboard":
+			convertKickstartKeyboard(c, kd)
+		case "timezone":
+			if len(kd.args) > 0 {
+				c.si.Timezone = &timezone.TimeZone{Code: kd.args[0]}
+			}
+		case "network":
+			convertKickstartNetwork(c, kd)
+		case "rootpw":
+			c.warn("line %d: rootpw is not supported, Clear Linux has no root password, "+
+				"add an admin user instead", kd.line)
+		case "user":
+			convertKickstartUser(c, kd)
+		case "sshkey":
+			login, _ := kd.option("username")
+			if login == "" || len(kd.args) == 0 {
+				c.warn("line %d: sshkey requires --username and a key", kd.line)
+				break
+			}
+			usr := c.user(login)
+			usr.SSHKeys = append(usr.SSHKeys, strings.Join(kd.args, " "))
+		case "ignoredisk", "clearpart":
+			for _, name := range []string{"only-use", "drives"} {
+				if value, ok := kd.option(name); ok {
+					drives = append(drives, strings.Split(value, ",")...)
+				}
+			}
+		case "autopart":
+			autopart = true
+		case "reqpart":
+			parts = append(parts, &kickstartPart{line: kd.line, mount: "/boot", fstype: "vfat"})
+		case "part", "partition":
+			if part := convertKickstartPart(c, kd); part != nil {
+				parts = append(parts, part)
+			}
+		case "bootloader":
+			if value, ok := kd.option("append"); ok {
+				c.si.AddExtraKernelArguments(strings.Fields(value))
+			}
+		case "services":
+			convertKickstartServices(c, kd)
+		case "reboot":
+			c.si.PostReboot = true
+		default:
+			if !kickstartIgnored[kd.name] {
+				c.warn("line %d: unsupported kickstart directive %q", kd.line, kd.name)
+			}
+		}
+	}
+
+	if section != nil {
+		return nil, nil, errors.ValidationErrorf("line %d: %s section has no %%end", lineCount,
+			section.directive.name)
+	}
+
+	disk := convertedDisk
+	if len(drives) > 0 {
+		disk = drives[0]
+	}
+
+	if autopart || len(parts) == 0 {
+		if len(parts) == 0 && !autopart {
+			c.warn("No disk layout, using the default layout")
+		}
+		c.defaultLayout(c.disk(disk))
+	} else {
+		bootSize, _ := storage.ParseVolumeSize(defaultBootSize)
+
+		for _, curr := range parts {
+			if curr.mount == "/boot" && curr.fstype == "vfat" && curr.size == 0 {
+				curr.size = bootSize
+			}
+
+			name := curr.disk
+			if name == "" {
+				name = disk
+			}
+
+			c.addPartition(c.disk(name), curr.mount, curr.fstype, curr.size)
+		}
+	}
+
+	si, warnings := c.finish()
+	return si, warnings, nil
+}
+
+// parseKickstartDirective splits a kickstart line in its name, options and arguments, the
+// quotes are removed from the values
+func parseKickstartDirective(line int, text string) (*kickstartDirective, error) {
+	fields, err := splitQuoted(text)
+	if err != nil {
+		return nil, errors.ValidationErrorf("line %d: %v", line, err)
+	}
+
+	kd := &kickstartDirective{line: line, name: fields[0], options: map[string]string{}}
+
+	for _, curr := range fields[1:] {
+		if !strings.HasPrefix(curr, "--") {
+			kd.args = append(kd.args, curr)
+			continue
+		}
+
+		tks := strings.SplitN(strings.TrimPrefix(curr, "--"), "=", 2)
+		if len(tks) == 1 {
+			tks = append(tks, "")
+		}
+		kd.options[tks[0]] = tks[1]
+	}
+
+	return kd, nil
+}
+
+// splitQuoted splits a line on white spaces, as a shell would, with single and double
+// quoted strings
+func splitQuoted(text string) ([]string, error) {
+	result := []string{}
+	var (
+		curr   strings.Builder
+		quote  rune
+		inWord bool
+	)
+
+	for _, r := range text {
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote != 0:
+			curr.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t':
+			if inWord {
+				result = append(result, curr.String())
+				curr.Reset()
+				inWord = false
+			}
+		default:
+			curr.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+
+	if inWord {
+		result = append(result, curr.String())
+	}
+
+	return result, nil
+}
+
+func convertKickstartKeyboard(c *converter, kd *kickstartDirective) {
+	code := ""
+
+	if len(kd.args) > 0 {
+		code = kd.args[0]
+	} else if value, ok := kd.option("vckeymap"); ok {
+		code = value
+	} else if value, ok := kd.option("xlayouts"); ok {
+		code = strings.Split(value, ",")[0]
+	}
+
+	if code == "" {
+		c.warn("line %d: keyboard has no layout", kd.line)
+		return
+	}
+
+	c.si.Keyboard = &keyboard.Keymap{Code: strings.Trim(code, "'\"")}
+}
+
+func convertKickstartNetwork(c *converter, kd *kickstartDirective) {
+	if value, ok := kd.option("hostname"); ok {
+		c.si.Hostname = value
+	}
+
+	proto, hasProto := kd.option("bootproto")
+	device, _ := kd.option("device")
+
+	if !hasProto && device == "" {
+		return
+	}
+
+	if device == "" || device == "link" || strings.Contains(device, ":") {
+		c.warn("line %d: network requires an interface name --device, the interface is not configured",
+			kd.line)
+		return
+	}
+
+	iface := &network.Interface{Name: device, DHCP: proto != "static"}
+
+	if _, ok := kd.option("ipv6"); ok {
+		c.warn("line %d: network --ipv6 is not supported", kd.line)
+	}
+
+	if proto == "static" {
+		ip, _ := kd.option("ip")
+		mask, _ := kd.option("netmask")
+
+		if ip == "" || mask == "" {
+			c.warn("line %d: a static network requires --ip and --netmask", kd.line)
+			return
+		}
+
+		iface.AddAddr(ip, mask, network.IPv4)
+		iface.Gateway, _ = kd.option("gateway")
+
+		if value, ok := kd.option("nameserver"); ok {
+			servers := strings.Split(value, ",")
+			iface.DNSServer = servers[0]
+
+			if len(servers) > 1 {
+				c.warn("line %d: only the first name server, %s, is kept", kd.line, servers[0])
+			}
+		}
+	} else if proto != "" && proto != "dhcp" {
+		c.warn("line %d: network --bootproto=%s is not supported, using dhcp", kd.line, proto)
+	}
+
+	c.si.AddNetworkInterface(iface)
+}
+
+func convertKickstartUser(c *converter, kd *kickstartDirective) {
+	login, _ := kd.option("name")
+	if login == "" {
+		c.warn("line %d: user requires --name", kd.line)
+		return
+	}
+
+	usr := c.user(login)
+	usr.UserName, _ = kd.option("gecos")
+
+	if groups, ok := kd.option("groups"); ok {
+		for _, curr := range strings.Split(groups, ",") {
+			if curr == "wheel" {
+				usr.Admin = true
+			} else {
+				usr.Groups = append(usr.Groups, curr)
+			}
+		}
+	}
+
+	for _, id := range []struct {
+		option string
+		value  *uint
+	}{{"uid", &usr.UID}, {"gid", &usr.GID}} {
+		if value, ok := kd.option(id.option); ok {
+			parsed, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.warn("line %d: user %s --%s=%s is not a number", kd.line, login, id.option, value)
+				continue
+			}
+			*id.value = uint(parsed)
+		}
+	}
+
+	usr.Shell, _ = kd.option("shell")
+	usr.Home, _ = kd.option("homedir")
+	_, usr.Locked = kd.option("lock")
+
+	if password, ok := kd.option("password"); ok {
+		_, encrypted := kd.option("iscrypted")
+		c.setPassword(usr, password, encrypted)
+	}
+}
+
+// convertKickstartPart returns the partition of a part directive, nil for the unsupported ones
+func convertKickstartPart(c *converter, kd *kickstartDirective) *kickstartPart {
+	if len(kd.args) == 0 {
+		c.warn("line %d: part has no mount point", kd.line)
+		return nil
+	}
+
+	part := &kickstartPart{line: kd.line, mount: kd.args[0]}
+	part.disk, _ = kd.option("ondisk")
+	part.fstype, _ = kd.option("fstype")
+
+	switch {
+	case part.mount == "swap":
+		part.mount, part.fstype = "", "swap"
+	case part.mount == "biosboot" || part.fstype == "biosboot":
+		c.warn("line %d: biosboot partitions are not needed, skipped", kd.line)
+		return nil
+	case strings.HasPrefix(part.mount, "pv.") || strings.HasPrefix(part.mount, "raid."):
+		c.warn("line %d: LVM and RAID partitions are not supported, %s skipped", kd.line, part.mount)
+		return nil
+	case part.fstype == "":
+		part.fstype = "ext4"
+	}
+
+	if part.mount == "/boot/efi" || part.fstype == "efi" {
+		part.fstype = "vfat"
+	}
+
+	if value, ok := kd.option("size"); ok {
+		size, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			c.warn("line %d: invalid part size %q", kd.line, value)
+			return nil
+		}
+
+		// kickstart sizes are in MiB
+		part.size = size << 20
+	}
+
+	if _, ok := kd.option("grow"); ok {
+		part.size = 0
+	} else if _, ok := kd.option("recommended"); ok {
+		part.size, _ = storage.ParseVolumeSize(defaultSwapSize)
+	}
+
+	return part
+}
+
+func convertKickstartServices(c *converter, kd *kickstartDirective) {
+	if c.si.Services == nil {
+		c.si.Services = &services.Services{}
+	}
+
+	for name, units := range map[string]*[]string{
+		"enabled":  &c.si.Services.Enable,
+		"disabled": &c.si.Services.Disable,
+	} {
+		value, ok := kd.option(name)
+		if !ok {
+			continue
+		}
+
+		for _, curr := range strings.Split(value, ",") {
+			if curr = strings.TrimSpace(curr); curr == "" {
+				continue
+			}
+
+			if !strings.Contains(curr, ".") {
+				curr += ".service"
+			}
+			*units = append(*units, curr)
+		}
+	}
+}
+
+// convertKickstartSection converts the packages and scripts sections, the scripts run with
+// the given interpreter and the /mnt/sysimage paths of the non chrooted ones are mapped to
+// the installer's target
+func convertKickstartSection(c *converter, section *kickstartSection) {
+	kd := section.directive
+
+	switch kd.name {
+	case "%packages":
+		packages := []string{}
+
+		for _, curr := range section.lines {
+			curr = strings.TrimSpace(curr)
+
+			switch {
+			case curr == "" || strings.HasPrefix(curr, "#"):
+			case strings.HasPrefix(curr, "-"):
+				c.warn("line %d: excluded package %s is ignored", kd.line, strings.TrimPrefix(curr, "-"))
+			case strings.HasPrefix(curr, "kernel"):
+				c.si.Kernel = &kernel.Kernel{Bundle: "kernel-native"}
+			default:
+				packages = append(packages, curr)
+			}
+		}
+
+		c.addPackages(packages)
+	case "%pre", "%post":
+		body := strings.Join(section.lines, "\n")
+		if strings.TrimSpace(body) == "" {
+			return
+		}
+
+		_, nochroot := kd.option("nochroot")
+		hook := &InstallHook{Chroot: kd.name == "%post" && !nochroot}
+
+		if interpreter, ok := kd.option("interpreter"); ok &&
+			interpreter != "/bin/sh" && interpreter != "/bin/bash" && interpreter != "/usr/bin/bash" {
+			body = fmt.Sprintf("%s <<'KICKSTART_EOF'\n%s\nKICKSTART_EOF", interpreter, body)
+		}
+
+		if !hook.Chroot {
+			body = strings.Replace(body, "/mnt/sysimage", "${chrootDir}", -1)
+		}
+
+		if _, ok := kd.option("log"); ok {
+			c.warn("line %d: %s --log is ignored, the installer logs the hooks output", kd.line, kd.name)
+		}
+
+		hook.Cmd = body
+
+		if kd.name == "%pre" {
+			c.si.PreInstall = append(c.si.PreInstall, hook)
+		} else {
+			c.si.PostInstall = append(c.si.PostInstall, hook)
+		}
+	default:
+		c.warn("line %d: unsupported kickstart section %s", kd.line, kd.name)
+	}
+}
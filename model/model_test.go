@@ -13,8 +13,15 @@ import (
 	"testing"
 
 	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/bootloader"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/oci"
+	"github.com/clearlinux/clr-installer/storage"
 	"github.com/clearlinux/clr-installer/user"
 	"github.com/clearlinux/clr-installer/utils"
+
+	"gopkg.in/yaml.v2"
 )
 
 func init() {
@@ -44,6 +51,9 @@ func TestLoadFile(t *testing.T) {
 		{"no-root-partition-descriptor.yaml", false},
 		{"no-telemetry.yaml", false},
 		{"invalid-no-kernel.yaml", false},
+		{"invalid-unknown-field.yaml", false},
+		{"valid-directory-target.yaml", true},
+		{"invalid-directory-target-no-dir.yaml", false},
 		{"block-device-image.yaml", true},
 		{"block-devices-alias.yaml", true},
 		{"mixed-block-device.yaml", true},
@@ -52,6 +62,9 @@ func TestLoadFile(t *testing.T) {
 		{"valid-minimal.yaml", true},
 		{"valid-network.yaml", true},
 		{"valid-with-pre-post-hooks.yaml", true},
+		{"valid-with-staged-hooks.yaml", true},
+		{"valid-with-files.yaml", true},
+		{"valid-with-services.yaml", true},
 		{"valid-with-version.yaml", true},
 		{"azure-config.json", true},
 		{"azure-docker-config.json", true},
@@ -581,3 +594,322 @@ func TestBackupFile(t *testing.T) {
 		t.Fatalf("%s should exist and shouldn't return an error: %v", cf, err)
 	}
 }
+
+func TestConvertIster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ister-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	content, err := ioutil.ReadFile(filepath.Join(testsDir, "full-good.json"))
+	if err != nil {
+		t.Fatalf("Failed to read the ister file: %v", err)
+	}
+
+	path := filepath.Join(dir, "ister.json")
+	if err = ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+
+	si, err := ConvertIster(path)
+	if err != nil || si.Keyboard == nil || len(si.TargetMedias) == 0 {
+		t.Fatalf("Failed to convert %s: %+v %v", path, si, err)
+	}
+
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Fatalf("The conversion should not write any file, found: %d files", len(files))
+	}
+}
+
+func TestDirectoryTargetValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-directory-target.yaml")
+
+	tests := []struct {
+		field  string
+		modify func(si *SystemInstall)
+	}{
+		{"", func(si *SystemInstall) {}},
+		{"targetDir", func(si *SystemInstall) { si.TargetDir = "" }},
+		{"targetDir", func(si *SystemInstall) { si.TargetDir = "relative/dir" }},
+		{"targetDir", func(si *SystemInstall) { si.TargetDir = "/tmp/.." }},
+		{"targetMedia", func(si *SystemInstall) { si.AddTargetMedia(&storage.BlockDevice{Name: "sda"}) }},
+		{"iso", func(si *SystemInstall) { si.MakeISO = true }},
+		{"postReboot", func(si *SystemInstall) { si.PostReboot = true }},
+		{"target", func(si *SystemInstall) { si.Target = "cloud" }},
+		{"", func(si *SystemInstall) { si.Container = &oci.Config{Output: "/tmp/image"} }},
+		{"container.output", func(si *SystemInstall) { si.Container = &oci.Config{} }},
+		{"container.format", func(si *SystemInstall) { si.Container = &oci.Config{Output: "/tmp/image", Format: "zip"} }},
+		{"container.output", func(si *SystemInstall) { si.Container = &oci.Config{Output: si.TargetDir + "/image"} }},
+	}
+
+	for _, curr := range tests {
+		si, err := LoadFile(path, args.Args{})
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", path, err)
+		}
+
+		if !si.IsDirectoryTarget() {
+			t.Fatalf("%s should be a directory target", path)
+		}
+
+		curr.modify(si)
+		err = si.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Directory target should be valid: %v", err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for field %q, got: %v", curr.field, err)
+		}
+	}
+}
+
+func TestHooksValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-with-staged-hooks.yaml")
+
+	tests := []struct {
+		field  string
+		modify func(si *SystemInstall)
+	}{
+		{"", func(si *SystemInstall) {}},
+		{"postMount[0].cmd", func(si *SystemInstall) { si.PostMount[0].Script = "" }},
+		{"postMount[0].script", func(si *SystemInstall) { si.PostMount[0].Cmd = "ls" }},
+		{"", func(si *SystemInstall) {
+			si.PreInstall = []*InstallHook{{Chroot: true, Cmd: "ls"}}
+		}},
+		{"preInstall[0].user", func(si *SystemInstall) {
+			si.PreInstall = []*InstallHook{{Chroot: true, User: "clrlinux", Cmd: "id"}}
+		}},
+		{"postPartition[0].chroot", func(si *SystemInstall) { si.PostPartition[0].Chroot = true }},
+		{"postMount[0].chroot", func(si *SystemInstall) { si.PostMount[0].Chroot = true }},
+		{"postInstall[0].user", func(si *SystemInstall) {
+			si.PostInstall = []*InstallHook{{Cmd: "id", User: "clrlinux"}}
+		}},
+		{"postBundles[0].user", func(si *SystemInstall) { si.PostBundles[0].User = "invalid login" }},
+		{"preBootloader[0].env", func(si *SystemInstall) { si.PreBootloader[0].Env[""] = "value" }},
+		{"preInstall[0]", func(si *SystemInstall) { si.PreInstall = []*InstallHook{nil} }},
+	}
+
+	for _, curr := range tests {
+		si, err := LoadFile(path, args.Args{})
+		if err != nil {
+			t.Fatalf("Failed to load %s: %v", path, err)
+		}
+
+		curr.modify(si)
+		err = si.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Hooks should be valid: %v", err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for field %q, got: %v", curr.field, err)
+		}
+	}
+
+	si, err := LoadFile(filepath.Join(testsDir, "valid-directory-target.yaml"), args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load directory target: %v", err)
+	}
+
+	si.PreBootloader = []*InstallHook{{Cmd: "ls"}}
+	if err = si.Validate(); err == nil {
+		t.Fatal("A directory target should not accept preBootloader hooks")
+	}
+}
+
+func TestFilesValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-with-files.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	if len(si.Files) != 3 || !si.Files[0].Template || si.Files[1].Mode != "0755" {
+		t.Fatalf("Unexpected files loaded: %+v", si.Files)
+	}
+
+	si.Files[1].Encoding = "gzip"
+
+	ve, ok := si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "files[1].encoding" {
+		t.Fatalf("Expected a validation error for files[1].encoding, got: %v", ve)
+	}
+}
+
+func TestUsersValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-with-users.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	if len(si.Users) != 3 || si.Users[0].UID != 1500 || si.Users[0].Groups[1] != "kvm" ||
+		!si.Users[0].ForcePasswordChange || !si.Users[1].System || !si.Users[1].Locked ||
+		len(si.Users[2].Sudo) != 2 || si.Users[2].Sudo[1].RunAs != "app" {
+		t.Fatalf("Unexpected users loaded: %+v", si.Users)
+	}
+
+	if err = si.Validate(); err != nil {
+		t.Fatalf("The users should be valid: %v", err)
+	}
+
+	si.Users[1].UID = 1500
+
+	ve, ok := si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "users[1].uid" {
+		t.Fatalf("Expected a validation error for users[1].uid, got: %v", ve)
+	}
+
+	si.Users[1].UID = 0
+	si.Users[1].Shell = "bash"
+
+	ve, ok = si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "users[1].shell" {
+		t.Fatalf("Expected a validation error for users[1].shell, got: %v", ve)
+	}
+
+	si.Users[1].Shell = ""
+	si.Users[2].Sudo[0].Commands = []string{"systemctl restart app.service"}
+
+	ve, ok = si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "users[2].sudo[0].commands[0]" || ve.Line == 0 {
+		t.Fatalf("Expected a located validation error for users[2].sudo[0].commands[0], got: %v", ve)
+	}
+}
+
+func TestServicesValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-with-services.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	if si.Services == nil || len(si.Services.DropIns) != 1 || si.Services.Enable[0] != "sshd.socket" {
+		t.Fatalf("Unexpected services loaded: %+v", si.Services)
+	}
+
+	si.Services.Disable = []string{"sshd"}
+
+	ve, ok := si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "services.disable[0]" {
+		t.Fatalf("Expected a validation error for services.disable[0], got: %v", ve)
+	}
+}
+
+func TestBootloaderValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-with-bootloader.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	if si.Bootloader == nil || si.Bootloader.GetBackend() != bootloader.BackendSystemdBoot ||
+		si.Bootloader.Timeout == nil || *si.Bootloader.Timeout != 5 {
+		t.Fatalf("Unexpected boot loader loaded: %+v", si.Bootloader)
+	}
+
+	if err = si.Validate(); err != nil {
+		t.Fatalf("Boot loader configuration should be valid: %v", err)
+	}
+
+	si.LegacyBios = true
+
+	ve, ok := si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "bootloader.backend" {
+		t.Fatalf("Expected a validation error for bootloader.backend, got: %v", ve)
+	}
+
+	si.LegacyBios = false
+	si.CryptPass = "passphrase"
+	si.TargetMedias[0].Children[2].Type = storage.BlockDeviceTypeCrypt
+
+	ve, ok = si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "bootloader.backend" {
+		t.Fatalf("Expected a validation error for bootloader.backend, got: %v", ve)
+	}
+
+	si.TargetMedias[0].Children[2].Type = storage.BlockDeviceTypePart
+	si.KernelArguments.Add = []string{"splash", "mitigations=some"}
+
+	ve, ok = si.Validate().(errors.ValidationError)
+	if !ok || ve.Field != "kernelArguments.add[1]" {
+		t.Fatalf("Expected a validation error for kernelArguments.add[1], got: %v", ve)
+	}
+}
+
+func TestKernelsValidate(t *testing.T) {
+	path := filepath.Join(testsDir, "valid-with-kernels.yaml")
+
+	si, err := LoadFile(path, args.Args{})
+	if err != nil {
+		t.Fatalf("Failed to load %s: %v", path, err)
+	}
+
+	if si.Kernel == nil || si.Kernel.Bundle != "kernel-lts" {
+		t.Fatalf("The kernels default should be the kernel: %+v", si.Kernel)
+	}
+
+	if kernels := si.InstalledKernels(); len(kernels) != 2 || kernels[1] != "kernel-native" {
+		t.Fatalf("Unexpected installed kernels: %v", kernels)
+	}
+
+	if err = si.Validate(); err != nil {
+		t.Fatalf("Kernels should be valid: %v", err)
+	}
+
+	tests := []struct {
+		kernels []*kernel.Kernel
+		field   string
+	}{
+		{[]*kernel.Kernel{{Bundle: "kernel-lts"}, {Bundle: "kernel-lts"}}, "kernels[1]"},
+		{[]*kernel.Kernel{{Bundle: "kernel-lts", Default: true}, {Bundle: "kernel-native", Default: true}}, "kernels[1].default"},
+		{[]*kernel.Kernel{{Bundle: "kernel-native", Default: true}, {Bundle: "kernel-lts"}}, "kernel"},
+		{[]*kernel.Kernel{{Bundle: "kernel-lts"}, nil}, "kernels[1]"},
+	}
+
+	for _, curr := range tests {
+		si.Kernels = curr.kernels
+
+		ve, ok := si.Validate().(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for %q, got: %v", curr.field, ve)
+		}
+	}
+
+	si.SetKernels(&kernel.Kernel{Bundle: "kernel-native"}, []*kernel.Kernel{{Bundle: "kernel-lts"}})
+
+	if len(si.Kernels) != 2 || !si.Kernels[0].Default || si.Kernels[0].Bundle != "kernel-native" {
+		t.Fatalf("Unexpected kernels set: %+v", si.Kernels)
+	}
+
+	b, err := yaml.Marshal(si)
+	if err != nil {
+		t.Fatalf("Failed to marshal the model: %v", err)
+	}
+
+	if !strings.Contains(string(b), "default: true") {
+		t.Fatalf("The default kernel should be flagged:\n%s", b)
+	}
+
+	si.SetKernels(&kernel.Kernel{Bundle: "kernel-native"}, nil)
+
+	if si.Kernels != nil || len(si.InstalledKernels()) != 1 {
+		t.Fatalf("A single kernel should have no kernels list: %+v", si.Kernels)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+// Patch returns a copy of the model with the top level entries of data, a json or yaml
+// document with the configuration file syntax, replaced. The patch is migrated and decoded
+// strictly and its secrets are resolved as LoadFile does, from yamlDir, the sections it
+// replaces must be valid while the others may still be incomplete. The model itself is
+// never changed.
+func (si *SystemInstall) Patch(data []byte, yamlDir string) (*SystemInstall, error) {
+	var patch SystemInstall
+
+	data, _, err := migrateConfig("", data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := yaml.UnmarshalStrict(data, &patch); err != nil {
+		return nil, errors.ValidationErrorf("%v", err)
+	}
+
+	var entries yaml.MapSlice
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, errors.ValidationErrorf("%v", err)
+	}
+
+	result := *si
+	src := reflect.ValueOf(&patch).Elem()
+	dst := reflect.ValueOf(&result).Elem()
+	patched := map[string]bool{}
+
+	for _, curr := range entries {
+		name := fmt.Sprintf("%v", curr.Key)
+
+		// the strict decoding refused the unknown entries
+		if idx := yamlFieldIndex(dst.Type(), name); idx >= 0 {
+			dst.Field(idx).Set(src.Field(idx))
+			patched[name] = true
+		}
+	}
+
+	// the locations are the ones of the loaded file, if any
+	result.locations = nil
+
+	if err := result.resolveSecrets(yamlDir); err != nil {
+		return nil, err
+	}
+
+	for _, check := range result.checks() {
+		if err := check(); err != nil && patched[topLevelField(err)] {
+			return nil, err
+		}
+	}
+
+	return &result, nil
+}
+
+// yamlFieldIndex returns the index of the typ field named name in yaml, -1 if none
+func yamlFieldIndex(typ reflect.Type, name string) int {
+	for idx := 0; idx < typ.NumField(); idx++ {
+		if tag := strings.Split(typ.Field(idx).Tag.Get("yaml"), ",")[0]; tag == name && tag != "-" {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// topLevelField returns the top level configuration entry of a validation error field, the
+// errors with no field belong to no entry
+func topLevelField(err error) string {
+	ve, ok := err.(errors.ValidationError)
+	if !ok {
+		return ""
+	}
+
+	if idx := strings.IndexAny(ve.Field, ".["); idx >= 0 {
+		return ve.Field[:idx]
+	}
+
+	return ve.Field
+}
@@ -0,0 +1,96 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/timezone"
+)
+
+func TestPatch(t *testing.T) {
+	si := &SystemInstall{
+		Hostname: "clr",
+		Timezone: &timezone.TimeZone{Code: timezone.DefaultTimezone},
+	}
+
+	patched, err := si.Patch([]byte(`{"bundles": ["vim"], "timezone": "UTC"}`), "")
+	if err != nil {
+		t.Fatalf("Failed to patch the model: %v", err)
+	}
+
+	if patched.Hostname != "clr" || len(patched.Bundles) != 1 || patched.Timezone.Code != "UTC" {
+		t.Fatalf("Unexpected patched model: %+v", patched)
+	}
+
+	if len(si.Bundles) != 0 || si.Timezone.Code != timezone.DefaultTimezone {
+		t.Fatalf("The patched model must be a copy, got: %+v %v", si, si.Timezone)
+	}
+
+	tests := []struct {
+		patch string
+		field string
+	}{
+		{`{"hostname": "clr-test", "bundle": ["vim"]}`, ""},
+		{`{"files": [{"path": "etc/motd"}]}`, "files[0].path"},
+		{`{"timezone": null}`, "timezone"},
+	}
+
+	for _, curr := range tests {
+		_, err := si.Patch([]byte(curr.patch), "")
+
+		if ve, ok := err.(errors.ValidationError); !ok || ve.Field != curr.field {
+			t.Fatalf("%s: expected a %q validation error, got: %v", curr.patch, curr.field, err)
+		}
+	}
+
+	// the older schema versions names are migrated as the ones of a configuration file
+	patched, err = si.Patch([]byte(`{"post-install": [{"cmd": "true"}], "kernel-arguments": {"add": ["quiet"]}}`), "")
+	if err != nil {
+		t.Fatalf("A patch with the deprecated names should be migrated: %v", err)
+	}
+
+	if len(patched.PostInstall) != 1 || patched.KernelArguments == nil ||
+		len(patched.KernelArguments.Add) != 1 {
+		t.Fatalf("Unexpected migrated patch: %+v", patched)
+	}
+
+	// the sections the patch doesn't replace may be incomplete
+	if _, err = si.Patch([]byte(`{"hostname": "clr-test"}`), ""); err != nil {
+		t.Fatalf("A patch should only be checked for the entries it replaces: %v", err)
+	}
+}
+
+func TestPatchSecrets(t *testing.T) {
+	si := &SystemInstall{}
+
+	patched, err := si.Patch([]byte(`{"users": [{"login": "clrlinux", "password": {plain: "user password"}}],
+"cryptPassphrase": {"fromEnv": "CLR_INSTALLER_TEST_PASSPHRASE"}}`), "")
+	if ve, ok := err.(errors.ValidationError); !ok || ve.Field != "cryptPassphrase" {
+		t.Fatalf("A missing secret variable should fail, got: %v %+v", err, patched)
+	}
+
+	if err = os.Setenv("CLR_INSTALLER_TEST_PASSPHRASE", "luks passphrase"); err != nil {
+		t.Fatalf("Failed to set the passphrase variable: %v", err)
+	}
+	defer func() { _ = os.Unsetenv("CLR_INSTALLER_TEST_PASSPHRASE") }()
+
+	patched, err = si.Patch([]byte(`{"users": [{"login": "clrlinux", "password": {plain: "user password"}}],
+"cryptPassphrase": {"fromEnv": "CLR_INSTALLER_TEST_PASSPHRASE"}}`), "")
+	if err != nil {
+		t.Fatalf("Failed to patch the model: %v", err)
+	}
+
+	if !strings.HasPrefix(patched.Users[0].Password, "$6$") {
+		t.Fatalf("The user password should be encrypted, got: %s", patched.Users[0].Password)
+	}
+
+	if patched.CryptPass != "luks passphrase" || si.CryptPass != "" {
+		t.Fatalf("Unexpected encryption passphrases: %q %q", patched.CryptPass, si.CryptPass)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package model
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+// resolveSecrets encrypts the users passwords set as secrets and sets the encryption
+// passphrase and the proxy credentials, the relative secret files are resolved from yamlDir
+func (si *SystemInstall) resolveSecrets(yamlDir string) error {
+	for idx, curr := range si.Users {
+		if curr == nil {
+			continue
+		}
+
+		if err := curr.ResolvePassword(yamlDir); err != nil {
+			return prefixFieldError(fmt.Sprintf("users[%d]", idx), err)
+		}
+	}
+
+	if si.CryptPassphrase != nil {
+		pass, err := si.CryptPassphrase.Resolve(yamlDir)
+		if err != nil {
+			return errors.FieldValidationErrorf("cryptPassphrase", "%v", err)
+		}
+
+		si.CryptPass = pass
+	}
+
+	if si.ProxyCredentials != nil {
+		credentials, err := si.ProxyCredentials.Resolve(yamlDir)
+		if err != nil {
+			return errors.FieldValidationErrorf("httpsProxyCredentials", "%v", err)
+		}
+
+		si.proxyCredentials = credentials
+	}
+
+	return nil
+}
+
+// HTTPSProxyURL returns the https proxy address with the httpsProxyCredentials user
+// information, user:password, if set
+func (si *SystemInstall) HTTPSProxyURL() string {
+	if si.HTTPSProxy == "" || si.proxyCredentials == "" {
+		return si.HTTPSProxy
+	}
+
+	u, err := url.Parse(si.HTTPSProxy)
+	if err != nil || u.Host == "" {
+		return si.HTTPSProxy
+	}
+
+	if tks := strings.SplitN(si.proxyCredentials, ":", 2); len(tks) == 2 {
+		u.User = url.UserPassword(tks[0], tks[1])
+	} else {
+		u.User = url.User(tks[0])
+	}
+
+	return u.String()
+}
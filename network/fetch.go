@@ -0,0 +1,402 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/godbus/dbus"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/proxy"
+)
+
+const (
+	pacrunnerService = "org.pacrunner"
+	pacrunnerPath    = "/org/pacrunner/client"
+	pacrunnerMethod  = "org.pacrunner.Client.FindProxyForURL"
+
+	tftpPort       = "69"
+	tftpOpRRQ      = 1
+	tftpOpData     = 3
+	tftpOpAck      = 4
+	tftpOpError    = 5
+	tftpBlockSize  = 512
+	tftpMaxRetries = 5
+)
+
+// the fetch settings and the PAC lookup, replaced by the tests
+var (
+	fetchTimeout     = 30 * time.Second
+	fetchAttempts    = 4
+	fetchBackoff     = time.Second
+	tftpTimeout      = 5 * time.Second
+	fetchMaxSize     = int64(8 << 20)
+	findProxyForURL  = pacrunnerFindProxyForURL
+	fetchCACertsPath string
+)
+
+// temporaryError is a fetch failure worth retrying, i.e a network error or a server error
+type temporaryError struct {
+	err error
+}
+
+func (te temporaryError) Error() string {
+	return te.err.Error()
+}
+
+// SetCACertsPath sets the PEM CA certificates file, or directory of files, trusted by the
+// https fetches on top of the system ones, as swupd --certpath
+func SetCACertsPath(path string) {
+	log.Debug("network.SetCACertsPath = %s", path)
+	fetchCACertsPath = path
+}
+
+// Fetch downloads the http, https, file or tftp url content, the transient failures are
+// retried with an exponential backoff
+func Fetch(addr string) ([]byte, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, errors.Errorf("Invalid url %s: %v", addr, err)
+	}
+
+	var fetch func(*url.URL) ([]byte, error)
+
+	switch u.Scheme {
+	case "http", "https":
+		fetch = fetchHTTP
+	case "file":
+		fetch = fetchFile
+	case "tftp":
+		fetch = fetchTFTP
+	default:
+		return nil, errors.Errorf("Unsupported url scheme %q: %s", u.Scheme, addr)
+	}
+
+	backoff := fetchBackoff
+	for attempt := 1; ; attempt++ {
+		log.Info("Fetching %s (attempt %d/%d)", proxy.Redact(addr), attempt, fetchAttempts)
+
+		content, err := fetch(u)
+		if err == nil {
+			log.Info("Fetched %s: %d bytes", proxy.Redact(addr), len(content))
+			return content, nil
+		}
+
+		if _, ok := err.(temporaryError); !ok || attempt >= fetchAttempts {
+			log.Warning("Failed to fetch %s: %v", proxy.Redact(addr), err)
+			return nil, errors.Wrap(err)
+		}
+
+		log.Warning("Failed to fetch %s: %v, retrying in %s", proxy.Redact(addr), err, backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// FetchRemoteConfigFile given an config url fetches it from the network, see Fetch for
+// the supported urls. After success return the local file path.
+func FetchRemoteConfigFile(addr string) (string, error) {
+	content, err := Fetch(addr)
+	if err != nil {
+		return "", err
+	}
+
+	// Get a temp filename to download to
+	out, err := ioutil.TempFile("", "clr-installer-yaml-")
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	_, err = out.Write(content)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", errors.Wrap(err)
+	}
+
+	return out.Name(), nil
+}
+
+func fetchFile(u *url.URL) ([]byte, error) {
+	content, err := ioutil.ReadFile(u.Path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return content, nil
+}
+
+func fetchHTTP(u *url.URL) ([]byte, error) {
+	transport, err := newTransport()
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: transport, Timeout: fetchTimeout}
+
+	resp, err := client.Get(u.String())
+	if err != nil {
+		return nil, temporaryError{err}
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		err = errors.Errorf("Unexpected http status: %s", resp.Status)
+
+		if resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, temporaryError{err}
+		}
+		return nil, err
+	}
+
+	// the configurations and descriptors are small, don't buffer whatever the server sends
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, fetchMaxSize+1))
+	if err != nil {
+		return nil, temporaryError{err}
+	}
+
+	if int64(len(content)) > fetchMaxSize {
+		return nil, errors.Errorf("The fetched content exceeds the %d bytes limit", fetchMaxSize)
+	}
+
+	return content, nil
+}
+
+// newTransport returns the http transport with the configured proxies and CA certificates
+func newTransport() (*http.Transport, error) {
+	transport := &http.Transport{Proxy: proxyForRequest(proxyValues())}
+
+	if fetchCACertsPath == "" {
+		return transport, nil
+	}
+
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+
+	files := []string{fetchCACertsPath}
+	if fi, err := os.Stat(fetchCACertsPath); err == nil && fi.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(fetchCACertsPath, "*")); err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+
+	for _, curr := range files {
+		pem, err := ioutil.ReadFile(curr)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			log.Warning("No CA certificate found in %s", curr)
+		}
+	}
+
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return transport, nil
+}
+
+// proxyValues returns the proxy settings by lower case prefix, i.e https or no
+func proxyValues() map[string]string {
+	result := map[string]string{}
+
+	for _, curr := range proxy.GetProxyValues() {
+		tks := strings.SplitN(curr, "=", 2)
+
+		if len(tks) == 2 && strings.HasSuffix(tks[0], "_proxy") {
+			result[strings.TrimSuffix(tks[0], "_proxy")] = tks[1]
+		}
+	}
+
+	return result
+}
+
+// proxyForRequest returns the transport's proxy function, the configured proxy of the url
+// scheme unless the host is excluded by no_proxy, or else the PAC result
+func proxyForRequest(values map[string]string) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		if noProxy(values["no"], req.URL.Hostname()) {
+			return nil, nil
+		}
+
+		addr := values[req.URL.Scheme]
+		if addr == "" {
+			var err error
+
+			if addr, err = findProxyForURL(req.URL.String(), req.URL.Hostname()); err != nil {
+				log.Debug("No PAC proxy for %s: %v", req.URL.Hostname(), err)
+				return nil, nil
+			}
+		}
+
+		if addr == "" {
+			return nil, nil
+		}
+
+		if !strings.Contains(addr, "://") {
+			addr = "http://" + addr
+		}
+
+		result, err := url.Parse(addr)
+		if err != nil {
+			return nil, errors.Errorf("Invalid proxy %s: %v", proxy.Redact(addr), err)
+		}
+
+		log.Debug("Using the proxy %s for %s", proxy.Redact(addr), req.URL.Hostname())
+		return result, nil
+	}
+}
+
+// noProxy returns true if the host matches the comma separated no_proxy list of host or
+// domain suffixes
+func noProxy(list string, host string) bool {
+	for _, curr := range strings.Split(list, ",") {
+		curr = strings.TrimPrefix(strings.TrimSpace(curr), ".")
+
+		switch {
+		case curr == "":
+		case curr == "*", curr == host, strings.HasSuffix(host, "."+curr):
+			return true
+		}
+	}
+
+	return false
+}
+
+// pacrunnerFindProxyForURL asks pacrunner, running the PAC file found by pacdiscovery,
+// the proxy of the url. It returns the first PROXY of the result, empty for DIRECT.
+func pacrunnerFindProxyForURL(addr string, host string) (string, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return "", err
+	}
+
+	var result string
+	obj := conn.Object(pacrunnerService, dbus.ObjectPath(pacrunnerPath))
+
+	if err = obj.Call(pacrunnerMethod, 0, addr, host).Store(&result); err != nil {
+		return "", err
+	}
+
+	for _, curr := range strings.Split(result, ";") {
+		fields := strings.Fields(curr)
+
+		if len(fields) == 2 && strings.ToUpper(fields[0]) == "PROXY" {
+			return fields[1], nil
+		}
+	}
+
+	return "", nil
+}
+
+// fetchTFTP downloads a file with the TFTP protocol, RFC 1350, in octet mode
+func fetchTFTP(u *url.URL) ([]byte, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), tftpPort)
+	}
+
+	raddr, err := net.ResolveUDPAddr("udp", host)
+	if err != nil {
+		return nil, temporaryError{err}
+	}
+
+	conn, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	// the server answers from a new port, the transfer id
+	request := new(bytes.Buffer)
+	_ = binary.Write(request, binary.BigEndian, uint16(tftpOpRRQ))
+	request.WriteString(strings.TrimPrefix(u.Path, "/") + "\x00octet\x00")
+
+	var content bytes.Buffer
+	packet := request.Bytes()
+	peer := raddr
+	buf := make([]byte, tftpBlockSize+4)
+	block := uint16(1)
+
+	for {
+		var n int
+
+		for retry := 0; ; retry++ {
+			if retry >= tftpMaxRetries {
+				return nil, temporaryError{fmt.Errorf("tftp timeout waiting for block %d", block)}
+			}
+
+			if _, err = conn.WriteToUDP(packet, peer); err != nil {
+				return nil, temporaryError{err}
+			}
+
+			if err = conn.SetReadDeadline(time.Now().Add(tftpTimeout)); err != nil {
+				return nil, errors.Wrap(err)
+			}
+
+			var from *net.UDPAddr
+
+			n, from, err = conn.ReadFromUDP(buf)
+			if err != nil {
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					continue
+				}
+				return nil, temporaryError{err}
+			}
+
+			if n < 4 || (block > 1 && from.Port != peer.Port) {
+				continue
+			}
+
+			op := binary.BigEndian.Uint16(buf[:2])
+			if op == tftpOpError {
+				return nil, errors.Errorf("tftp error: %s", strings.TrimRight(string(buf[4:n]), "\x00"))
+			}
+
+			if op != tftpOpData || binary.BigEndian.Uint16(buf[2:4]) != block {
+				continue
+			}
+
+			peer = from
+			break
+		}
+
+		content.Write(buf[4:n])
+		if int64(content.Len()) > fetchMaxSize {
+			return nil, errors.Errorf("The fetched content exceeds the %d bytes limit", fetchMaxSize)
+		}
+
+		ack := make([]byte, 4)
+		binary.BigEndian.PutUint16(ack[:2], tftpOpAck)
+		binary.BigEndian.PutUint16(ack[2:], block)
+		packet = ack
+
+		if n-4 < tftpBlockSize {
+			_, _ = conn.WriteToUDP(ack, peer)
+			return content.Bytes(), nil
+		}
+
+		block++
+	}
+}
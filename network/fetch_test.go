@@ -0,0 +1,283 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package network
+
+import (
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/clearlinux/clr-installer/proxy"
+)
+
+// setupFetch makes the retries fast and disables the PAC lookup
+func setupFetch() func() {
+	savedBackoff, savedFind, savedCerts, savedMax := fetchBackoff, findProxyForURL, fetchCACertsPath, fetchMaxSize
+
+	fetchBackoff = time.Millisecond
+	findProxyForURL = func(addr string, host string) (string, error) { return "", nil }
+
+	return func() {
+		fetchBackoff, findProxyForURL, fetchCACertsPath, fetchMaxSize = savedBackoff, savedFind, savedCerts, savedMax
+		proxy.SetGetProxyValueFunc(nil)
+	}
+}
+
+func TestFetchHTTP(t *testing.T) {
+	defer setupFetch()()
+
+	failures := 2
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/flaky.yaml":
+			if failures > 0 {
+				failures--
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = fmt.Fprint(w, "flaky")
+		case "/config.yaml":
+			_, _ = fmt.Fprint(w, "config")
+		case "/large.yaml":
+			_, _ = fmt.Fprint(w, strings.Repeat("x", 64))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	content, err := Fetch(srv.URL + "/config.yaml")
+	if err != nil || string(content) != "config" {
+		t.Fatalf("Expected the config content, got: %q %v", content, err)
+	}
+
+	if content, err = Fetch(srv.URL + "/flaky.yaml"); err != nil || string(content) != "flaky" {
+		t.Fatalf("The server errors should be retried, got: %q %v", content, err)
+	}
+
+	failures = fetchAttempts
+	if _, err = Fetch(srv.URL + "/flaky.yaml"); err == nil {
+		t.Fatal("The fetch should fail once the attempts are exhausted")
+	}
+
+	start := time.Now()
+	fetchBackoff = time.Hour
+	if _, err = Fetch(srv.URL + "/missing.yaml"); err == nil || time.Since(start) > time.Minute {
+		t.Fatalf("A missing file should fail without being retried, got: %v", err)
+	}
+
+	path, err := FetchRemoteConfigFile(srv.URL + "/config.yaml")
+	if err != nil {
+		t.Fatalf("Failed to fetch the config file: %v", err)
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	if content, err = ioutil.ReadFile(path); err != nil || string(content) != "config" {
+		t.Fatalf("Expected the config file content, got: %q %v", content, err)
+	}
+
+	if _, err = Fetch("ftp://host/config.yaml"); err == nil {
+		t.Fatal("Unsupported url schemes should fail")
+	}
+
+	fetchMaxSize = 32
+	if _, err = Fetch(srv.URL + "/large.yaml"); err == nil || !strings.Contains(err.Error(), "limit") {
+		t.Fatalf("A content larger than the limit should fail, got: %v", err)
+	}
+}
+
+func TestFetchProxy(t *testing.T) {
+	defer setupFetch()()
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "direct")
+	}))
+	defer target.Close()
+
+	proxied := ""
+	pxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied = r.URL.String()
+		_, _ = fmt.Fprint(w, "proxied")
+	}))
+	defer pxy.Close()
+
+	values := map[string]string{"http": pxy.URL}
+	proxy.SetGetProxyValueFunc(func(prefix string) string { return values[prefix] })
+
+	addr := target.URL + "/config.yaml"
+	if content, err := Fetch(addr); err != nil || string(content) != "proxied" || proxied != addr {
+		t.Fatalf("The request should go through the proxy, got: %q %q %v", content, proxied, err)
+	}
+
+	values["no"] = "example.com, 127.0.0.1"
+	if content, err := Fetch(addr); err != nil || string(content) != "direct" {
+		t.Fatalf("The no_proxy hosts should be fetched directly, got: %q %v", content, err)
+	}
+
+	values = map[string]string{}
+	findProxyForURL = func(addr string, host string) (string, error) {
+		return strings.TrimPrefix(pxy.URL, "http://"), nil
+	}
+
+	if content, err := Fetch(addr); err != nil || string(content) != "proxied" {
+		t.Fatalf("The request should go through the PAC proxy, got: %q %v", content, err)
+	}
+}
+
+func TestFetchCACerts(t *testing.T) {
+	defer setupFetch()()
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "secure")
+	}))
+	defer srv.Close()
+
+	if _, err := Fetch(srv.URL); err == nil {
+		t.Fatal("An untrusted certificate should fail")
+	}
+
+	dir, err := ioutil.TempDir("", "fetch-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err = ioutil.WriteFile(filepath.Join(dir, "ca.pem"), cert, 0644); err != nil {
+		t.Fatalf("Failed to write the certificate: %v", err)
+	}
+
+	for _, curr := range []string{filepath.Join(dir, "ca.pem"), dir} {
+		SetCACertsPath(curr)
+
+		if content, err := Fetch(srv.URL); err != nil || string(content) != "secure" {
+			t.Fatalf("The %s certificates should be trusted, got: %q %v", curr, content, err)
+		}
+	}
+}
+
+func TestFetchFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetch-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	path := filepath.Join(dir, "config.yaml")
+	if err = ioutil.WriteFile(path, []byte("local"), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", path, err)
+	}
+
+	if content, err := Fetch("file://" + path); err != nil || string(content) != "local" {
+		t.Fatalf("Expected the local file content, got: %q %v", content, err)
+	}
+
+	if _, err = Fetch("file://" + filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Fatal("A missing local file should fail")
+	}
+}
+
+// serveTFTP serves the files, read requests only, until the connection is closed
+func serveTFTP(t *testing.T, conn *net.UDPConn, files map[string][]byte) {
+	buf := make([]byte, 1024)
+
+	for {
+		n, client, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		if n < 2 || binary.BigEndian.Uint16(buf[:2]) != tftpOpRRQ {
+			continue
+		}
+
+		name := strings.SplitN(string(buf[2:n]), "\x00", 2)[0]
+		go sendTFTP(t, client, files[name], files[name] != nil)
+	}
+}
+
+func sendTFTP(t *testing.T, client *net.UDPAddr, content []byte, found bool) {
+	// each transfer has its own port
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	if !found {
+		packet := []byte{0, tftpOpError, 0, 1}
+		_, _ = conn.WriteToUDP(append(packet, []byte("File not found\x00")...), client)
+		return
+	}
+
+	ack := make([]byte, 4)
+	for block := 1; ; block++ {
+		start := (block - 1) * tftpBlockSize
+		end := start + tftpBlockSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		packet := make([]byte, 4)
+		binary.BigEndian.PutUint16(packet[:2], tftpOpData)
+		binary.BigEndian.PutUint16(packet[2:], uint16(block))
+
+		if _, err = conn.WriteToUDP(append(packet, content[start:end]...), client); err != nil {
+			t.Error(err)
+			return
+		}
+
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		if _, _, err = conn.ReadFromUDP(ack); err != nil {
+			t.Error(err)
+			return
+		}
+
+		if end-start < tftpBlockSize {
+			return
+		}
+	}
+}
+
+func TestFetchTFTP(t *testing.T) {
+	defer setupFetch()()
+
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer func() { _ = conn.Close() }()
+
+	large := []byte(strings.Repeat("0123456789", 2*tftpBlockSize/10) + "end")
+	exact := []byte(strings.Repeat("x", tftpBlockSize))
+
+	go serveTFTP(t, conn, map[string][]byte{
+		"config.yaml": []byte("tftp"),
+		"large.yaml":  large,
+		"exact.yaml":  exact,
+	})
+
+	for name, expected := range map[string][]byte{"config.yaml": []byte("tftp"), "large.yaml": large,
+		"exact.yaml": exact} {
+		content, err := Fetch(fmt.Sprintf("tftp://%s/%s", conn.LocalAddr(), name))
+		if err != nil || string(content) != string(expected) {
+			t.Fatalf("Expected the %s content, got %d bytes: %v", name, len(content), err)
+		}
+	}
+
+	if _, err = Fetch(fmt.Sprintf("tftp://%s/missing.yaml", conn.LocalAddr())); err == nil {
+		t.Fatal("A missing tftp file should fail")
+	}
+}
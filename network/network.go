@@ -734,42 +734,6 @@ func CheckURL(url string) error {
 	return nil
 }
 
-// FetchRemoteConfigFile given an config url fetches it from the network. This function
-// currently supports only http/https protocol. After success return the local file path.
-func FetchRemoteConfigFile(url string) (string, error) {
-	// Get a temp filename to download to
-	out, err := ioutil.TempFile("", "clr-installer-yaml-")
-	if err != nil {
-		return "", err
-	}
-	_ = out.Close()
-
-	// Since Clear Linux automatically proxy are not support in golang via
-	// the patch to libcurl, we need to use a system call to curl for now.
-	// TODO: Change this back to native http.Get(url) once a better
-	// proxy solution is deployed in the OS
-	args := []string{
-		"timeout",
-		"--kill-after=30s",
-		"30s",
-		"curl",
-		"--no-sessionid",
-		"-o",
-		out.Name(),
-		"-s",
-		"-f",
-		url,
-	}
-
-	if err := cmd.Run(nil, args...); err != nil {
-		log.Debug("FetchRemoteConfigFile failed : %q", err)
-		defer func() { _ = os.Remove(out.Name()) }()
-		return "", err
-	}
-
-	return out.Name(), nil
-}
-
 // DownloadInstallerMessage pulls down a message from a URL
 // Intended for getting a message to display before or after
 // the installation process
@@ -777,18 +741,11 @@ func DownloadInstallerMessage(header string, installConf string) string {
 	var result Messenger
 
 	downloadURL := fmt.Sprintf(installDataURLBase, utils.ClearVersion, installConf)
-	msgFile, err := FetchRemoteConfigFile(downloadURL)
+	configStr, err := Fetch(downloadURL)
 	if err != nil {
 		log.Debug("Failed to download the %s message: %s", header, err)
 		return ""
 	}
-	defer func() { _ = os.Remove(msgFile) }()
-
-	configStr, err := ioutil.ReadFile(msgFile)
-	if err != nil {
-		log.Debug("Failed to read the %s file: %s", header, err)
-		return ""
-	}
 
 	if err := yaml.Unmarshal(configStr, &result); err != nil {
 		log.Debug("Failed to parse the %s YAML file: %s", header, err)
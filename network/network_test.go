@@ -8,8 +8,10 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 
+	"github.com/clearlinux/clr-installer/schema"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
@@ -329,3 +331,13 @@ func TestGoodDownload(t *testing.T) {
 		t.Fatalf("Good Clear Linux HTTPS URL failed: %s", err)
 	}
 }
+
+func TestSchemaFields(t *testing.T) {
+	if err := schema.CheckFields(reflect.TypeOf(interfaceYAMLMarshal{}), "networkInterfaces[]"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := schema.CheckFields(reflect.TypeOf(Addr{}), "networkInterfaces[].addrs[]"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+// paxXattrPrefix is the PAX record prefix used to store extended attributes
+const paxXattrPrefix = "SCHILY.xattr."
+
+type inode struct {
+	dev uint64
+	ino uint64
+}
+
+// readXattrs reads the extended attributes of path, file systems not supporting
+// extended attributes are handled as files with no attributes
+func readXattrs(path string) (map[string]string, error) {
+	size, err := syscall.Listxattr(path, nil)
+	if err != nil || size == 0 {
+		return nil, nil
+	}
+
+	buf := make([]byte, size)
+	if size, err = syscall.Listxattr(path, buf); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	result := map[string]string{}
+
+	for _, name := range bytes.Split(buf[:size], []byte{0}) {
+		if len(name) == 0 {
+			continue
+		}
+
+		vsize, err := syscall.Getxattr(path, string(name), nil)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		value := make([]byte, vsize)
+		if vsize, err = syscall.Getxattr(path, string(name), value); err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		result[string(name)] = string(value[:vsize])
+	}
+
+	return result, nil
+}
+
+func copyFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	if _, err = io.Copy(w, f); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeLayer writes a reproducible tar archive with the content of rootDir to w, the
+// entries are written in lexical order, every timestamp is set to mtime and the owner
+// names are dropped (the numeric ids are kept). The file systems mounted under rootDir,
+// i.e /proc, /sys and /dev, are not descended.
+func writeLayer(w io.Writer, rootDir string, mtime time.Time) error {
+	var rootStat syscall.Stat_t
+
+	if err := syscall.Lstat(rootDir, &rootStat); err != nil {
+		return errors.Wrap(err)
+	}
+
+	tw := tar.NewWriter(w)
+	links := map[inode]string{}
+
+	err := filepath.Walk(rootDir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(rootDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		// sockets are runtime only objects
+		if fi.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+
+		link := ""
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		hdr, err := tar.FileInfoHeader(fi, link)
+		if err != nil {
+			return err
+		}
+
+		hdr.Name = filepath.ToSlash(rel)
+		if fi.IsDir() {
+			hdr.Name = hdr.Name + "/"
+		}
+
+		hdr.Format = tar.FormatPAX
+		hdr.Uname = ""
+		hdr.Gname = ""
+		hdr.ModTime = mtime
+		hdr.AccessTime = time.Time{}
+		hdr.ChangeTime = time.Time{}
+
+		st, _ := fi.Sys().(*syscall.Stat_t)
+
+		if fi.Mode()&os.ModeSymlink == 0 {
+			xattrs, err := readXattrs(path)
+			if err != nil {
+				return err
+			}
+
+			for name, value := range xattrs {
+				if hdr.PAXRecords == nil {
+					hdr.PAXRecords = map[string]string{}
+				}
+				hdr.PAXRecords[paxXattrPrefix+name] = value
+			}
+		}
+
+		if fi.Mode().IsRegular() && st != nil && st.Nlink > 1 {
+			key := inode{dev: uint64(st.Dev), ino: st.Ino}
+
+			if first, ok := links[key]; ok {
+				hdr.Typeflag = tar.TypeLink
+				hdr.Linkname = first
+				hdr.Size = 0
+			} else {
+				links[key] = hdr.Name
+			}
+		}
+
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+
+		if hdr.Typeflag == tar.TypeReg {
+			if err = copyFile(tw, path); err != nil {
+				return err
+			}
+		}
+
+		// keep the mount point itself but not the mounted content
+		if fi.IsDir() && st != nil && st.Dev != rootStat.Dev {
+			return filepath.SkipDir
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = tw.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
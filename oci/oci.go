@@ -0,0 +1,453 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	// FormatOCI produces an OCI image layout directory
+	FormatOCI = "oci"
+
+	// FormatDocker produces a tarball which can be imported with "docker load"
+	FormatDocker = "docker"
+
+	// DefaultTag is the image reference used when none is configured
+	DefaultTag = "clearlinux:latest"
+
+	mediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeConfig   = "application/vnd.oci.image.config.v1+json"
+	mediaTypeLayer    = "application/vnd.oci.image.layer.v1.tar"
+
+	// sourceDateEpochVar is the environment variable overriding the image timestamps
+	// see: https://reproducible-builds.org/specs/source-date-epoch/
+	sourceDateEpochVar = "SOURCE_DATE_EPOCH"
+)
+
+// Config describes the container image to be produced from the installed system
+type Config struct {
+	Output     string            `yaml:"output"`
+	Format     string            `yaml:"format,omitempty"`
+	Tag        string            `yaml:"tag,omitempty"`
+	Entrypoint []string          `yaml:"entrypoint,omitempty,flow"`
+	Cmd        []string          `yaml:"cmd,omitempty,flow"`
+	Env        []string          `yaml:"env,omitempty"`
+	WorkingDir string            `yaml:"workingDir,omitempty"`
+	Labels     map[string]string `yaml:"labels,omitempty"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Config        *descriptor   `json:"config"`
+	Layers        []*descriptor `json:"layers"`
+}
+
+type index struct {
+	SchemaVersion int           `json:"schemaVersion"`
+	Manifests     []*descriptor `json:"manifests"`
+}
+
+type runConfig struct {
+	Entrypoint []string          `json:"Entrypoint,omitempty"`
+	Cmd        []string          `json:"Cmd,omitempty"`
+	Env        []string          `json:"Env,omitempty"`
+	WorkingDir string            `json:"WorkingDir,omitempty"`
+	Labels     map[string]string `json:"Labels,omitempty"`
+}
+
+type rootFS struct {
+	Type    string   `json:"type"`
+	DiffIDs []string `json:"diff_ids"`
+}
+
+type history struct {
+	Created   time.Time `json:"created"`
+	CreatedBy string    `json:"created_by"`
+}
+
+type imageConfig struct {
+	Created      time.Time  `json:"created"`
+	Architecture string     `json:"architecture"`
+	OS           string     `json:"os"`
+	Config       *runConfig `json:"config"`
+	RootFS       *rootFS    `json:"rootfs"`
+	History      []*history `json:"history"`
+}
+
+type dockerManifest struct {
+	Config   string   `json:"Config"`
+	RepoTags []string `json:"RepoTags"`
+	Layers   []string `json:"Layers"`
+}
+
+// blob is a content addressable file of the image
+type blob struct {
+	path string
+	hex  string
+	size int64
+}
+
+func (b *blob) digest() string {
+	return "sha256:" + b.hex
+}
+
+// Validate checks the container image configuration
+func (cfg *Config) Validate() error {
+	if cfg.Output == "" {
+		return errors.FieldValidationErrorf("output", "A container image output path must be provided")
+	}
+
+	if cfg.Format != "" && cfg.Format != FormatOCI && cfg.Format != FormatDocker {
+		return errors.FieldValidationErrorf("format", "Invalid container image format: %s", cfg.Format)
+	}
+
+	return nil
+}
+
+// GetFormat returns the configured image format or the default one
+func (cfg *Config) GetFormat() string {
+	if cfg.Format == "" {
+		return FormatOCI
+	}
+
+	return cfg.Format
+}
+
+// GetTag returns the configured image reference or the default one
+func (cfg *Config) GetTag() string {
+	if cfg.Tag == "" {
+		return DefaultTag
+	}
+
+	return cfg.Tag
+}
+
+// timestamp returns the time used for every image timestamp, the unix epoch
+// unless SOURCE_DATE_EPOCH is set
+func timestamp() (time.Time, error) {
+	value := os.Getenv(sourceDateEpochVar)
+	if value == "" {
+		return time.Unix(0, 0).UTC(), nil
+	}
+
+	epoch, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.Errorf("Invalid %s value: %s", sourceDateEpochVar, value)
+	}
+
+	return time.Unix(epoch, 0).UTC(), nil
+}
+
+// writeBlob writes data to a new blob file in dir
+func writeBlob(dir string, data []byte) (*blob, error) {
+	sum := sha256.Sum256(data)
+	result := &blob{hex: hex.EncodeToString(sum[:]), size: int64(len(data))}
+	result.path = filepath.Join(dir, result.hex)
+
+	if err := ioutil.WriteFile(result.path, data, 0644); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return result, nil
+}
+
+// writeLayerBlob writes the rootDir layer to a new blob file in dir
+func writeLayerBlob(dir string, rootDir string, mtime time.Time) (*blob, error) {
+	tmp, err := ioutil.TempFile(dir, "layer-")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	hash := sha256.New()
+	counter := &countWriter{}
+
+	err = writeLayer(io.MultiWriter(tmp, hash, counter), rootDir, mtime)
+	if cerr := tmp.Close(); err == nil && cerr != nil {
+		err = errors.Wrap(cerr)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	result := &blob{hex: hex.EncodeToString(hash.Sum(nil)), size: counter.size}
+	result.path = filepath.Join(dir, result.hex)
+
+	if err = os.Rename(tmp.Name(), result.path); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return result, nil
+}
+
+type countWriter struct {
+	size int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.size += int64(len(p))
+	return len(p), nil
+}
+
+func newImageConfig(cfg *Config, labels map[string]string, layer *blob, created time.Time) *imageConfig {
+	allLabels := map[string]string{}
+
+	for k, v := range labels {
+		allLabels[k] = v
+	}
+
+	// the user provided labels take precedence
+	for k, v := range cfg.Labels {
+		allLabels[k] = v
+	}
+
+	return &imageConfig{
+		Created:      created,
+		Architecture: runtime.GOARCH,
+		OS:           "linux",
+		Config: &runConfig{
+			Entrypoint: cfg.Entrypoint,
+			Cmd:        cfg.Cmd,
+			Env:        cfg.Env,
+			WorkingDir: cfg.WorkingDir,
+			Labels:     allLabels,
+		},
+		RootFS: &rootFS{
+			Type:    "layers",
+			DiffIDs: []string{layer.digest()},
+		},
+		History: []*history{
+			{Created: created, CreatedBy: "clr-installer"},
+		},
+	}
+}
+
+// Export packs the content of rootDir into a container image described by cfg,
+// labels are added to the image configuration and may be overridden by cfg.Labels
+func Export(rootDir string, cfg *Config, labels map[string]string) error {
+	if _, err := os.Lstat(cfg.Output); err == nil {
+		return errors.Errorf("Container image output already exists: %s", cfg.Output)
+	}
+
+	created, err := timestamp()
+	if err != nil {
+		return err
+	}
+
+	// build the image next to the output so it can be moved in place when complete
+	workDir, err := ioutil.TempDir(filepath.Dir(cfg.Output), ".clr-installer-oci-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = os.RemoveAll(workDir)
+	}()
+
+	blobsDir := filepath.Join(workDir, "blobs", "sha256")
+	if err = os.MkdirAll(blobsDir, 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	log.Debug("Writing container image layer of: %s", rootDir)
+
+	layer, err := writeLayerBlob(blobsDir, rootDir, created)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(newImageConfig(cfg, labels, layer, created))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	config, err := writeBlob(blobsDir, data)
+	if err != nil {
+		return err
+	}
+
+	if cfg.GetFormat() == FormatDocker {
+		return writeDockerArchive(cfg, config, layer, created)
+	}
+
+	if err = writeOCILayout(workDir, blobsDir, cfg, config, layer); err != nil {
+		return err
+	}
+
+	if err = os.Rename(workDir, cfg.Output); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeOCILayout completes the OCI image layout in dir, see:
+// https://github.com/opencontainers/image-spec/blob/master/image-layout.md
+func writeOCILayout(dir string, blobsDir string, cfg *Config, config *blob, layer *blob) error {
+	data, err := json.Marshal(&manifest{
+		SchemaVersion: 2,
+		Config:        &descriptor{MediaType: mediaTypeConfig, Digest: config.digest(), Size: config.size},
+		Layers: []*descriptor{
+			{MediaType: mediaTypeLayer, Digest: layer.digest(), Size: layer.size},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	mfst, err := writeBlob(blobsDir, data)
+	if err != nil {
+		return err
+	}
+
+	data, err = json.Marshal(&index{
+		SchemaVersion: 2,
+		Manifests: []*descriptor{
+			{
+				MediaType:   mediaTypeManifest,
+				Digest:      mfst.digest(),
+				Size:        mfst.size,
+				Annotations: map[string]string{"org.opencontainers.image.ref.name": cfg.GetTag()},
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "index.json"), data, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	layout := []byte(`{"imageLayoutVersion":"1.0.0"}`)
+	if err = ioutil.WriteFile(filepath.Join(dir, "oci-layout"), layout, 0644); err != nil {
+		return errors.Wrap(err)
+	}
+
+	// the work directory is created with a restrictive mode
+	if err = os.Chmod(dir, 0755); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+func addArchiveFile(tw *tar.Writer, name string, size int64, created time.Time, r io.Reader) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  created,
+	}
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if _, err := io.Copy(tw, r); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
+// writeDockerArchive writes the image in the format expected by "docker load"
+func writeDockerArchive(cfg *Config, config *blob, layer *blob, created time.Time) error {
+	configName := config.hex + ".json"
+	layerName := fmt.Sprintf("%s/layer.tar", layer.hex)
+
+	data, err := json.Marshal([]*dockerManifest{
+		{Config: configName, RepoTags: []string{cfg.GetTag()}, Layers: []string{layerName}},
+	})
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	tmpFile := cfg.Output + ".tmp"
+
+	f, err := os.Create(tmpFile)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = f.Close()
+		_ = os.Remove(tmpFile)
+	}()
+
+	tw := tar.NewWriter(f)
+
+	if err = tw.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     layer.hex + "/",
+		Mode:     0755,
+		ModTime:  created,
+	}); err != nil {
+		return errors.Wrap(err)
+	}
+
+	for _, curr := range []struct {
+		name string
+		blob *blob
+	}{
+		{layerName, layer},
+		{configName, config},
+	} {
+		bf, err := os.Open(curr.blob.path)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+
+		err = addArchiveFile(tw, curr.name, curr.blob.size, created, bf)
+		_ = bf.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = addArchiveFile(tw, "manifest.json", int64(len(data)), created, bytes.NewReader(data)); err != nil {
+		return err
+	}
+
+	if err = tw.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = f.Close(); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if err = os.Rename(tmpFile, cfg.Output); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
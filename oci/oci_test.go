@@ -0,0 +1,278 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func createTestRoot(t *testing.T) string {
+	rootDir, err := ioutil.TempDir("", "oci-root-")
+	if err != nil {
+		t.Fatalf("Failed to create root dir: %v", err)
+	}
+
+	if err = os.MkdirAll(filepath.Join(rootDir, "usr", "bin"), 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+
+	file := filepath.Join(rootDir, "usr", "bin", "hello")
+	if err = ioutil.WriteFile(file, []byte("#!/bin/sh\necho hello\n"), 0755); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	if err = os.Link(file, filepath.Join(rootDir, "usr", "bin", "hello-link")); err != nil {
+		t.Fatalf("Failed to create hard link: %v", err)
+	}
+
+	if err = os.Symlink("usr/bin", filepath.Join(rootDir, "bin")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	return rootDir
+}
+
+func readTar(t *testing.T, r io.Reader) map[string]*tar.Header {
+	result := map[string]*tar.Header{}
+	tr := tar.NewReader(r)
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to read tar: %v", err)
+		}
+
+		result[hdr.Name] = hdr
+	}
+
+	return result
+}
+
+func TestLayerReproducible(t *testing.T) {
+	rootDir := createTestRoot(t)
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	mtime := time.Unix(0, 0)
+
+	first := bytes.NewBuffer(nil)
+	if err := writeLayer(first, rootDir, mtime); err != nil {
+		t.Fatalf("Failed to write layer: %v", err)
+	}
+
+	// touching the files must not change the layer
+	now := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(rootDir, "usr", "bin", "hello"), now, now); err != nil {
+		t.Fatalf("Failed to change file times: %v", err)
+	}
+
+	second := bytes.NewBuffer(nil)
+	if err := writeLayer(second, rootDir, mtime); err != nil {
+		t.Fatalf("Failed to write layer: %v", err)
+	}
+
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Fatal("Layers of the same content should be identical")
+	}
+
+	entries := readTar(t, first)
+
+	for _, name := range []string{"usr/", "usr/bin/", "usr/bin/hello", "bin"} {
+		hdr, ok := entries[name]
+		if !ok {
+			t.Fatalf("Missing layer entry: %s", name)
+		}
+
+		if !hdr.ModTime.Equal(mtime) || hdr.Uname != "" {
+			t.Fatalf("Layer entry %s is not reproducible: %+v", name, hdr)
+		}
+	}
+
+	if entries["bin"].Typeflag != tar.TypeSymlink || entries["bin"].Linkname != "usr/bin" {
+		t.Fatalf("Invalid symlink entry: %+v", entries["bin"])
+	}
+
+	link := entries["usr/bin/hello-link"]
+	if link == nil || link.Typeflag != tar.TypeLink || link.Linkname != "usr/bin/hello" {
+		t.Fatalf("Invalid hard link entry: %+v", link)
+	}
+}
+
+func TestExportOCI(t *testing.T) {
+	rootDir := createTestRoot(t)
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	outDir, err := ioutil.TempDir("", "oci-out-")
+	if err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(outDir) }()
+
+	cfg := &Config{
+		Output:     filepath.Join(outDir, "image"),
+		Entrypoint: []string{"/usr/bin/hello"},
+		Labels:     map[string]string{"org.clearlinux.version": "override"},
+	}
+
+	if err = Export(rootDir, cfg, map[string]string{"org.clearlinux.version": "30000", "other": "value"}); err != nil {
+		t.Fatalf("Failed to export OCI image: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(cfg.Output, "index.json"))
+	if err != nil {
+		t.Fatalf("Failed to read index: %v", err)
+	}
+
+	idx := &index{}
+	if err = json.Unmarshal(data, idx); err != nil || len(idx.Manifests) != 1 {
+		t.Fatalf("Invalid index: %s", string(data))
+	}
+
+	if idx.Manifests[0].Annotations["org.opencontainers.image.ref.name"] != DefaultTag {
+		t.Fatalf("Invalid image reference: %+v", idx.Manifests[0].Annotations)
+	}
+
+	blobPath := func(digest string) string {
+		return filepath.Join(cfg.Output, "blobs", "sha256", digest[len("sha256:"):])
+	}
+
+	data, err = ioutil.ReadFile(blobPath(idx.Manifests[0].Digest))
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+
+	mfst := &manifest{}
+	if err = json.Unmarshal(data, mfst); err != nil || len(mfst.Layers) != 1 {
+		t.Fatalf("Invalid manifest: %s", string(data))
+	}
+
+	data, err = ioutil.ReadFile(blobPath(mfst.Config.Digest))
+	if err != nil {
+		t.Fatalf("Failed to read image config: %v", err)
+	}
+
+	config := &imageConfig{}
+	if err = json.Unmarshal(data, config); err != nil {
+		t.Fatalf("Invalid image config: %s", string(data))
+	}
+
+	if config.Config.Labels["org.clearlinux.version"] != "override" || config.Config.Labels["other"] != "value" {
+		t.Fatalf("Invalid image labels: %+v", config.Config.Labels)
+	}
+
+	if !config.Created.Equal(time.Unix(0, 0)) || config.RootFS.DiffIDs[0] != mfst.Layers[0].Digest {
+		t.Fatalf("Invalid image config: %s", string(data))
+	}
+
+	if err = Export(rootDir, cfg, nil); err == nil {
+		t.Fatal("Export should not overwrite an existing output")
+	}
+}
+
+func TestExportDocker(t *testing.T) {
+	rootDir := createTestRoot(t)
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	outDir, err := ioutil.TempDir("", "oci-out-")
+	if err != nil {
+		t.Fatalf("Failed to create output dir: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(outDir) }()
+
+	if err = os.Setenv(sourceDateEpochVar, "1556668800"); err != nil {
+		t.Fatalf("Failed to set %s: %v", sourceDateEpochVar, err)
+	}
+	defer func() { _ = os.Unsetenv(sourceDateEpochVar) }()
+
+	cfg := &Config{Output: filepath.Join(outDir, "image.tar"), Format: FormatDocker, Tag: "clear:test"}
+
+	if err = Export(rootDir, cfg, nil); err != nil {
+		t.Fatalf("Failed to export docker image: %v", err)
+	}
+
+	f, err := os.Open(cfg.Output)
+	if err != nil {
+		t.Fatalf("Failed to open docker image: %v", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	tr := tar.NewReader(f)
+	found := false
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to read docker image: %v", err)
+		}
+
+		if hdr.ModTime.Unix() != 1556668800 {
+			t.Fatalf("Entry %s should use %s as timestamp", hdr.Name, sourceDateEpochVar)
+		}
+
+		if hdr.Name != "manifest.json" {
+			continue
+		}
+
+		mfsts := []*dockerManifest{}
+		if err = json.NewDecoder(tr).Decode(&mfsts); err != nil || len(mfsts) != 1 {
+			t.Fatalf("Invalid docker manifest: %v", err)
+		}
+
+		if mfsts[0].RepoTags[0] != "clear:test" || len(mfsts[0].Layers) != 1 {
+			t.Fatalf("Invalid docker manifest: %+v", mfsts[0])
+		}
+
+		found = true
+	}
+
+	if !found {
+		t.Fatal("Docker image is missing manifest.json")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		cfg   *Config
+		field string
+	}{
+		{&Config{Output: "image"}, ""},
+		{&Config{Output: "image.tar", Format: FormatDocker}, ""},
+		{&Config{}, "output"},
+		{&Config{Output: "image", Format: "zip"}, "format"},
+	}
+
+	for _, curr := range tests {
+		err := curr.cfg.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Config %+v should be valid: %v", curr.cfg, err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for %q, got: %v", curr.field, err)
+		}
+	}
+}
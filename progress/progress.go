@@ -7,6 +7,8 @@ package progress
 import (
 	"fmt"
 	"time"
+
+	"github.com/clearlinux/clr-installer/metrics"
 )
 
 // Client is the interface a frontend must implement in order to be notified about
@@ -45,6 +47,7 @@ type Progress interface {
 // BaseProgress is the common implementation between MultiStep and Loop progress
 type BaseProgress struct {
 	total int
+	phase *metrics.Phase
 }
 
 // Loop defines the specific data for Loop progress implementation
@@ -69,7 +72,7 @@ func MultiStep(total int, format string, a ...interface{}) Progress {
 	}
 
 	desc := fmt.Sprintf(format, a...)
-	prg := &BaseProgress{total: total}
+	prg := &BaseProgress{total: total, phase: metrics.StartPhase(desc)}
 	impl.Desc(desc)
 	return prg
 }
@@ -95,6 +98,7 @@ func NewLoop(format string, a ...interface{}) Progress {
 	desc := fmt.Sprintf(format, a...)
 	prg := &Loop{}
 	prg.done = make(chan bool)
+	prg.phase = metrics.StartPhase(desc)
 
 	impl.Desc(desc)
 	go runStepLoop(prg, impl.LoopWaitDuration())
@@ -106,6 +110,7 @@ func NewLoop(format string, a ...interface{}) Progress {
 // successfully, this is the specific implementation for Loop based progress
 func (prg *Loop) Success() {
 	prg.done <- true
+	prg.phase.Finish(true)
 	impl.Success()
 }
 
@@ -113,6 +118,7 @@ func (prg *Loop) Success() {
 // unsuccessfully, this is the specific implementation for Loop based progress
 func (prg *Loop) Failure() {
 	prg.done <- true
+	prg.phase.Finish(false)
 	impl.Failure()
 }
 
@@ -125,11 +131,13 @@ func (prg *BaseProgress) Partial(step int) {
 // Success is the common BaseProgress implementation and simply notify the actual
 // implementation we've finished a task successfully
 func (prg *BaseProgress) Success() {
+	prg.phase.Finish(true)
 	impl.Success()
 }
 
 // Failure is the common BaseProgress implementation and simply notify the actual
 // implementation we've finished a task unsuccessfully
 func (prg *BaseProgress) Failure() {
+	prg.phase.Finish(false)
 	impl.Failure()
 }
@@ -6,6 +6,7 @@ package proxy
 
 import (
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 
@@ -24,10 +25,40 @@ var (
 
 // SetHTTPSProxy defines the HTTPS_PROXY env var value for all the cmd executions
 func SetHTTPSProxy(addr string) {
-	log.Debug("proxy.SetHTTPSProxy = %s", addr)
+	log.Debug("proxy.SetHTTPSProxy = %s", Redact(addr))
 	httpsProxy = addr
 }
 
+// Redact returns the proxy address without the user information password, if any
+func Redact(addr string) string {
+	u, err := url.Parse(addr)
+	if err != nil || u.User == nil {
+		return addr
+	}
+
+	if _, ok := u.User.Password(); !ok {
+		return addr
+	}
+
+	u.User = url.User(u.User.Username())
+	return u.String()
+}
+
+// RedactValues returns the name=value environment variables with the proxy addresses
+// passwords removed
+func RedactValues(values []string) []string {
+	result := []string{}
+
+	for _, curr := range values {
+		if tks := strings.SplitN(curr, "=", 2); len(tks) == 2 {
+			curr = tks[0] + "=" + Redact(tks[1])
+		}
+		result = append(result, curr)
+	}
+
+	return result
+}
+
 // SetPreProxyFunc save the function used to run before processing proxies
 // This is currently used by Gnome UI to copy Network Proxy from install user
 func SetPreProxyFunc(f func()) {
@@ -0,0 +1,131 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package schema
+
+import (
+	"reflect"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+var unmarshalerType = reflect.TypeOf((*yaml.Unmarshaler)(nil)).Elem()
+
+// CheckFields checks the yaml keys of typ match the properties of the field of path, i.e
+// targetMedia[], a key missing in the schema or a property matching no key is an error.
+// It's meant for the packages tests to keep their types and the schema in sync.
+func CheckFields(typ reflect.Type, path string) error {
+	field := Root.Lookup(path)
+	if field == nil {
+		return errors.Errorf("The %s field is not described by the schema", path)
+	}
+
+	if path != "" {
+		path += "."
+	}
+
+	return field.checkFields(typ, path)
+}
+
+// checkFields checks the yaml keys of typ and the properties of f match, path prefixes the
+// reported fields. The types with a custom YAML format are only checked where the schema
+// describes them as objects, and by their package tests when they are decoded through a
+// private struct.
+func (f *Field) checkFields(typ reflect.Type, path string) error {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	props := f.properties()
+
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	if reflect.PtrTo(typ).Implements(unmarshalerType) && (len(props) == 0 || !yamlTagged(typ)) {
+		return nil
+	}
+
+	names := map[string]bool{}
+
+	for i := 0; i < typ.NumField(); i++ {
+		curr := typ.Field(i)
+		name := strings.Split(curr.Tag.Get("yaml"), ",")[0]
+
+		if name == "-" || curr.PkgPath != "" {
+			continue
+		}
+
+		if name == "" {
+			name = strings.ToLower(curr.Name)
+		}
+		names[name] = true
+
+		sub := f.Field(name)
+		if sub == nil {
+			return errors.Errorf("The %s%s field is not described by the schema", path, name)
+		}
+
+		ftyp := curr.Type
+		if items := sub.items(); ftyp.Kind() == reflect.Slice && items != nil {
+			if err := items.checkFields(ftyp.Elem(), path+name+"[]."); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := sub.checkFields(ftyp, path+name+"."); err != nil {
+			return err
+		}
+	}
+
+	for _, curr := range props {
+		if !names[curr.Name] {
+			return errors.Errorf("The schema %s%s field is not a configuration field", path, curr.Name)
+		}
+	}
+
+	return nil
+}
+
+// properties returns the object properties of f, the ones of its alternative forms too
+func (f *Field) properties() []*Field {
+	result := append([]*Field{}, f.Fields...)
+
+	for _, alt := range f.OneOf {
+		result = append(result, alt.Fields...)
+	}
+
+	return result
+}
+
+// items returns the array items of f, or of its array alternative form
+func (f *Field) items() *Field {
+	if f.Items != nil {
+		return f.Items
+	}
+
+	for _, alt := range f.OneOf {
+		if alt.Items != nil {
+			return alt.Items
+		}
+	}
+
+	return nil
+}
+
+// yamlTagged returns true if any field of the typ struct has a yaml tag, the types with a
+// custom YAML format and no tags are decoded through their package private struct
+func yamlTagged(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if typ.Field(i).Tag.Get("yaml") != "" {
+			return true
+		}
+	}
+
+	return false
+}
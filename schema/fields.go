@@ -0,0 +1,357 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package schema
+
+var (
+	str     = []string{TypeString}
+	integer = []string{TypeInteger}
+	boolean = []string{TypeBoolean}
+	array   = []string{TypeArray}
+	object  = []string{TypeObject}
+
+	// boolString is a boolean the configuration may quote, i.e dhcp: "false"
+	boolString = []string{TypeBoolean, TypeString}
+
+	// size is a size in bytes or a string with a unit suffix, i.e 150M
+	size = []string{TypeString, TypeInteger}
+
+	// deviceTypes are the block device types
+	deviceTypes = []string{"disk", "part", "crypt", "loop", "rom", "LVM2_member", "lvm"}
+
+	// stringList is a list of strings
+	stringList = &Field{Type: str}
+
+	// stringMap is a map of strings
+	stringMap = &Field{Type: str}
+
+	// deviceInternals are the block device fields written by clr-installer when saving
+	// the detected devices, they are accepted but not meant to be set by the users
+	deviceInternals = []*Field{
+		{Name: "model", Type: str, Desc: "Device model", Hidden: true},
+		{Name: "majMin", Type: str, Desc: "Device major:minor number", Hidden: true},
+		{Name: "uuid", Type: str, Desc: "File system UUID", Hidden: true},
+		{Name: "serial", Type: str, Desc: "Device serial number", Hidden: true},
+		{Name: "ro", Type: boolString, Desc: "Read-only device", Hidden: true},
+		{Name: "rm", Type: boolString, Desc: "Removable device", Hidden: true},
+		{Name: "state", Type: str, Desc: "Device state", Hidden: true},
+	}
+
+	// secretRef is a reference to a secret, or the plain text secret, see secret.Value
+	secretRef = &Field{
+		Type: object,
+		Def:  "secret",
+		Fields: []*Field{
+			{Name: "fromEnv", Type: str, Desc: "Environment variable holding the secret"},
+			{Name: "fromFile", Type: str, Desc: "File holding the secret, relative paths are resolved from `yamlDir`; its trailing new line is dropped"},
+			{Name: "plain", Type: str, Desc: "Plain text secret, never written back"},
+		},
+	}
+
+	// partition is a targetMedia child, partitions may have children themselves, i.e
+	// the mapped device of an encrypted partition
+	partition = &Field{
+		Type: object,
+		Def:  "partition",
+		Fields: append([]*Field{
+			{Name: "name", Type: str, Required: true,
+				Desc: "Block-device alias and partition number or the physical partition name"},
+			{Name: "type", Type: str, Required: true, Enum: deviceTypes,
+				Desc: "Partition type should be `part` for a standard partition or `crypt` for encrypted partitions"},
+			{Name: "fstype", Type: str, Required: true,
+				Desc: "Type of the partition can be one of: `swap`, or `ext2`, `ext3`, `ext4`, `xfs`, `btrfs`, or `vfat`"},
+			{Name: "size", Type: size, Required: true,
+				Desc: "Size of the partition. Set to `0` to use the remaining free space for this partition; there can only be one partition of size `0`. The suffixes `B` for bytes, `K` for kilobytes, `M` for megabytes, `G` for gigabytes, `T` for terabytes, or `P` for petabytes can be used."},
+			{Name: "mountpoint", Type: str, Desc: "The file system path where the partition should be mounted"},
+			{Name: "options", Type: str, Desc: "Additional file system options to be used when creating the fs"},
+			{Name: "label", Type: str, Desc: "Short string labeling the partition"},
+		}, deviceInternals...),
+	}
+
+	disk = &Field{
+		Type: object,
+		Fields: append([]*Field{
+			{Name: "name", Type: str, Required: true, Desc: "Block-device alias or the physical device name"},
+			{Name: "type", Type: str, Required: true, Enum: deviceTypes,
+				Desc: "Type of the target media should always be `disk`"},
+			{Name: "children", Type: array, Requirement: "Yes", Items: partition,
+				Desc: "List of partition for the image"},
+			{Name: "size", Type: size,
+				Desc: "Size of the media to be used, or the image file size to be generated. This will be calculated as the sum of the partition sizes if not present."},
+			{Name: "fstype", Type: str, Desc: "File system of an unpartitioned media", Hidden: true},
+			{Name: "mountpoint", Type: str, Desc: "Mount point of an unpartitioned media", Hidden: true},
+			{Name: "options", Type: str, Desc: "File system options of an unpartitioned media", Hidden: true},
+			{Name: "label", Type: str, Desc: "File system label of an unpartitioned media", Hidden: true},
+		}, deviceInternals...),
+	}
+
+	hook = &Field{
+		Type: object,
+		Fields: []*Field{
+			{Name: "cmd", Type: str, Requirement: "Yes, unless `script` is set",
+				Desc: "The command to run plus any arguments; usually passing `chrootDir`"},
+			{Name: "script", Type: str, Requirement: "Yes, unless `cmd` is set",
+				Desc: "Path of a script file to run, relative paths are resolved from `yamlDir`"},
+			{Name: "chroot", Type: boolean,
+				Desc: "Boolean indicating if this command should be run chrooted, not supported by `postPartition` and `postMount`, which run before the bundles are installed; a chrooted `preInstall` hook requires a target populated beforehand"},
+			{Name: "user", Type: str, Desc: "User to run a chrooted hook as, defaults to root"},
+			{Name: "env", Type: object, Values: stringMap,
+				Desc: "Map of additional environment variables, values may use the predefined variables"},
+			{Name: "timeout", Type: integer,
+				Desc: "Seconds to wait for the hook to complete before killing it, defaults to no limit"},
+			{Name: "retries", Type: integer,
+				Desc: "Number of times to run the hook again if it fails, defaults to 0"},
+			{Name: "continueOnError", Type: boolean,
+				Desc: "Boolean indicating if the installation should go on if the hook fails"},
+		},
+	}
+
+	kernelBundle = &Field{
+		Type: object,
+		Fields: []*Field{
+			{Name: "bundle", Type: str, Required: true, Desc: "Kernel bundle name"},
+			{Name: "default", Type: boolean, Desc: "Boolean indicating if the kernel is booted by default"},
+		},
+	}
+
+	// Root is the configuration document
+	Root = &Field{
+		Type: object,
+		Fields: []*Field{
+			{Name: "schemaVersion", Type: integer,
+				Desc: "Version of the configuration schema the file is written for, `1` if not set. The files of the older versions are migrated, see [Schema Versions](#schema-versions)"},
+			{Name: "extends", Type: []string{TypeString, TypeArray}, Items: stringList,
+				Desc: "Configuration file, or list of files, this file is merged on top of, see [Composition](#composition)"},
+			{Name: "include", Type: []string{TypeString, TypeArray}, Items: stringList,
+				Desc: "Configuration file, or list of files, merged on top of this file, see [Composition](#composition)"},
+			{Name: "env", Type: object, Values: stringMap,
+				Desc: "Map of environment variables set when the installation hooks are executed"},
+			{Name: "blockDevices", Type: array,
+				Desc: "List of device aliases used by the `targetMedia` names",
+				Items: &Field{
+					Type: object,
+					Fields: []*Field{
+						{Name: "name", Type: str, Required: true,
+							Desc: "Alias name, referenced as `${name}` by the `targetMedia` names"},
+						{Name: "file", Type: str, Required: true,
+							Desc: "Image file, created if missing, or device file the alias stands for"},
+						{Name: "devicefile", Type: boolean,
+							Desc: "Set by clr-installer when the file is a device file", Hidden: true},
+					},
+				}},
+			{Name: "targetMedia", Type: array, Items: disk,
+				Desc: "The media where the Clear Linux OS will be installed"},
+			{Name: "target", Type: str, Enum: []string{"disk", "directory"},
+				Desc: "Install target, either `disk` (the default) or `directory`"},
+			{Name: "targetDir", Type: str, Requirement: "Yes, for `directory`",
+				Desc: "Absolute path of the directory to install into, it is created if missing"},
+			{Name: "container", Type: object,
+				Desc: "Exports the installed root file system as a container image",
+				Fields: []*Field{
+					{Name: "output", Type: str, Required: true,
+						Desc: "Path of the image, it must not exist and must not be inside `targetDir`"},
+					{Name: "format", Type: str, Enum: []string{"oci", "docker"},
+						Desc: "Either `oci` (an OCI image layout directory, the default) or `docker` (a `docker load` tarball)"},
+					{Name: "tag", Type: str, Desc: "Image reference name, defaults to `clearlinux:latest`"},
+					{Name: "entrypoint", Type: array, Items: stringList, Desc: "List with the image entrypoint"},
+					{Name: "cmd", Type: array, Items: stringList, Desc: "List with the image default arguments"},
+					{Name: "env", Type: array, Items: stringList,
+						Desc: "List of `NAME=value` environment variables"},
+					{Name: "workingDir", Type: str, Desc: "Image working directory"},
+					{Name: "labels", Type: object, Values: stringMap, Desc: "Map of image labels"},
+				}},
+			{Name: "bundles", Type: array, Items: stringList,
+				Desc: "List of the Clear Linux OS bundles installed to the target"},
+			{Name: "userBundles", Type: array, Items: stringList,
+				Desc: "List of the bundles selected by the user in the interactive installers", Hidden: true},
+			{Name: "users", Type: array,
+				Desc: "List of the user accounts created at the time of installation",
+				Items: &Field{
+					Type: object,
+					Fields: []*Field{
+						{Name: "login", Type: str, Required: true, Desc: "Name of the user's login"},
+						{Name: "username", Type: str, Desc: "The full name of the user"},
+						{Name: "password", OneOf: []*Field{{Type: str}, secretRef},
+							Desc: "The encrypted password suitable for the /etc/passwd file. This string can be generated using `clr-installer --genpass <passwd>`. A [secret](#secrets) holds the plain text password, encrypted when the configuration is loaded"},
+						{Name: "ssh-keys", Type: array, Items: stringList,
+							Desc: "A list of SSH keys add to the `.ssh/authorized_keys` file for the account. An entry is a key, a file or a directory of `.pub` files, relative paths are resolved from `yamlDir`, or an `https://` url"},
+						{Name: "admin", Type: boolean,
+							Desc: "Boolean value if this account is an administrative and should be included in the `wheel` group"},
+						{Name: "groups", Type: array, Items: stringList,
+							Desc: "List of the supplementary groups of the account, the missing ones are created. The `wheel` group is set with `admin`"},
+						{Name: "uid", Type: integer, Desc: "User id of the account, up to 65533. Defaults to the next free one"},
+						{Name: "gid", Type: integer,
+							Desc: "Primary group id of the account, a group named after the login is created if the id is not defined"},
+						{Name: "shell", Type: str, Desc: "Absolute path of the login shell"},
+						{Name: "home", Type: str, Desc: "Absolute path of the home directory, created at the time of installation"},
+						{Name: "system", Type: boolean, Desc: "Boolean value if this account is a system account"},
+						{Name: "passwordMaxDays", Type: integer,
+							Desc: "Maximum number of days a password is valid, up to 99999. Defaults to never expiring passwords"},
+						{Name: "forcePasswordChange", Type: boolean,
+							Desc: "Boolean value if the password must be changed at the first login, a password is required"},
+						{Name: "locked", Type: boolean,
+							Desc: "Boolean value if the account password is locked, the ssh keys logins are still allowed"},
+						{Name: "sudo", Type: array,
+							Desc: "List of the sudo rules of the account, written to `/etc/sudoers.d` and checked with `visudo`",
+							Items: &Field{
+								Type: object,
+								Fields: []*Field{
+									{Name: "commands", Type: array, Items: stringList, Required: true,
+										Desc: "List of the allowed commands, absolute paths without `,`, `:`, `=` nor `\\` followed by their arguments, or `ALL`"},
+									{Name: "runAs", Type: str, Desc: "User the commands are run as, `ALL` for any. Defaults to root"},
+									{Name: "noPassword", Type: boolean, Desc: "Boolean value if the commands run with no password"},
+								},
+							}},
+					},
+				}},
+			{Name: "files", Type: array,
+				Desc: "List of the files written to the target system",
+				Items: &Field{
+					Type: object,
+					Fields: []*Field{
+						{Name: "path", Type: str, Required: true,
+							Desc: "Absolute path of the file in the target system, without `..`; parent directories are created as needed and symlinks are resolved within the target"},
+						{Name: "content", Type: str, Desc: "The file content"},
+						{Name: "encoding", Type: str, Enum: []string{"base64"},
+							Desc: "Set to `base64` if `content` is base64 encoded"},
+						{Name: "source", Type: str,
+							Desc: "Path of a file to copy the content from, relative paths are resolved from `yamlDir`; can not be used with `content`"},
+						{Name: "owner", Type: str,
+							Desc: "Owner of the file, a user name of the target system or a numeric id"},
+						{Name: "group", Type: str,
+							Desc: "Group of the file, a group name of the target system or a numeric id"},
+						{Name: "mode", Type: str, Desc: "Octal permissions of the file, defaults to `0644`"},
+						{Name: "append", Type: boolean,
+							Desc: "Boolean indicating if the content should be appended to an existing file instead of overwriting it"},
+						{Name: "template", Type: boolean,
+							Desc: "Boolean indicating if the content should have the hook [Environment Variables](#environment-variables) expanded"},
+					},
+				}},
+			{Name: "services", Type: object,
+				Desc: "Sets the state of the target system's systemd units",
+				Fields: []*Field{
+					{Name: "enable", Type: array, Items: stringList, Desc: "List of units to enable"},
+					{Name: "disable", Type: array, Items: stringList, Desc: "List of units to disable"},
+					{Name: "mask", Type: array, Items: stringList, Desc: "List of units to mask"},
+					{Name: "unmask", Type: array, Items: stringList, Desc: "List of units to unmask"},
+					{Name: "dropIns", Type: array,
+						Desc: "List of override configuration files, with `unit`, `content` and an optional `name` (defaults to `clr-installer.conf`), written to `/etc/systemd/system/<unit>.d/`",
+						Items: &Field{
+							Type: object,
+							Fields: []*Field{
+								{Name: "unit", Type: str, Required: true, Desc: "Unit the drop-in overrides"},
+								{Name: "name", Type: str, Desc: "Drop-in file name, defaults to `clr-installer.conf`"},
+								{Name: "content", Type: str, Required: true, Desc: "Drop-in file content"},
+							},
+						}},
+				}},
+			{Name: "keyboard", Type: str, Default: "us",
+				Desc: "Name of the keyboard type. Valid value can be found using `localectl list-keymaps`; may require installing the `kbd` bundle first."},
+			{Name: "language", Type: str, Default: "en_US.UTF-8",
+				Desc: "Name of the system language. Valid values can be found using `locale -a`; may require installing the `locales` bundle first."},
+			{Name: "timezone", Type: str, Default: "UTC",
+				Desc: "Name of the system timezone. Valid values can be found using `timedatectl list-timezones`; may require installing the `tzdata` bundle first."},
+			{Name: "kernel", Type: str, Default: "kernel-native",
+				Desc: "Kernel bundle to be used, see [Kernels](#kernels) to install several"},
+			{Name: "kernels", Type: array,
+				Desc:  "List of the kernels installed side by side, either kernel bundle names or mappings with the `bundle` and `default` keys",
+				Items: &Field{OneOf: []*Field{{Type: str}, kernelBundle}}},
+			{Name: "kernelArguments", Type: object,
+				Desc: "Kernel arguments added to, or removed from, the kernel command line",
+				Fields: []*Field{
+					{Name: "add", Type: array, Items: stringList,
+						Desc: "A YAML list of strings with additional kernel parameters. These are always appending to the pre-defined kernel parameters."},
+					{Name: "remove", Type: array, Items: stringList,
+						Desc: "A YAML list of strings to attempt to remove from the pre-defined kernel parameters. Only exact matches are removed."},
+				}},
+			{Name: "bootloader", Type: object,
+				Desc: "Configures the boot loader installed to the target media",
+				Fields: []*Field{
+					{Name: "backend", Type: str, Enum: []string{"clr-boot-manager", "systemd-boot"},
+						Default: "clr-boot-manager", Desc: "Either `clr-boot-manager` or `systemd-boot`"},
+					{Name: "timeout", Type: integer, Default: "`-BACKEND DEFAULT-`",
+						Desc: "Seconds the boot menu is shown"},
+					{Name: "default", Type: str, Default: "`kernel`",
+						Desc: "Kernel bundle booted by default; must be an installed kernel and, with a `kernels` list, its default"},
+					{Name: "console", Type: array, Items: stringList, Default: "`-UNDEFINED-`",
+						Desc: "List of consoles, each added as a `console=` kernel argument"},
+					{Name: "kernelArgs", Type: object, Values: &Field{Type: array, Items: stringList},
+						Default: "`-UNDEFINED-`",
+						Desc:    "Map of kernel bundle to a list of arguments added to its boot entry. With `clr-boot-manager` the arguments are shared by every kernel, so only a single kernel is supported"},
+				}},
+			{Name: "httpsProxy", Type: str, Default: "`-UNDEFINED-`", Desc: "HTTPS Proxy as a string"},
+			{Name: "httpsProxyCredentials", OneOf: []*Field{{Type: str}, secretRef}, Default: "`-UNDEFINED-`",
+				Desc: "[Secret](#secrets) holding the `user:password` credentials of the HTTPS Proxy"},
+			{Name: "cryptPassphrase", OneOf: []*Field{{Type: str}, secretRef}, Default: "`-UNDEFINED-`",
+				Desc: "[Secret](#secrets) holding the passphrase of the encrypted partitions, `--crypt-file` takes precedence"},
+			{Name: "swupdMirror", Type: str, Default: "`-UNDEFINED-`",
+				Desc: "URL of the swupd stream to use. Useful for installing from a local mirror or from a locally published mix."},
+			{Name: "hostname", Type: str, Default: "`-UNIQUE RANDOM-`", Desc: "Name of the host system"},
+			{Name: "version", Type: integer, Default: "`-VERSION_ON_BUILD_SYSTEM-`",
+				Desc: "Version of Clear Linux OS to install"},
+			{Name: "autoUpdate", Type: boolean, Default: "true",
+				Desc: "Should the system automatically update to the latest release of Clear Linux OS as part of the installation?; true or false"},
+			{Name: "postReboot", Type: boolean, Default: "true",
+				Desc: "Should the system reboot after the installation completes?; true or false"},
+			{Name: "postArchive", Type: boolean, Default: "true",
+				Desc: "Should the system archive the log and configuration file on the target media?; true or false"},
+			{Name: "legacyBios", Type: boolean, Default: "false",
+				Desc: "Is the install using the Legacy boot from BIOS?; true or false"},
+			{Name: "copyNetwork", Type: boolean, Default: "false",
+				Desc: "Copy the locally configured network interfaces to target; `/etc/systemd/network`"},
+			{Name: "iso", Type: boolean, Default: "false",
+				Desc: "Should a bootable ISO image be created from the installed image file?; true or false"},
+			{Name: "keepImage", Type: boolean, Default: "true",
+				Desc: "Should the image file be kept once the ISO image is created?; true or false"},
+			{Name: "telemetry", Type: boolean, Default: "false",
+				Desc: "Should telemetry be enabled by default; true or false"},
+			{Name: "telemetryURL", Type: str, Default: "`-UNDEFINED-`",
+				Desc: "URL of where the telemetry records should publish"},
+			{Name: "telemetryTID", Type: str, Default: "`-UNDEFINED-`",
+				Desc: "Telemetry ID of the records published to `telemetryURL`"},
+			{Name: "telemetryPolicy", Type: str, Default: "`-UNDEFINED-`",
+				Desc: "Policy string displayed to users during interactive installs"},
+			{Name: "verify", Type: boolean, Default: "false",
+				Desc: "Should the installed system be verified before the installation is reported successful?; true or false. See [Verification](#verification)"},
+			{Name: "networkInterfaces", Type: array,
+				Desc: "Network interfaces configured by the interactive installers", Hidden: true,
+				Items: &Field{
+					Type: object,
+					Fields: []*Field{
+						{Name: "name", Type: str, Desc: "Interface name"},
+						{Name: "addrs", Type: array, Desc: "Interface addresses",
+							Items: &Field{
+								Type: object,
+								Fields: []*Field{
+									{Name: "ip", Type: str, Desc: "IP address"},
+									{Name: "netmask", Type: str, Desc: "Network mask"},
+									{Name: "version", Type: integer, Desc: "0 for IPv4, 1 for IPv6"},
+								},
+							}},
+						{Name: "dhcp", Type: boolString, Desc: "Use DHCP"},
+						{Name: "gateway", Type: str, Desc: "Gateway address"},
+						{Name: "dns", Type: str, Desc: "DNS server address"},
+						{Name: "domain", Type: str, Desc: "DNS domain"},
+					},
+				}},
+			{Name: "preInstall", Type: array, Items: hook,
+				Desc: "Before the start of the installation, nothing has been written to the target"},
+			{Name: "postPartition", Type: array, Items: hook,
+				Desc: "After the target media is partitioned and the file systems are created, not supported by a directory target"},
+			{Name: "postMount", Type: array, Items: hook,
+				Desc: "After the target file systems are mounted under `chrootDir`"},
+			{Name: "postBundles", Type: array, Items: hook,
+				Desc: "After the bundles are installed"},
+			{Name: "preBootloader", Type: array, Items: hook,
+				Desc: "Right before the boot loader is installed, not supported by a directory target"},
+			{Name: "postInstall", Type: array, Items: hook,
+				Desc: "After the installation steps are completed"},
+		},
+	}
+)
+
+func init() {
+	partition.Fields = append(partition.Fields, &Field{Name: "children", Type: array, Items: partition,
+		Desc: "Devices of the partition, i.e the mapped device of an encrypted partition", Hidden: true})
+}
@@ -0,0 +1,134 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package schema
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// ColumnRequired lists if the fields are required in the third table column
+	ColumnRequired = "Required?"
+
+	// ColumnDefault lists the fields default values in the third table column
+	ColumnDefault = "Default"
+
+	// TemplateFile is the configuration syntax document template
+	TemplateFile = "schema/InstallerYAMLSyntax.md.tmpl"
+
+	// MarkdownFile is the generated configuration syntax document
+	MarkdownFile = "scripts/InstallerYAMLSyntax.md"
+
+	// JSONFile is the generated JSON Schema
+	JSONFile = "scripts/clr-installer.schema.json"
+)
+
+// table returns the markdown table of the fields of the object at path, or only of the
+// named fields, the column is either ColumnRequired, ColumnDefault or "" for no third column
+func table(column string, path string, names ...string) (string, error) {
+	parent := Root.Lookup(path)
+	if parent == nil {
+		return "", errors.Errorf("Unknown field: %s", path)
+	}
+
+	fields := []*Field{}
+
+	if len(names) == 0 {
+		for _, curr := range parent.Fields {
+			if !curr.Hidden {
+				fields = append(fields, curr)
+			}
+		}
+	}
+
+	for _, curr := range names {
+		field := parent.Field(curr)
+		if field == nil {
+			return "", errors.Errorf("Unknown field: %s.%s", path, curr)
+		}
+		fields = append(fields, field)
+	}
+
+	var sb strings.Builder
+
+	if column == "" {
+		sb.WriteString("Item | Description\n------------ | -------------\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("Item | Description | %s\n------------ | ------------- | -------------\n",
+			column))
+	}
+
+	for _, curr := range fields {
+		sb.WriteString(fmt.Sprintf("`%s:` | %s", curr.Name, curr.Desc))
+
+		switch column {
+		case ColumnRequired:
+			sb.WriteString(" | " + curr.requirement())
+		case ColumnDefault:
+			sb.WriteString(" | " + curr.Default)
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return strings.TrimSuffix(sb.String(), "\n"), nil
+}
+
+// requirement returns the Required? column value of the field
+func (f *Field) requirement() string {
+	if f.Requirement != "" {
+		return f.Requirement
+	}
+
+	if f.Required {
+		return "Yes"
+	}
+
+	return "No"
+}
+
+// Markdown returns the configuration syntax document, the tmpl markdown template
+// lists the fields with the table function, i.e {{table "Required?" "users[]"}}
+func Markdown(tmpl []byte) ([]byte, error) {
+	t, err := template.New("markdown").Funcs(template.FuncMap{"table": table}).Parse(string(tmpl))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, nil); err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Files returns the content of the generated files by their path relative to the source
+// tree top directory srcDir
+func Files(srcDir string) (map[string][]byte, error) {
+	tmpl, err := ioutil.ReadFile(filepath.Join(srcDir, TemplateFile))
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	md, err := Markdown(tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	js, err := JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string][]byte{MarkdownFile: md, JSONFile: js}, nil
+}
@@ -0,0 +1,244 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package schema
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	// TypeString is the JSON Schema string type
+	TypeString = "string"
+
+	// TypeInteger is the JSON Schema integer type
+	TypeInteger = "integer"
+
+	// TypeBoolean is the JSON Schema boolean type
+	TypeBoolean = "boolean"
+
+	// TypeArray is the JSON Schema array type
+	TypeArray = "array"
+
+	// TypeObject is the JSON Schema object type
+	TypeObject = "object"
+
+	// draft is the JSON Schema version the schema complies to
+	draft = "http://json-schema.org/draft-07/schema#"
+)
+
+// Field describes a configuration field, it's the source of both the JSON Schema and
+// the configuration syntax document
+type Field struct {
+	Name        string   // Name is the YAML key
+	Type        []string // Type are the accepted JSON Schema types
+	Desc        string   // Desc is the markdown description
+	Required    bool     // Required is set if the field must always be set
+	Requirement string   // Requirement documents a conditionally required field
+	Default     string   // Default documents the default value
+	Enum        []string // Enum are the accepted values
+	Items       *Field   // Items describes the array items
+	Fields      []*Field // Fields are the object properties
+	Values      *Field   // Values describes the values of a map, an object with any key
+	OneOf       []*Field // OneOf are the alternative forms of the field
+	Def         string   // Def is the name the field is defined as, for recursive fields
+	Hidden      bool     // Hidden fields are accepted but left out of the document tables
+}
+
+// Lookup returns the field of the path, i.e targetMedia[0].children[1].type, relative
+// to f, nil if the path does not match any field. The items of an array are matched by
+// any index, i.e bundles[], as well as the values of a map by any key.
+func (f *Field) Lookup(path string) *Field {
+	result := f
+
+	for _, elem := range strings.FieldsFunc(path, func(r rune) bool { return r == '.' || r == '[' }) {
+		if result == nil {
+			return nil
+		}
+
+		if strings.HasSuffix(elem, "]") {
+			result = result.Items
+			continue
+		}
+
+		if result.Values != nil {
+			result = result.Values
+			continue
+		}
+
+		result = result.Field(elem)
+	}
+
+	return result
+}
+
+// Field returns the object property named name, or the property of the object form of
+// an alternative field, nil if f has no such property
+func (f *Field) Field(name string) *Field {
+	for _, curr := range f.Fields {
+		if curr.Name == name {
+			return curr
+		}
+	}
+
+	for _, alt := range f.OneOf {
+		if result := alt.Field(name); result != nil {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// Closest returns the property of f whose name is the closest to name, "" if none is
+// close enough to be a misspelling of name
+func (f *Field) Closest(name string) string {
+	result := ""
+	best := 3
+
+	if f == nil {
+		return result
+	}
+
+	fields := f.Fields
+	for _, alt := range f.OneOf {
+		fields = append(fields, alt.Fields...)
+	}
+
+	for _, curr := range fields {
+		if dist := editDistance(strings.ToLower(curr.Name), strings.ToLower(name)); dist < best {
+			result = curr.Name
+			best = dist
+		}
+	}
+
+	return result
+}
+
+// editDistance returns the Levenshtein distance of a and b
+func editDistance(a string, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
+
+// jsonSchema converts f to its JSON Schema, the recursive fields are added to defs and
+// referenced
+func (f *Field) jsonSchema(defs map[string]interface{}) map[string]interface{} {
+	if f.Def != "" {
+		if _, ok := defs[f.Def]; !ok {
+			defs[f.Def] = nil
+			defs[f.Def] = f.definition(defs)
+		}
+
+		return map[string]interface{}{"$ref": "#/definitions/" + f.Def}
+	}
+
+	return f.definition(defs)
+}
+
+func (f *Field) definition(defs map[string]interface{}) map[string]interface{} {
+	result := map[string]interface{}{}
+
+	if f.Desc != "" {
+		result["description"] = f.Desc
+	}
+
+	if len(f.Type) == 1 {
+		result["type"] = f.Type[0]
+	} else if len(f.Type) > 1 {
+		result["type"] = f.Type
+	}
+
+	if len(f.Enum) > 0 {
+		result["enum"] = f.Enum
+	}
+
+	if f.Items != nil {
+		result["items"] = f.Items.jsonSchema(defs)
+	}
+
+	if len(f.Fields) > 0 {
+		properties := map[string]interface{}{}
+		required := []string{}
+
+		for _, curr := range f.Fields {
+			properties[curr.Name] = curr.jsonSchema(defs)
+
+			if curr.Required {
+				required = append(required, curr.Name)
+			}
+		}
+
+		result["properties"] = properties
+		result["additionalProperties"] = false
+
+		if len(required) > 0 {
+			result["required"] = required
+		}
+	}
+
+	if f.Values != nil {
+		result["additionalProperties"] = f.Values.jsonSchema(defs)
+	}
+
+	if len(f.OneOf) > 0 {
+		alts := []interface{}{}
+		for _, curr := range f.OneOf {
+			alts = append(alts, curr.jsonSchema(defs))
+		}
+		result["oneOf"] = alts
+	}
+
+	return result
+}
+
+// JSON returns the JSON Schema of the configuration document
+func JSON() ([]byte, error) {
+	defs := map[string]interface{}{}
+
+	result := Root.jsonSchema(defs)
+	result["$schema"] = draft
+	result["title"] = "clr-installer configuration"
+
+	if len(defs) > 0 {
+		result["definitions"] = defs
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	return append(data, '\n'), nil
+}
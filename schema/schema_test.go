@@ -0,0 +1,276 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+func TestGeneratedFiles(t *testing.T) {
+	files, err := Files("..")
+	if err != nil {
+		t.Fatalf("Failed to generate the files: %v", err)
+	}
+
+	for path, content := range files {
+		committed, err := ioutil.ReadFile(filepath.Join("..", path))
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+
+		if !bytes.Equal(committed, content) {
+			t.Fatalf("%s is outdated, run: go run gen-schema/gen-schema.go", path)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	content, err := JSON()
+	if err != nil {
+		t.Fatalf("Failed to generate the JSON Schema: %v", err)
+	}
+
+	var result map[string]interface{}
+	if err = json.Unmarshal(content, &result); err != nil {
+		t.Fatalf("Invalid JSON Schema: %v", err)
+	}
+
+	if _, ok := result["definitions"].(map[string]interface{})["partition"]; !ok {
+		t.Fatal("The recursive partition definition should be set")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		path string
+		name string
+	}{
+		{"targetMedia[0].children[1].mountpoint", "mountpoint"},
+		{"targetMedia[0].children[1].children[0].fstype", "fstype"},
+		{"bootloader.kernelArgs.kernel-native", ""},
+		{"kernels[0].default", "default"},
+		{"postInstall[2].continueOnError", "continueOnError"},
+		{"bootloader.unknown", "-"},
+	}
+
+	for _, curr := range tests {
+		field := Root.Lookup(curr.path)
+
+		if curr.name == "-" {
+			if field != nil {
+				t.Fatalf("Path %s should not match a field", curr.path)
+			}
+			continue
+		}
+
+		if field == nil || field.Name != curr.name {
+			t.Fatalf("Path %s should match the %q field, got: %+v", curr.path, curr.name, field)
+		}
+	}
+}
+
+func TestClosest(t *testing.T) {
+	tests := []struct {
+		path    string
+		name    string
+		closest string
+	}{
+		{"", "bundels", "bundles"},
+		{"targetMedia[0].children[0]", "mountpont", "mountpoint"},
+		{"kernels[0]", "defualt", "default"},
+		{"", "something", ""},
+	}
+
+	for _, curr := range tests {
+		if closest := Root.Lookup(curr.path).Closest(curr.name); closest != curr.closest {
+			t.Fatalf("The closest field to %s should be %q, got: %q", curr.name, curr.closest, closest)
+		}
+	}
+}
+
+func TestCheckFields(t *testing.T) {
+	field := &Field{Type: object, Fields: []*Field{
+		{Name: "name", Type: str},
+		{Name: "items", Type: array, Items: &Field{Type: object, Fields: []*Field{
+			{Name: "size", Type: integer},
+		}}},
+	}}
+
+	type item struct {
+		Size int `yaml:"size"`
+	}
+
+	type valid struct {
+		Name  string  `yaml:"name,omitempty"`
+		Items []*item `yaml:"items"`
+		state string
+	}
+
+	if err := field.checkFields(reflect.TypeOf(valid{}), ""); err != nil {
+		t.Fatalf("The fields should match the schema: %v", err)
+	}
+
+	type unknown struct {
+		Name  string  `yaml:"name"`
+		Items []*item `yaml:"items"`
+		Mode  string  `yaml:"mode"`
+	}
+
+	if err := field.checkFields(reflect.TypeOf(unknown{}), ""); err == nil ||
+		!strings.Contains(err.Error(), "mode field is not described") {
+		t.Fatalf("A field missing in the schema should fail, got: %v", err)
+	}
+
+	type missing struct {
+		Items []struct {
+			Size int    `yaml:"size"`
+			Unit string `yaml:"unit"`
+		} `yaml:"items"`
+		Name string `yaml:"name"`
+	}
+
+	if err := field.checkFields(reflect.TypeOf(missing{}), ""); err == nil ||
+		!strings.Contains(err.Error(), "items[].unit field is not described") {
+		t.Fatalf("The list items fields should be checked, got: %v", err)
+	}
+
+	type partial struct {
+		Items []*item `yaml:"items"`
+	}
+
+	if err := field.checkFields(reflect.TypeOf(partial{}), ""); err == nil ||
+		!strings.Contains(err.Error(), "schema name field is not a configuration field") {
+		t.Fatalf("A schema field missing in the type should fail, got: %v", err)
+	}
+
+	if err := CheckFields(reflect.TypeOf(valid{}), "unknown[]"); err == nil {
+		t.Fatal("An unknown schema path should fail")
+	}
+}
+
+// check validates a decoded YAML value against the field
+func check(f *Field, value interface{}, path string) error {
+	if len(f.OneOf) > 0 {
+		for _, curr := range f.OneOf {
+			if check(curr, value, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: no alternative matches %v", path, value)
+	}
+
+	typ := ""
+	switch value.(type) {
+	case string:
+		typ = TypeString
+	case int, uint64:
+		typ = TypeInteger
+	case bool:
+		typ = TypeBoolean
+	case []interface{}:
+		typ = TypeArray
+	case map[interface{}]interface{}:
+		typ = TypeObject
+	case nil:
+		return nil
+	}
+
+	if len(f.Type) > 0 && !utils.StringSliceContains(f.Type, typ) {
+		return fmt.Errorf("%s: %v is not a %s", path, value, strings.Join(f.Type, " or "))
+	}
+
+	if len(f.Enum) > 0 && !utils.StringSliceContains(f.Enum, fmt.Sprint(value)) {
+		return fmt.Errorf("%s: invalid value %v", path, value)
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for idx, curr := range v {
+			if err := check(f.Items, curr, fmt.Sprintf("%s[%d]", path, idx)); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for key, curr := range v {
+			field := f.Values
+			if field == nil {
+				field = f.Field(fmt.Sprint(key))
+			}
+
+			if field == nil {
+				return fmt.Errorf("%s: unknown field %v", path, key)
+			}
+
+			if err := check(field, curr, fmt.Sprintf("%s.%v", path, key)); err != nil {
+				return err
+			}
+		}
+
+		for _, curr := range f.Fields {
+			if _, ok := v[curr.Name]; curr.Required && !ok {
+				return fmt.Errorf("%s: %s is required", path, curr.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+func TestConfigurations(t *testing.T) {
+	files, err := filepath.Glob("../scripts/*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to list the configurations: %v", err)
+	}
+
+	tests, err := filepath.Glob("../tests/valid*.yaml")
+	if err != nil {
+		t.Fatalf("Failed to list the configurations: %v", err)
+	}
+
+	for _, curr := range append(files, tests...) {
+		content, err := ioutil.ReadFile(curr)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", curr, err)
+		}
+
+		var doc interface{}
+		if err = yaml.Unmarshal(content, &doc); err != nil {
+			t.Fatalf("Failed to parse %s: %v", curr, err)
+		}
+
+		if err = check(Root, doc, ""); err != nil {
+			t.Fatalf("%s does not match the schema: %v", curr, err)
+		}
+	}
+
+	invalid := []string{
+		"bundels: [os-core]",
+		"targetMedia: [{name: sda, type: disk, children: [{name: sda1, type: part, size: 1G}]}]",
+		"bootloader: {backend: grub}",
+		"kernels: [{bundle: kernel-lts, default: maybe}]",
+	}
+
+	for _, curr := range invalid {
+		var doc interface{}
+		if err = yaml.Unmarshal([]byte(curr), &doc); err != nil {
+			t.Fatalf("Failed to parse %s: %v", curr, err)
+		}
+
+		if err = check(Root, doc, ""); err == nil {
+			t.Fatalf("%s should not match the schema", curr)
+		}
+	}
+}
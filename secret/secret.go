@@ -0,0 +1,110 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+// Value is a secret configuration value, either a literal YAML string or a mapping with
+// one of the fromEnv, fromFile or plain keys. Only the fromEnv and fromFile references
+// are ever written back, the literal and plain values are never marshalled.
+type Value struct {
+	FromEnv  string `yaml:"fromEnv,omitempty"`
+	FromFile string `yaml:"fromFile,omitempty"`
+	Plain    string `yaml:"plain,omitempty"`
+	literal  string
+}
+
+// UnmarshalYAML decodes a literal string or a secret mapping
+func (v *Value) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var literal string
+
+	if err := unmarshal(&literal); err == nil {
+		*v = Value{literal: literal}
+		return nil
+	}
+
+	type value Value
+	var result value
+
+	if err := unmarshal(&result); err != nil {
+		return err
+	}
+
+	set := 0
+	for _, curr := range []string{result.FromEnv, result.FromFile, result.Plain} {
+		if curr != "" {
+			set++
+		}
+	}
+
+	if set != 1 {
+		return errors.Errorf("A secret must set exactly one of fromEnv, fromFile or plain")
+	}
+
+	*v = Value(result)
+	return nil
+}
+
+// MarshalYAML writes the secret references only
+func (v Value) MarshalYAML() (interface{}, error) {
+	if v.IsZero() {
+		return nil, nil
+	}
+
+	return struct {
+		FromEnv  string `yaml:"fromEnv,omitempty"`
+		FromFile string `yaml:"fromFile,omitempty"`
+	}{v.FromEnv, v.FromFile}, nil
+}
+
+// IsZero returns true if the value has no reference to write
+func (v Value) IsZero() bool {
+	return v.FromEnv == "" && v.FromFile == ""
+}
+
+// IsLiteral returns true if the value was set as a literal YAML string
+func (v *Value) IsLiteral() bool {
+	return v.FromEnv == "" && v.FromFile == "" && v.Plain == ""
+}
+
+// Resolve returns the secret, a relative secret file is resolved from dir, i.e the
+// configuration file's directory, and its trailing new line is dropped
+func (v *Value) Resolve(dir string) (string, error) {
+	switch {
+	case v.FromEnv != "":
+		value, ok := os.LookupEnv(v.FromEnv)
+		if !ok || value == "" {
+			return "", errors.ValidationErrorf("Environment variable %s is not set", v.FromEnv)
+		}
+		return value, nil
+	case v.FromFile != "":
+		path := v.FromFile
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.ValidationErrorf("Could not read the secret file: %v", err)
+		}
+
+		value := strings.TrimRight(string(content), "\r\n")
+		if value == "" {
+			return "", errors.ValidationErrorf("Secret file %s is empty", v.FromFile)
+		}
+		return value, nil
+	case v.Plain != "":
+		return v.Plain, nil
+	}
+
+	return v.literal, nil
+}
@@ -0,0 +1,108 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package secret
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		doc     string
+		literal bool
+		valid   bool
+	}{
+		{"secret: $6$salt$hash", true, true},
+		{"secret: {fromEnv: PASSWORD}", false, true},
+		{"secret: {fromFile: /run/secrets/password}", false, true},
+		{"secret: {plain: password}", false, true},
+		{"secret: {}", false, false},
+		{"secret: {fromEnv: PASSWORD, plain: password}", false, false},
+		{"secret: {fromenv: PASSWORD}", false, false},
+	}
+
+	for _, curr := range tests {
+		var doc struct {
+			Secret *Value `yaml:"secret"`
+		}
+
+		err := yaml.UnmarshalStrict([]byte(curr.doc), &doc)
+		if (err == nil) != curr.valid {
+			t.Fatalf("Unexpected result decoding %q: %v", curr.doc, err)
+		}
+
+		if err == nil && doc.Secret.IsLiteral() != curr.literal {
+			t.Fatalf("Unexpected literal value decoding %q", curr.doc)
+		}
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	doc := struct {
+		Env     *Value `yaml:"env,omitempty"`
+		Plain   *Value `yaml:"plain,omitempty"`
+		Literal *Value `yaml:"literal,omitempty"`
+	}{&Value{FromEnv: "PASSWORD"}, &Value{Plain: "password"}, &Value{literal: "password"}}
+
+	content, err := yaml.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal the secrets: %v", err)
+	}
+
+	if string(content) != "env:\n  fromEnv: PASSWORD\n" {
+		t.Fatalf("Only the secret references should be written, got: %s", content)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	file, err := ioutil.TempFile("", "secret-")
+	if err != nil {
+		t.Fatalf("Failed to create the secret file: %v", err)
+	}
+	defer func() { _ = os.Remove(file.Name()) }()
+
+	if _, err = file.WriteString("from file\n"); err != nil {
+		t.Fatalf("Failed to write the secret file: %v", err)
+	}
+	_ = file.Close()
+
+	if err = os.Setenv("CLR_INSTALLER_TEST_SECRET", "from env"); err != nil {
+		t.Fatalf("Failed to set the secret variable: %v", err)
+	}
+	defer func() { _ = os.Unsetenv("CLR_INSTALLER_TEST_SECRET") }()
+
+	tests := []struct {
+		value  *Value
+		secret string
+		err    string
+	}{
+		{&Value{literal: "literal"}, "literal", ""},
+		{&Value{Plain: "plain"}, "plain", ""},
+		{&Value{FromEnv: "CLR_INSTALLER_TEST_SECRET"}, "from env", ""},
+		{&Value{FromFile: file.Name()}, "from file", ""},
+		{&Value{FromEnv: "CLR_INSTALLER_TEST_UNSET"}, "", "is not set"},
+		{&Value{FromFile: file.Name() + ".missing"}, "", "Could not read"},
+	}
+
+	for _, curr := range tests {
+		secret, err := curr.value.Resolve("")
+
+		if curr.err != "" {
+			if err == nil || !strings.Contains(err.Error(), curr.err) {
+				t.Fatalf("Expected a %q error, got: %v", curr.err, err)
+			}
+			continue
+		}
+
+		if err != nil || secret != curr.secret {
+			t.Fatalf("Expected the %q secret, got: %q %v", curr.secret, secret, err)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package services
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// DefaultDropInName is the drop-in file name used when none is provided
+const DefaultDropInName = "clr-installer.conf"
+
+var (
+	unitExp = regexp.MustCompile(`^[a-zA-Z0-9:_.\\-]+(@[a-zA-Z0-9:_.\\-]*)?` +
+		`\.(service|socket|timer|target|path|mount|automount|swap|slice|device)$`)
+
+	// unitDirs are the target directories where unit files are looked up
+	unitDirs = []string{
+		"etc/systemd/system",
+		"usr/lib/systemd/system",
+		"lib/systemd/system",
+	}
+)
+
+// DropIn is an override configuration file for a unit
+type DropIn struct {
+	Unit    string `yaml:"unit,omitempty,flow"`
+	Name    string `yaml:"name,omitempty,flow"`
+	Content string `yaml:"content,omitempty,flow"`
+}
+
+// Services describes the systemd units state of the target system
+type Services struct {
+	Enable  []string  `yaml:"enable,omitempty,flow"`
+	Disable []string  `yaml:"disable,omitempty,flow"`
+	Mask    []string  `yaml:"mask,omitempty,flow"`
+	Unmask  []string  `yaml:"unmask,omitempty,flow"`
+	DropIns []*DropIn `yaml:"dropIns,omitempty,flow"`
+}
+
+// IsValidUnitName checks if name is a valid, fully qualified, unit name
+func IsValidUnitName(name string) bool {
+	return unitExp.MatchString(name)
+}
+
+func validateUnits(field string, units []string) error {
+	for idx, curr := range units {
+		if !IsValidUnitName(curr) {
+			return errors.FieldValidationErrorf(fmt.Sprintf("%s[%d]", field, idx),
+				"Invalid unit name: %s", curr)
+		}
+	}
+
+	return nil
+}
+
+// Validate checks the unit names and drop-ins are valid and no unit is requested
+// conflicting states, the units existence is only checked against the target
+func (s *Services) Validate() error {
+	lists := []struct {
+		field string
+		units []string
+	}{
+		{"enable", s.Enable},
+		{"disable", s.Disable},
+		{"mask", s.Mask},
+		{"unmask", s.Unmask},
+	}
+
+	for _, curr := range lists {
+		if err := validateUnits(curr.field, curr.units); err != nil {
+			return err
+		}
+	}
+
+	conflicts := []struct {
+		field string
+		units []string
+		other []string
+	}{
+		{"disable", s.Disable, s.Enable},
+		{"mask", s.Mask, s.Enable},
+		{"unmask", s.Unmask, s.Mask},
+	}
+
+	for _, curr := range conflicts {
+		for _, unit := range curr.units {
+			if utils.StringSliceContains(curr.other, unit) {
+				return errors.FieldValidationErrorf(curr.field, "Conflicting states requested for unit: %s", unit)
+			}
+		}
+	}
+
+	for idx, curr := range s.DropIns {
+		field := fmt.Sprintf("dropIns[%d]", idx)
+
+		if curr == nil {
+			return errors.FieldValidationErrorf(field, "Empty drop-in")
+		}
+
+		if !IsValidUnitName(curr.Unit) {
+			return errors.FieldValidationErrorf(field+".unit", "Invalid unit name: %s", curr.Unit)
+		}
+
+		if strings.Contains(curr.Name, "/") || curr.Name == "." || curr.Name == ".." {
+			return errors.FieldValidationErrorf(field+".name", "Invalid drop-in name: %s", curr.Name)
+		}
+
+		if curr.Content == "" {
+			return errors.FieldValidationErrorf(field+".content", "A drop-in must provide a content")
+		}
+	}
+
+	return nil
+}
+
+// unitExists checks if a unit file, or the template of an instance, is installed in rootDir
+func unitExists(rootDir string, unit string) (bool, error) {
+	names := []string{unit}
+
+	// an instance is provided by its template unit
+	if idx := strings.Index(unit, "@"); idx > 0 {
+		names = append(names, unit[:idx+1]+unit[strings.LastIndex(unit, "."):])
+	}
+
+	for _, dir := range unitDirs {
+		for _, name := range names {
+			ok, err := utils.FileExists(filepath.Join(rootDir, dir, name))
+			if err != nil {
+				return false, err
+			}
+
+			if ok {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// CheckUnits returns an error listing the referenced units not installed in rootDir,
+// masked units may not be installed, as with systemctl
+func (s *Services) CheckUnits(rootDir string) error {
+	units := []string{}
+	units = append(units, s.Enable...)
+	units = append(units, s.Disable...)
+	units = append(units, s.Unmask...)
+
+	for _, curr := range s.DropIns {
+		units = append(units, curr.Unit)
+	}
+
+	missing := []string{}
+
+	for _, curr := range units {
+		ok, err := unitExists(rootDir, curr)
+		if err != nil {
+			return err
+		}
+
+		if !ok && !utils.StringSliceContains(missing, curr) {
+			missing = append(missing, curr)
+		}
+	}
+
+	if len(missing) > 0 {
+		return errors.Errorf("Units not found in the target system: %s (missing bundles?)",
+			strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// writeDropIns writes the unit drop-ins to the target's /etc/systemd/system
+func (s *Services) writeDropIns(rootDir string) error {
+	for _, curr := range s.DropIns {
+		name := curr.Name
+		if name == "" {
+			name = DefaultDropInName
+		}
+
+		if !strings.HasSuffix(name, ".conf") {
+			name = name + ".conf"
+		}
+
+		dir := filepath.Join(rootDir, "etc", "systemd", "system", curr.Unit+".d")
+		if err := utils.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+
+		log.Debug("Writing %s drop-in: %s", curr.Unit, name)
+
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(curr.Content), 0644); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	return nil
+}
+
+func systemctl(rootDir string, action string, units []string) error {
+	if len(units) == 0 {
+		return nil
+	}
+
+	args := []string{"systemctl", fmt.Sprintf("--root=%s", rootDir), action}
+	args = append(args, units...)
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.Errorf("Failed to %s units %s: %v", action, strings.Join(units, ", "), err)
+	}
+
+	return nil
+}
+
+// Apply checks the referenced units are installed and applies the units state
+// offline against rootDir with the host's systemctl
+func (s *Services) Apply(rootDir string) error {
+	if err := s.CheckUnits(rootDir); err != nil {
+		return err
+	}
+
+	if err := systemctl(rootDir, "unmask", s.Unmask); err != nil {
+		return err
+	}
+
+	if err := s.writeDropIns(rootDir); err != nil {
+		return err
+	}
+
+	steps := []struct {
+		action string
+		units  []string
+	}{
+		{"enable", s.Enable},
+		{"disable", s.Disable},
+		{"mask", s.Mask},
+	}
+
+	for _, curr := range steps {
+		if err := systemctl(rootDir, curr.action, curr.units); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package services
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		services *Services
+		field    string
+	}{
+		{&Services{Enable: []string{"sshd.socket", "getty@tty2.service"}, Mask: []string{"tallow.service"}}, ""},
+		{&Services{DropIns: []*DropIn{{Unit: "sshd.service", Content: "[Service]\n"}}}, ""},
+		{&Services{Enable: []string{"sshd"}}, "enable[0]"},
+		{&Services{Disable: []string{"a.service", "b/c.service"}}, "disable[1]"},
+		{&Services{Enable: []string{"sshd.socket"}, Mask: []string{"sshd.socket"}}, "mask"},
+		{&Services{Enable: []string{"sshd.socket"}, Disable: []string{"sshd.socket"}}, "disable"},
+		{&Services{Mask: []string{"sshd.socket"}, Unmask: []string{"sshd.socket"}}, "unmask"},
+		{&Services{DropIns: []*DropIn{nil}}, "dropIns[0]"},
+		{&Services{DropIns: []*DropIn{{Unit: "sshd", Content: "x"}}}, "dropIns[0].unit"},
+		{&Services{DropIns: []*DropIn{{Unit: "sshd.service", Name: "../x", Content: "x"}}}, "dropIns[0].name"},
+		{&Services{DropIns: []*DropIn{{Unit: "sshd.service"}}}, "dropIns[0].content"},
+	}
+
+	for _, curr := range tests {
+		err := curr.services.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("Services %+v should be valid: %v", curr.services, err)
+			}
+			continue
+		}
+
+		ve, ok := err.(errors.ValidationError)
+		if !ok || ve.Field != curr.field {
+			t.Fatalf("Expected a validation error for %q, got: %v", curr.field, err)
+		}
+	}
+}
+
+func createUnits(t *testing.T, units ...string) string {
+	rootDir, err := ioutil.TempDir("", "services-root-")
+	if err != nil {
+		t.Fatalf("Failed to create root dir: %v", err)
+	}
+
+	unitDir := filepath.Join(rootDir, "usr", "lib", "systemd", "system")
+	if err = os.MkdirAll(unitDir, 0755); err != nil {
+		t.Fatalf("Failed to create unit dir: %v", err)
+	}
+
+	for _, curr := range units {
+		if err = ioutil.WriteFile(filepath.Join(unitDir, curr), []byte("[Unit]\n"), 0644); err != nil {
+			t.Fatalf("Failed to write unit: %v", err)
+		}
+	}
+
+	return rootDir
+}
+
+func TestCheckUnits(t *testing.T) {
+	rootDir := createUnits(t, "sshd.socket", "sshd.service", "getty@.service")
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	s := &Services{
+		Enable:  []string{"sshd.socket", "getty@tty2.service"},
+		Mask:    []string{"not-installed.service"},
+		DropIns: []*DropIn{{Unit: "sshd.service", Content: "x"}},
+	}
+
+	if err := s.CheckUnits(rootDir); err != nil {
+		t.Fatalf("Installed units should be found: %v", err)
+	}
+
+	s.Disable = []string{"tallow.service"}
+	s.DropIns = append(s.DropIns, &DropIn{Unit: "docker.service", Content: "x"})
+
+	err := s.CheckUnits(rootDir)
+	if err == nil || !strings.Contains(err.Error(), "tallow.service, docker.service") {
+		t.Fatalf("Missing units should be reported, got: %v", err)
+	}
+}
+
+func TestApplyDropIns(t *testing.T) {
+	rootDir := createUnits(t, "sshd.service")
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	s := &Services{
+		DropIns: []*DropIn{
+			{Unit: "sshd.service", Content: "[Service]\nNice=5\n"},
+			{Unit: "sshd.service", Name: "limits", Content: "[Service]\nLimitNOFILE=4096\n"},
+		},
+	}
+
+	if err := s.Apply(rootDir); err != nil {
+		t.Fatalf("Failed to apply drop-ins: %v", err)
+	}
+
+	dir := filepath.Join(rootDir, "etc", "systemd", "system", "sshd.service.d")
+
+	for name, content := range map[string]string{
+		DefaultDropInName: "[Service]\nNice=5\n",
+		"limits.conf":     "[Service]\nLimitNOFILE=4096\n",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to read drop-in %s: %v", name, err)
+		}
+
+		if string(data) != content {
+			t.Fatalf("Unexpected drop-in %s content: %q", name, string(data))
+		}
+	}
+
+	s.Enable = []string{"missing.service"}
+	if err := s.Apply(rootDir); err == nil {
+		t.Fatal("Apply should fail for a missing unit")
+	}
+}
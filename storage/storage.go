@@ -418,18 +418,21 @@ func (bd *BlockDevice) DeviceHasSwap() bool {
 	return hasSwap
 }
 
-// Validate checks if the minimal requirements for a installation is met
+// Validate checks if the minimal requirements for a installation is met, the
+// field path of the returned validation errors is relative to bd
 func (bd *BlockDevice) Validate(legacyBios bool, cryptPass string) error {
 	bootPartition := false
 	rootPartition := false
 	encrypted := false
 
-	for _, ch := range bd.Children {
+	for idx, ch := range bd.Children {
+		field := fmt.Sprintf("children[%d]", idx)
+
 		if ch.FsType == "vfat" && ch.MountPoint == "/boot" {
 			bootPartition = true
 
 			if ch.Type == BlockDeviceTypeCrypt {
-				return errors.Errorf("Encryption of /boot is not supported")
+				return errors.FieldValidationErrorf(field, "Encryption of /boot is not supported")
 			}
 		}
 
@@ -442,20 +445,20 @@ func (bd *BlockDevice) Validate(legacyBios bool, cryptPass string) error {
 		}
 
 		if bd.Type != BlockDeviceTypeDisk && bd.Size == 0 && ch.Size == 0 {
-			return errors.Errorf("Both image size and partition size cannot be 0")
+			return errors.FieldValidationErrorf(field+".size", "Both image size and partition size cannot be 0")
 		}
 	}
 
 	if !bootPartition && !legacyBios {
-		return errors.Errorf("Could not find a suitable EFI partition")
+		return errors.FieldValidationErrorf("children", "Could not find a suitable EFI partition")
 	}
 
 	if !rootPartition {
-		return errors.Errorf("Could not find a root partition")
+		return errors.FieldValidationErrorf("children", "Could not find a root partition")
 	}
 
 	if encrypted && cryptPass == "" {
-		return errors.Errorf("Encrypted file system enabled, but missing passphase")
+		return errors.ValidationErrorf("Encrypted file system enabled, but missing passphase")
 	}
 
 	return nil
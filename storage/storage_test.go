@@ -9,11 +9,13 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
+	"reflect"
 	"testing"
 	"text/template"
 	"time"
 
 	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/schema"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
@@ -1016,3 +1018,9 @@ func TestAddPartititions(t *testing.T) {
 	rootSize := uint64(bd.Size - bootSize - swapSize)
 	AddRootStandardPartition(bd, rootSize)
 }
+
+func TestSchemaFields(t *testing.T) {
+	if err := schema.CheckFields(reflect.TypeOf(blockDeviceYAMLMarshal{}), "targetMedia[]"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/clearlinux/clr-installer/args"
@@ -20,6 +21,7 @@ import (
 	"github.com/clearlinux/clr-installer/conf"
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/metrics"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/network"
 	"github.com/clearlinux/clr-installer/progress"
@@ -82,6 +84,23 @@ var (
 	}
 	prg     progress.Progress
 	prgDesc string
+
+	// downloadedExp matches the swupd messages reporting the amount of downloaded
+	// content, i.e: "Downloading packs (4.12 Mb) for:" or "Downloaded 230 KB"
+	downloadedExp = regexp.MustCompile(`(?i)download(?:ed|ing)?\D*?([0-9]+(?:\.[0-9]+)?)\s*([KMGT]?i?B)\b`)
+
+	sizeUnits = map[string]float64{
+		"B":  1,
+		"KB": 1000,
+		"MB": 1000 * 1000,
+		"GB": 1000 * 1000 * 1000,
+		"TB": 1000 * 1000 * 1000 * 1000,
+
+		"KIB": 1024,
+		"MIB": 1024 * 1024,
+		"GIB": 1024 * 1024 * 1024,
+		"TIB": 1024 * 1024 * 1024 * 1024,
+	}
 )
 
 // SoftwareUpdater abstracts the swupd executable, environment and operations
@@ -141,6 +160,11 @@ func (m Message) Process(line string) {
 		return
 	}
 
+	if size, ok := parseDownloadedBytes(m.Msg); ok {
+		log.Debug("swupd downloaded %d bytes", size)
+		metrics.AddDownloadedBytes(size)
+	}
+
 	if m.Type == "progress" {
 		// "pretty" descriptions for steps
 		switch m.StepDescription {
@@ -180,6 +204,27 @@ func (m Message) Process(line string) {
 
 }
 
+// parseDownloadedBytes parses a swupd message reporting an amount of downloaded
+// content and returns its size in bytes
+func parseDownloadedBytes(msg string) (uint64, bool) {
+	match := downloadedExp.FindStringSubmatch(msg)
+	if len(match) != 3 {
+		return 0, false
+	}
+
+	size, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+
+	mult, ok := sizeUnits[strings.ToUpper(match[2])]
+	if !ok {
+		return 0, false
+	}
+
+	return uint64(size * mult), true
+}
+
 // IsCoreBundle checks if bundle is in the list of core bundles
 func IsCoreBundle(bundle string) bool {
 	for _, curr := range CoreBundles {
@@ -378,6 +423,28 @@ func (s *SoftwareUpdater) VerifyWithBundles(version string, mirror string, bundl
 	return nil
 }
 
+// VerifyInstall runs "swupd verify" checking the installed content matches the
+// manifests without fixing it, an error is returned if there is any mismatch
+func (s *SoftwareUpdater) VerifyInstall() error {
+	args := []string{
+		"swupd",
+		"verify",
+	}
+
+	args = s.setExtraFlags(args)
+
+	args = append(args,
+		fmt.Sprintf("--path=%s", s.rootDir),
+		fmt.Sprintf("--statedir=%s", s.stateDir),
+	)
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.Wrap(err)
+	}
+
+	return nil
+}
+
 // DisableUpdate executes the "systemctl" to disable auto update operation
 // "swupd autoupdate" currently does not --path
 // See Issue https://github.com/clearlinux/swupd-client/issues/527
@@ -189,3 +189,30 @@ func TestProcess(t *testing.T) {
 		t.Fatal("Message processed incorrectly. Expected: success, Actual:", mp.output)
 	}
 }
+
+func TestParseDownloadedBytes(t *testing.T) {
+	tests := []struct {
+		msg   string
+		size  uint64
+		valid bool
+	}{
+		{"Downloading packs (4.5 Mb) for:", 4500000, true},
+		{"Downloaded 230 KB", 230000, true},
+		{"Downloading 12 bytes", 0, false},
+		{"Downloaded 2 GiB of content", 2 * 1024 * 1024 * 1024, true},
+		{"Downloading packs (1.5 MiB) for:", 1572864, true},
+		{"Installing files...", 0, false},
+		{"Downloading 3 missing files", 0, false},
+	}
+
+	for _, curr := range tests {
+		size, ok := parseDownloadedBytes(curr.msg)
+		if ok != curr.valid {
+			t.Fatalf("parseDownloadedBytes(%q) should return %v, got: %v", curr.msg, curr.valid, ok)
+		}
+
+		if size != curr.size {
+			t.Fatalf("parseDownloadedBytes(%q) should return %d, got: %d", curr.msg, curr.size, size)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/conf"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// SignatureSuffix is appended to a remote configuration url to fetch its detached signature
+	SignatureSuffix = ".sig"
+
+	// SignatureNamespace is the namespace of the ssh signatures, as in: ssh-keygen -Y sign -n
+	SignatureNamespace = "clr-installer"
+
+	checksumPrefix  = ",sha256="
+	sshSignature    = "-----BEGIN SSH SIGNATURE-----"
+	sshKeyExt       = ".pub"
+	gpgKeyringExt   = ".gpg"
+	signerPrincipal = "clr-installer"
+)
+
+// the policy file and trusted keys directory lookups, replaced by the tests
+var (
+	lookupPolicy  = conf.LookupConfigPolicy
+	lookupKeysDir = conf.LookupTrustedKeysDir
+)
+
+// Policy is the remote configuration files verification policy
+type Policy struct {
+	RequireSignature bool `yaml:"requireSignature"`
+}
+
+// Descriptor is a remote configuration file reference, the kernel parameter value
+// <url>[,sha256=<hex digest>]
+type Descriptor struct {
+	URL    string
+	SHA256 string
+}
+
+// ParseDescriptor parses a remote configuration file reference
+func ParseDescriptor(value string) (*Descriptor, error) {
+	result := &Descriptor{URL: value}
+
+	if idx := strings.LastIndex(value, checksumPrefix); idx >= 0 {
+		result.URL = value[:idx]
+		result.SHA256 = strings.ToLower(value[idx+len(checksumPrefix):])
+
+		if sum, err := hex.DecodeString(result.SHA256); err != nil || len(sum) != sha256.Size {
+			return nil, errors.ValidationErrorf("Invalid sha256 checksum: %s", result.SHA256)
+		}
+	}
+
+	if result.URL == "" {
+		return nil, errors.ValidationErrorf("Missing configuration file url")
+	}
+
+	return result, nil
+}
+
+// LoadPolicy loads the verification policy, the default policy accepts unsigned files
+func LoadPolicy() (*Policy, error) {
+	result := &Policy{}
+
+	path, err := lookupPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	if ok, _ := utils.FileExists(path); !ok {
+		return result, nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	if err = yaml.UnmarshalStrict(content, result); err != nil {
+		return nil, errors.Errorf("Invalid policy file %s: %v", path, err)
+	}
+
+	return result, nil
+}
+
+// TrustedKeys returns the ssh public keys (.pub) and gpg keyrings (.gpg) of the trusted
+// keys directory followed by the extra keys
+func TrustedKeys(extra []string) ([]string, error) {
+	dir, err := lookupKeysDir()
+	if err != nil {
+		return nil, err
+	}
+
+	result := []string{}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err)
+	}
+
+	for _, curr := range files {
+		ext := filepath.Ext(curr.Name())
+
+		if !curr.IsDir() && (ext == sshKeyExt || ext == gpgKeyringExt) {
+			result = append(result, filepath.Join(dir, curr.Name()))
+		}
+	}
+
+	return append(result, extra...), nil
+}
+
+// VerifyChecksum checks the sha256 checksum of the file
+func VerifyChecksum(path string, sum string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return errors.Wrap(err)
+	}
+
+	if actual := hex.EncodeToString(h.Sum(nil)); actual != strings.ToLower(sum) {
+		return errors.ValidationErrorf("Checksum mismatch, expected sha256 %s got %s", sum, actual)
+	}
+
+	return nil
+}
+
+// VerifySignature checks the detached signature of the file against the trusted keys, an
+// ssh signature (ssh-keygen -Y sign -n clr-installer) is checked against the ssh keys and
+// any other signature against the gpg keyrings
+func VerifySignature(path string, signature string, keys []string) error {
+	content, err := ioutil.ReadFile(signature)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	if strings.HasPrefix(strings.TrimSpace(string(content)), sshSignature) {
+		return verifySSHSignature(path, signature, filterKeys(keys, sshKeyExt))
+	}
+
+	return verifyGPGSignature(path, signature, filterKeys(keys, gpgKeyringExt))
+}
+
+func filterKeys(keys []string, ext string) []string {
+	result := []string{}
+
+	for _, curr := range keys {
+		if filepath.Ext(curr) == ext {
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
+
+// verifySSHSignature checks an ssh signature, ssh-keygen takes the trusted keys as an
+// allowed signers file
+func verifySSHSignature(path string, signature string, keys []string) error {
+	if len(keys) == 0 {
+		return errors.ValidationErrorf("No trusted ssh key to check the signature against")
+	}
+
+	signers := []string{}
+	for _, key := range keys {
+		content, err := ioutil.ReadFile(key)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+
+			if line != "" && !strings.HasPrefix(line, "#") {
+				signers = append(signers, fmt.Sprintf("%s %s", signerPrincipal, line))
+			}
+		}
+	}
+
+	allowed, err := ioutil.TempFile("", "clr-installer-signers-")
+	if err != nil {
+		return errors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(allowed.Name()) }()
+
+	_, err = allowed.WriteString(strings.Join(signers, "\n") + "\n")
+	if cerr := allowed.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	args := []string{
+		"ssh-keygen",
+		"-Y",
+		"verify",
+		"-f",
+		allowed.Name(),
+		"-I",
+		signerPrincipal,
+		"-n",
+		SignatureNamespace,
+		"-s",
+		signature,
+	}
+
+	if err = cmd.PipeRunAndLog(string(content), args...); err != nil {
+		return errors.ValidationErrorf("Invalid ssh signature: %v", err)
+	}
+
+	return nil
+}
+
+// verifyGPGSignature checks a gpg signature against the binary keyrings
+func verifyGPGSignature(path string, signature string, keyrings []string) error {
+	if len(keyrings) == 0 {
+		return errors.ValidationErrorf("No trusted gpg keyring to check the signature against")
+	}
+
+	args := []string{"gpgv"}
+
+	for _, curr := range keyrings {
+		abs, err := filepath.Abs(curr)
+		if err != nil {
+			return errors.Wrap(err)
+		}
+
+		// gpgv looks relative keyrings up in its home directory
+		args = append(args, "--keyring", abs)
+	}
+
+	args = append(args, signature, path)
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		return errors.ValidationErrorf("Invalid gpg signature: %v", err)
+	}
+
+	return nil
+}
+
+// FetchConfigFile downloads the remote configuration file and verifies it, returning the
+// downloaded file path. The checksum is checked when the descriptor has one. The url's
+// detached signature is checked when available, a missing signature is refused when the
+// policy requires signatures or keys are given.
+func FetchConfigFile(desc *Descriptor, keys []string) (string, error) {
+	policy, err := LoadPolicy()
+	if err != nil {
+		return "", err
+	}
+
+	trusted, err := TrustedKeys(keys)
+	if err != nil {
+		return "", err
+	}
+
+	return fetchConfigFile(desc, policy.RequireSignature || len(keys) > 0, trusted)
+}
+
+// FetchSignedConfigFile downloads the remote configuration file and verifies it as
+// FetchConfigFile does, but the signature is required whatever the policy says and the
+// configuration is refused if there is no trusted key to check it with.
+func FetchSignedConfigFile(desc *Descriptor, keys []string) (string, error) {
+	trusted, err := TrustedKeys(keys)
+	if err != nil {
+		return "", err
+	}
+
+	if len(trusted) == 0 {
+		return "", errors.ValidationErrorf("Refusing the configuration file %s, no trusted key to verify it",
+			desc.URL)
+	}
+
+	return fetchConfigFile(desc, true, trusted)
+}
+
+func fetchConfigFile(desc *Descriptor, requireSignature bool, keys []string) (string, error) {
+	path, err := network.FetchRemoteConfigFile(desc.URL)
+	if err != nil {
+		return "", err
+	}
+
+	if err = verifyConfigFile(desc, path, requireSignature, keys); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+
+	return path, nil
+}
+
+func verifyConfigFile(desc *Descriptor, path string, requireSignature bool, keys []string) error {
+	if desc.SHA256 != "" {
+		if err := VerifyChecksum(path, desc.SHA256); err != nil {
+			return err
+		}
+		log.Info("Configuration file %s sha256 checksum verified", desc.URL)
+	}
+
+	signature, err := network.FetchRemoteConfigFile(desc.URL + SignatureSuffix)
+	if err != nil {
+		if requireSignature {
+			return errors.ValidationErrorf("Refusing the unsigned configuration file %s", desc.URL)
+		}
+
+		log.Warning("Configuration file %s is not signed", desc.URL)
+		return nil
+	}
+	defer func() { _ = os.Remove(signature) }()
+
+	if err = VerifySignature(path, signature, keys); err != nil {
+		return err
+	}
+
+	log.Info("Configuration file %s signature verified", desc.URL)
+	return nil
+}
@@ -0,0 +1,267 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/cmd"
+)
+
+const configContent = "keyboard: us\n"
+
+func configSum() string {
+	sum := sha256.Sum256([]byte(configContent))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestParseDescriptor(t *testing.T) {
+	sum := configSum()
+
+	tests := []struct {
+		value  string
+		url    string
+		sha256 string
+		valid  bool
+	}{
+		{"http://host/c.yaml", "http://host/c.yaml", "", true},
+		{"http://host/c.yaml?a=b,sha256=" + sum, "http://host/c.yaml?a=b", sum, true},
+		{"http://host/c.yaml,sha256=" + strings.ToUpper(sum), "http://host/c.yaml", sum, true},
+		{"http://host/c.yaml,sha256=abcd", "", "", false},
+		{"http://host/c.yaml,sha256=", "", "", false},
+		{",sha256=" + sum, "", "", false},
+	}
+
+	for _, curr := range tests {
+		desc, err := ParseDescriptor(curr.value)
+
+		if !curr.valid {
+			if err == nil {
+				t.Fatalf("Parsing %q should fail", curr.value)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", curr.value, err)
+		}
+
+		if desc.URL != curr.url || desc.SHA256 != curr.sha256 {
+			t.Fatalf("Parsing %q should result in %q %q, got: %q %q", curr.value, curr.url, curr.sha256,
+				desc.URL, desc.SHA256)
+		}
+	}
+}
+
+// setupTrust creates a signed configuration file with an ssh key, the trusted keys
+// directory and the policy file, skipping the test if ssh-keygen can't sign
+func setupTrust(t *testing.T, requireSignature bool) (string, func()) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen is not available")
+	}
+
+	dir, err := ioutil.TempDir("", "trust-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+
+	keysDir := filepath.Join(dir, "keys")
+	policy := filepath.Join(dir, "policy.yaml")
+	savedPolicy, savedKeysDir := lookupPolicy, lookupKeysDir
+
+	cleanup := func() {
+		lookupPolicy, lookupKeysDir = savedPolicy, savedKeysDir
+		_ = os.RemoveAll(dir)
+	}
+
+	lookupPolicy = func() (string, error) { return policy, nil }
+	lookupKeysDir = func() (string, error) { return keysDir, nil }
+
+	content := "requireSignature: false\n"
+	if requireSignature {
+		content = "requireSignature: true\n"
+	}
+
+	for _, curr := range []struct {
+		path    string
+		content string
+	}{
+		{policy, content},
+		{filepath.Join(dir, "config.yaml"), configContent},
+		{filepath.Join(dir, "unsigned.yaml"), configContent},
+	} {
+		if err = ioutil.WriteFile(curr.path, []byte(curr.content), 0644); err != nil {
+			cleanup()
+			t.Fatalf("Failed to write %s: %v", curr.path, err)
+		}
+	}
+
+	if err = os.Mkdir(keysDir, 0755); err != nil {
+		cleanup()
+		t.Fatalf("Failed to create the keys directory: %v", err)
+	}
+
+	for _, curr := range [][]string{
+		{"ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", filepath.Join(dir, "trusted")},
+		{"ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-f", filepath.Join(dir, "other")},
+		{"ssh-keygen", "-Y", "sign", "-f", filepath.Join(dir, "trusted"), "-n", SignatureNamespace,
+			filepath.Join(dir, "config.yaml")},
+	} {
+		if err = cmd.RunAndLog(curr...); err != nil {
+			cleanup()
+			t.Skipf("ssh-keygen can't sign files: %v", err)
+		}
+	}
+
+	if err = os.Rename(filepath.Join(dir, "trusted.pub"), filepath.Join(keysDir, "trusted.pub")); err != nil {
+		cleanup()
+		t.Fatalf("Failed to install the trusted key: %v", err)
+	}
+
+	return dir, cleanup
+}
+
+func TestVerifySignature(t *testing.T) {
+	dir, cleanup := setupTrust(t, false)
+	defer cleanup()
+
+	config := filepath.Join(dir, "config.yaml")
+	signature := config + SignatureSuffix
+
+	keys, err := TrustedKeys(nil)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected the trusted key, got: %v %v", keys, err)
+	}
+
+	if err = VerifySignature(config, signature, keys); err != nil {
+		t.Fatalf("The signature should be valid: %v", err)
+	}
+
+	if err = VerifySignature(config, signature, []string{filepath.Join(dir, "other.pub")}); err == nil {
+		t.Fatal("A signature of an untrusted key should fail")
+	}
+
+	if err = VerifySignature(config, signature, []string{filepath.Join(dir, "keyring.gpg")}); err == nil {
+		t.Fatal("An ssh signature should not be checked against gpg keyrings")
+	}
+
+	if err = ioutil.WriteFile(config, []byte("keyboard: fr\n"), 0644); err != nil {
+		t.Fatalf("Failed to tamper the configuration file: %v", err)
+	}
+
+	if err = VerifySignature(config, signature, keys); err == nil {
+		t.Fatal("The signature of a modified file should fail")
+	}
+}
+
+func TestFetchConfigFile(t *testing.T) {
+	dir, cleanup := setupTrust(t, false)
+	defer cleanup()
+
+	fetch := func(name string, sum string, keys []string) error {
+		path, err := FetchConfigFile(&Descriptor{URL: "file://" + filepath.Join(dir, name), SHA256: sum}, keys)
+		if err == nil {
+			_ = os.Remove(path)
+		}
+		return err
+	}
+
+	if err := fetch("config.yaml", configSum(), nil); err != nil {
+		t.Fatalf("The signed configuration file should be accepted: %v", err)
+	}
+
+	if err := fetch("unsigned.yaml", configSum(), nil); err != nil {
+		t.Fatalf("Unsigned configuration files should be accepted by default: %v", err)
+	}
+
+	if err := fetch("config.yaml", strings.Repeat("0", 64), nil); err == nil {
+		t.Fatal("A checksum mismatch should fail")
+	}
+
+	if err := fetch("unsigned.yaml", "", []string{filepath.Join(dir, "other.pub")}); err == nil {
+		t.Fatal("An unsigned configuration file should be refused when keys are given")
+	}
+
+	if err := fetch("config.yaml", "", []string{filepath.Join(dir, "other.pub")}); err != nil {
+		t.Fatalf("The trusted keys directory should still apply with extra keys: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "policy.yaml"), []byte("requireSignature: true\n"),
+		0644); err != nil {
+		t.Fatalf("Failed to write the policy file: %v", err)
+	}
+
+	if err := fetch("unsigned.yaml", configSum(), nil); err == nil ||
+		!strings.Contains(err.Error(), "unsigned") {
+		t.Fatalf("The policy should refuse unsigned configuration files, got: %v", err)
+	}
+
+	if err := fetch("config.yaml", "", nil); err != nil {
+		t.Fatalf("The policy should accept signed configuration files: %v", err)
+	}
+}
+
+func TestFetchSignedConfigFile(t *testing.T) {
+	dir, cleanup := setupTrust(t, false)
+	defer cleanup()
+
+	fetch := func(name string) error {
+		path, err := FetchSignedConfigFile(&Descriptor{URL: "file://" + filepath.Join(dir, name)}, nil)
+		if err == nil {
+			_ = os.Remove(path)
+		}
+		return err
+	}
+
+	if err := fetch("config.yaml"); err != nil {
+		t.Fatalf("The signed configuration file should be accepted: %v", err)
+	}
+
+	if err := fetch("unsigned.yaml"); err == nil || !strings.Contains(err.Error(), "unsigned") {
+		t.Fatalf("Unsigned configuration files should be refused whatever the policy, got: %v", err)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "keys")); err != nil {
+		t.Fatalf("Failed to remove the trusted keys: %v", err)
+	}
+
+	if err := fetch("config.yaml"); err == nil || !strings.Contains(err.Error(), "no trusted key") {
+		t.Fatalf("The configuration file should be refused without trusted keys, got: %v", err)
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir, cleanup := setupTrust(t, true)
+	defer cleanup()
+
+	policy, err := LoadPolicy()
+	if err != nil || !policy.RequireSignature {
+		t.Fatalf("The policy should require signatures, got: %v %v", policy, err)
+	}
+
+	if err = ioutil.WriteFile(filepath.Join(dir, "policy.yaml"), []byte("requireSignatures: true\n"),
+		0644); err != nil {
+		t.Fatalf("Failed to write the policy file: %v", err)
+	}
+
+	if _, err = LoadPolicy(); err == nil {
+		t.Fatal("An unknown policy field should fail")
+	}
+
+	if err = os.Remove(filepath.Join(dir, "policy.yaml")); err != nil {
+		t.Fatalf("Failed to remove the policy file: %v", err)
+	}
+
+	if policy, err = LoadPolicy(); err != nil || policy.RequireSignature {
+		t.Fatalf("A missing policy should not require signatures, got: %v %v", policy, err)
+	}
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/VladimirMarkelov/clui"
 	term "github.com/nsf/termbox-go"
 
+	"github.com/clearlinux/clr-installer/files"
 	"github.com/clearlinux/clr-installer/model"
 	"github.com/clearlinux/clr-installer/storage"
 )
@@ -26,6 +27,8 @@ type ConfirmInstallDialog struct {
 	modelSI       *model.SystemInstall
 	warningLabel  *clui.Label
 	mediaLabel    *clui.Label
+	filesLabel    *clui.Label
+	cmdlineLabel  *clui.Label
 	cancelButton  *SimpleButton
 	confirmButton *SimpleButton
 }
@@ -55,7 +58,17 @@ func initConfirmDiaglogWindow(dialog *ConfirmInstallDialog) error {
 	const wBuff = 5
 	const hBuff = 5
 	const dWidth = 50
-	const dHeight = 8
+	dHeight := 8
+
+	// make room for the list of files to be written
+	if len(dialog.modelSI.Files) > 0 {
+		dHeight += 2
+	}
+
+	// make room for the effective kernel command line
+	if dialog.modelSI.KernelCmdline() != "" {
+		dHeight += 3
+	}
 
 	sw, sh := clui.ScreenSize()
 
@@ -116,6 +129,17 @@ func initConfirmDiaglogWindow(dialog *ConfirmInstallDialog) error {
 		dialog.mediaLabel.SetBackColor(term.ColorRed)
 	}
 
+	if len(dialog.modelSI.Files) > 0 {
+		paths := strings.Join(files.Paths(dialog.modelSI.Files), ", ")
+		dialog.filesLabel = clui.CreateLabel(borderFrame, 1, 1, "Files"+": "+paths, 1)
+		dialog.filesLabel.SetMultiline(true)
+	}
+
+	if cmdline := dialog.modelSI.KernelCmdline(); cmdline != "" {
+		dialog.cmdlineLabel = clui.CreateLabel(borderFrame, 1, 2, "Kernel command line"+": "+cmdline, 1)
+		dialog.cmdlineLabel.SetMultiline(true)
+	}
+
 	buttonFrame := clui.CreateFrame(borderFrame, AutoSize, 1, clui.BorderNone, clui.Fixed)
 	buttonFrame.SetPack(clui.Horizontal)
 	buttonFrame.SetGaps(1, 0)
@@ -9,6 +9,11 @@ import (
 	"strings"
 
 	"github.com/VladimirMarkelov/clui"
+	term "github.com/nsf/termbox-go"
+
+	"github.com/clearlinux/clr-installer/bootloader"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/log"
 )
 
 // KernelCMDLine is the Page implementation for the kernel cmd line configuration page
@@ -16,13 +21,19 @@ type KernelCMDLine struct {
 	BasePage
 	addKernelArgEdit *clui.EditField
 	remKernelArgEdit *clui.EditField
+	previewLabel     *clui.Label
+	hintLabel        *clui.Label
 }
 
 const (
 	kernelArgsHelp = `Note: The boot manager tool will first include the "Add Extra Arguments"
       items, then the "Remove Arguments" items are removed. The final
       argument list contains the kernel bundle's configured arguments
-      and the ones configured by the user.`
+      and the ones configured by the user. Press Ctrl+Space to complete
+      the known parameters.`
+
+	// kernelArgsMaxHints is the maximum number of parameters described by the hint
+	kernelArgsMaxHints = 3
 )
 
 // GetConfiguredValue Returns the string representation of currently value set
@@ -53,8 +64,57 @@ func (pp *KernelCMDLine) GetConfiguredValue() string {
 	return result
 }
 
+// previewText returns the boot entry command line of the selected kernel
+func (pp *KernelCMDLine) previewText() string {
+	cmdline := pp.getModel().KernelCmdline()
+
+	if cmdline == "" {
+		return ""
+	}
+
+	return "Boot entry: " + cmdline
+}
+
+// showHint describes the known parameters matching the last edited argument
+func (pp *KernelCMDLine) showHint(edit *clui.EditField) {
+	_, matches := kernel.Complete(edit.Title())
+
+	hints := []string{}
+	for idx, curr := range matches {
+		if idx == kernelArgsMaxHints {
+			hints = append(hints, "...")
+			break
+		}
+
+		hints = append(hints, fmt.Sprintf("%s: %s", curr.Usage(), curr.Desc))
+	}
+
+	pp.hintLabel.SetTitle(strings.Join(hints, "\n"))
+}
+
+// setupCompletion completes the last argument of edit with the known parameters
+func (pp *KernelCMDLine) setupCompletion(edit *clui.EditField) {
+	edit.OnChange(func(ev clui.Event) {
+		pp.showHint(edit)
+	})
+
+	edit.OnKeyPress(func(key term.Key, ch rune) bool {
+		if key != term.KeyCtrlSpace {
+			return false
+		}
+
+		completed, _ := kernel.Complete(edit.Title())
+		edit.SetTitle(completed)
+		pp.showHint(edit)
+
+		return true
+	})
+}
+
 // Activate sets the kernel cmd line configuration with the current model's value
 func (pp *KernelCMDLine) Activate() {
+	pp.previewLabel.SetTitle(pp.previewText())
+
 	if pp.getModel().KernelArguments == nil {
 		return
 	}
@@ -100,6 +160,15 @@ func newKernelCMDLine(tui *Tui) (Page, error) {
 
 	page.remKernelArgEdit = clui.CreateEditField(iframe, 1, "", Fixed)
 
+	page.setupCompletion(page.addKernelArgEdit)
+	page.setupCompletion(page.remKernelArgEdit)
+
+	page.previewLabel = clui.CreateLabel(page.content, AutoSize, 2, "", Fixed)
+	page.previewLabel.SetMultiline(true)
+
+	page.hintLabel = clui.CreateLabel(page.content, AutoSize, kernelArgsMaxHints+1, "", Fixed)
+	page.hintLabel.SetMultiline(true)
+
 	btnFrm := clui.CreateFrame(fldFrm, 30, 1, BorderNone, Fixed)
 	btnFrm.SetPack(clui.Horizontal)
 	btnFrm.SetGaps(1, 1)
@@ -113,17 +182,26 @@ func newKernelCMDLine(tui *Tui) (Page, error) {
 	confirmBtn := CreateSimpleButton(btnFrm, AutoSize, AutoSize, "Confirm", Fixed)
 
 	confirmBtn.OnClick(func(ev clui.Event) {
-		addKernelArguments := page.addKernelArgEdit.Title()
-		remKernelArguments := page.remKernelArgEdit.Title()
+		args := &kernel.Arguments{
+			Add:    strings.Fields(page.addKernelArgEdit.Title()),
+			Remove: strings.Fields(page.remKernelArgEdit.Title()),
+		}
 
-		if addKernelArguments != "" {
-			page.getModel().AddExtraKernelArguments(strings.Split(addKernelArguments, " "))
+		if err := bootloader.ValidateArguments(args); err != nil {
+			if _, derr := CreateWarningDialogBox(err.Error()); derr != nil {
+				log.Warning("%s: %s", err, derr)
+			}
+			return
+		}
+
+		if len(args.Add) > 0 {
+			page.getModel().AddExtraKernelArguments(args.Add)
 		} else {
 			page.getModel().ClearExtraKernelArguments()
 		}
 
-		if remKernelArguments != "" {
-			page.getModel().RemoveKernelArguments(strings.Split(remKernelArguments, " "))
+		if len(args.Remove) > 0 {
+			page.getModel().RemoveKernelArguments(args.Remove)
 		} else {
 			page.getModel().ClearRemoveKernelArguments()
 		}
@@ -131,6 +209,20 @@ func newKernelCMDLine(tui *Tui) (Page, error) {
 		done := page.addKernelArgEdit.Title() != "" || page.remKernelArgEdit.Title() != ""
 		page.SetDone(done)
 
+		// the arguments are kept, the warnings are only informative
+		if warnings := args.Warnings(); len(warnings) > 0 {
+			message := strings.Join(warnings, "\n")
+
+			if dialog, err := CreateWarningDialogBox(message); err != nil {
+				log.Warning("%s: %s", message, err)
+			} else {
+				dialog.OnClose(func() {
+					page.GotoPage(TuiPageMenu)
+				})
+				return
+			}
+		}
+
 		page.GotoPage(TuiPageMenu)
 	})
 
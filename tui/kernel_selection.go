@@ -6,9 +6,11 @@ package tui
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/VladimirMarkelov/clui"
 	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/utils"
 )
 
 // KernelPage is the Page implementation for the proxy configuration page
@@ -18,28 +20,40 @@ type KernelPage struct {
 	group   *clui.RadioGroup
 }
 
-// KernelRadio maps a map name and description with the actual checkbox
+// KernelRadio maps a map name and description with the actual radio, selecting the
+// default kernel, and the fallback checkbox
 type KernelRadio struct {
-	kernel *kernel.Kernel
-	radio  *clui.Radio
+	kernel   *kernel.Kernel
+	radio    *clui.Radio
+	fallback *clui.CheckBox
 }
 
 // GetConfiguredValue Returns the string representation of currently value set
 func (kp *KernelPage) GetConfiguredValue() string {
+	kernels := kp.getModel().InstalledKernels()
+
+	if len(kernels) > 1 {
+		return fmt.Sprintf("%s (fallbacks: %s)", kernels[0], strings.Join(kernels[1:], ", "))
+	}
+
 	return kp.getModel().Kernel.Bundle
 }
 
 // Activate marks selects the kernel radio based on the data model
 func (kp *KernelPage) Activate() {
 	model := kp.getModel()
+	installed := model.InstalledKernels()
 
 	for _, curr := range kp.kernels {
-		if !curr.kernel.Equals(model.Kernel) {
-			continue
+		if curr.kernel.Equals(model.Kernel) {
+			kp.group.SelectItem(curr.radio)
 		}
 
-		kp.group.SelectItem(curr.radio)
-		break
+		state := 0
+		if !curr.kernel.Equals(model.Kernel) && utils.StringSliceContains(installed, curr.kernel.Bundle) {
+			state = 1
+		}
+		curr.fallback.SetState(state)
 	}
 }
 
@@ -66,11 +80,11 @@ func newKernelPage(tui *Tui) (Page, error) {
 	}
 
 	for _, curr := range kernels {
-		page.kernels = append(page.kernels, &KernelRadio{curr, nil})
+		page.kernels = append(page.kernels, &KernelRadio{curr, nil, nil})
 	}
 
 	page.setupMenu(tui, TuiPageKernel, "Kernel Selection", NoButtons, TuiPageMenu)
-	clui.CreateLabel(page.content, 2, 2, "Select desired kernel", Fixed)
+	clui.CreateLabel(page.content, 2, 2, "Select the default kernel, and optionally fallback kernels", Fixed)
 
 	frm := clui.CreateFrame(page.content, AutoSize, AutoSize, BorderNone, Fixed)
 	frm.SetPack(clui.Vertical)
@@ -82,8 +96,13 @@ func newKernelPage(tui *Tui) (Page, error) {
 	page.group = clui.CreateRadioGroup()
 
 	for _, curr := range page.kernels {
+		rowFrm := clui.CreateFrame(lblFrm, AutoSize, 1, BorderNone, Fixed)
+		rowFrm.SetPack(clui.Horizontal)
+
+		curr.fallback = clui.CreateCheckBox(rowFrm, 12, "Fallback", Fixed)
+
 		lbl := fmt.Sprintf("%s: %s", curr.kernel.Name, curr.kernel.Desc)
-		curr.radio = clui.CreateRadio(lblFrm, AutoSize, lbl, AutoSize)
+		curr.radio = clui.CreateRadio(rowFrm, AutoSize, lbl, AutoSize)
 		curr.radio.SetPack(clui.Horizontal)
 		page.group.AddItem(curr.radio)
 	}
@@ -99,7 +118,15 @@ func newKernelPage(tui *Tui) (Page, error) {
 	confirmBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Confirm", Fixed)
 	confirmBtn.OnClick(func(ev clui.Event) {
 		selected := page.group.Selected()
-		page.getModel().Kernel = page.kernels[selected].kernel
+		fallbacks := []*kernel.Kernel{}
+
+		for idx, curr := range page.kernels {
+			if idx != selected && curr.fallback.State() == 1 {
+				fallbacks = append(fallbacks, curr.kernel)
+			}
+		}
+
+		page.getModel().SetKernels(page.kernels[selected].kernel, fallbacks)
 		page.SetDone(true)
 		page.GotoPage(TuiPageMenu)
 	})
@@ -5,8 +5,10 @@
 package tui
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/user"
 
@@ -26,6 +28,16 @@ type UseraddPage struct {
 	passwordEdit    *clui.EditField
 	pwConfirmEdit   *clui.EditField
 	adminCheck      *clui.CheckBox
+	groupsEdit      *clui.EditField
+	uidEdit         *clui.EditField
+	gidEdit         *clui.EditField
+	shellEdit       *clui.EditField
+	homeEdit        *clui.EditField
+	maxDaysEdit     *clui.EditField
+	accountWarning  *clui.Label
+	systemCheck     *clui.CheckBox
+	forceChgCheck   *clui.CheckBox
+	lockedCheck     *clui.CheckBox
 	deleteBtn       *SimpleButton
 	changedPwd      bool
 	changedLogin    bool
@@ -103,6 +115,17 @@ func (page *UseraddPage) SetDone(done bool) bool {
 		page.user.Admin = false
 	}
 
+	// the account settings were validated with the confirm button
+	page.user.Groups, _, _ = user.ParseGroups(page.groupsEdit.Title())
+	page.user.UID, _, _ = user.ParseID(page.uidEdit.Title())
+	page.user.GID, _, _ = user.ParseID(page.gidEdit.Title())
+	page.user.Shell = strings.TrimSpace(page.shellEdit.Title())
+	page.user.Home = strings.TrimSpace(page.homeEdit.Title())
+	page.user.PasswordMaxDays, _, _ = user.ParsePasswordMaxDays(page.maxDaysEdit.Title())
+	page.user.System = page.systemCheck.State() != 0
+	page.user.ForcePasswordChange = page.forceChgCheck.State() != 0
+	page.user.Locked = page.lockedCheck.State() != 0
+
 	page.GotoPage(TuiPageUserManager)
 
 	return false
@@ -112,6 +135,7 @@ func (page *UseraddPage) setConfirmButton() {
 	if page.usernameWarning.Title() == "" &&
 		page.loginWarning.Title() == "" &&
 		page.passwordWarning.Title() == "" &&
+		page.accountWarning.Title() == "" &&
 		page.loginEdit.Title() != "" &&
 		page.passwordEdit.Title() != "" {
 		page.confirmBtn.SetEnabled(true)
@@ -173,6 +197,47 @@ func (page *UseraddPage) validatePassword() {
 	page.setConfirmButton()
 }
 
+// accountProblem returns the first problem of the account settings fields, the clashes
+// with the system default users included
+func (page *UseraddPage) accountProblem() string {
+	usr := &user.User{
+		Login:  page.loginEdit.Title(),
+		Shell:  strings.TrimSpace(page.shellEdit.Title()),
+		Home:   strings.TrimSpace(page.homeEdit.Title()),
+		System: page.systemCheck.State() != 0,
+	}
+
+	var ok bool
+	var msg string
+
+	if usr.Groups, ok, msg = user.ParseGroups(page.groupsEdit.Title()); !ok {
+		return msg
+	}
+
+	if usr.UID, ok, msg = user.ParseID(page.uidEdit.Title()); !ok {
+		return "UID: " + msg
+	}
+
+	if usr.GID, ok, msg = user.ParseID(page.gidEdit.Title()); !ok {
+		return "GID: " + msg
+	}
+
+	if usr.PasswordMaxDays, ok, msg = user.ParsePasswordMaxDays(page.maxDaysEdit.Title()); !ok {
+		return msg
+	}
+
+	if ve, ok := usr.Validate().(errors.ValidationError); ok {
+		return ve.What
+	}
+
+	return ""
+}
+
+func (page *UseraddPage) validateAccount() {
+	page.accountWarning.SetTitle(page.accountProblem())
+	page.setConfirmButton()
+}
+
 func newUseraddPage(tui *Tui) (Page, error) {
 	page := &UseraddPage{}
 	page.setup(tui, TuiPageUseradd, NoButtons, TuiPageUserManager)
@@ -189,6 +254,13 @@ func newUseraddPage(tui *Tui) (Page, error) {
 	newFieldLabel(lblFrm, "Login:")
 	newFieldLabel(lblFrm, "Password:")
 	newFieldLabel(lblFrm, "Confirm:")
+	newFieldLabel(lblFrm, "")
+	newFieldLabel(lblFrm, "Groups:")
+	newFieldLabel(lblFrm, "UID:")
+	newFieldLabel(lblFrm, "GID:")
+	newFieldLabel(lblFrm, "Shell:")
+	newFieldLabel(lblFrm, "Home:")
+	newFieldLabel(lblFrm, "Max Days:")
 
 	fldFrm := clui.CreateFrame(frm, 50, AutoSize, BorderNone, Fixed)
 	fldFrm.SetPack(clui.Vertical)
@@ -300,6 +372,32 @@ func newUseraddPage(tui *Tui) (Page, error) {
 
 	page.adminCheck = clui.CreateCheckBox(adminFrm, 1, "Administrator", Fixed)
 
+	page.groupsEdit, _ = newEditField(fldFrm, false, nil)
+	page.uidEdit, _ = newEditField(fldFrm, false, nil)
+	page.gidEdit, _ = newEditField(fldFrm, false, nil)
+	page.shellEdit, _ = newEditField(fldFrm, false, nil)
+	page.homeEdit, _ = newEditField(fldFrm, false, nil)
+	page.maxDaysEdit, page.accountWarning = newEditField(fldFrm, true, nil)
+	page.accountWarning.SetVisible(true)
+
+	for _, curr := range []*clui.EditField{page.groupsEdit, page.uidEdit, page.gidEdit,
+		page.shellEdit, page.homeEdit, page.maxDaysEdit} {
+		curr.OnChange(func(ev clui.Event) {
+			page.validateAccount()
+		})
+	}
+
+	accountFrm := clui.CreateFrame(fldFrm, 5, 2, BorderNone, Fixed)
+	accountFrm.SetPack(clui.Horizontal)
+
+	page.systemCheck = clui.CreateCheckBox(accountFrm, 1, "System Account", Fixed)
+	page.forceChgCheck = clui.CreateCheckBox(accountFrm, 1, "Expire Password", Fixed)
+	page.lockedCheck = clui.CreateCheckBox(accountFrm, 1, "Locked", Fixed)
+
+	page.systemCheck.OnChange(func(state int) {
+		page.validateAccount()
+	})
+
 	cancelBtn := CreateSimpleButton(page.cFrame, AutoSize, AutoSize, "Cancel", Fixed)
 	cancelBtn.OnClick(func(ev clui.Event) {
 		page.clearForm()
@@ -320,6 +418,11 @@ func newUseraddPage(tui *Tui) (Page, error) {
 		page.user.Login = ""
 		page.user.Password = ""
 		page.user.Admin = false
+		page.user.Groups = nil
+		page.user.UID, page.user.GID = 0, 0
+		page.user.Shell, page.user.Home = "", ""
+		page.user.System, page.user.Locked = false, false
+		page.user.PasswordMaxDays, page.user.ForcePasswordChange = 0, false
 		page.clearForm()
 		page.GotoPage(TuiPageUserManager)
 	})
@@ -368,6 +471,16 @@ func (page *UseraddPage) resetForm() {
 		page.adminCheck.SetState(1)
 	}
 
+	page.groupsEdit.SetTitle(strings.Join(page.user.Groups, ","))
+	page.uidEdit.SetTitle(formatAccountNumber(page.user.UID))
+	page.gidEdit.SetTitle(formatAccountNumber(page.user.GID))
+	page.shellEdit.SetTitle(page.user.Shell)
+	page.homeEdit.SetTitle(page.user.Home)
+	page.maxDaysEdit.SetTitle(formatAccountNumber(page.user.PasswordMaxDays))
+	page.systemCheck.SetState(boolState(page.user.System))
+	page.forceChgCheck.SetState(boolState(page.user.ForcePasswordChange))
+	page.lockedCheck.SetState(boolState(page.user.Locked))
+
 	page.deleteBtn.SetEnabled(true)
 
 	clui.ActivateControl(page.tui.currPage.GetWindow(), page.usernameEdit)
@@ -390,7 +503,35 @@ func (page *UseraddPage) clearForm() {
 	page.passwordEdit.SetPasswordMode(true)
 	page.pwConfirmEdit.SetPasswordMode(true)
 	page.adminCheck.SetState(0)
+	page.groupsEdit.SetTitle("")
+	page.uidEdit.SetTitle("")
+	page.gidEdit.SetTitle("")
+	page.shellEdit.SetTitle("")
+	page.homeEdit.SetTitle("")
+	page.maxDaysEdit.SetTitle("")
+	page.accountWarning.SetTitle("")
+	page.systemCheck.SetState(0)
+	page.forceChgCheck.SetState(0)
+	page.lockedCheck.SetState(0)
 	page.deleteBtn.SetEnabled(false)
 	page.confirmBtn.SetEnabled(false)
 	clui.ActivateControl(page.tui.currPage.GetWindow(), page.usernameEdit)
 }
+
+// formatAccountNumber returns the edit text of an account number, empty if unset
+func formatAccountNumber(value uint) string {
+	if value == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d", value)
+}
+
+// boolState returns the check box state of value
+func boolState(value bool) int {
+	if value {
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,286 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/proxy"
+)
+
+// sshKeyTypes are the allowed public key types, the DSA keys are refused
+var sshKeyTypes = []string{
+	"ssh-ed25519",
+	"ssh-rsa",
+	"ecdsa-sha2-nistp256",
+	"ecdsa-sha2-nistp384",
+	"ecdsa-sha2-nistp521",
+	"sk-ssh-ed25519@openssh.com",
+	"sk-ecdsa-sha2-nistp256@openssh.com",
+}
+
+// sshKeyTypeExp matches the key types, allowed or not, telling them from the key options
+var sshKeyTypeExp = regexp.MustCompile("^(ssh|ecdsa|sk)-[0-9a-z@.-]+$")
+
+// replaced by the tests
+var (
+	fetchSSHKeys = network.Fetch
+)
+
+// sshKey is a parsed authorized_keys line
+type sshKey struct {
+	line        string
+	keyType     string
+	fingerprint string
+}
+
+func isSSHKeyType(keyType string) bool {
+	for _, curr := range sshKeyTypes {
+		if curr == keyType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitSSHKeyOptions splits the leading options of an authorized_keys line, the options
+// are separated by the first space not in a quoted value
+func splitSSHKeyOptions(line string) (string, string) {
+	quoted := false
+
+	for idx, curr := range line {
+		switch {
+		case curr == '"' && (idx == 0 || line[idx-1] != '\\'):
+			quoted = !quoted
+		case (curr == ' ' || curr == '\t') && !quoted:
+			return line[:idx], strings.TrimSpace(line[idx:])
+		}
+	}
+
+	return line, ""
+}
+
+// parseSSHKey parses an authorized_keys line, [options] type base64-key [comment], the key
+// blob must hold a key of the declared type
+func parseSSHKey(line string) (*sshKey, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return nil, errors.Errorf("Empty ssh key")
+	}
+
+	if !sshKeyTypeExp.MatchString(fields[0]) {
+		_, rest := splitSSHKeyOptions(strings.TrimSpace(line))
+		fields = strings.Fields(rest)
+	}
+
+	if len(fields) < 2 {
+		return nil, errors.Errorf("Invalid ssh key, a key type and a key are required")
+	}
+
+	if !isSSHKeyType(fields[0]) {
+		return nil, errors.Errorf("The ssh key type %s is not allowed, use one of: %s", fields[0],
+			strings.Join(sshKeyTypes, ", "))
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil, errors.Errorf("Invalid %s ssh key encoding", fields[0])
+	}
+
+	if len(blob) < 4 {
+		return nil, errors.Errorf("Invalid %s ssh key", fields[0])
+	}
+
+	size := binary.BigEndian.Uint32(blob)
+	if uint64(size) > uint64(len(blob)-4) || string(blob[4:4+size]) != fields[0] {
+		return nil, errors.Errorf("Invalid %s ssh key, the key does not match its type", fields[0])
+	}
+
+	sum := sha256.Sum256(blob)
+
+	return &sshKey{
+		line:        strings.TrimSpace(line),
+		keyType:     fields[0],
+		fingerprint: "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:]),
+	}, nil
+}
+
+// isSSHKeyURL checks if the ssh-keys entry is an url
+func isSSHKeyURL(entry string) bool {
+	return strings.Contains(entry, "://")
+}
+
+// isSSHKeyPath checks if the ssh-keys entry is a file or directory path, a key has spaces
+func isSSHKeyPath(entry string) bool {
+	return !isSSHKeyURL(entry) && !strings.ContainsAny(strings.TrimSpace(entry), " \t")
+}
+
+// validateSSHKey checks an inline key is valid and an url is an https one
+func validateSSHKey(entry string) error {
+	if isSSHKeyURL(entry) {
+		u, err := url.Parse(entry)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return errors.Errorf("Invalid ssh keys url, an https url is required: %s", proxy.Redact(entry))
+		}
+		return nil
+	}
+
+	if isSSHKeyPath(entry) {
+		return nil
+	}
+
+	_, err := parseSSHKey(entry)
+	return err
+}
+
+// parseSSHKeys parses the keys of an authorized_keys style content, the empty lines and the
+// comments are skipped
+func parseSSHKeys(content []byte, source string) ([]*sshKey, error) {
+	result := []*sshKey{}
+
+	for idx, line := range strings.Split(string(content), "\n") {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, err := parseSSHKey(line)
+		if err != nil {
+			return nil, errors.Errorf("%s: line %d: %v", source, idx+1, err)
+		}
+
+		result = append(result, key)
+	}
+
+	return result, nil
+}
+
+// readSSHKeys reads the keys of a file, or of the .pub files of a directory
+func readSSHKeys(path string) ([]*sshKey, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, errors.Wrap(err)
+	}
+
+	files := []string{path}
+	if info.IsDir() {
+		if files, err = filepath.Glob(filepath.Join(path, "*.pub")); err != nil {
+			return nil, errors.Wrap(err)
+		}
+	}
+
+	result := []*sshKey{}
+	for _, curr := range files {
+		content, err := ioutil.ReadFile(curr)
+		if err != nil {
+			return nil, errors.Wrap(err)
+		}
+
+		keys, err := parseSSHKeys(content, curr)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, keys...)
+	}
+
+	return result, nil
+}
+
+// entrySSHKeys returns the keys of a ssh-keys entry, the relative paths are resolved from
+// yamlDir
+func entrySSHKeys(entry string, yamlDir string) ([]*sshKey, string, error) {
+	if isSSHKeyURL(entry) {
+		source := proxy.Redact(entry)
+
+		content, err := fetchSSHKeys(entry)
+		if err != nil {
+			return nil, source, err
+		}
+
+		keys, err := parseSSHKeys(content, source)
+		return keys, source, err
+	}
+
+	if isSSHKeyPath(entry) {
+		path := strings.TrimSpace(entry)
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(yamlDir, path)
+		}
+
+		keys, err := readSSHKeys(path)
+		return keys, path, err
+	}
+
+	key, err := parseSSHKey(entry)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return []*sshKey{key}, "the configuration", nil
+}
+
+// ResolveSSHKeys reads the users ssh keys files, directories and https urls, the keys are
+// checked and deduplicated. Only the keys fingerprints are logged.
+func ResolveSSHKeys(users []*User, yamlDir string) error {
+	for _, usr := range users {
+		if usr == nil || len(usr.SSHKeys) == 0 {
+			continue
+		}
+
+		seen := map[string]bool{}
+		usr.authorizedKeys = []string{}
+
+		for _, entry := range usr.SSHKeys {
+			keys, source, err := entrySSHKeys(entry, yamlDir)
+			if err != nil {
+				return errors.Errorf("User %s ssh keys: %v", usr.Login, err)
+			}
+
+			for _, key := range keys {
+				if seen[key.fingerprint] {
+					log.Debug("Skipping the duplicated %s ssh key %s of user %s", key.keyType,
+						key.fingerprint, usr.Login)
+					continue
+				}
+				seen[key.fingerprint] = true
+
+				log.Info("Adding the %s ssh key %s of user %s from %s", key.keyType, key.fingerprint,
+					usr.Login, source)
+				usr.authorizedKeys = append(usr.authorizedKeys, key.line)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sshKeys returns the authorized keys of the user, the resolved ones if ResolveSSHKeys was
+// called, the inline ones otherwise
+func (u *User) sshKeys() []string {
+	if u.authorizedKeys != nil {
+		return u.authorizedKeys
+	}
+
+	result := []string{}
+	for _, curr := range u.SSHKeys {
+		if !isSSHKeyURL(curr) && !isSSHKeyPath(curr) {
+			result = append(result, curr)
+		}
+	}
+
+	return result
+}
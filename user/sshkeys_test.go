@@ -0,0 +1,142 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package user
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+const (
+	testSSHKey   = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIF3eiWiH9nVMmxW/46RBrkgG3y/elAATEeCL8RBiLgu+ a@host"
+	testSSHKey2  = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIO+Q2cHsdrHtye368sDAU1nBDMxJro7Pe3/SXOnALoak b@host"
+	testSSHKey3  = "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIFTQDYZ3WM74FrxGhfWOMnuUlxKwfr0Xw0hfP/yen1Ez c@host"
+	testSSHPrint = "SHA256:Ev/GNf7RCmc6ExIzuRyi89k2hD1OD6C+XkYXgW/jxP4"
+)
+
+func TestParseSSHKey(t *testing.T) {
+	tests := []struct {
+		line string
+		err  string
+	}{
+		{testSSHKey, ""},
+		{`command="echo a b",no-pty ` + testSSHKey, ""},
+		{"ssh-ed25519", "a key type and a key are required"},
+		{"ssh-dss AAAAB3NzaC1kc3M=", "ssh-dss is not allowed"},
+		{"ssh-rsa AAAAC3NzaC1lZDI1NTE5AAAAIF3eiWiH9nVMmxW/46RBrkgG3y/elAATEeCL8RBiLgu+", "does not match"},
+		{"ssh-ed25519 AAAA!", "encoding"},
+		{"ssh-ed25519 AAAAfw==", "does not match"},
+	}
+
+	for _, curr := range tests {
+		key, err := parseSSHKey(curr.line)
+
+		if curr.err != "" {
+			if err == nil || !strings.Contains(err.Error(), curr.err) {
+				t.Fatalf("%q: expected the %q error, got: %v", curr.line, curr.err, err)
+			}
+			continue
+		}
+
+		if err != nil || key.keyType != "ssh-ed25519" || key.line != curr.line {
+			t.Fatalf("%q: unexpected key: %+v %v", curr.line, key, err)
+		}
+	}
+
+	key, _ := parseSSHKey(testSSHKey)
+	if key.fingerprint != testSSHPrint {
+		t.Fatalf("Expected the %s fingerprint, got: %s", testSSHPrint, key.fingerprint)
+	}
+}
+
+func TestValidateSSHKeys(t *testing.T) {
+	tests := []struct {
+		entry string
+		valid bool
+	}{
+		{testSSHKey, true},
+		{"keys/admin.pub", true},
+		{"/etc/clr-installer/keys", true},
+		{"https://keys.example.com/admin.keys", true},
+		{"http://keys.example.com/admin.keys", false},
+		{"ssh-rsa AAAA admin@host", false},
+	}
+
+	for _, curr := range tests {
+		err := (&User{Login: "admin", SSHKeys: []string{curr.entry}}).Validate()
+
+		if curr.valid && err != nil {
+			t.Fatalf("%q: unexpected error: %v", curr.entry, err)
+		}
+
+		if ve, ok := err.(errors.ValidationError); !curr.valid && (!ok || ve.Field != "ssh-keys[0]") {
+			t.Fatalf("%q: expected a ssh-keys[0] error, got: %v", curr.entry, err)
+		}
+	}
+}
+
+func TestResolveSSHKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sshkeys-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	files := map[string]string{
+		"admin.pub":     testSSHKey + "\n",
+		"team/b.pub":    "# team keys\n\n" + testSSHKey2 + "\n",
+		"team/c.pub":    testSSHKey3 + "\n" + testSSHKey + "\n",
+		"team/notes":    "not a key",
+		"invalid/a.pub": "ssh-dss AAAAB3NzaC1kc3M=\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err = os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(path), err)
+		}
+		if err = ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	fetched := []string{}
+	saved := fetchSSHKeys
+	fetchSSHKeys = func(addr string) ([]byte, error) {
+		fetched = append(fetched, addr)
+		return []byte(testSSHKey2 + "\n"), nil
+	}
+	defer func() { fetchSSHKeys = saved }()
+
+	usr := &User{Login: "admin", SSHKeys: []string{testSSHKey, "admin.pub", filepath.Join(dir, "team"),
+		"https://keys.example.com/admin.keys"}}
+	if err = ResolveSSHKeys([]*User{usr}, dir); err != nil {
+		t.Fatalf("Failed to resolve the ssh keys: %v", err)
+	}
+
+	expected := strings.Join([]string{testSSHKey, testSSHKey2, testSSHKey3}, "|")
+	if keys := strings.Join(usr.sshKeys(), "|"); keys != expected || len(fetched) != 1 {
+		t.Fatalf("Expected the deduplicated keys %q, got: %q %v", expected, keys, fetched)
+	}
+
+	if strings.Join(usr.SSHKeys, "|") == expected {
+		t.Fatal("The configured entries should be kept")
+	}
+
+	usr = &User{Login: "admin", SSHKeys: []string{"invalid"}}
+	if err = ResolveSSHKeys([]*User{usr}, dir); err == nil || !strings.Contains(err.Error(), "a.pub: line 1") {
+		t.Fatalf("Expected a refused key error, got: %v", err)
+	}
+
+	usr = &User{Login: "admin", SSHKeys: []string{testSSHKey, "missing.pub"}}
+	if keys := usr.sshKeys(); len(keys) != 1 {
+		t.Fatalf("Only the inline keys should be written if not resolved, got: %q", keys)
+	}
+}
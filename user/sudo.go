@@ -0,0 +1,186 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package user
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/cmd"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+const (
+	// sudoAll is the sudoers keyword matching any command or run as user
+	sudoAll = "ALL"
+
+	sudoersDir = "/etc/sudoers.d"
+
+	// sudoSpecialChars are the sudoers characters escaped in the commands arguments, they
+	// are refused in the commands paths
+	sudoSpecialChars = "\\,:="
+)
+
+// SudoRule is a sudoers rule granting the user to run commands as another user
+type SudoRule struct {
+	Commands   []string `yaml:"commands,omitempty,flow"`
+	RunAs      string   `yaml:"runAs,omitempty,flow"`
+	NoPassword bool     `yaml:"noPassword,omitempty,flow"`
+}
+
+// runAs returns the user the commands run as, root by default
+func (sr *SudoRule) runAs() string {
+	if sr.RunAs == "" {
+		return "root"
+	}
+
+	return sr.RunAs
+}
+
+// isFull checks if the rule grants any command as root
+func (sr *SudoRule) isFull() bool {
+	if runAs := sr.runAs(); runAs != "root" && runAs != sudoAll {
+		return false
+	}
+
+	for _, curr := range sr.Commands {
+		if curr == sudoAll {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate checks the rule commands are absolute paths with their arguments, or ALL. The
+// field path of the returned validation errors is relative to sr
+func (sr *SudoRule) Validate() error {
+	if len(sr.Commands) == 0 {
+		return errors.FieldValidationErrorf("commands", "A sudo rule requires commands")
+	}
+
+	for idx, curr := range sr.Commands {
+		field := fmt.Sprintf("commands[%d]", idx)
+
+		if strings.ContainsAny(curr, "\n#") {
+			return errors.FieldValidationErrorf(field, "Invalid sudo command: %q", curr)
+		}
+
+		if curr == sudoAll {
+			continue
+		}
+
+		fields := strings.Fields(curr)
+		if len(fields) == 0 || !filepath.IsAbs(fields[0]) {
+			return errors.FieldValidationErrorf(field, "The sudo command %s must be an absolute path", curr)
+		}
+
+		// i.e /usr/bin/id,ALL would grant any command
+		if strings.ContainsAny(fields[0], sudoSpecialChars) {
+			return errors.FieldValidationErrorf(field, "The sudo command path %s can not have any of: %s",
+				fields[0], sudoSpecialChars)
+		}
+	}
+
+	if runAs := sr.runAs(); runAs != sudoAll && !loginExp.MatchString(runAs) {
+		return errors.FieldValidationErrorf("runAs", "Invalid sudo run as user: %s", runAs)
+	}
+
+	return nil
+}
+
+// sudoCommand escapes the sudoers special characters of the command arguments
+func sudoCommand(command string) string {
+	fields := strings.Fields(command)
+
+	for idx := 1; idx < len(fields); idx++ {
+		for _, curr := range sudoSpecialChars {
+			fields[idx] = strings.Replace(fields[idx], string(curr), "\\"+string(curr), -1)
+		}
+	}
+
+	return strings.Join(fields, " ")
+}
+
+// String returns the sudoers user specification of the rule, without the user
+func (sr *SudoRule) String() string {
+	commands := []string{}
+	for _, curr := range sr.Commands {
+		commands = append(commands, sudoCommand(curr))
+	}
+
+	tag := ""
+	if sr.NoPassword {
+		tag = "NOPASSWD: "
+	}
+
+	return fmt.Sprintf("ALL=(%s) %s%s", sr.runAs(), tag, strings.Join(commands, ", "))
+}
+
+// hasFullSudo checks if the sudo rules grant the user any command as root
+func (u *User) hasFullSudo() bool {
+	for _, curr := range u.Sudo {
+		if curr.isFull() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sudoersFile returns the sudoers drop-in file of the user, sudo skips the files with a dot
+func (u *User) sudoersFile() string {
+	return filepath.Join(sudoersDir, "50-"+strings.Replace(u.Login, ".", "_", -1))
+}
+
+// sudoersContent returns the sudoers drop-in content of the user's rules
+func (u *User) sudoersContent() string {
+	lines := []string{"# sudo rules of the " + u.Login + " user, written by clr-installer"}
+
+	for _, curr := range u.Sudo {
+		lines = append(lines, fmt.Sprintf("%s %s", u.Login, curr))
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// writeSudoers writes the sudoers drop-in of the user, the file is checked with the target
+// visudo and removed if it is refused
+func (u *User) writeSudoers(rootDir string) error {
+	dpath := filepath.Join(rootDir, sudoersDir)
+	if err := utils.MkdirAll(dpath, 0750); err != nil {
+		return err
+	}
+
+	file := u.sudoersFile()
+	fpath := filepath.Join(rootDir, file)
+
+	if err := ioutil.WriteFile(fpath, []byte(u.sudoersContent()), 0440); err != nil {
+		return errors.Wrap(err)
+	}
+
+	args := []string{
+		"chroot",
+		rootDir,
+		"visudo",
+		"-c",
+		"-f",
+		file,
+	}
+
+	if err := cmd.RunAndLog(args...); err != nil {
+		if rerr := os.Remove(fpath); rerr != nil {
+			log.Warning("Failed to remove the refused sudoers file %s: %v", fpath, rerr)
+		}
+		return errors.Errorf("Invalid sudo rules of the %s user: %v", u.Login, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package user
+
+import (
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+)
+
+func TestSudoRuleValidate(t *testing.T) {
+	tests := []struct {
+		rule  *SudoRule
+		field string
+	}{
+		{&SudoRule{Commands: []string{"ALL"}}, ""},
+		{&SudoRule{Commands: []string{"/usr/bin/systemctl restart nginx.service"}, RunAs: "www"}, ""},
+		{&SudoRule{}, "commands"},
+		{&SudoRule{Commands: []string{"/usr/bin/id", "systemctl"}}, "commands[1]"},
+		{&SudoRule{Commands: []string{" "}}, "commands[0]"},
+		{&SudoRule{Commands: []string{"/usr/bin/id\nroot ALL=(ALL) ALL"}}, "commands[0]"},
+		{&SudoRule{Commands: []string{"/usr/bin/systemctl,ALL"}}, "commands[0]"},
+		{&SudoRule{Commands: []string{"/usr/bin/id", "/usr/bin/systemctl, ALL"}}, "commands[1]"},
+		{&SudoRule{Commands: []string{"/usr/bin/a:b"}}, "commands[0]"},
+		{&SudoRule{Commands: []string{"/usr/bin/a=b"}}, "commands[0]"},
+		{&SudoRule{Commands: []string{"/usr/bin/a\\b"}}, "commands[0]"},
+		{&SudoRule{Commands: []string{"/usr/bin/id"}, RunAs: "root,www"}, "runAs"},
+	}
+
+	for _, curr := range tests {
+		err := curr.rule.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("%+v: unexpected error: %v", curr.rule, err)
+			}
+			continue
+		}
+
+		if ve, ok := err.(errors.ValidationError); !ok || ve.Field != curr.field {
+			t.Fatalf("%+v: expected a %s error, got: %v", curr.rule, curr.field, err)
+		}
+	}
+}
+
+func TestSudoersContent(t *testing.T) {
+	usr := &User{Login: "deploy.bot", Sudo: []*SudoRule{
+		{Commands: []string{"/usr/bin/systemctl restart app.service", "/usr/bin/journalctl -u app:1,a=b"},
+			NoPassword: true},
+		{Commands: []string{"ALL"}, RunAs: "www"},
+	}}
+
+	expected := "# sudo rules of the deploy.bot user, written by clr-installer\n" +
+		"deploy.bot ALL=(root) NOPASSWD: /usr/bin/systemctl restart app.service, " +
+		"/usr/bin/journalctl -u app\\:1\\,a\\=b\n" +
+		"deploy.bot ALL=(www) ALL\n"
+	if content := usr.sudoersContent(); content != expected {
+		t.Fatalf("Expected %q, got: %q", expected, content)
+	}
+
+	if file := usr.sudoersFile(); file != "/etc/sudoers.d/50-deploy_bot" {
+		t.Fatalf("The sudoers file should have no dot, got: %s", file)
+	}
+
+	if usr.hasFullSudo() {
+		t.Fatal("Only the commands as www are granted")
+	}
+
+	usr.Sudo[1].RunAs = "ALL"
+	if !usr.hasFullSudo() {
+		t.Fatal("Any command as any user is granted")
+	}
+}
+
+func TestUnmarshalSudo(t *testing.T) {
+	var usr User
+
+	doc := "{login: deploy, sudo: [{commands: [/usr/bin/id], noPassword: true}]}"
+	if err := yaml.UnmarshalStrict([]byte(doc), &usr); err != nil {
+		t.Fatalf("Failed to decode the user: %v", err)
+	}
+
+	if len(usr.Sudo) != 1 || !usr.Sudo[0].NoPassword || usr.Sudo[0].Commands[0] != "/usr/bin/id" {
+		t.Fatalf("Unexpected sudo rules: %+v", usr.Sudo)
+	}
+
+	usr.Sudo = append(usr.Sudo, &SudoRule{Commands: []string{"id"}})
+	if ve, ok := usr.Validate().(errors.ValidationError); !ok || ve.Field != "sudo[1].commands[0]" {
+		t.Fatalf("Expected a sudo[1].commands[0] error, got: %v", usr.Validate())
+	}
+}
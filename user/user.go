@@ -11,6 +11,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -20,6 +21,7 @@ import (
 	"github.com/clearlinux/clr-installer/errors"
 	"github.com/clearlinux/clr-installer/log"
 	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/secret"
 	"github.com/clearlinux/clr-installer/utils"
 )
 
@@ -30,10 +32,51 @@ type User struct {
 	Password string   `yaml:"password,omitempty,flow"`
 	Admin    bool     `yaml:"admin,omitempty,flow"`
 	SSHKeys  []string `yaml:"ssh-keys,omitempty,flow"`
+
+	// the account settings, the zero values keep the useradd defaults
+	Groups              []string `yaml:"groups,omitempty,flow"`
+	UID                 uint     `yaml:"uid,omitempty,flow"`
+	GID                 uint     `yaml:"gid,omitempty,flow"`
+	Shell               string   `yaml:"shell,omitempty,flow"`
+	Home                string   `yaml:"home,omitempty,flow"`
+	System              bool     `yaml:"system,omitempty,flow"`
+	PasswordMaxDays     uint     `yaml:"passwordMaxDays,omitempty,flow"`
+	ForcePasswordChange bool     `yaml:"forcePasswordChange,omitempty,flow"`
+	Locked              bool     `yaml:"locked,omitempty,flow"`
+
+	// Sudo are the sudoers rules of the user, besides the wheel group ones of the admins
+	Sudo []*SudoRule `yaml:"sudo,omitempty,flow"`
+
+	// passwordSecret is the plain text password secret, encrypted by ResolvePassword
+	passwordSecret *secret.Value
+
+	// authorizedKeys are the keys of the SSHKeys entries, set by ResolveSSHKeys
+	authorizedKeys []string
+}
+
+// userYAML is the YAML representation of a User, the password is either the encrypted
+// password or a secret holding the plain text one
+type userYAML struct {
+	Login    string        `yaml:"login,omitempty"`
+	UserName string        `yaml:"username,omitempty"`
+	Password *secret.Value `yaml:"password,omitempty"`
+	Admin    bool          `yaml:"admin,omitempty"`
+	SSHKeys  []string      `yaml:"ssh-keys,omitempty"`
+
+	Groups              []string `yaml:"groups,omitempty"`
+	UID                 uint     `yaml:"uid,omitempty"`
+	GID                 uint     `yaml:"gid,omitempty"`
+	Shell               string   `yaml:"shell,omitempty"`
+	Home                string   `yaml:"home,omitempty"`
+	System              bool     `yaml:"system,omitempty"`
+	PasswordMaxDays     uint     `yaml:"passwordMaxDays,omitempty"`
+	ForcePasswordChange bool     `yaml:"forcePasswordChange,omitempty"`
+	Locked              bool     `yaml:"locked,omitempty"`
+
+	Sudo []*SudoRule `yaml:"sudo,omitempty"`
 }
 
 const (
-	defaultUsersFile = "/usr/share/defaults/etc/passwd"
 	// MaxUsernameLength is the longest possible username
 	MaxUsernameLength = 64
 	// MaxLoginLength is the longest possible login
@@ -42,6 +85,13 @@ const (
 	MinPasswordLength = 8
 	// MaxPasswordLength is the shortest possible password
 	MaxPasswordLength = 255
+	// MaxID is the largest uid or gid of an account, the next one is the nobody's overflow id
+	MaxID = 65533
+	// MaxPasswordDays is the longest password validity chage accepts
+	MaxPasswordDays = 99999
+
+	// adminGroup is the group granting the administrative privileges
+	adminGroup = "wheel"
 
 	// RequiredBundle the bundle needed to enable non-root user accounts
 	RequiredBundle = "sysadmin-basic"
@@ -51,6 +101,13 @@ var (
 	usernameExp     = regexp.MustCompile("^([a-zA-Z]+[0-9a-zA-Z-_ ,'.]*|)$")
 	loginExp        = regexp.MustCompile("^[a-zA-Z]+[0-9a-zA-Z-_.]*$")
 	sysDefaultUsers = []string{}
+	// sysDefaultUIDs maps the uids of the system default users to their logins
+	sysDefaultUIDs = map[uint]string{}
+)
+
+// replaced by the tests
+var (
+	defaultUsersFile = "/usr/share/defaults/etc/passwd"
 )
 
 // IsSysDefaultUser checks if a given login is in the list of default users
@@ -90,6 +147,12 @@ func loadSysDefaultUsers() error {
 		}
 
 		sysDefaultUsers = append(sysDefaultUsers, tks[0])
+
+		if len(tks) > 2 {
+			if uid, err := strconv.ParseUint(tks[2], 10, 32); err == nil {
+				sysDefaultUIDs[uint(uid)] = tks[0]
+			}
+		}
 	}
 
 	return nil
@@ -121,12 +184,152 @@ func (u *User) SetPassword(pwd string) error {
 	return nil
 }
 
+// UnmarshalYAML decodes a user, a password set as a secret is only encrypted once
+// ResolvePassword is called
+func (u *User) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var result userYAML
+
+	if err := unmarshal(&result); err != nil {
+		return err
+	}
+
+	*u = User{
+		Login:               result.Login,
+		UserName:            result.UserName,
+		Admin:               result.Admin,
+		SSHKeys:             result.SSHKeys,
+		Groups:              result.Groups,
+		UID:                 result.UID,
+		GID:                 result.GID,
+		Shell:               result.Shell,
+		Home:                result.Home,
+		System:              result.System,
+		PasswordMaxDays:     result.PasswordMaxDays,
+		ForcePasswordChange: result.ForcePasswordChange,
+		Locked:              result.Locked,
+		Sudo:                result.Sudo,
+	}
+
+	if result.Password == nil {
+		return nil
+	}
+
+	if result.Password.IsLiteral() {
+		u.Password, _ = result.Password.Resolve("")
+		return nil
+	}
+
+	u.passwordSecret = result.Password
+	return nil
+}
+
+// ResolvePassword checks and encrypts the password set as a secret, a relative secret file
+// is resolved from yamlDir. The field path of the returned validation errors is relative to u
+func (u *User) ResolvePassword(yamlDir string) error {
+	if u.passwordSecret == nil {
+		return nil
+	}
+
+	pwd, err := u.passwordSecret.Resolve(yamlDir)
+	if err != nil {
+		return errors.FieldValidationErrorf("password", "%v", err)
+	}
+
+	// the plain text password is only available until it is encrypted
+	if ok, msg := IsValidPassword(pwd); !ok {
+		return errors.FieldValidationErrorf("password", "%s", msg)
+	}
+
+	if err = u.SetPassword(pwd); err != nil {
+		return err
+	}
+
+	u.passwordSecret = nil
+	return nil
+}
+
 // Equals returns true if u and usr point to the same struct or if both have
 // the same Login string
 func (u *User) Equals(usr *User) bool {
 	return u == usr || u.Login == usr.Login
 }
 
+// Validate checks the account settings, the clashes with the system default users are only
+// checked if their passwd file is available. The field path of the returned validation
+// errors is relative to u
+func (u *User) Validate() error {
+	for idx, curr := range u.Groups {
+		if ok, msg := IsValidGroup(curr); !ok {
+			return errors.FieldValidationErrorf(fmt.Sprintf("groups[%d]", idx), "%s", msg)
+		}
+	}
+
+	if ok, msg := IsValidID(u.UID); !ok {
+		return errors.FieldValidationErrorf("uid", "%s", msg)
+	}
+
+	if ok, msg := IsValidID(u.GID); !ok {
+		return errors.FieldValidationErrorf("gid", "%s", msg)
+	}
+
+	if ok, msg := IsValidShell(u.Shell); !ok {
+		return errors.FieldValidationErrorf("shell", "%s", msg)
+	}
+
+	if ok, msg := IsValidHome(u.Home); !ok {
+		return errors.FieldValidationErrorf("home", "%s", msg)
+	}
+
+	if u.PasswordMaxDays > MaxPasswordDays {
+		return errors.FieldValidationErrorf("passwordMaxDays",
+			"Password maximum days can not be greater than %d", MaxPasswordDays)
+	}
+
+	// a forced change would lock out the accounts reached with ssh keys only
+	if u.ForcePasswordChange && u.Password == "" && u.passwordSecret == nil {
+		return errors.FieldValidationErrorf("forcePasswordChange", "A password change requires a password")
+	}
+
+	for idx, curr := range u.SSHKeys {
+		if err := validateSSHKey(curr); err != nil {
+			return errors.FieldValidationErrorf(fmt.Sprintf("ssh-keys[%d]", idx), "%v", err)
+		}
+	}
+
+	for idx, curr := range u.Sudo {
+		field := fmt.Sprintf("sudo[%d]", idx)
+
+		if curr == nil {
+			return errors.FieldValidationErrorf(field, "Empty sudo rule")
+		}
+
+		if err := curr.Validate(); err != nil {
+			if ve, ok := err.(errors.ValidationError); ok {
+				ve.Field = field + "." + ve.Field
+				return ve
+			}
+			return err
+		}
+	}
+
+	if err := loadSysDefaultUsers(); err != nil {
+		log.Warning("Could not check the system default users: %v", err)
+		return nil
+	}
+
+	isDefault, _ := IsSysDefaultUser(u.Login)
+	if isDefault && (u.UID != 0 || u.GID != 0 || u.Shell != "" || u.Home != "" || u.System) {
+		return errors.FieldValidationErrorf("login",
+			"%s is a system default user, its uid, gid, shell, home and system settings are fixed", u.Login)
+	}
+
+	if login, ok := sysDefaultUIDs[u.UID]; u.UID != 0 && ok && login != u.Login {
+		return errors.FieldValidationErrorf("uid", "uid %d belongs to the %s system default user", u.UID, login)
+	}
+
+	return nil
+}
+
 // setTempTargetPAMConfig copy the temporary chpasswd PAM config to target system
 // this is required for changing user's password into target system.
 func setTempTargetPAMConfig(rootDir string) error {
@@ -157,7 +360,7 @@ func Apply(rootDir string, users []*User) error {
 		return nil
 	}
 
-	prg := progress.NewLoop(utils.Locale.Get("Adding extra users"))
+	prg := progress.NewLoop("%s", utils.Locale.Get("Adding extra users"))
 	if err := setTempTargetPAMConfig(rootDir); err != nil {
 		prg.Failure()
 		return err
@@ -175,7 +378,8 @@ func Apply(rootDir string, users []*User) error {
 			return err
 		}
 
-		if usr.Admin {
+		// a sudo rule granting any command as root is an admin one
+		if usr.Admin || usr.hasFullSudo() {
 			haveAdmins = true
 		}
 
@@ -300,32 +504,160 @@ func (u *User) getUserHome(rootDir string) string {
 	return home
 }
 
-// apply applies the user configuration to the target install
-func (u *User) apply(rootDir string) error {
-	accountAdded := false
+// groups returns the supplementary groups of the account, wheel included for the admins
+func (u *User) groups() []string {
+	result := []string{}
 
-	if u.userExist(rootDir) {
-		log.Info("Account '%s' already a defined system account, skipping add.", u.Login)
-	} else {
+	if u.Admin {
+		result = append(result, adminGroup)
+	}
+
+	return append(result, u.Groups...)
+}
+
+// groupExist checks if the group name or gid is defined in the installation target
+func groupExist(rootDir string, group string) bool {
+	args := []string{
+		"chroot",
+		rootDir,
+		"getent",
+		"group",
+		group,
+	}
+
+	return cmd.RunAndLog(args...) == nil
+}
+
+// addGroups creates the supplementary groups missing in the installation target, and the
+// primary group named after the login if the gid is not defined
+func (u *User) addGroups(rootDir string) error {
+	if u.GID != 0 && !groupExist(rootDir, fmt.Sprintf("%d", u.GID)) {
 		args := []string{
 			"chroot",
 			rootDir,
-			"useradd",
-			"--comment",
-			u.UserName,
+			"groupadd",
+			"--gid",
+			fmt.Sprintf("%d", u.GID),
 			u.Login,
 		}
 
-		if u.Admin {
-			args = append(args, []string{
-				"-G",
-				"wheel",
-			}...)
+		if err := cmd.RunAndLog(args...); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	for _, curr := range u.Groups {
+		if groupExist(rootDir, curr) {
+			continue
+		}
+
+		log.Info("Adding group '%s'", curr)
+		args := []string{
+			"chroot",
+			rootDir,
+			"groupadd",
+			curr,
 		}
 
 		if err := cmd.RunAndLog(args...); err != nil {
 			return errors.Wrap(err)
 		}
+	}
+
+	return nil
+}
+
+// useraddArgs returns the useradd command creating the account
+func (u *User) useraddArgs(rootDir string) []string {
+	args := []string{
+		"chroot",
+		rootDir,
+		"useradd",
+		"--comment",
+		u.UserName,
+	}
+
+	if u.UID != 0 {
+		args = append(args, "--uid", fmt.Sprintf("%d", u.UID))
+	}
+
+	if u.GID != 0 {
+		args = append(args, "--gid", fmt.Sprintf("%d", u.GID))
+	}
+
+	if u.Shell != "" {
+		args = append(args, "--shell", u.Shell)
+	}
+
+	if u.Home != "" {
+		args = append(args, "--home-dir", u.Home, "--create-home")
+	}
+
+	if u.System {
+		args = append(args, "--system")
+	}
+
+	if groups := u.groups(); len(groups) > 0 {
+		args = append(args, "-G", strings.Join(groups, ","))
+	}
+
+	return append(args, u.Login)
+}
+
+// chageArgs returns the chage command setting the password aging, nil if there is none
+func (u *User) chageArgs(rootDir string) []string {
+	if u.PasswordMaxDays == 0 && !u.ForcePasswordChange {
+		return nil
+	}
+
+	args := []string{
+		"chroot",
+		rootDir,
+		"chage",
+	}
+
+	if u.PasswordMaxDays != 0 {
+		args = append(args, "--maxdays", fmt.Sprintf("%d", u.PasswordMaxDays))
+	}
+
+	// a last change at the beginning of time expires the password
+	if u.ForcePasswordChange {
+		args = append(args, "--lastday", "0")
+	}
+
+	return append(args, u.Login)
+}
+
+// apply applies the user configuration to the target install
+func (u *User) apply(rootDir string) error {
+	accountAdded := false
+
+	if err := u.addGroups(rootDir); err != nil {
+		return err
+	}
+
+	if u.userExist(rootDir) {
+		log.Info("Account '%s' already a defined system account, skipping add.", u.Login)
+
+		if groups := u.groups(); len(groups) > 0 {
+			args := []string{
+				"chroot",
+				rootDir,
+				"usermod",
+				"-a",
+				"-G",
+				strings.Join(groups, ","),
+				u.Login,
+			}
+
+			if err := cmd.RunAndLog(args...); err != nil {
+				return errors.Wrap(err)
+			}
+		}
+	} else {
+		if err := cmd.RunAndLog(u.useraddArgs(rootDir)...); err != nil {
+			return errors.Wrap(err)
+		}
 
 		accountAdded = true
 	}
@@ -363,7 +695,34 @@ func (u *User) apply(rootDir string) error {
 		}
 	}
 
-	if len(u.SSHKeys) > 0 {
+	if args := u.chageArgs(rootDir); args != nil {
+		if err := cmd.RunAndLog(args...); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	// Only the password is locked, the ssh keys logins are still possible
+	if u.Locked {
+		args := []string{
+			"chroot",
+			rootDir,
+			"usermod",
+			"--lock",
+			u.Login,
+		}
+
+		if err := cmd.RunAndLog(args...); err != nil {
+			return errors.Wrap(err)
+		}
+	}
+
+	if len(u.Sudo) > 0 {
+		if err := u.writeSudoers(rootDir); err != nil {
+			return err
+		}
+	}
+
+	if len(u.sshKeys()) > 0 {
 		if err := writeSSHKey(rootDir, u); err != nil {
 			return err
 		}
@@ -390,7 +749,7 @@ func writeSSHKey(rootDir string, u *User) error {
 		_ = f.Close()
 	}()
 
-	cnt := fmt.Sprintf("%s\n", strings.Join(u.SSHKeys, "\n"))
+	cnt := fmt.Sprintf("%s\n", strings.Join(u.sshKeys(), "\n"))
 	bt := []byte(cnt)
 	n, err := f.Write(bt)
 	if err != nil {
@@ -406,7 +765,8 @@ func writeSSHKey(rootDir string, u *User) error {
 		rootDir,
 		"/usr/bin/chown",
 		"-R",
-		fmt.Sprintf("%s:%s", u.Login, u.Login),
+		// the primary group, it is not named after the login with a gid
+		fmt.Sprintf("%s:", u.Login),
 		sshDir,
 	}
 
@@ -463,3 +823,108 @@ func IsValidPassword(pwd string) (bool, string) {
 
 	return true, ""
 }
+
+// IsValidGroup checks the supplementary group name restrictions
+func IsValidGroup(group string) (bool, string) {
+	if group == adminGroup {
+		return false, utils.Locale.Get("The %s group is granted with the administrator flag", adminGroup)
+	}
+
+	if len(group) > MaxLoginLength {
+		return false, utils.Locale.Get("Group maximum length is %d", MaxLoginLength)
+	}
+
+	if !loginExp.MatchString(group) {
+		return false, utils.Locale.Get("Group must contain only numbers, letters, -, _ or .")
+	}
+
+	return true, ""
+}
+
+// IsValidID checks the uid or gid range, 0 is an unset id
+func IsValidID(id uint) (bool, string) {
+	if id > MaxID {
+		return false, utils.Locale.Get("Id maximum value is %d", MaxID)
+	}
+
+	return true, ""
+}
+
+// isValidPath checks path is an absolute path suitable for the passwd file
+func isValidPath(path string) bool {
+	return path == "" || (filepath.IsAbs(path) && !strings.ContainsAny(path, ":\n"))
+}
+
+// IsValidShell checks the login shell is an absolute path, empty for the default one
+func IsValidShell(shell string) (bool, string) {
+	if !isValidPath(shell) {
+		return false, utils.Locale.Get("Shell must be an absolute path")
+	}
+
+	return true, ""
+}
+
+// IsValidHome checks the home directory is an absolute path, empty for the default one
+func IsValidHome(home string) (bool, string) {
+	if !isValidPath(home) {
+		return false, utils.Locale.Get("Home must be an absolute path")
+	}
+
+	return true, ""
+}
+
+// ParseGroups parses the comma separated groups of the interactive installers
+func ParseGroups(text string) ([]string, bool, string) {
+	result := []string{}
+
+	for _, curr := range strings.Split(text, ",") {
+		if curr = strings.TrimSpace(curr); curr == "" {
+			continue
+		}
+
+		if ok, msg := IsValidGroup(curr); !ok {
+			return nil, false, msg
+		}
+
+		result = append(result, curr)
+	}
+
+	return result, true, ""
+}
+
+// ParseID parses the uid or gid of the interactive installers, an empty text is an unset id
+func ParseID(text string) (uint, bool, string) {
+	if text = strings.TrimSpace(text); text == "" {
+		return 0, true, ""
+	}
+
+	id, err := strconv.ParseUint(text, 10, 32)
+	if err != nil {
+		return 0, false, utils.Locale.Get("Id must be a number")
+	}
+
+	if ok, msg := IsValidID(uint(id)); !ok {
+		return 0, false, msg
+	}
+
+	return uint(id), true, ""
+}
+
+// ParsePasswordMaxDays parses the password validity of the interactive installers, an
+// empty text is a password that never expires
+func ParsePasswordMaxDays(text string) (uint, bool, string) {
+	if text = strings.TrimSpace(text); text == "" {
+		return 0, true, ""
+	}
+
+	days, err := strconv.ParseUint(text, 10, 32)
+	if err != nil {
+		return 0, false, utils.Locale.Get("Password maximum days must be a number")
+	}
+
+	if days > MaxPasswordDays {
+		return 0, false, utils.Locale.Get("Password maximum days can not be greater than %d", MaxPasswordDays)
+	}
+
+	return uint(days), true, ""
+}
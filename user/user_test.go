@@ -0,0 +1,202 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package user
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/schema"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+func init() {
+	utils.SetLocale("en_US.UTF-8")
+}
+
+func TestUserYAMLFields(t *testing.T) {
+	for _, curr := range []reflect.Type{reflect.TypeOf(User{}), reflect.TypeOf(userYAML{})} {
+		if err := schema.CheckFields(curr, "users[]"); err != nil {
+			t.Fatalf("%s: %v", curr.Name(), err)
+		}
+	}
+}
+
+func TestUnmarshalPassword(t *testing.T) {
+	var users []*User
+
+	doc := "[{login: hashed, password: $6$salt$hash}, {login: clrlinux, password: {plain: password}}]"
+	if err := yaml.UnmarshalStrict([]byte(doc), &users); err != nil {
+		t.Fatalf("Failed to decode the users: %v", err)
+	}
+
+	if users[0].Password != "$6$salt$hash" || users[1].Password != "" {
+		t.Fatalf("Only the encrypted password should be set, got: %+v", users)
+	}
+
+	for _, curr := range users {
+		if err := curr.ResolvePassword(""); err != nil {
+			t.Fatalf("Failed to resolve the password: %v", err)
+		}
+	}
+
+	if users[0].Password != "$6$salt$hash" || !strings.HasPrefix(users[1].Password, "$6$") {
+		t.Fatalf("The plain password should be encrypted, got: %+v", users)
+	}
+
+	content, err := yaml.Marshal(users)
+	if err != nil || strings.Contains(string(content), "plain") {
+		t.Fatalf("The plain password should not be written: %s %v", content, err)
+	}
+}
+
+func TestResolveInvalidPassword(t *testing.T) {
+	var users []*User
+
+	if err := yaml.UnmarshalStrict([]byte("[{login: clrlinux, password: {plain: x}}]"), &users); err != nil {
+		t.Fatalf("Failed to decode the users: %v", err)
+	}
+
+	err := users[0].ResolvePassword("")
+	if ve, ok := err.(errors.ValidationError); !ok || ve.Field != "password" {
+		t.Fatalf("A too short password secret should be rejected, got: %v", err)
+	}
+
+	if users[0].Password != "" {
+		t.Fatalf("A rejected password should not be encrypted, got: %q", users[0].Password)
+	}
+}
+
+func TestUseraddArgs(t *testing.T) {
+	usr := &User{Login: "dev", UserName: "Dev", Admin: true, Groups: []string{"docker", "kvm"},
+		UID: 1500, GID: 1500, Shell: "/bin/zsh", Home: "/srv/dev", System: true}
+
+	expected := "chroot /target useradd --comment Dev --uid 1500 --gid 1500 --shell /bin/zsh " +
+		"--home-dir /srv/dev --create-home --system -G wheel,docker,kvm dev"
+	if args := strings.Join(usr.useraddArgs("/target"), " "); args != expected {
+		t.Fatalf("Expected %q, got: %q", expected, args)
+	}
+
+	usr = &User{Login: "plain"}
+	if args := strings.Join(usr.useraddArgs("/target"), " "); args != "chroot /target useradd --comment  plain" {
+		t.Fatalf("Only the login and comment should be set, got: %q", args)
+	}
+}
+
+func TestChageArgs(t *testing.T) {
+	tests := []struct {
+		usr      *User
+		expected string
+	}{
+		{&User{Login: "a"}, ""},
+		{&User{Login: "a", PasswordMaxDays: 90}, "chroot /target chage --maxdays 90 a"},
+		{&User{Login: "a", ForcePasswordChange: true}, "chroot /target chage --lastday 0 a"},
+		{&User{Login: "a", PasswordMaxDays: 30, ForcePasswordChange: true},
+			"chroot /target chage --maxdays 30 --lastday 0 a"},
+	}
+
+	for _, curr := range tests {
+		if args := strings.Join(curr.usr.chageArgs("/target"), " "); args != curr.expected {
+			t.Fatalf("%+v: expected %q, got: %q", curr.usr, curr.expected, args)
+		}
+	}
+}
+
+// setDefaultUsers replaces the system default users with the passwd content
+func setDefaultUsers(t *testing.T, passwd string) func() {
+	dir, err := ioutil.TempDir("", "user-")
+	if err != nil {
+		t.Fatalf("Failed to create the temporary directory: %v", err)
+	}
+
+	file := filepath.Join(dir, "passwd")
+	if err = ioutil.WriteFile(file, []byte(passwd), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", file, err)
+	}
+
+	saved := defaultUsersFile
+	defaultUsersFile = file
+	sysDefaultUsers, sysDefaultUIDs = []string{}, map[uint]string{}
+
+	return func() {
+		defaultUsersFile = saved
+		sysDefaultUsers, sysDefaultUIDs = []string{}, map[uint]string{}
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defer setDefaultUsers(t, "root:x:0:0:root:/root:/bin/bash\ndbus:x:81:81::/:/bin/false\n")()
+
+	tests := []struct {
+		usr   *User
+		field string
+	}{
+		{&User{Login: "dev", Groups: []string{"docker"}, UID: 1500, GID: 100, Shell: "/bin/zsh",
+			Home: "/srv/dev", PasswordMaxDays: 90, Password: "$6$a$b", ForcePasswordChange: true}, ""},
+		{&User{Login: "root", SSHKeys: []string{testSSHKey}}, ""},
+		{&User{Login: "dev", Groups: []string{"docker", "9lives"}}, "groups[1]"},
+		{&User{Login: "dev", Groups: []string{"wheel"}}, "groups[0]"},
+		{&User{Login: "dev", UID: 65534}, "uid"},
+		{&User{Login: "dev", GID: 70000}, "gid"},
+		{&User{Login: "dev", Shell: "zsh"}, "shell"},
+		{&User{Login: "dev", Home: "/home/a:b"}, "home"},
+		{&User{Login: "dev", PasswordMaxDays: 100000}, "passwordMaxDays"},
+		{&User{Login: "dev", ForcePasswordChange: true}, "forcePasswordChange"},
+		{&User{Login: "dbus", Shell: "/bin/bash"}, "login"},
+		{&User{Login: "dev", UID: 81}, "uid"},
+	}
+
+	for _, curr := range tests {
+		err := curr.usr.Validate()
+
+		if curr.field == "" {
+			if err != nil {
+				t.Fatalf("%+v: unexpected error: %v", curr.usr, err)
+			}
+			continue
+		}
+
+		if ve, ok := err.(errors.ValidationError); !ok || ve.Field != curr.field {
+			t.Fatalf("%+v: expected a %s error, got: %v", curr.usr, curr.field, err)
+		}
+	}
+}
+
+func TestParseFields(t *testing.T) {
+	groups, ok, _ := ParseGroups(" docker, kvm,,")
+	if !ok || strings.Join(groups, "|") != "docker|kvm" {
+		t.Fatalf("Unexpected groups: %q", groups)
+	}
+
+	if _, ok, _ = ParseGroups("docker,wheel"); ok {
+		t.Fatal("The wheel group should be refused")
+	}
+
+	if id, ok, _ := ParseID(" "); !ok || id != 0 {
+		t.Fatalf("An empty id should be unset, got: %d", id)
+	}
+
+	for _, curr := range []string{"-1", "abc", "65534"} {
+		if _, ok, _ := ParseID(curr); ok {
+			t.Fatalf("The %q id should be refused", curr)
+		}
+	}
+
+	if days, ok, _ := ParsePasswordMaxDays("90"); !ok || days != 90 {
+		t.Fatalf("Expected 90 days, got: %d", days)
+	}
+
+	if _, ok, _ := ParsePasswordMaxDays("100000"); ok {
+		t.Fatal("The password maximum days should be limited")
+	}
+}
@@ -0,0 +1,438 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package verify
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/user"
+)
+
+const (
+	// CheckSwupd is the name of the installed content check
+	CheckSwupd = "swupd"
+
+	// CheckBootEntries is the name of the boot loader entries check
+	CheckBootEntries = "boot-entries"
+
+	// CheckFstab is the name of the fstab entries check
+	CheckFstab = "fstab"
+
+	// CheckCrypttab is the name of the crypttab entries check
+	CheckCrypttab = "crypttab"
+
+	// CheckUsers is the name of the users and groups check
+	CheckUsers = "users"
+
+	// adminGroup is the group the administrative users are added to
+	adminGroup = "wheel"
+)
+
+var (
+	// devDiskDir is where the udev device links are looked up
+	devDiskDir = "/dev/disk"
+
+	// devSpecDirs maps the fstab/crypttab device spec tags to the udev link directories
+	devSpecDirs = map[string]string{
+		"UUID":      "by-uuid",
+		"PARTUUID":  "by-partuuid",
+		"LABEL":     "by-label",
+		"PARTLABEL": "by-partlabel",
+	}
+)
+
+// Check is the result of a single verification check
+type Check struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// Report is the result of the verification of an installed system
+type Report struct {
+	Passed bool     `json:"passed"`
+	Checks []*Check `json:"checks"`
+}
+
+func (r *Report) add(name string, err error) {
+	check := &Check{Name: name, Passed: err == nil}
+
+	if err != nil {
+		check.Message = err.Error()
+		if te, ok := err.(errors.TraceableError); ok {
+			check.Message = te.What
+		}
+
+		r.Passed = false
+	}
+
+	r.Checks = append(r.Checks, check)
+}
+
+func (r *Report) skip(name string, reason string) {
+	r.Checks = append(r.Checks, &Check{Name: name, Passed: true, Skipped: true, Message: reason})
+}
+
+// Log writes the report to the install log
+func (r *Report) Log() {
+	for _, curr := range r.Checks {
+		switch {
+		case curr.Skipped:
+			log.Info("Verification %s: SKIPPED (%s)", curr.Name, curr.Message)
+		case curr.Passed:
+			log.Info("Verification %s: PASS", curr.Name)
+		default:
+			log.Error("Verification %s: FAIL (%s)", curr.Name, curr.Message)
+		}
+	}
+
+	if r.Passed {
+		log.Info("Verification result: PASS")
+	} else {
+		log.Error("Verification result: FAIL")
+	}
+}
+
+// Error returns an error naming the failed checks, or nil if every check has passed
+func (r *Report) Error() error {
+	if r.Passed {
+		return nil
+	}
+
+	failed := []string{}
+	for _, curr := range r.Checks {
+		if !curr.Passed {
+			failed = append(failed, curr.Name)
+		}
+	}
+
+	return errors.Errorf("Installation verification failed: %s", strings.Join(failed, ", "))
+}
+
+// Run verifies the system installed to rootDir matches the install model
+func Run(rootDir string, md *model.SystemInstall, options args.Args) *Report {
+	report := &Report{Passed: true}
+
+	report.add(CheckSwupd, swupd.New(rootDir, options).VerifyInstall())
+
+	if md.IsDirectoryTarget() {
+		reason := "directory target"
+		report.skip(CheckBootEntries, reason)
+		report.skip(CheckFstab, reason)
+		report.skip(CheckCrypttab, reason)
+	} else {
+		if kernels := md.InstalledKernels(); len(kernels) == 0 {
+			report.skip(CheckBootEntries, "no kernel installed")
+		} else {
+			var err error
+
+			for _, curr := range kernels {
+				if err = VerifyBootEntries(rootDir, curr, md.LegacyBios); err != nil {
+					break
+				}
+			}
+
+			report.add(CheckBootEntries, err)
+		}
+
+		mapped, err := VerifyCrypttab(rootDir)
+		report.add(CheckCrypttab, err)
+		report.add(CheckFstab, VerifyFstab(rootDir, mapped))
+	}
+
+	report.add(CheckUsers, VerifyUsers(rootDir, md.Users))
+
+	return report
+}
+
+// kernelFlavor returns the kernel flavor, i.e native for kernel-native, used
+// by clr-boot-manager to name the kernel files and boot entries
+func kernelFlavor(bundle string) string {
+	return strings.TrimPrefix(bundle, "kernel-")
+}
+
+// VerifyBootEntries checks clr-boot-manager has written a boot entry for the kernel
+// bundle and the kernel file it points to exists in the boot partition
+func VerifyBootEntries(rootDir string, bundle string, legacyBios bool) error {
+	bootDir := filepath.Join(rootDir, "boot")
+	flavor := kernelFlavor(bundle)
+
+	if legacyBios {
+		cfg := filepath.Join(bootDir, "syslinux.cfg")
+
+		content, err := ioutil.ReadFile(cfg)
+		if err != nil {
+			return errors.Errorf("Failed to read boot loader configuration: %v", err)
+		}
+
+		if !strings.Contains(string(content), "org.clearlinux."+flavor+".") {
+			return errors.Errorf("No boot entry for %s in %s", bundle, cfg)
+		}
+
+		return nil
+	}
+
+	entries, err := filepath.Glob(filepath.Join(bootDir, "loader", "entries", "*.conf"))
+	if err != nil {
+		return errors.Wrap(err)
+	}
+
+	for _, curr := range entries {
+		if !strings.Contains(filepath.Base(curr), "-"+flavor+"-") {
+			continue
+		}
+
+		kernelFile, err := entryKernel(curr)
+		if err != nil {
+			return err
+		}
+
+		if _, err = os.Stat(filepath.Join(bootDir, kernelFile)); err != nil {
+			return errors.Errorf("Boot entry %s kernel not found: %s", filepath.Base(curr), kernelFile)
+		}
+
+		return nil
+	}
+
+	return errors.Errorf("No boot entry for %s found", bundle)
+}
+
+// entryKernel returns the kernel file, relative to the boot partition, of a boot loader entry
+func entryKernel(entry string) (string, error) {
+	f, err := os.Open(entry)
+	if err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && fields[0] == "linux" {
+			return fields[1], nil
+		}
+	}
+
+	return "", errors.Errorf("Boot entry %s has no kernel", filepath.Base(entry))
+}
+
+// readTabFile returns the non comment lines fields of a tab file, a missing
+// file has no entries
+func readTabFile(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrap(err)
+	}
+
+	defer func() {
+		_ = f.Close()
+	}()
+
+	result := [][]string{}
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		result = append(result, strings.Fields(line))
+	}
+
+	return result, nil
+}
+
+// resolveDeviceSpec checks a fstab/crypttab device spec resolves to an existing
+// device, mapped devices are resolved if set up by crypttab
+func resolveDeviceSpec(spec string, mapped []string) error {
+	if idx := strings.Index(spec, "="); idx > 0 {
+		dir, ok := devSpecDirs[spec[:idx]]
+		if !ok {
+			return errors.Errorf("Unsupported device spec: %s", spec)
+		}
+
+		if _, err := os.Stat(filepath.Join(devDiskDir, dir, spec[idx+1:])); err != nil {
+			return errors.Errorf("Device not found: %s", spec)
+		}
+
+		return nil
+	}
+
+	if strings.HasPrefix(spec, "/dev/mapper/") {
+		for _, curr := range mapped {
+			if filepath.Base(spec) == curr {
+				return nil
+			}
+		}
+	}
+
+	if _, err := os.Stat(spec); err != nil {
+		return errors.Errorf("Device not found: %s", spec)
+	}
+
+	return nil
+}
+
+// VerifyCrypttab checks every target's crypttab entry resolves to a device, the
+// names of the mapped devices are returned
+func VerifyCrypttab(rootDir string) ([]string, error) {
+	crypttab, err := readTabFile(filepath.Join(rootDir, "etc", "crypttab"))
+	if err != nil {
+		return nil, err
+	}
+
+	mapped := []string{}
+
+	for _, curr := range crypttab {
+		if len(curr) < 2 {
+			return mapped, errors.Errorf("Invalid crypttab entry: %s", strings.Join(curr, " "))
+		}
+
+		mapped = append(mapped, curr[0])
+
+		if err = resolveDeviceSpec(curr[1], nil); err != nil {
+			return mapped, err
+		}
+	}
+
+	return mapped, nil
+}
+
+// VerifyFstab checks every target's fstab entry resolves to a device, mapped are
+// the devices set up by crypttab
+func VerifyFstab(rootDir string, mapped []string) error {
+	fstab, err := readTabFile(filepath.Join(rootDir, "etc", "fstab"))
+	if err != nil {
+		return err
+	}
+
+	for _, curr := range fstab {
+		if len(curr) < 3 {
+			return errors.Errorf("Invalid fstab entry: %s", strings.Join(curr, " "))
+		}
+
+		if err = resolveDeviceSpec(curr[0], mapped); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readDatabase returns the second field of a passwd or group database, the
+// target's /etc entries take precedence over the stateless defaults
+func readDatabase(rootDir string, db string) (map[string][]string, error) {
+	result := map[string][]string{}
+
+	for _, dir := range []string{"usr/share/defaults/etc", "etc"} {
+		entries, err := readColonFile(filepath.Join(rootDir, dir, db))
+		if err != nil {
+			return nil, err
+		}
+
+		for name, fields := range entries {
+			result[name] = fields
+		}
+	}
+
+	return result, nil
+}
+
+func readColonFile(path string) (map[string][]string, error) {
+	result := map[string][]string{}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return result, nil
+		}
+		return nil, errors.Wrap(err)
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+
+		result[fields[0]] = fields
+	}
+
+	return result, nil
+}
+
+// isGroupMember checks login is a supplementary member of the group database entry
+func isGroupMember(group []string, login string) bool {
+	if len(group) < 4 {
+		return false
+	}
+
+	for _, curr := range strings.Split(group[3], ",") {
+		if curr == login {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VerifyUsers checks the configured users exist in the target, only the administrative
+// ones are members of the wheel group and all are members of their supplementary groups
+func VerifyUsers(rootDir string, users []*user.User) error {
+	if len(users) == 0 {
+		return nil
+	}
+
+	passwd, err := readDatabase(rootDir, "passwd")
+	if err != nil {
+		return err
+	}
+
+	groups, err := readDatabase(rootDir, "group")
+	if err != nil {
+		return err
+	}
+
+	for _, curr := range users {
+		if _, ok := passwd[curr.Login]; !ok {
+			return errors.Errorf("User %s not found", curr.Login)
+		}
+
+		isAdmin := isGroupMember(groups[adminGroup], curr.Login)
+
+		if curr.Admin && !isAdmin {
+			return errors.Errorf("User %s is not a member of the %s group", curr.Login, adminGroup)
+		}
+
+		if !curr.Admin && isAdmin {
+			return errors.Errorf("User %s should not be a member of the %s group", curr.Login, adminGroup)
+		}
+
+		for _, name := range curr.Groups {
+			if !isGroupMember(groups[name], curr.Login) {
+				return errors.Errorf("User %s is not a member of the %s group", curr.Login, name)
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,191 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package verify
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/user"
+)
+
+func writeFiles(t *testing.T, rootDir string, files map[string]string) {
+	for path, content := range files {
+		path = filepath.Join(rootDir, path)
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "verify-")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+
+	return dir
+}
+
+func TestVerifyBootEntries(t *testing.T) {
+	rootDir := tempDir(t)
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	if err := VerifyBootEntries(rootDir, "kernel-native", false); err == nil {
+		t.Fatal("Missing boot entries should fail")
+	}
+
+	writeFiles(t, rootDir, map[string]string{
+		"boot/loader/entries/Clear-linux-native-5.3.8-855.conf": "title Clear Linux OS\n" +
+			"linux /EFI/org.clearlinux/kernel-org.clearlinux.native.5.3.8-855\n",
+	})
+
+	if err := VerifyBootEntries(rootDir, "kernel-native", false); err == nil {
+		t.Fatal("A boot entry with a missing kernel should fail")
+	}
+
+	writeFiles(t, rootDir, map[string]string{
+		"boot/EFI/org.clearlinux/kernel-org.clearlinux.native.5.3.8-855": "",
+	})
+
+	if err := VerifyBootEntries(rootDir, "kernel-native", false); err != nil {
+		t.Fatalf("Boot entry should be found: %v", err)
+	}
+
+	if err := VerifyBootEntries(rootDir, "kernel-lts", false); err == nil {
+		t.Fatal("A boot entry of a different kernel should not match")
+	}
+
+	writeFiles(t, rootDir, map[string]string{
+		"boot/syslinux.cfg": "LABEL native\n  KERNEL org.clearlinux.native.5.3.8-855\n",
+	})
+
+	if err := VerifyBootEntries(rootDir, "kernel-native", true); err != nil {
+		t.Fatalf("Legacy boot entry should be found: %v", err)
+	}
+
+	if err := VerifyBootEntries(rootDir, "kernel-lts", true); err == nil {
+		t.Fatal("A legacy boot entry of a different kernel should not match")
+	}
+}
+
+func TestVerifyTabFiles(t *testing.T) {
+	rootDir := tempDir(t)
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	devDir := tempDir(t)
+	defer func() { _ = os.RemoveAll(devDir) }()
+
+	saved := devDiskDir
+	devDiskDir = devDir
+	defer func() { devDiskDir = saved }()
+
+	if _, err := VerifyCrypttab(rootDir); err != nil {
+		t.Fatalf("A missing crypttab has no entries to check: %v", err)
+	}
+
+	if err := VerifyFstab(rootDir, nil); err != nil {
+		t.Fatalf("A missing fstab has no entries to check: %v", err)
+	}
+
+	writeFiles(t, devDir, map[string]string{
+		"by-uuid/1111-2222":  "",
+		"by-label/home":      "",
+		"by-partuuid/abc-12": "",
+	})
+
+	writeFiles(t, rootDir, map[string]string{
+		"etc/crypttab": "# encrypted data\nluks-data PARTUUID=abc-12\n",
+		"etc/fstab": "UUID=1111-2222 /srv ext4 defaults 0 2\n" +
+			"LABEL=home /home ext4 defaults 0 2\n" +
+			"/dev/mapper/luks-data /data ext4 defaults 0 2\n",
+	})
+
+	mapped, err := VerifyCrypttab(rootDir)
+	if err != nil || len(mapped) != 1 || mapped[0] != "luks-data" {
+		t.Fatalf("Crypttab should be valid, mapped: %v, err: %v", mapped, err)
+	}
+
+	if err = VerifyFstab(rootDir, mapped); err != nil {
+		t.Fatalf("Fstab should be valid: %v", err)
+	}
+
+	if err = VerifyFstab(rootDir, nil); err == nil {
+		t.Fatal("An unmapped device should fail")
+	}
+
+	writeFiles(t, rootDir, map[string]string{
+		"etc/fstab": "UUID=3333-4444 /srv ext4 defaults 0 2\n",
+	})
+
+	if err = VerifyFstab(rootDir, mapped); err == nil || !strings.Contains(err.Error(), "UUID=3333-4444") {
+		t.Fatalf("A missing UUID should fail, got: %v", err)
+	}
+}
+
+func TestVerifyUsers(t *testing.T) {
+	rootDir := tempDir(t)
+	defer func() { _ = os.RemoveAll(rootDir) }()
+
+	writeFiles(t, rootDir, map[string]string{
+		"usr/share/defaults/etc/passwd": "root:x:0:0:root:/root:/bin/bash\n",
+		"usr/share/defaults/etc/group":  "root:x:0:\nwheel:x:10:\n",
+		"etc/passwd":                    "admin:x:1000:1000::/home/admin:/bin/bash\nclr:x:1001:1001::/home/clr:/bin/bash\n",
+		"etc/group":                     "wheel:x:10:admin\ndocker:x:900:clr,admin\n",
+	})
+
+	users := []*user.User{
+		{Login: "admin", Admin: true},
+		{Login: "clr", Groups: []string{"docker"}},
+	}
+
+	if err := VerifyUsers(rootDir, users); err != nil {
+		t.Fatalf("Users should be valid: %v", err)
+	}
+
+	tests := []*user.User{
+		{Login: "missing"},
+		{Login: "clr", Admin: true},
+		{Login: "admin"},
+		{Login: "clr", Groups: []string{"kvm"}},
+	}
+
+	for _, curr := range tests {
+		if err := VerifyUsers(rootDir, []*user.User{curr}); err == nil {
+			t.Fatalf("User %+v should fail verification", curr)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	report := &Report{Passed: true}
+
+	report.add(CheckSwupd, nil)
+	report.skip(CheckBootEntries, "no kernel installed")
+
+	if !report.Passed || report.Error() != nil {
+		t.Fatal("Passed and skipped checks should pass the report")
+	}
+
+	report.add(CheckUsers, errors.Errorf("User clr not found"))
+	report.Log()
+
+	if report.Passed || report.Checks[2].Message != "User clr not found" {
+		t.Fatalf("Failed check should fail the report: %+v", report.Checks[2])
+	}
+
+	if err := report.Error(); err == nil || !strings.Contains(err.Error(), CheckUsers) {
+		t.Fatalf("Report error should name the failed checks, got: %v", err)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package web
+
+import (
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+)
+
+const (
+	stateIdle    = "idle"
+	stateRunning = "running"
+	stateSuccess = "success"
+	stateFailure = "failure"
+
+	// maxLogLines is the number of log lines kept to be displayed in the progress page
+	maxLogLines = 30
+)
+
+// installState implements the progress.Client interface and keeps the install
+// progress to be displayed by the progress page
+type installState struct {
+	mutex   sync.Mutex
+	state   string
+	desc    string
+	percent int
+	logs    []string
+	err     error
+}
+
+// progressView is the snapshot of the install progress passed to the template
+type progressView struct {
+	State   string
+	Desc    string
+	Percent int
+	Logs    []string
+	Error   string
+}
+
+func newInstallState() *installState {
+	return &installState{state: stateIdle, logs: []string{}}
+}
+
+// Desc is part of the progress.Client implementation
+func (is *installState) Desc(desc string) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	is.desc = desc
+	is.percent = 0
+}
+
+// Partial is part of the progress.Client implementation
+func (is *installState) Partial(total int, step int) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	if total > 0 {
+		is.percent = step * 100 / total
+	}
+}
+
+// Step is part of the progress.Client implementation, the page is refreshed
+// periodically so loop steps need no handling
+func (is *installState) Step() {}
+
+// Success is part of the progress.Client implementation
+func (is *installState) Success() {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	is.percent = 100
+}
+
+// Failure is part of the progress.Client implementation
+func (is *installState) Failure() {}
+
+// LoopWaitDuration is part of the progress.Client implementation
+func (is *installState) LoopWaitDuration() time.Duration {
+	return 500 * time.Millisecond
+}
+
+// logHook keeps the most recent informational log messages
+func (is *installState) logHook(level int, msg string) {
+	if level > log.LogLevelInfo {
+		return
+	}
+
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	is.logs = append(is.logs, msg)
+	if len(is.logs) > maxLogLines {
+		is.logs = is.logs[len(is.logs)-maxLogLines:]
+	}
+}
+
+// start moves the state to running, returns false if an install was already started
+func (is *installState) start() bool {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	if is.state != stateIdle {
+		return false
+	}
+
+	is.state = stateRunning
+	return true
+}
+
+func (is *installState) finish(err error) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	is.err = err
+	is.state = stateSuccess
+
+	if err != nil {
+		is.state = stateFailure
+	}
+}
+
+func (is *installState) result() (string, error) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	return is.state, is.err
+}
+
+func (is *installState) view() *progressView {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	result := &progressView{
+		State:   is.state,
+		Desc:    is.desc,
+		Percent: is.percent,
+		Logs:    append([]string{}, is.logs...),
+	}
+
+	if is.err != nil {
+		result.Error = is.err.Error()
+
+		if te, ok := is.err.(errors.TraceableError); ok {
+			result.Error = te.What
+		}
+	}
+
+	return result
+}
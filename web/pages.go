@@ -0,0 +1,984 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package web
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/clearlinux/clr-installer/bootloader"
+	"github.com/clearlinux/clr-installer/controller"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/files"
+	"github.com/clearlinux/clr-installer/hostname"
+	"github.com/clearlinux/clr-installer/kernel"
+	"github.com/clearlinux/clr-installer/keyboard"
+	"github.com/clearlinux/clr-installer/language"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/network"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/swupd"
+	"github.com/clearlinux/clr-installer/telemetry"
+	"github.com/clearlinux/clr-installer/timezone"
+	"github.com/clearlinux/clr-installer/user"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+// pageData is the data passed to every page template
+type pageData struct {
+	Title string
+	Nav   []*navItem
+	Error string
+	Info  string
+	Data  interface{}
+}
+
+// navItem is a configuration page entry of the menu, Value is the current configured value
+type navItem struct {
+	Path   string
+	Title  string
+	Value  string
+	Active bool
+}
+
+// option is a selectable entry of a select, radio or checkbox list
+type option struct {
+	Value    string
+	Label    string
+	Selected bool
+}
+
+type partitionView struct {
+	Index      int
+	Name       string
+	FsType     string
+	Size       string
+	MountPoint string
+	Label      string
+	Swap       bool
+}
+
+type diskView struct {
+	Targets    []*option
+	Partitions []*partitionView
+}
+
+type networkView struct {
+	Hostname   string
+	Interfaces []*network.Interface
+	Status     string
+}
+
+type usersView struct {
+	Users []*user.User
+	Login string
+	Name  string
+	Admin bool
+}
+
+type kernelView struct {
+	Kernels   []*option
+	Fallbacks []*option
+	Add       string
+	Remove    string
+	Preview   string
+	Warnings  []string
+}
+
+type telemetryView struct {
+	Enabled  bool
+	AboutURL string
+	Policy   string
+}
+
+type confirmView struct {
+	Items           []*navItem
+	ValidationError string
+	DataLoss        bool
+}
+
+// menuItems is the ordered list of configuration pages
+var menuItems = []struct {
+	path  string
+	title string
+	value func(md *model.SystemInstall) string
+}{
+	{"/language", "Language", languageValue},
+	{"/keyboard", "Keyboard", keyboardValue},
+	{"/timezone", "Timezone", timezoneValue},
+	{"/disk", "Disk Configuration", diskValue},
+	{"/network", "Network", networkValue},
+	{"/proxy", "Proxy", proxyValue},
+	{"/users", "Users", usersValue},
+	{"/bundles", "Bundles", bundlesValue},
+	{"/kernel", "Kernel", kernelValue},
+	{"/telemetry", "Telemetry", telemetryValue},
+	{"/confirm", "Install", func(md *model.SystemInstall) string { return "" }},
+}
+
+func languageValue(md *model.SystemInstall) string {
+	if md.Language == nil {
+		return ""
+	}
+
+	return md.Language.Code
+}
+
+func keyboardValue(md *model.SystemInstall) string {
+	if md.Keyboard == nil {
+		return ""
+	}
+
+	return md.Keyboard.Code
+}
+
+func timezoneValue(md *model.SystemInstall) string {
+	if md.Timezone == nil {
+		return ""
+	}
+
+	return md.Timezone.Code
+}
+
+func diskValue(md *model.SystemInstall) string {
+	if len(md.TargetMedias) == 0 {
+		return "No media selected"
+	}
+
+	target := md.InstallSelected
+
+	// the target media was loaded from a configuration file
+	if target.Name == "" {
+		return md.TargetMedias[0].Name
+	}
+
+	size, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-target.FreeStart, 1)
+
+	encrypted := ""
+	for _, bd := range md.TargetMedias {
+		for _, ch := range bd.Children {
+			if ch.Type == storage.BlockDeviceTypeCrypt {
+				encrypted = " Encryption"
+			}
+		}
+	}
+
+	return fmt.Sprintf("%s (%s) %s%s %s", target.Friendly, target.Name,
+		storage.FormatInstallPortion(target), encrypted, size)
+}
+
+func networkValue(md *model.SystemInstall) string {
+	if md.Hostname == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("Hostname: %s", md.Hostname)
+}
+
+func proxyValue(md *model.SystemInstall) string {
+	return md.HTTPSProxy
+}
+
+func usersValue(md *model.SystemInstall) string {
+	logins := []string{}
+
+	for _, curr := range md.Users {
+		logins = append(logins, curr.Login)
+	}
+
+	return strings.Join(logins, ", ")
+}
+
+func bundlesValue(md *model.SystemInstall) string {
+	return strings.Join(md.UserBundles, ", ")
+}
+
+func kernelValue(md *model.SystemInstall) string {
+	if md.Kernel == nil {
+		return ""
+	}
+
+	return md.Kernel.Bundle
+}
+
+func telemetryValue(md *model.SystemInstall) string {
+	if md.IsTelemetryEnabled() {
+		return "Enabled"
+	}
+
+	return "Disabled"
+}
+
+// newPageData creates the page data with the navigation menu, must be called
+// with wb.mutex held
+func (wb *Web) newPageData(path string) *pageData {
+	result := &pageData{Nav: []*navItem{}}
+
+	for _, curr := range menuItems {
+		item := &navItem{
+			Path:   curr.path,
+			Title:  curr.title,
+			Value:  curr.value(wb.md),
+			Active: curr.path == path,
+		}
+
+		if item.Active {
+			result.Title = curr.title
+		}
+
+		result.Nav = append(result.Nav, item)
+	}
+
+	return result
+}
+
+func (wb *Web) render(w http.ResponseWriter, status int, name string, data *pageData) {
+	buf := bytes.NewBuffer(nil)
+
+	if err := wb.templates.ExecuteTemplate(buf, name, data); err != nil {
+		log.ErrorError(errors.Wrap(err))
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// renderPage renders a configuration page, a page with an error message is
+// the answer to an invalid form submission
+func (wb *Web) renderPage(w http.ResponseWriter, name string, data *pageData) {
+	status := http.StatusOK
+
+	if data.Error != "" {
+		status = http.StatusBadRequest
+	}
+
+	wb.render(w, status, name, data)
+}
+
+func backToMenu(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (wb *Web) handleMenu(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if state, _ := wb.install.result(); state != stateIdle {
+		http.Redirect(w, r, "/progress", http.StatusSeeOther)
+		return
+	}
+
+	wb.mutex.Lock()
+	defer wb.mutex.Unlock()
+
+	data := wb.newPageData("/")
+	data.Title = "Clear Linux OS Installer"
+
+	wb.renderPage(w, "menu", data)
+}
+
+// handleChoice implements the pages where a single value is selected from a list
+func (wb *Web) handleChoice(w http.ResponseWriter, r *http.Request, path string,
+	codes []string, current string, apply func(idx int)) {
+	data := wb.newPageData(path)
+
+	if r.Method == http.MethodPost {
+		code := r.FormValue("code")
+
+		for idx, curr := range codes {
+			if curr == code {
+				apply(idx)
+				backToMenu(w, r)
+				return
+			}
+		}
+
+		data.Error = fmt.Sprintf("Invalid %s: %q", strings.ToLower(data.Title), code)
+	}
+
+	options := []*option{}
+	for _, curr := range codes {
+		options = append(options, &option{Value: curr, Label: curr, Selected: curr == current})
+	}
+
+	data.Data = options
+	wb.renderPage(w, "choice", data)
+}
+
+func (wb *Web) handleLoadError(w http.ResponseWriter, path string, err error) {
+	log.ErrorError(err)
+
+	data := wb.newPageData(path)
+	data.Error = err.Error()
+
+	wb.render(w, http.StatusInternalServerError, "menu", data)
+}
+
+func (wb *Web) handleLanguage(w http.ResponseWriter, r *http.Request) {
+	langs, err := language.Load()
+	if err != nil {
+		wb.handleLoadError(w, "/language", err)
+		return
+	}
+
+	codes := []string{}
+	for _, curr := range langs {
+		codes = append(codes, curr.Code)
+	}
+
+	wb.handleChoice(w, r, "/language", codes, languageValue(wb.md), func(idx int) {
+		wb.md.Language = langs[idx]
+	})
+}
+
+func (wb *Web) handleKeyboard(w http.ResponseWriter, r *http.Request) {
+	kmaps, err := keyboard.LoadKeymaps()
+	if err != nil {
+		wb.handleLoadError(w, "/keyboard", err)
+		return
+	}
+
+	codes := []string{}
+	for _, curr := range kmaps {
+		codes = append(codes, curr.Code)
+	}
+
+	wb.handleChoice(w, r, "/keyboard", codes, keyboardValue(wb.md), func(idx int) {
+		wb.md.Keyboard = kmaps[idx]
+	})
+}
+
+func (wb *Web) handleTimezone(w http.ResponseWriter, r *http.Request) {
+	zones, err := timezone.Load()
+	if err != nil {
+		wb.handleLoadError(w, "/timezone", err)
+		return
+	}
+
+	codes := []string{}
+	for _, curr := range zones {
+		codes = append(codes, curr.Code)
+	}
+
+	wb.handleChoice(w, r, "/timezone", codes, timezoneValue(wb.md), func(idx int) {
+		wb.md.Timezone = zones[idx]
+	})
+}
+
+// loadTargets builds the safe and destructive install target lists
+func (wb *Web) loadTargets(rescan bool) error {
+	var devs []*storage.BlockDevice
+	var err error
+
+	if rescan {
+		devs, err = storage.RescanBlockDevices(wb.md.TargetMedias)
+	} else {
+		devs, err = storage.ListAvailableBlockDevices(wb.md.TargetMedias)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	wb.safeTargets = storage.FindSafeInstallTargets(storage.MinimumServerInstallSize, devs)
+	wb.destructiveTargets = storage.FindAllInstallTargets(devs)
+
+	return nil
+}
+
+func targetLabel(target storage.InstallTarget, destructive bool) string {
+	size, _ := storage.HumanReadableSizeWithPrecision(target.FreeEnd-target.FreeStart, 1)
+	label := fmt.Sprintf("%s (%s) %s %s", target.Friendly, target.Name,
+		storage.FormatInstallPortion(target), size)
+
+	if destructive {
+		label = label + " - destroys all data"
+	}
+
+	return label
+}
+
+// applyTarget sets the selected install target into the model with the
+// standard partitions, same as the TUI media configuration page
+func (wb *Web) applyTarget(target storage.InstallTarget, encrypt bool) error {
+	bds, err := storage.ListAvailableBlockDevices(wb.md.TargetMedias)
+	if err != nil {
+		return err
+	}
+
+	for _, curr := range bds {
+		if curr.Name != target.Name {
+			continue
+		}
+
+		installBlockDevice := curr.Clone()
+
+		if target.WholeDisk {
+			storage.NewStandardPartitions(installBlockDevice)
+		} else {
+			size := target.FreeEnd - target.FreeStart
+			size = size - storage.AddBootStandardPartition(installBlockDevice)
+			if !installBlockDevice.DeviceHasSwap() {
+				size = size - storage.AddSwapStandardPartition(installBlockDevice)
+			}
+			storage.AddRootStandardPartition(installBlockDevice, size)
+		}
+
+		if encrypt {
+			for _, child := range installBlockDevice.Children {
+				if child.MountPoint == "/" {
+					child.Type = storage.BlockDeviceTypeCrypt
+				}
+			}
+		}
+
+		wb.md.InstallSelected = target
+		wb.md.TargetMedias = nil
+		wb.md.AddTargetMedia(installBlockDevice)
+
+		log.Debug("Web Install Target %v", target)
+		return nil
+	}
+
+	return errors.Errorf("Could not find the block device: %s", target.Name)
+}
+
+func (wb *Web) selectTarget(r *http.Request) string {
+	var target storage.InstallTarget
+
+	tks := strings.Split(r.FormValue("target"), "-")
+	if len(tks) != 2 {
+		return "No installation media selected"
+	}
+
+	idx, err := strconv.Atoi(tks[1])
+	if err != nil {
+		return "Invalid installation media"
+	}
+
+	switch {
+	case tks[0] == "safe" && idx >= 0 && idx < len(wb.safeTargets):
+		target = wb.safeTargets[idx]
+	case tks[0] == "destructive" && idx >= 0 && idx < len(wb.destructiveTargets):
+		target = wb.destructiveTargets[idx]
+	default:
+		return "Invalid installation media"
+	}
+
+	encrypt := r.FormValue("encrypt") != ""
+	if encrypt {
+		passphrase := r.FormValue("passphrase")
+
+		if ok, msg := storage.IsValidPassphrase(passphrase); !ok {
+			return msg
+		}
+
+		if passphrase != r.FormValue("passphrase-confirm") {
+			return "Passphrases do not match"
+		}
+
+		wb.md.CryptPass = passphrase
+	}
+
+	if err = wb.applyTarget(target, encrypt); err != nil {
+		log.ErrorError(err)
+		return err.Error()
+	}
+
+	return ""
+}
+
+// applyPartitions updates the mount points and labels of the target media partitions
+func (wb *Web) applyPartitions(r *http.Request) string {
+	if len(wb.md.TargetMedias) == 0 {
+		return "No installation media selected"
+	}
+
+	children := wb.md.TargetMedias[0].Children
+	mounts := map[string]bool{}
+
+	for idx, ch := range children {
+		if ch.FsType == "swap" {
+			continue
+		}
+
+		mount := strings.TrimSpace(r.FormValue(fmt.Sprintf("mount-%d", idx)))
+		label := strings.TrimSpace(r.FormValue(fmt.Sprintf("label-%d", idx)))
+
+		if mount != "" {
+			if msg := storage.IsValidMount(mount); msg != "" {
+				return fmt.Sprintf("%s: %s", mount, msg)
+			}
+
+			if mounts[mount] {
+				return fmt.Sprintf("%s: Duplicated mount point", mount)
+			}
+
+			mounts[mount] = true
+		}
+
+		if msg := storage.IsValidLabel(label, ch.FsType); msg != "" {
+			return fmt.Sprintf("%s: %s", label, msg)
+		}
+	}
+
+	for idx, ch := range children {
+		if ch.FsType == "swap" {
+			continue
+		}
+
+		ch.MountPoint = strings.TrimSpace(r.FormValue(fmt.Sprintf("mount-%d", idx)))
+		ch.Label = strings.TrimSpace(r.FormValue(fmt.Sprintf("label-%d", idx)))
+	}
+
+	return ""
+}
+
+func (wb *Web) handleDisk(w http.ResponseWriter, r *http.Request) {
+	data := wb.newPageData("/disk")
+
+	if (wb.safeTargets == nil && wb.destructiveTargets == nil) || r.FormValue("action") == "rescan" {
+		if err := wb.loadTargets(r.FormValue("action") == "rescan"); err != nil {
+			wb.handleLoadError(w, "/disk", err)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "target":
+			data.Error = wb.selectTarget(r)
+		case "partitions":
+			data.Error = wb.applyPartitions(r)
+		}
+
+		if data.Error == "" {
+			http.Redirect(w, r, "/disk", http.StatusSeeOther)
+			return
+		}
+	}
+
+	view := &diskView{Targets: []*option{}, Partitions: []*partitionView{}}
+
+	for idx, curr := range wb.safeTargets {
+		view.Targets = append(view.Targets, &option{
+			Value:    fmt.Sprintf("safe-%d", idx),
+			Label:    targetLabel(curr, false),
+			Selected: curr == wb.md.InstallSelected,
+		})
+	}
+
+	for idx, curr := range wb.destructiveTargets {
+		view.Targets = append(view.Targets, &option{
+			Value:    fmt.Sprintf("destructive-%d", idx),
+			Label:    targetLabel(curr, true),
+			Selected: curr == wb.md.InstallSelected,
+		})
+	}
+
+	if len(wb.md.TargetMedias) > 0 {
+		for idx, ch := range wb.md.TargetMedias[0].Children {
+			size, _ := ch.HumanReadableSize()
+
+			view.Partitions = append(view.Partitions, &partitionView{
+				Index:      idx,
+				Name:       ch.Name,
+				FsType:     ch.FsType,
+				Size:       size,
+				MountPoint: ch.MountPoint,
+				Label:      ch.Label,
+				Swap:       ch.FsType == "swap",
+			})
+		}
+	}
+
+	data.Data = view
+	wb.renderPage(w, "disk", data)
+}
+
+func (wb *Web) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	data := wb.newPageData("/network")
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "hostname":
+			name := strings.TrimSpace(r.FormValue("hostname"))
+
+			if name != "" {
+				data.Error = hostname.IsValidHostname(name)
+			}
+
+			if data.Error == "" {
+				wb.md.Hostname = name
+				backToMenu(w, r)
+				return
+			}
+		case "test":
+			if err := controller.ConfigureNetwork(wb.md); err != nil {
+				wb.networkStatus = ""
+				data.Error = fmt.Sprintf("Network check failed: %s", err)
+			} else {
+				wb.networkStatus = "Network check passed"
+			}
+		}
+	}
+
+	ifaces, err := network.Interfaces()
+	if err != nil {
+		log.ErrorError(err)
+		ifaces = []*network.Interface{}
+	}
+
+	data.Data = &networkView{
+		Hostname:   wb.md.Hostname,
+		Interfaces: ifaces,
+		Status:     wb.networkStatus,
+	}
+
+	wb.renderPage(w, "network", data)
+}
+
+func (wb *Web) handleProxy(w http.ResponseWriter, r *http.Request) {
+	data := wb.newPageData("/proxy")
+
+	if r.Method == http.MethodPost {
+		currentProxy := wb.md.HTTPSProxy
+		wb.md.HTTPSProxy = strings.TrimSpace(r.FormValue("proxy"))
+
+		// same as the TUI, a proxy is only accepted if the network works with it
+		if err := controller.ConfigureNetwork(wb.md); err != nil {
+			wb.md.HTTPSProxy = currentProxy
+			data.Error = fmt.Sprintf("Network check failed: %s", err)
+		} else {
+			backToMenu(w, r)
+			return
+		}
+	}
+
+	data.Data = wb.md.HTTPSProxy
+	wb.renderPage(w, "proxy", data)
+}
+
+// addUser validates the add user form and adds the new user to the model
+func (wb *Web) addUser(r *http.Request) string {
+	login := strings.TrimSpace(r.FormValue("login"))
+	name := strings.TrimSpace(r.FormValue("name"))
+	pwd := r.FormValue("password")
+
+	if ok, msg := user.IsValidLogin(login); !ok {
+		return msg
+	}
+
+	if name != "" {
+		if ok, msg := user.IsValidUsername(name); !ok {
+			return msg
+		}
+	}
+
+	if ok, msg := user.IsValidPassword(pwd); !ok {
+		return msg
+	}
+
+	if pwd != r.FormValue("password-confirm") {
+		return "Passwords do not match"
+	}
+
+	for _, curr := range wb.md.Users {
+		if curr.Login == login {
+			return fmt.Sprintf("User %s already exists", login)
+		}
+	}
+
+	usr, err := user.NewUser(login, name, pwd, r.FormValue("admin") != "")
+	if err != nil {
+		log.ErrorError(err)
+		return err.Error()
+	}
+
+	wb.md.AddUser(usr)
+	return ""
+}
+
+func (wb *Web) handleUsers(w http.ResponseWriter, r *http.Request) {
+	data := wb.newPageData("/users")
+	form := &usersView{}
+
+	if r.Method == http.MethodPost {
+		switch r.FormValue("action") {
+		case "add":
+			data.Error = wb.addUser(r)
+
+			// keep the form content, but never the password
+			form.Login = r.FormValue("login")
+			form.Name = r.FormValue("name")
+			form.Admin = r.FormValue("admin") != ""
+		case "remove":
+			users := []*user.User{}
+
+			for _, curr := range wb.md.Users {
+				if curr.Login != r.FormValue("login") {
+					users = append(users, curr)
+				}
+			}
+
+			wb.md.Users = users
+		}
+
+		if data.Error == "" {
+			http.Redirect(w, r, "/users", http.StatusSeeOther)
+			return
+		}
+	}
+
+	form.Users = wb.md.Users
+	data.Data = form
+
+	wb.renderPage(w, "users", data)
+}
+
+func (wb *Web) handleBundles(w http.ResponseWriter, r *http.Request) {
+	bundles, err := swupd.LoadBundleList(wb.md)
+	if err != nil {
+		wb.handleLoadError(w, "/bundles", err)
+		return
+	}
+
+	data := wb.newPageData("/bundles")
+
+	if r.Method == http.MethodPost {
+		if err = r.ParseForm(); err != nil {
+			data.Error = err.Error()
+		} else {
+			selected := map[string]bool{}
+			for _, curr := range r.Form["bundle"] {
+				selected[curr] = true
+			}
+
+			for _, curr := range bundles {
+				if selected[curr.Name] {
+					wb.md.AddUserBundle(curr.Name)
+				} else {
+					wb.md.RemoveUserBundle(curr.Name)
+				}
+			}
+
+			backToMenu(w, r)
+			return
+		}
+	}
+
+	options := []*option{}
+	for _, curr := range bundles {
+		options = append(options, &option{
+			Value:    curr.Name,
+			Label:    fmt.Sprintf("%s: %s", curr.Name, curr.Desc),
+			Selected: wb.md.ContainsUserBundle(curr.Name),
+		})
+	}
+
+	data.Data = options
+	wb.renderPage(w, "bundles", data)
+}
+
+func (wb *Web) handleKernel(w http.ResponseWriter, r *http.Request) {
+	kernels, err := kernel.LoadKernelList()
+	if err != nil {
+		wb.handleLoadError(w, "/kernel", err)
+		return
+	}
+
+	data := wb.newPageData("/kernel")
+
+	if r.Method == http.MethodPost {
+		data.Error = "Invalid kernel"
+
+		for _, curr := range kernels {
+			if curr.Bundle != r.FormValue("kernel") {
+				continue
+			}
+
+			args := &kernel.Arguments{
+				Add:    strings.Fields(r.FormValue("add")),
+				Remove: strings.Fields(r.FormValue("remove")),
+			}
+
+			if err = bootloader.ValidateArguments(args); err != nil {
+				data.Error = err.Error()
+				break
+			}
+
+			fallbacks := []*kernel.Kernel{}
+			for _, fb := range kernels {
+				if utils.StringSliceContains(r.Form["fallback"], fb.Bundle) {
+					fallbacks = append(fallbacks, fb)
+				}
+			}
+
+			wb.md.SetKernels(curr, fallbacks)
+
+			wb.md.ClearExtraKernelArguments()
+			wb.md.AddExtraKernelArguments(args.Add)
+
+			wb.md.ClearRemoveKernelArguments()
+			wb.md.RemoveKernelArguments(args.Remove)
+
+			backToMenu(w, r)
+			return
+		}
+	}
+
+	view := &kernelView{Kernels: []*option{}, Fallbacks: []*option{}}
+	installed := wb.md.InstalledKernels()
+
+	for _, curr := range kernels {
+		view.Kernels = append(view.Kernels, &option{
+			Value:    curr.Bundle,
+			Label:    fmt.Sprintf("%s: %s", curr.Name, curr.Desc),
+			Selected: curr.Equals(wb.md.Kernel),
+		})
+
+		view.Fallbacks = append(view.Fallbacks, &option{
+			Value:    curr.Bundle,
+			Label:    curr.Name,
+			Selected: !curr.Equals(wb.md.Kernel) && utils.StringSliceContains(installed, curr.Bundle),
+		})
+	}
+
+	if wb.md.KernelArguments != nil {
+		view.Add = strings.Join(wb.md.KernelArguments.Add, " ")
+		view.Remove = strings.Join(wb.md.KernelArguments.Remove, " ")
+	}
+
+	if wb.md.Kernel != nil {
+		view.Preview = bootloader.Preview(wb.md.Bootloader, wb.md.KernelArguments, wb.md.Kernel.Bundle)
+	}
+
+	view.Warnings = wb.md.KernelArgumentWarnings()
+
+	data.Data = view
+	wb.renderPage(w, "kernel", data)
+}
+
+func (wb *Web) handleTelemetry(w http.ResponseWriter, r *http.Request) {
+	data := wb.newPageData("/telemetry")
+
+	if wb.md.Telemetry == nil {
+		wb.md.Telemetry = &telemetry.Telemetry{}
+	}
+
+	if r.Method == http.MethodPost {
+		wb.md.EnableTelemetry(r.FormValue("enable") != "")
+		wb.md.Telemetry.SetUserDefined(true)
+
+		backToMenu(w, r)
+		return
+	}
+
+	data.Data = &telemetryView{
+		Enabled:  wb.md.IsTelemetryEnabled(),
+		AboutURL: telemetry.TelemetryAboutURL,
+		Policy:   telemetry.Policy,
+	}
+
+	wb.renderPage(w, "telemetry", data)
+}
+
+func (wb *Web) handleConfirm(w http.ResponseWriter, r *http.Request) {
+	data := wb.newPageData("/confirm")
+	view := &confirmView{
+		Items:    append([]*navItem{}, data.Nav[:len(data.Nav)-1]...),
+		DataLoss: wb.md.InstallSelected.DataLoss || wb.md.InstallSelected.EraseDisk,
+	}
+
+	if len(wb.md.Files) > 0 {
+		paths := strings.Join(files.Paths(wb.md.Files), ", ")
+		view.Items = append(view.Items, &navItem{Title: "Files", Value: paths})
+	}
+
+	if cmdline := wb.md.KernelCmdline(); cmdline != "" {
+		view.Items = append(view.Items, &navItem{Title: "Kernel command line", Value: cmdline})
+	}
+
+	for _, curr := range wb.md.KernelArgumentWarnings() {
+		view.Items = append(view.Items, &navItem{Title: "Kernel arguments warning", Value: curr})
+	}
+
+	if err := wb.md.Validate(); err != nil {
+		view.ValidationError = err.Error()
+	} else if wb.md.EncryptionRequiresPassphrase() && wb.md.CryptPass == "" {
+		// there is no terminal to prompt for the passphrase
+		view.ValidationError = "Encryption requires a passphrase, select the media again"
+	}
+
+	if r.Method == http.MethodPost {
+		if view.ValidationError != "" {
+			data.Error = view.ValidationError
+		} else if wb.install.start() {
+			go wb.runInstall()
+			http.Redirect(w, r, "/progress", http.StatusSeeOther)
+			return
+		}
+	}
+
+	data.Data = view
+	wb.renderPage(w, "confirm", data)
+}
+
+func (wb *Web) runInstall() {
+	log.Debug("Starting install")
+
+	err := controller.Install(wb.rootDir, wb.md, wb.options)
+	if err != nil {
+		log.ErrorError(err)
+	}
+
+	wb.install.finish(err)
+}
+
+func (wb *Web) handleProgress(w http.ResponseWriter, r *http.Request) {
+	view := wb.install.view()
+
+	if view.State == stateIdle {
+		backToMenu(w, r)
+		return
+	}
+
+	wb.render(w, http.StatusOK, "progress", &pageData{Title: "Installing", Data: view})
+}
+
+// handleFinish ends the web frontend execution, rebooting is only possible
+// after a successful install
+func (wb *Web) handleFinish(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	state, _ := wb.install.result()
+	if state == stateRunning {
+		http.Redirect(w, r, "/progress", http.StatusSeeOther)
+		return
+	}
+
+	wb.mutex.Lock()
+	wb.reboot = state == stateSuccess && r.FormValue("reboot") != ""
+	reboot := wb.reboot
+	wb.mutex.Unlock()
+
+	wb.render(w, http.StatusOK, "finish", &pageData{Title: "Finished", Data: reboot})
+
+	wb.quitOnce.Do(func() {
+		close(wb.done)
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package web
+
+import (
+	"html/template"
+)
+
+// the templates are kept in the binary so the installer image needs no extra files
+var pageTemplates = map[string]string{
+	"header": `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+{{if .Refresh}}<meta http-equiv="refresh" content="2">{{end}}
+<title>{{.Page.Title}} - Clear Linux OS Installer</title>
+<style>
+body { font-family: sans-serif; margin: 0; color: #222; }
+header { background: #1b2a4a; color: #fff; padding: 0.8em 1.5em; font-size: 1.2em; }
+nav { float: left; width: 16em; padding: 1em; }
+nav a { display: block; padding: 0.3em 0.5em; color: #1b2a4a; text-decoration: none; }
+nav a.active { background: #dde4f0; font-weight: bold; }
+main { margin-left: 18em; padding: 1em 2em; }
+.error { background: #fbe3e4; color: #8a1f11; padding: 0.6em; margin-bottom: 1em; }
+.info { background: #e6efc2; color: #264409; padding: 0.6em; margin-bottom: 1em; }
+.value { color: #666; font-size: 0.9em; }
+table { border-collapse: collapse; }
+td, th { padding: 0.3em 0.8em; text-align: left; border-bottom: 1px solid #ddd; }
+fieldset { border: 1px solid #ddd; margin-bottom: 1em; }
+pre { background: #f4f4f4; padding: 0.6em; overflow-x: auto; }
+</style>
+</head>
+<body>
+<header>Clear Linux OS Installer</header>
+{{if .Page.Nav}}<nav>{{range .Page.Nav}}<a href="{{.Path}}"{{if .Active}} class="active"{{end}}>{{.Title}}</a>{{end}}</nav>{{end}}
+<main>
+<h2>{{.Page.Title}}</h2>
+{{if .Page.Error}}<div class="error">{{.Page.Error}}</div>{{end}}
+{{if .Page.Info}}<div class="info">{{.Page.Info}}</div>{{end}}
+`,
+
+	"footer": `</main>
+</body>
+</html>
+`,
+
+	"login": `{{template "header" wrap .}}
+<p>Open the login URL printed on the installer console to start a session.</p>
+{{template "footer"}}`,
+
+	"menu": `{{template "header" wrap .}}
+<table>
+{{range .Nav}}<tr><td><a href="{{.Path}}">{{.Title}}</a></td><td class="value">{{.Value}}</td></tr>
+{{end}}</table>
+{{template "footer"}}`,
+
+	"choice": `{{template "header" wrap .}}
+<form method="post">
+<select name="code" size="15">
+{{range .Data}}<option value="{{.Value}}"{{if .Selected}} selected{{end}}>{{.Label}}</option>
+{{end}}</select>
+<p><input type="submit" value="Confirm"></p>
+</form>
+{{template "footer"}}`,
+
+	"disk": `{{template "header" wrap .}}
+<form method="post">
+<fieldset><legend>Installation media</legend>
+{{range .Data.Targets}}<label><input type="radio" name="target" value="{{.Value}}"{{if .Selected}} checked{{end}}> {{.Label}}</label><br>
+{{else}}<p>No media available for the installation.</p>
+{{end}}
+<p><label><input type="checkbox" name="encrypt" value="1"> Enable encryption</label></p>
+<p><label>Passphrase <input type="password" name="passphrase" autocomplete="off"></label>
+<label>Confirm <input type="password" name="passphrase-confirm" autocomplete="off"></label></p>
+<button type="submit" name="action" value="target">Use media</button>
+<button type="submit" name="action" value="rescan">Rescan media</button>
+</fieldset>
+</form>
+{{if .Data.Partitions}}<form method="post">
+<fieldset><legend>Partitions</legend>
+<table>
+<tr><th>Name</th><th>File system</th><th>Size</th><th>Mount point</th><th>Label</th></tr>
+{{range .Data.Partitions}}<tr><td>{{.Name}}</td><td>{{.FsType}}</td><td>{{.Size}}</td>
+{{if .Swap}}<td></td><td>{{.Label}}</td>
+{{else}}<td><input type="text" name="mount-{{.Index}}" value="{{.MountPoint}}"></td>
+<td><input type="text" name="label-{{.Index}}" value="{{.Label}}"></td>{{end}}</tr>
+{{end}}</table>
+<p><button type="submit" name="action" value="partitions">Save partitions</button></p>
+</fieldset>
+</form>{{end}}
+{{template "footer"}}`,
+
+	"network": `{{template "header" wrap .}}
+{{if .Data.Status}}<div class="info">{{.Data.Status}}</div>{{end}}
+<form method="post">
+<fieldset><legend>Hostname</legend>
+<input type="text" name="hostname" value="{{.Data.Hostname}}">
+<button type="submit" name="action" value="hostname">Confirm</button>
+</fieldset>
+</form>
+<fieldset><legend>Interfaces</legend>
+<table>
+<tr><th>Name</th><th>DHCP</th><th>Addresses</th><th>Gateway</th></tr>
+{{range .Data.Interfaces}}<tr><td>{{.Name}}</td><td>{{.DHCP}}</td><td>{{range .Addrs}}{{.IP}} {{end}}</td><td>{{.Gateway}}</td></tr>
+{{end}}</table>
+</fieldset>
+<form method="post"><button type="submit" name="action" value="test">Test network</button></form>
+{{template "footer"}}`,
+
+	"proxy": `{{template "header" wrap .}}
+<form method="post">
+<p><label>HTTPS proxy <input type="text" name="proxy" size="50" value="{{.Data}}"></label></p>
+<p>The network is tested with the new proxy before it is accepted.</p>
+<input type="submit" value="Confirm">
+</form>
+{{template "footer"}}`,
+
+	"users": `{{template "header" wrap .}}
+<table>
+<tr><th>Login</th><th>Name</th><th>Administrator</th><th></th></tr>
+{{range .Data.Users}}<tr><td>{{.Login}}</td><td>{{.UserName}}</td><td>{{if .Admin}}yes{{end}}</td>
+<td><form method="post"><input type="hidden" name="login" value="{{.Login}}"><button type="submit" name="action" value="remove">Remove</button></form></td></tr>
+{{end}}</table>
+<form method="post">
+<fieldset><legend>Add user</legend>
+<p><label>Login <input type="text" name="login" value="{{.Data.Login}}"></label></p>
+<p><label>Name <input type="text" name="name" value="{{.Data.Name}}"></label></p>
+<p><label>Password <input type="password" name="password" autocomplete="off"></label></p>
+<p><label>Confirm <input type="password" name="password-confirm" autocomplete="off"></label></p>
+<p><label><input type="checkbox" name="admin" value="1"{{if .Data.Admin}} checked{{end}}> Administrator</label></p>
+<button type="submit" name="action" value="add">Add user</button>
+</fieldset>
+</form>
+{{template "footer"}}`,
+
+	"bundles": `{{template "header" wrap .}}
+<form method="post">
+{{range .Data}}<label><input type="checkbox" name="bundle" value="{{.Value}}"{{if .Selected}} checked{{end}}> {{.Label}}</label><br>
+{{end}}
+<p><input type="submit" value="Confirm"></p>
+</form>
+{{template "footer"}}`,
+
+	"kernel": `{{template "header" wrap .}}
+<form method="post">
+<fieldset><legend>Kernel</legend>
+{{range .Data.Kernels}}<label><input type="radio" name="kernel" value="{{.Value}}"{{if .Selected}} checked{{end}}> {{.Label}}</label><br>
+{{end}}
+</fieldset>
+<fieldset><legend>Fallback kernels</legend>
+{{range .Data.Fallbacks}}<label><input type="checkbox" name="fallback" value="{{.Value}}"{{if .Selected}} checked{{end}}> {{.Label}}</label><br>
+{{end}}
+</fieldset>
+<fieldset><legend>Kernel command line</legend>
+<p><label>Add arguments <input type="text" name="add" size="50" value="{{.Data.Add}}"></label></p>
+<p><label>Remove arguments <input type="text" name="remove" size="50" value="{{.Data.Remove}}"></label></p>
+{{if .Data.Preview}}<p>Boot entry: <code>{{.Data.Preview}}</code></p>{{end}}
+{{range .Data.Warnings}}<div class="error">{{.}}</div>
+{{end}}</fieldset>
+<input type="submit" value="Confirm">
+</form>
+{{template "footer"}}`,
+
+	"telemetry": `{{template "header" wrap .}}
+<p>Telemetry sends anonymous reports about system issues to help improve Clear Linux OS.</p>
+<p>For more details, see: <a href="{{.Data.AboutURL}}">{{.Data.AboutURL}}</a></p>
+<p>{{.Data.Policy}}</p>
+<form method="post">
+<p><label><input type="checkbox" name="enable" value="1"{{if .Data.Enabled}} checked{{end}}> Enable telemetry</label></p>
+<input type="submit" value="Confirm">
+</form>
+{{template "footer"}}`,
+
+	"confirm": `{{template "header" wrap .}}
+<table>
+{{range .Data.Items}}<tr><td>{{.Title}}</td><td class="value">{{.Value}}</td></tr>
+{{end}}</table>
+{{if .Data.ValidationError}}<div class="error">{{.Data.ValidationError}}</div>
+{{else}}{{if .Data.DataLoss}}<div class="error">The installation will destroy data on the selected media.</div>{{end}}
+<form method="post"><p><input type="submit" value="Install"></p></form>{{end}}
+{{template "footer"}}`,
+
+	"progress": `{{template "header" wrapRefresh . (eq .Data.State "running")}}
+{{if eq .Data.State "running"}}<p>{{.Data.Desc}} {{.Data.Percent}}%</p>
+<progress max="100" value="{{.Data.Percent}}"></progress>
+{{else if eq .Data.State "success"}}<div class="info">Installation completed</div>
+<form method="post" action="/finish">
+<button type="submit" name="reboot" value="1">Reboot</button>
+<button type="submit">Exit</button>
+</form>
+{{else}}<div class="error">Installation has failed: {{.Data.Error}}</div>
+<form method="post" action="/finish"><button type="submit">Exit</button></form>
+{{end}}
+<pre>{{range .Data.Logs}}{{.}}
+{{end}}</pre>
+{{template "footer"}}`,
+
+	"finish": `{{template "header" wrap .}}
+<p>{{if .Data}}The system is rebooting.{{else}}The installer has exited.{{end}} You can close this window.</p>
+{{template "footer"}}`,
+}
+
+// headerData is the data of the shared page header
+type headerData struct {
+	Page    *pageData
+	Refresh bool
+}
+
+func parseTemplates() *template.Template {
+	funcs := template.FuncMap{
+		"wrap": func(page *pageData) *headerData {
+			return &headerData{Page: page}
+		},
+		"wrapRefresh": func(page *pageData, refresh bool) *headerData {
+			return &headerData{Page: page, Refresh: refresh}
+		},
+	}
+
+	result := template.New("").Funcs(funcs)
+
+	for name, content := range pageTemplates {
+		template.Must(result.New(name).Parse(content))
+	}
+
+	return result
+}
@@ -0,0 +1,281 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package web
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/errors"
+	"github.com/clearlinux/clr-installer/log"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/progress"
+	"github.com/clearlinux/clr-installer/storage"
+	"github.com/clearlinux/clr-installer/syscheck"
+)
+
+const (
+	// sessionCookie is the name of the cookie holding the session id
+	sessionCookie = "clr-installer-session"
+
+	// tokenLength is the number of random bytes of tokens and session ids
+	tokenLength = 16
+
+	// shutdownTimeout is how long we wait the pending requests before quitting
+	shutdownTimeout = 5 * time.Second
+)
+
+// Web is the frontend implementation serving a browser based installer, it is
+// meant for headless machines only reachable through a serial console and the network
+type Web struct {
+	mutex              sync.Mutex
+	md                 *model.SystemInstall
+	rootDir            string
+	options            args.Args
+	addr               string
+	token              string
+	sessions           map[string]bool
+	templates          *template.Template
+	install            *installState
+	safeTargets        []storage.InstallTarget
+	destructiveTargets []storage.InstallTarget
+	networkStatus      string
+	reboot             bool
+	done               chan struct{}
+	quitOnce           sync.Once
+}
+
+// New creates a new instance of the Web frontend implementation
+func New() *Web {
+	return &Web{
+		sessions:  map[string]bool{},
+		templates: parseTemplates(),
+		install:   newInstallState(),
+		done:      make(chan struct{}),
+	}
+}
+
+// MustRun is part of the Frontend implementation and tells the core implementation that this
+// frontend wants or should be executed
+func (wb *Web) MustRun(args *args.Args) bool {
+	return args.WebAddr != ""
+}
+
+// Run is part of the Frontend implementation and is the actual entry point for the
+// web frontend, it serves the installer pages until the user exits or reboots
+func (wb *Web) Run(md *model.SystemInstall, rootDir string, options args.Args) (bool, error) {
+	wb.md = md
+	wb.rootDir = rootDir
+	wb.options = options
+
+	// When using the Interactive Installer we always want to copy network
+	// configurations to the target system
+	wb.md.CopyNetwork = options.CopyNetwork
+
+	if err := syscheck.RunSystemCheck(true); err != nil {
+		fmt.Printf("System failed to pass pre-install checks: %s\n", err)
+		return false, err
+	}
+
+	listener, err := net.Listen("tcp", options.WebAddr)
+	if err != nil {
+		return false, errors.Wrap(err)
+	}
+
+	progress.Set(wb.install)
+	log.SetHookFunc(wb.install.logHook)
+	defer log.SetHookFunc(nil)
+
+	srv := &http.Server{Handler: wb.handler()}
+	srvErr := make(chan error, 1)
+
+	go func() {
+		srvErr <- srv.Serve(listener)
+	}()
+
+	log.Info("Web installer listening on: %s", listener.Addr())
+
+	wb.addr = listener.Addr().String()
+
+	if err = wb.newToken(); err != nil {
+		_ = srv.Close()
+		return false, err
+	}
+
+	select {
+	case <-wb.done:
+	case err = <-srvErr:
+		return false, errors.Wrap(err)
+	}
+
+	// let the in flight responses, i.e the finish one, to be delivered
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err = srv.Shutdown(ctx); err != nil {
+		_ = srv.Close()
+	}
+
+	wb.mutex.Lock()
+	defer wb.mutex.Unlock()
+
+	_, instError := wb.install.result()
+	return wb.reboot, instError
+}
+
+func randomString() (string, error) {
+	data := make([]byte, tokenLength)
+
+	if _, err := rand.Read(data); err != nil {
+		return "", errors.Wrap(err)
+	}
+
+	return hex.EncodeToString(data), nil
+}
+
+// newToken generates a new one-time login token and prints it to the console,
+// the token is intentionally never written to the log file. The login URL is the
+// one of the listener address, never of a client provided Host header.
+func (wb *Web) newToken() error {
+	token, err := randomString()
+	if err != nil {
+		return err
+	}
+
+	wb.token = token
+
+	fmt.Printf("Web installer login URL: %s\n", loginURL(wb.addr, token))
+	return nil
+}
+
+// loginURL builds the url to be opened in the browser, when listening on all
+// the addresses the host part is left for the user to fill
+func loginURL(addr string, token string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Sprintf("http://%s/login?token=%s", addr, token)
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "<this-machine-address>"
+	}
+
+	return fmt.Sprintf("http://%s/login?token=%s", net.JoinHostPort(host, port), token)
+}
+
+func (wb *Web) handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/login", wb.handleLogin)
+
+	mux.Handle("/", wb.authenticated(wb.handleMenu))
+	mux.Handle("/language", wb.configPage(wb.handleLanguage))
+	mux.Handle("/keyboard", wb.configPage(wb.handleKeyboard))
+	mux.Handle("/timezone", wb.configPage(wb.handleTimezone))
+	mux.Handle("/disk", wb.configPage(wb.handleDisk))
+	mux.Handle("/network", wb.configPage(wb.handleNetwork))
+	mux.Handle("/proxy", wb.configPage(wb.handleProxy))
+	mux.Handle("/users", wb.configPage(wb.handleUsers))
+	mux.Handle("/bundles", wb.configPage(wb.handleBundles))
+	mux.Handle("/kernel", wb.configPage(wb.handleKernel))
+	mux.Handle("/telemetry", wb.configPage(wb.handleTelemetry))
+	mux.Handle("/confirm", wb.configPage(wb.handleConfirm))
+	mux.Handle("/progress", wb.authenticated(wb.handleProgress))
+	mux.Handle("/finish", wb.authenticated(wb.handleFinish))
+
+	return mux
+}
+
+// handleLogin exchanges the one-time token for a session cookie, once used a
+// new token is printed to the console so other browsers can still log in
+func (wb *Web) handleLogin(w http.ResponseWriter, r *http.Request) {
+	wb.mutex.Lock()
+	defer wb.mutex.Unlock()
+
+	token := r.URL.Query().Get("token")
+
+	if wb.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(wb.token)) != 1 {
+		log.Warning("Web installer: rejected login attempt from %s", r.RemoteAddr)
+		wb.render(w, http.StatusForbidden, "login", &pageData{
+			Title: "Login",
+			Error: "Invalid or already used token, check the console for a new one",
+		})
+		return
+	}
+
+	session, err := randomString()
+	if err != nil {
+		wb.render(w, http.StatusInternalServerError, "login", &pageData{Title: "Login", Error: err.Error()})
+		return
+	}
+
+	wb.sessions[session] = true
+	log.Info("Web installer: new session from %s", r.RemoteAddr)
+
+	if err = wb.newToken(); err != nil {
+		log.ErrorError(err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    session,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// authenticated wraps h rejecting the requests without a valid session
+func (wb *Web) authenticated(h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie(sessionCookie)
+
+		wb.mutex.Lock()
+		valid := err == nil && wb.sessions[cookie.Value]
+		wb.mutex.Unlock()
+
+		if !valid {
+			wb.render(w, http.StatusUnauthorized, "login", &pageData{
+				Title: "Login",
+				Error: "Use the login URL printed on the console",
+			})
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+// configPage wraps a configuration page handler, once the install has started
+// the configuration can no longer be changed
+func (wb *Web) configPage(h http.HandlerFunc) http.Handler {
+	return wb.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		if state, _ := wb.install.result(); state != stateIdle {
+			http.Redirect(w, r, "/progress", http.StatusSeeOther)
+			return
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		wb.mutex.Lock()
+		defer wb.mutex.Unlock()
+
+		h(w, r)
+	})
+}
@@ -0,0 +1,248 @@
+// Copyright © 2019 Intel Corporation
+//
+// SPDX-License-Identifier: GPL-3.0-only
+
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/clearlinux/clr-installer/args"
+	"github.com/clearlinux/clr-installer/model"
+	"github.com/clearlinux/clr-installer/utils"
+)
+
+func init() {
+	utils.SetLocale("en_US.UTF-8")
+}
+
+func newTestWeb() *Web {
+	wb := New()
+	wb.md = &model.SystemInstall{}
+	wb.token = "test-token"
+
+	return wb
+}
+
+func login(t *testing.T, wb *Web) *http.Cookie {
+	rec := httptest.NewRecorder()
+	wb.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?token=test-token", nil))
+
+	if rec.Code != http.StatusSeeOther {
+		t.Fatalf("Login should redirect to the menu, got: %d", rec.Code)
+	}
+
+	for _, curr := range rec.Result().Cookies() {
+		if curr.Name == sessionCookie {
+			return curr
+		}
+	}
+
+	t.Fatal("Login should set the session cookie")
+	return nil
+}
+
+func post(wb *Web, cookie *http.Cookie, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+
+	rec := httptest.NewRecorder()
+	wb.handler().ServeHTTP(rec, req)
+
+	return rec
+}
+
+func TestMustRun(t *testing.T) {
+	wb := New()
+
+	if wb.MustRun(&args.Args{}) {
+		t.Fatal("MustRun() should be false without a web address")
+	}
+
+	if !wb.MustRun(&args.Args{WebAddr: ":8080"}) {
+		t.Fatal("MustRun() should be true with a web address")
+	}
+}
+
+func TestLoginURL(t *testing.T) {
+	if url := loginURL("192.168.0.1:8080", "abc"); url != "http://192.168.0.1:8080/login?token=abc" {
+		t.Fatalf("Unexpected login url: %s", url)
+	}
+
+	if url := loginURL("[::]:8080", "abc"); !strings.Contains(url, "<this-machine-address>:8080") {
+		t.Fatalf("Unexpected login url for unspecified address: %s", url)
+	}
+}
+
+func TestOneTimeToken(t *testing.T) {
+	wb := newTestWeb()
+
+	rec := httptest.NewRecorder()
+	wb.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("Pages should require a session, got: %d", rec.Code)
+	}
+
+	cookie := login(t, wb)
+
+	if wb.token == "test-token" || wb.token == "" {
+		t.Fatal("A used token should be replaced by a new one")
+	}
+
+	rec = httptest.NewRecorder()
+	wb.handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login?token=test-token", nil))
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("A token should only be used once, got: %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+
+	rec = httptest.NewRecorder()
+	wb.handler().ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Disk Configuration") {
+		t.Fatalf("The menu should be served to a valid session, got: %d", rec.Code)
+	}
+}
+
+func TestNetworkHostname(t *testing.T) {
+	wb := newTestWeb()
+	cookie := login(t, wb)
+
+	rec := post(wb, cookie, "/network", url.Values{"action": {"hostname"}, "hostname": {"-invalid"}})
+	if rec.Code != http.StatusBadRequest || wb.md.Hostname != "" {
+		t.Fatalf("Invalid hostname should be rejected, got: %d", rec.Code)
+	}
+
+	rec = post(wb, cookie, "/network", url.Values{"action": {"hostname"}, "hostname": {"clr-web"}})
+	if rec.Code != http.StatusSeeOther || wb.md.Hostname != "clr-web" {
+		t.Fatalf("Valid hostname should be accepted, got: %d", rec.Code)
+	}
+}
+
+func TestUsers(t *testing.T) {
+	wb := newTestWeb()
+	cookie := login(t, wb)
+
+	form := url.Values{
+		"action":           {"add"},
+		"login":            {"clrlinux"},
+		"name":             {"Clear Linux"},
+		"password":         {"a-good-password"},
+		"password-confirm": {"a-different-password"},
+	}
+
+	rec := post(wb, cookie, "/users", form)
+	if rec.Code != http.StatusBadRequest || len(wb.md.Users) != 0 {
+		t.Fatalf("Mismatching passwords should be rejected, got: %d", rec.Code)
+	}
+
+	if strings.Contains(rec.Body.String(), "a-good-password") {
+		t.Fatal("The password must not be sent back to the browser")
+	}
+
+	form.Set("login", "invalid login")
+	form.Set("password-confirm", "a-good-password")
+
+	rec = post(wb, cookie, "/users", form)
+	if rec.Code != http.StatusBadRequest || len(wb.md.Users) != 0 {
+		t.Fatalf("Invalid login should be rejected, got: %d", rec.Code)
+	}
+
+	form.Set("login", "clrlinux")
+
+	rec = post(wb, cookie, "/users", form)
+	if rec.Code != http.StatusSeeOther || len(wb.md.Users) != 1 {
+		t.Fatalf("Valid user should be added, got: %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = post(wb, cookie, "/users", url.Values{"action": {"remove"}, "login": {"clrlinux"}})
+	if rec.Code != http.StatusSeeOther || len(wb.md.Users) != 0 {
+		t.Fatalf("User should be removed, got: %d", rec.Code)
+	}
+}
+
+func TestConfirmInvalidModel(t *testing.T) {
+	wb := newTestWeb()
+	cookie := login(t, wb)
+
+	rec := post(wb, cookie, "/confirm", url.Values{})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("Install should not start with an invalid model, got: %d", rec.Code)
+	}
+
+	if state, _ := wb.install.result(); state != stateIdle {
+		t.Fatalf("Install should not be started, state: %s", state)
+	}
+}
+
+func TestConfigLockedAfterInstall(t *testing.T) {
+	wb := newTestWeb()
+	cookie := login(t, wb)
+
+	wb.install.start()
+	wb.install.finish(nil)
+
+	rec := post(wb, cookie, "/network", url.Values{"action": {"hostname"}, "hostname": {"clr-web"}})
+	if rec.Code != http.StatusSeeOther || wb.md.Hostname != "" {
+		t.Fatalf("Configuration should be locked after install, got: %d", rec.Code)
+	}
+
+	rec = post(wb, cookie, "/finish", url.Values{"reboot": {"1"}})
+	if rec.Code != http.StatusOK || !wb.reboot {
+		t.Fatalf("Finish should request a reboot after a successful install, got: %d", rec.Code)
+	}
+
+	select {
+	case <-wb.done:
+	default:
+		t.Fatal("Finish should release the frontend")
+	}
+}
+
+func TestRenderTemplates(t *testing.T) {
+	wb := newTestWeb()
+
+	pages := map[string]interface{}{
+		"choice":    []*option{{Value: "en_US.UTF-8", Label: "en_US.UTF-8", Selected: true}},
+		"disk":      &diskView{Targets: []*option{{Value: "safe-0"}}, Partitions: []*partitionView{{Swap: true}, {}}},
+		"network":   &networkView{Hostname: "clr"},
+		"proxy":     "http://proxy:8080",
+		"users":     &usersView{},
+		"bundles":   []*option{{Value: "vim"}},
+		"kernel":    &kernelView{Kernels: []*option{{Value: "kernel-native"}}, Fallbacks: []*option{{Value: "kernel-lts"}}, Preview: "root=<root partition>", Warnings: []string{"Duplicated argument: quiet"}},
+		"telemetry": &telemetryView{Enabled: true},
+		"confirm":   &confirmView{DataLoss: true},
+		"finish":    true,
+	}
+
+	for name, data := range pages {
+		page := wb.newPageData("/")
+		page.Data = data
+
+		rec := httptest.NewRecorder()
+		wb.render(rec, http.StatusOK, name, page)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to render %s template", name)
+		}
+	}
+
+	for _, state := range []string{stateRunning, stateSuccess, stateFailure} {
+		rec := httptest.NewRecorder()
+		wb.render(rec, http.StatusOK, "progress", &pageData{Data: &progressView{State: state}})
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Failed to render progress template for state: %s", state)
+		}
+
+		if refresh := strings.Contains(rec.Body.String(), "http-equiv=\"refresh\""); refresh != (state == stateRunning) {
+			t.Fatalf("Progress page should only refresh while running, state: %s", state)
+		}
+	}
+}